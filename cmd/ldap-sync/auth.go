@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	ldapsync "github.com/adedayo/ldap-sync/pkg"
+)
+
+// auth authenticates a user as Client.Authenticate does, to test a configuration's binds and RequiredGroups. The
+// password is read from the first line of standard input, so it stays out of the shell history
+func auth(args []string) (code int, err error) {
+	flags := flag.NewFlagSet("auth", flag.ContinueOnError)
+	configPath := flags.String("config", "", "sync configuration (JSON or YAML)")
+	user := flags.String("user", "", "the user's ID (the value of the userIDAttribute) or DN")
+	secondFactor := flags.String("code", "", "second factor code, if the configuration requires one")
+	if err = flags.Parse(args); err != nil {
+		return flagError(err)
+	}
+	if *configPath == "" || *user == "" || flags.NArg() != 0 {
+		fmt.Fprint(os.Stderr, "usage: ldap-sync auth --config config.yaml --user alice [--code 123456] < password\n")
+		return 2, nil
+	}
+
+	conf, err := loadConfig(*configPath)
+	if err != nil {
+		return
+	}
+	if info, statErr := os.Stdin.Stat(); statErr == nil && info.Mode()&os.ModeCharDevice != 0 {
+		fmt.Fprint(os.Stderr, "password: ") // prompted for at a terminal, where the password is echoed
+	}
+	password, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && password == "" {
+		return 2, fmt.Errorf("reading the password: %w", err)
+	}
+	password = strings.TrimRight(password, "\r\n")
+
+	client := ldapsync.NewClient(conf)
+	result, err := client.AuthenticateCode(context.Background(), *user, password, *secondFactor)
+	if err != nil {
+		return
+	}
+	if !result.Success {
+		fmt.Printf("rejected: %s\n", result.ErrorMessage)
+		return 1, nil
+	}
+	fmt.Print("authenticated")
+	if result.Offline {
+		fmt.Print(" (offline)")
+	}
+	fmt.Println()
+	if result.PasswordExpiry != nil {
+		fmt.Printf("password expires: %s\n", result.PasswordExpiry.Format("2006-01-02 15:04:05 MST"))
+	}
+	if ug := result.Identity; ug != nil && len(ug.Users) > 0 {
+		u := ug.Users[0]
+		fmt.Printf("user: %s (%s)\n", u.ID, u.DN)
+		for _, g := range ug.Groups {
+			fmt.Printf("group: %s (%s)\n", g.ID, g.DN)
+		}
+		for _, role := range ug.Roles[u.ID] {
+			fmt.Printf("role: %s\n", role)
+		}
+	}
+	return
+}
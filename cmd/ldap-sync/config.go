@@ -0,0 +1,267 @@
+package main
+
+import (
+	"context"
+	"embed"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	ldapsync "github.com/adedayo/ldap-sync/pkg"
+	"gopkg.in/yaml.v3"
+)
+
+//go:embed profiles/*.yaml
+var profiles embed.FS
+
+// config scaffolds, validates and converts configuration files
+func config(args []string) (code int, err error) {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, "usage: ldap-sync config init|validate|import|export [arguments]\n")
+		return 2, nil
+	}
+	switch args[0] {
+	case "init":
+		return configInit(args[1:])
+	case "validate":
+		return configValidate(args[1:])
+	case "import":
+		return configImport(args[1:])
+	case "export":
+		return configExport(args[1:])
+	default:
+		return 2, fmt.Errorf("unknown subcommand %q, expected init, validate, import or export", args[0])
+	}
+}
+
+// configInit writes the commented starter configuration of the profile
+func configInit(args []string) (code int, err error) {
+	flags := flag.NewFlagSet("config init", flag.ContinueOnError)
+	profile := flags.String("profile", "openldap", "directory profile: ad, openldap or freeipa")
+	out := flags.String("out", "", "file to write, standard output if empty")
+	if err = flags.Parse(args); err != nil {
+		return flagError(err)
+	}
+	data, err := profiles.ReadFile("profiles/" + *profile + ".yaml")
+	if err != nil {
+		return 2, fmt.Errorf("unknown profile %q, expected ad, openldap or freeipa", *profile)
+	}
+	if *out == "" {
+		_, err = os.Stdout.Write(data)
+		return
+	}
+	if _, statErr := os.Stat(*out); statErr == nil {
+		return 1, fmt.Errorf("%s already exists", *out)
+	}
+	return 0, os.WriteFile(*out, data, 0600) // the configuration holds the sync password
+}
+
+// configValidate validates the configuration file and, unless offline, checks the server is reachable with it
+func configValidate(args []string) (code int, err error) {
+	flags := flag.NewFlagSet("config validate", flag.ContinueOnError)
+	offline := flags.Bool("offline", false, "skip the connectivity preflight")
+	timeout := flags.Duration("timeout", 30*time.Second, "timeout of the connectivity preflight")
+	if err = flags.Parse(args); err != nil {
+		return flagError(err)
+	}
+	if flags.NArg() != 1 {
+		fmt.Fprint(os.Stderr, "usage: ldap-sync config validate [--offline] [--timeout 30s] config.yaml\n")
+		return 2, nil
+	}
+
+	conf, err := loadConfig(flags.Arg(0))
+	if err != nil {
+		return
+	}
+	var configErr *ldapsync.ConfigError
+	if err = conf.Validate(); errors.As(err, &configErr) {
+		for _, problem := range configErr.Problems {
+			fmt.Printf("invalid: %s\n", problem)
+		}
+		return 1, nil
+	}
+	fmt.Println("configuration is valid")
+	if *offline {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+	vendor, err := ldapsync.Preflight(ctx, conf)
+	if err != nil {
+		fmt.Printf("preflight failed: %v\n", err)
+		return 1, nil
+	}
+	if vendor == ldapsync.UnknownVendor {
+		vendor = "unknown"
+	}
+	fmt.Printf("connected to %s (vendor: %s), bound and read every base DN\n", conf.GetDialAddr(), vendor)
+	return
+}
+
+// configImport converts the configuration of another LDAP client, e.g. an sssd.conf, Grafana ldap.toml or Keycloak
+// user federation component
+func configImport(args []string) (code int, err error) {
+	flags := flag.NewFlagSet("config import", flag.ContinueOnError)
+	from := flags.String("from", "sssd", "format of the configuration: sssd, grafana (ldap.toml) or keycloak (component or realm JSON)")
+	domain := flags.String("domain", "", "sssd domain to import, the first one configured if empty")
+	out := flags.String("out", "", "file to write, as YAML if its extension is .yaml or .yml, JSON to standard output if empty")
+	if err = flags.Parse(args); err != nil {
+		return flagError(err)
+	}
+	if flags.NArg() != 1 {
+		fmt.Fprint(os.Stderr, "usage: ldap-sync config import [--from sssd|grafana|keycloak] [--domain name] [--out config.yaml] file\n")
+		return 2, nil
+	}
+
+	f, err := os.Open(flags.Arg(0))
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	var conf ldapsync.LDAPSyncConfig
+	switch *from {
+	case "sssd":
+		conf, err = ldapsync.ImportSSSDConfig(f, *domain)
+	case "grafana":
+		conf, err = ldapsync.ImportGrafanaConfig(f)
+	case "keycloak":
+		conf, err = ldapsync.ImportKeycloakConfig(f)
+	default:
+		return 2, fmt.Errorf("unknown format %q, expected sssd, grafana or keycloak", *from)
+	}
+	if err != nil {
+		return
+	}
+	return 0, writeConfig(*out, conf)
+}
+
+// configExport converts the configuration into that of another LDAP client, e.g. a Keycloak user federation component
+func configExport(args []string) (code int, err error) {
+	flags := flag.NewFlagSet("config export", flag.ContinueOnError)
+	to := flags.String("to", "keycloak", "format to convert to: keycloak (component JSON)")
+	out := flags.String("out", "", "file to write, standard output if empty")
+	if err = flags.Parse(args); err != nil {
+		return flagError(err)
+	}
+	if flags.NArg() != 1 {
+		fmt.Fprint(os.Stderr, "usage: ldap-sync config export [--to keycloak] [--out component.json] config.yaml\n")
+		return 2, nil
+	}
+
+	conf, err := loadConfig(flags.Arg(0))
+	if err != nil {
+		return
+	}
+	var exported interface{}
+	switch *to {
+	case "keycloak":
+		exported, err = ldapsync.ExportKeycloakConfig(conf)
+	default:
+		return 2, fmt.Errorf("unknown format %q, expected keycloak", *to)
+	}
+	if err != nil {
+		return
+	}
+	return 0, writeConfig(*out, exported)
+}
+
+// writeConfig writes the configuration to the file, as YAML if its extension is .yaml or .yml and JSON otherwise,
+// or as JSON to standard output if the path is empty
+func writeConfig(path string, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	if ext := strings.ToLower(filepath.Ext(path)); ext == ".yaml" || ext == ".yml" {
+		var doc interface{}
+		if err = json.Unmarshal(data, &doc); err != nil {
+			return err
+		}
+		if data, err = yaml.Marshal(pruned(doc)); err != nil {
+			return err
+		}
+	} else {
+		data = append(data, '\n')
+	}
+	if path == "" {
+		_, err = os.Stdout.Write(data)
+		return err
+	}
+	return os.WriteFile(path, data, 0600) // the configuration may hold the sync password
+}
+
+// pruned returns the decoded JSON without its empty values (null, false, 0, "" and empty lists and objects), which
+// are the defaults of the configuration
+func pruned(v interface{}) interface{} {
+	switch value := v.(type) {
+	case map[string]interface{}:
+		for k, item := range value {
+			if item = pruned(item); item == nil {
+				delete(value, k)
+			} else {
+				value[k] = item
+			}
+		}
+		if len(value) == 0 {
+			return nil
+		}
+	case []interface{}:
+		kept := value[:0]
+		for _, item := range value {
+			if item = pruned(item); item != nil {
+				kept = append(kept, item)
+			}
+		}
+		if len(kept) == 0 {
+			return nil
+		}
+		return kept
+	case bool, float64, string:
+		if value == false || value == 0.0 || value == "" {
+			return nil
+		}
+	}
+	return v
+}
+
+// loadConfig reads the sync configuration from the JSON or, by its extension, YAML file. YAML keys are the JSON
+// field names of the configuration
+func loadConfig(path string) (config ldapsync.LDAPSyncConfig, err error) {
+	err = loadFile(path, &config)
+	return
+}
+
+// loadFile decodes the JSON or YAML file into v, by its JSON field names
+func loadFile(path string, v interface{}) (err error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return
+	}
+	if ext := strings.ToLower(filepath.Ext(path)); ext == ".yaml" || ext == ".yml" {
+		var doc interface{}
+		if err = yaml.Unmarshal(data, &doc); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		if data, err = json.Marshal(doc); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	if err = json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return
+}
+
+// flagError returns the exit status for an error parsing flags, which the flag set has already reported
+func flagError(err error) (int, error) {
+	if errors.Is(err, flag.ErrHelp) {
+		return 0, nil
+	}
+	return 2, nil
+}
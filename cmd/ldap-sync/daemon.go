@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	ldapsync "github.com/adedayo/ldap-sync/pkg"
+)
+
+// daemon syncs on the schedule of the configuration, printing the changes of each sync and optionally writing
+// snapshots of its results. The configuration is reloaded on SIGHUP and when the file changes, and SIGUSR1 (SIGUSR2)
+// triggers an immediate (full) resync
+func daemon(args []string) (code int, err error) {
+	flags := flag.NewFlagSet("daemon", flag.ContinueOnError)
+	configPath := flags.String("config", "", "daemon configuration (JSON or YAML): the sync configuration with its interval, e.g. \"15m\"")
+	snapshot := flags.String("snapshot", "", "file to write the users and groups of each sync to, for ldap-sync diff")
+	listen := flags.String("listen", "", "address to serve the /healthz and /readyz probes, the /resync endpoint and the Prometheus /metrics on, e.g. localhost:8080")
+	lockFile := flags.String("lock", "", "lock file guarding against concurrent syncs by other instances, e.g. /var/run/ldap-sync.lock")
+	leaseRedis := flags.String("lease-redis", "", "Redis address (host:port) of a lease electing one syncing replica, with the password in $REDIS_PASSWORD")
+	leaseKey := flags.String("lease-key", "ldap-sync/leader", "Redis key of the lease")
+	leaseKubernetes := flags.String("lease-kubernetes", "", "name of a Kubernetes Lease, in the namespace of the pod, electing one syncing replica")
+	watch := flags.Duration("watch", 10*time.Second, "how often to check the configuration file for changes, 0 to only reload on SIGHUP")
+	if err = flags.Parse(args); err != nil {
+		return flagError(err)
+	}
+	if *configPath == "" || flags.NArg() != 0 {
+		fmt.Fprint(os.Stderr, "usage: ldap-sync daemon --config config.yaml [--snapshot snapshot.json] [--listen :8080] [--lock file] [--lease-redis host:port | --lease-kubernetes name] [--watch 10s]\n")
+		return 2, nil
+	}
+
+	var conf ldapsync.DaemonConfig
+	if err = loadFile(*configPath, &conf); err != nil {
+		return
+	}
+	var metrics *ldapsync.PrometheusMetrics
+	if *listen != "" {
+		metrics = ldapsync.NewPrometheusMetrics()
+		conf.Metrics = metrics
+	}
+	if err = conf.Validate(); err != nil {
+		return
+	}
+	d := ldapsync.NewDaemon(conf, ldapsync.SinkFunc(func(ctx context.Context, changes ldapsync.ChangeSet, current ldapsync.UsersAndGroups) error {
+		printChanges(os.Stdout, changes)
+		if *snapshot == "" {
+			return nil
+		}
+		return writeSnapshot(*snapshot, current)
+	}))
+	d.OnError = func(err error) { log.Printf("sync: %v", err) }
+	if *lockFile != "" {
+		d.Lock = ldapsync.NewFileLock(*lockFile)
+	}
+	if *leaseRedis != "" {
+		store := ldapsync.NewRedisStore(ldapsync.RedisOptions{Addr: *leaseRedis, Password: os.Getenv("REDIS_PASSWORD")})
+		defer store.Close()
+		d.Elector = &ldapsync.LeaderElector{Lease: store.Lease(*leaseKey)}
+	}
+	if *leaseKubernetes != "" {
+		d.Elector = &ldapsync.LeaderElector{Lease: ldapsync.NewKubernetesLease(*leaseKubernetes)}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go reloadConfig(ctx, d, *configPath, *watch, metrics)
+	go resyncOnSignal(ctx, d)
+	if *listen != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/healthz", d.ProbeHandler())
+		mux.Handle("/readyz", d.ProbeHandler())
+		mux.Handle("/resync", d.ResyncHandler())
+		mux.Handle("/metrics", metrics)
+		server := &http.Server{Addr: *listen, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+		go func() {
+			if err := server.ListenAndServe(); err != http.ErrServerClosed {
+				log.Printf("probes: %v", err)
+			}
+		}()
+		defer server.Close()
+	}
+
+	if err = d.Run(ctx); err == context.Canceled {
+		err = nil
+	}
+	return
+}
+
+// reloadConfig reloads the daemon's configuration on SIGHUP and, if watch is positive, when the file's modification
+// time changes, recording in the metrics if any. Invalid configurations are reported and ignored
+func reloadConfig(ctx context.Context, d *ldapsync.Daemon, path string, watch time.Duration, metrics *ldapsync.PrometheusMetrics) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	var tick <-chan time.Time
+	if watch > 0 {
+		ticker := time.NewTicker(watch)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	modified := modTime(path)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+		case <-tick:
+			m := modTime(path)
+			if m.Equal(modified) {
+				continue
+			}
+			modified = m
+		}
+		var conf ldapsync.DaemonConfig
+		if err := loadFile(path, &conf); err != nil {
+			log.Printf("configuration not reloaded: %v", err)
+			continue
+		}
+		if metrics != nil {
+			conf.Metrics = metrics
+		}
+		if err := d.Reload(conf); err != nil {
+			log.Printf("configuration not reloaded: %v", err)
+			continue
+		}
+		log.Printf("reloaded configuration from %s", path)
+	}
+}
+
+func modTime(path string) time.Time {
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
+
+// writeSnapshot writes the users and groups as JSON, replacing the file atomically
+func writeSnapshot(path string, ug ldapsync.UsersAndGroups) error {
+	data, err := json.MarshalIndent(ug, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err = os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
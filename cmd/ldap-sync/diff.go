@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	ldapsync "github.com/adedayo/ldap-sync/pkg"
+)
+
+// diff prints the changes between two snapshots, or a snapshot and a live sync, exiting with 1 if there are any
+func diff(args []string) (code int, err error) {
+	flags := flag.NewFlagSet("diff", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprint(flags.Output(), "usage: ldap-sync diff [--json] old.json new.json\n"+
+			"       ldap-sync diff [--json] --config config.yaml --against-live old.json\n\n"+
+			"Snapshots are the users and groups of a sync, as JSON. The exit status is 0 if nothing changed, 1 otherwise\n\n")
+		flags.PrintDefaults()
+	}
+	asJSON := flags.Bool("json", false, "print the change set as JSON")
+	configPath := flags.String("config", "", "sync configuration (JSON or YAML), for --against-live")
+	live := flags.Bool("against-live", false, "compare the snapshot against a live sync with the --config")
+	if err = flags.Parse(args); err != nil {
+		return flagError(err)
+	}
+
+	var old, new ldapsync.UsersAndGroups
+	switch {
+	case *live && flags.NArg() == 1:
+		if *configPath == "" {
+			return 0, errors.New("--against-live requires a --config")
+		}
+		if old, err = readSnapshot(flags.Arg(0)); err != nil {
+			return
+		}
+		var config ldapsync.LDAPSyncConfig
+		if config, err = loadConfig(*configPath); err != nil {
+			return
+		}
+		var records ldapsync.LDAPRecords
+		if records, err = ldapsync.DoContext(context.Background(), config); err != nil {
+			return
+		}
+		new = records.GetUsersAndGroups()
+	case !*live && flags.NArg() == 2:
+		if old, err = readSnapshot(flags.Arg(0)); err != nil {
+			return
+		}
+		if new, err = readSnapshot(flags.Arg(1)); err != nil {
+			return
+		}
+	default:
+		flags.Usage()
+		return 2, nil
+	}
+
+	changes := ldapsync.Diff(old, new)
+	if *asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		err = encoder.Encode(changes)
+	} else {
+		printChanges(os.Stdout, changes)
+	}
+	if err == nil && !changes.IsEmpty() {
+		code = 1
+	}
+	return
+}
+
+// readSnapshot reads the users and groups of a sync from the JSON file
+func readSnapshot(path string) (ug ldapsync.UsersAndGroups, err error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return
+	}
+	if err = json.Unmarshal(data, &ug); err != nil {
+		err = fmt.Errorf("%s: %w", path, err)
+	}
+	return
+}
+
+func printChanges(w io.Writer, changes ldapsync.ChangeSet) {
+	for _, u := range changes.AddedUsers {
+		fmt.Fprintf(w, "+ user       %s\n", u.DN)
+	}
+	for _, u := range changes.RemovedUsers {
+		fmt.Fprintf(w, "- user       %s\n", u.DN)
+	}
+	for _, g := range changes.AddedGroups {
+		fmt.Fprintf(w, "+ group      %s\n", g.DN)
+	}
+	for _, g := range changes.RemovedGroups {
+		fmt.Fprintf(w, "- group      %s\n", g.DN)
+	}
+	for _, m := range changes.AddedMemberships {
+		fmt.Fprintf(w, "+ membership %s in %s\n", m.UserDN, m.GroupDN)
+	}
+	for _, m := range changes.RemovedMemberships {
+		fmt.Fprintf(w, "- membership %s in %s\n", m.UserDN, m.GroupDN)
+	}
+	for _, e := range changes.AddedEntities {
+		fmt.Fprintf(w, "+ %-10s %s\n", e.Class, e.DN)
+	}
+	for _, e := range changes.RemovedEntities {
+		fmt.Fprintf(w, "- %-10s %s\n", e.Class, e.DN)
+	}
+	if changes.IsEmpty() {
+		fmt.Fprintln(w, "no changes")
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	ldapsync "github.com/adedayo/ldap-sync/pkg"
+)
+
+// ldifdump writes the entries of the configured search as LDIF
+func ldifdump(args []string) (code int, err error) {
+	flags := flag.NewFlagSet("ldifdump", flag.ContinueOnError)
+	configPath := flags.String("config", "", "sync configuration (JSON or YAML)")
+	out := flags.String("out", "", "file to write, standard output if empty")
+	if err = flags.Parse(args); err != nil {
+		return flagError(err)
+	}
+	if *configPath == "" || flags.NArg() != 0 {
+		fmt.Fprint(os.Stderr, "usage: ldap-sync ldifdump --config config.yaml [--out dump.ldif]\n")
+		return 2, nil
+	}
+
+	conf, err := loadConfig(*configPath)
+	if err != nil {
+		return
+	}
+	records, err := ldapsync.DoContext(context.Background(), conf)
+	if err != nil {
+		return
+	}
+
+	var w io.Writer = os.Stdout
+	if *out != "" {
+		f, createErr := os.OpenFile(*out, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+		if createErr != nil {
+			return 2, createErr
+		}
+		defer func() {
+			if closeErr := f.Close(); err == nil {
+				err = closeErr
+			}
+		}()
+		w = f
+	}
+	if err = ldapsync.WriteLDIF(w, records.Entries); err != nil {
+		return
+	}
+	if *out != "" {
+		fmt.Fprintf(os.Stderr, "wrote %d entries to %s\n", len(records.Entries), *out)
+	}
+	return
+}
@@ -0,0 +1,55 @@
+// Command ldap-sync syncs and inspects LDAP directories with the ldapsync package
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+const usage = `usage: ldap-sync <command> [arguments]
+
+commands:
+  auth      authenticate a user, reading the password from standard input
+  config    write a starter configuration (init), check one (validate) or convert one (import, export)
+  daemon    sync on a schedule, printing the changes of each sync
+  diff      print the users, groups and memberships added and removed between two snapshots
+  ldifdump  write the entries of the configured search as LDIF
+  stale     report the accounts that have not logged on for a number of days, as CSV or JSON
+  sync      sync and print the users and groups as a table, JSON or LDIF
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	var err error
+	code := 0
+	switch command, args := os.Args[1], os.Args[2:]; command {
+	case "auth":
+		code, err = auth(args)
+	case "config":
+		code, err = config(args)
+	case "daemon":
+		code, err = daemon(args)
+	case "diff":
+		code, err = diff(args)
+	case "ldifdump":
+		code, err = ldifdump(args)
+	case "stale":
+		code, err = stale(args)
+	case "sync":
+		code, err = sync(args)
+	case "help", "-h", "--help":
+		fmt.Print(usage)
+		return
+	default:
+		fmt.Fprintf(os.Stderr, "ldap-sync: unknown command %q\n\n%s", command, usage)
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ldap-sync %s: %v\n", os.Args[1], err)
+		os.Exit(2)
+	}
+	os.Exit(code)
+}
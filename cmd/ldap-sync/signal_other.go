@@ -0,0 +1,13 @@
+//go:build !unix
+
+package main
+
+import (
+	"context"
+
+	ldapsync "github.com/adedayo/ldap-sync/pkg"
+)
+
+// resyncOnSignal does nothing, as there are no SIGUSR1 and SIGUSR2 on the platform: resyncs are requested through
+// the /resync endpoint instead
+func resyncOnSignal(ctx context.Context, d *ldapsync.Daemon) {}
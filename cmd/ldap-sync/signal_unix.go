@@ -0,0 +1,27 @@
+//go:build unix
+
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+
+	ldapsync "github.com/adedayo/ldap-sync/pkg"
+)
+
+// resyncOnSignal requests a resync of the daemon on SIGUSR1, and a full one on SIGUSR2
+func resyncOnSignal(ctx context.Context, d *ldapsync.Daemon) {
+	usr := make(chan os.Signal, 1)
+	signal.Notify(usr, syscall.SIGUSR1, syscall.SIGUSR2)
+	defer signal.Stop(usr)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case sig := <-usr:
+			d.Resync(sig == syscall.SIGUSR2)
+		}
+	}
+}
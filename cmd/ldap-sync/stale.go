@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	ldapsync "github.com/adedayo/ldap-sync/pkg"
+)
+
+// stale reports the accounts that have not logged on for the number of days, grouped by their container
+func stale(args []string) (code int, err error) {
+	flags := flag.NewFlagSet("stale", flag.ContinueOnError)
+	configPath := flags.String("config", "", "sync configuration (JSON or YAML)")
+	days := flags.Int("days", 90, "days without a logon after which accounts are stale")
+	format := flags.String("format", "csv", "output format: csv or json")
+	out := flags.String("out", "", "file to write, standard output if empty")
+	if err = flags.Parse(args); err != nil {
+		return flagError(err)
+	}
+	if *configPath == "" || flags.NArg() != 0 || *days < 0 || (*format != "csv" && *format != "json") {
+		fmt.Fprint(os.Stderr, "usage: ldap-sync stale --config config.yaml [--days 90] [--format csv|json] [--out report.csv]\n")
+		return 2, nil
+	}
+
+	conf, err := loadConfig(*configPath)
+	if err != nil {
+		return
+	}
+	records, err := ldapsync.DoContext(context.Background(), conf)
+	if err != nil {
+		return
+	}
+	report := records.StaleAccounts(time.Duration(*days)*24*time.Hour, time.Now())
+
+	var w io.Writer = os.Stdout
+	if *out != "" {
+		f, createErr := os.OpenFile(*out, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+		if createErr != nil {
+			return 2, createErr
+		}
+		defer func() {
+			if closeErr := f.Close(); err == nil {
+				err = closeErr
+			}
+		}()
+		w = f
+	}
+	if *format == "json" {
+		err = ldapsync.WriteStaleAccountsJSON(w, report)
+	} else {
+		err = ldapsync.WriteStaleAccountsCSV(w, report)
+	}
+	if err == nil && *out != "" {
+		fmt.Fprintf(os.Stderr, "wrote %d stale accounts to %s\n", len(report.Accounts()), *out)
+	}
+	return
+}
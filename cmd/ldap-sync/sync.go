@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	ldapsync "github.com/adedayo/ldap-sync/pkg"
+)
+
+// sync syncs with the configuration and prints the users and groups
+func sync(args []string) (code int, err error) {
+	flags := flag.NewFlagSet("sync", flag.ContinueOnError)
+	configPath := flags.String("config", "", "sync configuration (JSON or YAML)")
+	format := flags.String("format", "table", "output format: table, json (of the users and groups) or ldif (of the entries)")
+	out := flags.String("out", "", "file to write, standard output if empty")
+	if err = flags.Parse(args); err != nil {
+		return flagError(err)
+	}
+	if *configPath == "" || flags.NArg() != 0 || (*format != "table" && *format != "json" && *format != "ldif") {
+		fmt.Fprint(os.Stderr, "usage: ldap-sync sync --config config.yaml [--format table|json|ldif] [--out users.json]\n")
+		return 2, nil
+	}
+
+	conf, err := loadConfig(*configPath)
+	if err != nil {
+		return
+	}
+	records, err := ldapsync.DoContext(context.Background(), conf)
+	if err != nil {
+		return
+	}
+
+	var w io.Writer = os.Stdout
+	if *out != "" {
+		f, createErr := os.OpenFile(*out, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+		if createErr != nil {
+			return 2, createErr
+		}
+		defer func() {
+			if closeErr := f.Close(); err == nil {
+				err = closeErr
+			}
+		}()
+		w = f
+	}
+	switch *format {
+	case "ldif":
+		err = ldapsync.WriteLDIF(w, records.Entries)
+	case "json":
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		err = encoder.Encode(records.GetUsersAndGroups())
+	default:
+		err = writeTable(w, records.GetUsersAndGroups())
+	}
+	if err == nil && records.Truncated {
+		fmt.Fprintf(os.Stderr, "warning: the server truncated the results at its size limit\n")
+	}
+	return
+}
+
+// writeTable writes the users and groups as tables
+func writeTable(w io.Writer, ug ldapsync.UsersAndGroups) error {
+	groupsOf := make(map[string][]string)
+	for _, g := range ug.Groups {
+		for _, member := range g.Members {
+			groupsOf[member] = append(groupsOf[member], g.ID)
+		}
+	}
+	t := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(t, "USER\tDN\tEMAIL\tGROUPS\n")
+	for _, u := range ug.Users {
+		fmt.Fprintf(t, "%s\t%s\t%s\t%s\n", u.ID, u.DN, u.Email, strings.Join(groupsOf[u.DN], ","))
+	}
+	fmt.Fprintf(t, "\nGROUP\tDN\tMEMBERS\tEXTERNAL MEMBERS\n")
+	for _, g := range ug.Groups {
+		fmt.Fprintf(t, "%s\t%s\t%d\t%d\n", g.ID, g.DN, len(g.Members), len(g.ExternalMembers))
+	}
+	fmt.Fprintf(t, "\n%d users, %d groups\n", len(ug.Users), len(ug.Groups))
+	return t.Flush()
+}
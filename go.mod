@@ -2,10 +2,16 @@ module github.com/adedayo/ldap-sync
 
 go 1.19
 
-require github.com/go-ldap/ldap/v3 v3.4.4
+require (
+	github.com/go-asn1-ber/asn1-ber v1.5.7
+	github.com/go-ldap/ldap/v3 v3.4.10
+	golang.org/x/crypto v0.31.0
+	golang.org/x/text v0.21.0
+	gopkg.in/yaml.v3 v3.0.1
+)
 
 require (
-	github.com/Azure/go-ntlmssp v0.0.0-20220621081337-cb9428e4ac1e // indirect
-	github.com/go-asn1-ber/asn1-ber v1.5.4 // indirect
-	golang.org/x/crypto v0.1.0 // indirect
+	github.com/Azure/go-ntlmssp v0.0.0-20221128193559-754e69321358 // indirect
+	github.com/google/uuid v1.6.0 // indirect
+	golang.org/x/sys v0.28.0 // indirect
 )
@@ -0,0 +1,267 @@
+package ldapsync
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// SourceError is the failure to sync one of the directories of an aggregate sync
+type SourceError struct {
+	Source int    // index of the directory's config
+	Server string // the directory server
+	Err    error
+}
+
+func (e SourceError) Error() string {
+	return fmt.Sprintf("source %d (%s): %v", e.Source, e.Server, e.Err)
+}
+
+func (e SourceError) Unwrap() error {
+	return e.Err
+}
+
+// AggregateResult is the outcome of syncing several directories
+type AggregateResult struct {
+	Records        []LDAPRecords  // the records of each directory, in the order of the configs
+	UsersAndGroups UsersAndGroups // the merged users and groups of the directories synced successfully
+	Errors         []SourceError  // the directories that failed to sync
+}
+
+// AggregateConfig configures the sync of several directories into one set of users and groups
+type AggregateConfig struct {
+	Sources []LDAPSyncConfig `json:"sources"`
+	// user attribute (e.g. mail, employeeID) identifying the same person across directories, whose users are then
+	// merged into one. Users are only merged by DN if not set
+	CorrelationAttribute string `json:"correlationAttribute"`
+}
+
+// DoAll syncs several directories (e.g. the domains of merged companies) concurrently and merges their users
+// and groups. A directory failing to sync does not fail the others; an error is only returned if all of them fail
+func DoAll(ctx context.Context, config AggregateConfig) (result AggregateResult, err error) {
+	configs := config.Sources
+	result.Records = make([]LDAPRecords, len(configs))
+	errs := make([]error, len(configs))
+
+	var wg sync.WaitGroup
+	for i := range configs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			result.Records[i], errs[i] = DoContext(ctx, configs[i])
+		}(i)
+	}
+	wg.Wait()
+
+	var ugs []UsersAndGroups
+	keys := make(map[string]string) // correlation keys by normalised user DN
+	for i, e := range errs {
+		if e != nil {
+			result.Errors = append(result.Errors, SourceError{Source: i, Server: configs[i].Server, Err: e})
+			continue
+		}
+		ugs = append(ugs, result.Records[i].GetUsersAndGroups())
+		if config.CorrelationAttribute != "" {
+			for _, u := range result.Records[i].GetUsers() {
+				if _, values := u.GetAttribute(config.CorrelationAttribute); len(values) > 0 {
+					keys[normalizeDN(u.DN)] = strings.ToLower(strings.TrimSpace(values[0]))
+				}
+			}
+		}
+	}
+	result.UsersAndGroups = MergeUsersAndGroups(ugs...)
+	if config.CorrelationAttribute != "" {
+		result.UsersAndGroups = correlateUsers(result.UsersAndGroups, keys)
+	}
+
+	if len(configs) > 0 && len(result.Errors) == len(configs) {
+		err = fmt.Errorf("all %d directories failed to sync, the first with: %w", len(configs), result.Errors[0])
+	}
+	return
+}
+
+// MergeUsersAndGroups merges the users and groups of several directories. Users, groups and entities with the same
+// DN are merged into one, groups taking the union of their members and users that of their Roles. External members of a group that are users
+// of another of the directories, by DN or as foreign security principals by SID, become members
+func MergeUsersAndGroups(ugs ...UsersAndGroups) (merged UsersAndGroups) {
+	users := make(map[string]int)    // index of users by normalised DN
+	groups := make(map[string]int)   // index of groups by normalised DN
+	entities := make(map[string]int) // index of entities by class and normalised DN
+
+	for _, ug := range ugs {
+		merged.Incomplete = merged.Incomplete || ug.Incomplete
+		for _, u := range ug.Users {
+			key := normalizeDN(u.DN)
+			if i, exists := users[key]; exists {
+				merged.Users[i].Sources = append(merged.Users[i].Sources, u.Sources...)
+				continue
+			}
+			users[key] = len(merged.Users)
+			u.Sources = append([]Provenance{}, u.Sources...)
+			merged.Users = append(merged.Users, u)
+		}
+		for _, g := range ug.Groups {
+			key := normalizeDN(g.DN)
+			i, exists := groups[key]
+			if !exists {
+				groups[key] = len(merged.Groups)
+				g.Members = append([]string{}, g.Members...)
+				g.ExternalMembers = append([]string{}, g.ExternalMembers...)
+				g.Sources = append([]Provenance{}, g.Sources...)
+				merged.Groups = append(merged.Groups, g)
+				continue
+			}
+			merged.Groups[i].Members = append(merged.Groups[i].Members, g.Members...)
+			merged.Groups[i].ExternalMembers = append(merged.Groups[i].ExternalMembers, g.ExternalMembers...)
+			merged.Groups[i].Sources = append(merged.Groups[i].Sources, g.Sources...)
+		}
+		merged.Memberships = append(merged.Memberships, ug.Memberships...)
+		for id, roles := range ug.Roles {
+			merged.Roles = addRoles(merged.Roles, id, roles)
+		}
+		for _, e := range ug.Entities {
+			key := entityKey(e)
+			if i, exists := entities[key]; exists {
+				merged.Entities[i].Sources = append(merged.Entities[i].Sources, e.Sources...)
+				continue
+			}
+			entities[key] = len(merged.Entities)
+			e.Sources = append([]Provenance{}, e.Sources...)
+			merged.Entities = append(merged.Entities, e)
+		}
+	}
+
+	sids := make(map[string]int) // index of users by SID, to resolve foreign security principals across trusts
+	for i, u := range merged.Users {
+		if u.SID != "" {
+			sids[u.SID] = i
+		}
+	}
+
+	for i := range merged.Groups {
+		g := &merged.Groups[i]
+		var external []string
+		for _, m := range g.ExternalMembers {
+			sid, _ := ForeignPrincipalSID(m)
+			if j, isUser := users[normalizeDN(m)]; isUser {
+				g.Members = append(g.Members, merged.Users[j].DN)
+			} else if j, isUser := sids[sid]; isUser && sid != "" {
+				g.Members = append(g.Members, merged.Users[j].DN)
+			} else {
+				external = append(external, m)
+			}
+		}
+		g.Members = uniqueDNs(g.Members)
+		g.ExternalMembers = uniqueDNs(external)
+	}
+	// memberships asserted by a group that resolve to a user of another directory have no Membership record;
+	// derive one with the provenance of the group
+	asserted := make(map[[2]string]bool)
+	for _, m := range merged.Memberships {
+		asserted[[2]string{normalizeDN(m.UserDN), normalizeDN(m.GroupDN)}] = true
+	}
+	for _, g := range merged.Groups {
+		for _, m := range g.Members {
+			if !asserted[[2]string{normalizeDN(m), normalizeDN(g.DN)}] && len(g.Sources) > 0 {
+				merged.Memberships = append(merged.Memberships, Membership{UserDN: m, GroupDN: g.DN, Source: g.Sources[0]})
+			}
+		}
+	}
+	merged.Memberships = uniqueMemberships(merged.Memberships)
+	return
+}
+
+// uniqueMemberships removes duplicate memberships, i.e. of the same user and group from the same source
+func uniqueMemberships(memberships []Membership) []Membership {
+	type key struct {
+		user, group string
+		source      Provenance
+	}
+	seen := make(map[key]bool, len(memberships))
+	var out []Membership
+	for _, m := range memberships {
+		k := key{normalizeDN(m.UserDN), normalizeDN(m.GroupDN), m.Source}
+		if !seen[k] {
+			seen[k] = true
+			out = append(out, m)
+		}
+	}
+	return out
+}
+
+// correlateUsers merges users with the same correlation key (keyed by normalised DN) into the first of them,
+// recording the DNs of the others as its AlternateDNs and replacing them in group memberships
+func correlateUsers(ug UsersAndGroups, keys map[string]string) UsersAndGroups {
+	canonical := make(map[string]int)  // index of the canonical user by correlation key
+	aliases := make(map[string]string) // canonical DN by normalised alternate DN
+	var users []User
+	for _, u := range ug.Users {
+		key, exists := keys[normalizeDN(u.DN)]
+		if !exists || key == "" {
+			users = append(users, u)
+			continue
+		}
+		if i, exists := canonical[key]; exists {
+			users[i].AlternateDNs = append(users[i].AlternateDNs, u.DN)
+			users[i].AlternateDNs = append(users[i].AlternateDNs, u.AlternateDNs...)
+			users[i].Sources = append(users[i].Sources, u.Sources...)
+			aliases[normalizeDN(u.DN)] = users[i].DN
+			if roles, hasRoles := ug.Roles[u.ID]; hasRoles && u.ID != users[i].ID {
+				delete(ug.Roles, u.ID)
+				ug.Roles = addRoles(ug.Roles, users[i].ID, roles)
+			}
+			continue
+		}
+		canonical[key] = len(users)
+		users = append(users, u)
+	}
+	ug.Users = users
+
+	for i := range ug.Groups {
+		g := &ug.Groups[i]
+		for j, m := range g.Members {
+			if dn, isAlias := aliases[normalizeDN(m)]; isAlias {
+				g.Members[j] = dn
+			}
+		}
+		g.Members = uniqueDNs(g.Members)
+	}
+	for i, m := range ug.Memberships {
+		if dn, isAlias := aliases[normalizeDN(m.UserDN)]; isAlias {
+			ug.Memberships[i].UserDN = dn
+		}
+	}
+	ug.Memberships = uniqueMemberships(ug.Memberships)
+	return ug
+}
+
+// addRoles adds the roles of the user ID to those it has in the map, which it creates if nil, without duplicates
+func addRoles(roles map[string][]string, id string, add []string) map[string][]string {
+	if roles == nil {
+		roles = make(map[string][]string)
+	}
+	for _, role := range add {
+		exists := false
+		for _, r := range roles[id] {
+			exists = exists || r == role
+		}
+		if !exists {
+			roles[id] = append(roles[id], role)
+		}
+	}
+	return roles
+}
+
+// uniqueDNs removes duplicate DNs, keeping the first occurrence
+func uniqueDNs(dns []string) []string {
+	seen := make(map[string]bool, len(dns))
+	var out []string
+	for _, dn := range dns {
+		if key := normalizeDN(dn); !seen[key] {
+			seen[key] = true
+			out = append(out, dn)
+		}
+	}
+	return out
+}
@@ -0,0 +1,24 @@
+package ldapsync_test
+
+import (
+	"fmt"
+	"testing"
+
+	ldapsync "github.com/adedayo/ldap-sync/pkg"
+)
+
+func TestMergeUsersAndGroupsMergesRoles(t *testing.T) {
+	alice := ldapsync.User{ID: "alice", DN: "uid=alice,ou=people,dc=example,dc=com"}
+	bob := ldapsync.User{ID: "bob", DN: "uid=bob,ou=people,dc=example,dc=org"}
+	merged := ldapsync.MergeUsersAndGroups(
+		ldapsync.UsersAndGroups{Users: []ldapsync.User{alice}, Roles: map[string][]string{"alice": {"viewer", "editor"}}},
+		ldapsync.UsersAndGroups{Users: []ldapsync.User{alice, bob},
+			Roles: map[string][]string{"alice": {"editor", "admin"}, "bob": {"viewer"}}},
+	)
+	if roles := fmt.Sprint(merged.Roles); roles != "map[alice:[viewer editor admin] bob:[viewer]]" {
+		t.Errorf("merged roles %s, want the union of the roles of each user", roles)
+	}
+	if merged := ldapsync.MergeUsersAndGroups(ldapsync.UsersAndGroups{Users: []ldapsync.User{alice}}); merged.Roles != nil {
+		t.Errorf("merged roles %v of users without any", merged.Roles)
+	}
+}
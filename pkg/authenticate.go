@@ -0,0 +1,166 @@
+package ldapsync
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+// Authenticate authenticates the user, identified by DN or by the value of the UserIDAttribute, by searching for
+// their entry with the configured (sync) credentials and then binding as it with the password. On success, the
+// result's Identity holds the user with their groups, resolved as by ResolveUserGroups, and roles.
+//
+// As with Auth, rejected credentials, including an unknown user, are reported by the result rather than the error,
+// which is kept for failures to reach or search the directory. If the directory is unreachable and the configuration
+// has OfflineCredentials, the credentials are verified against them instead, and the result is marked as Offline
+func (c *Client) Authenticate(ctx context.Context, identifier, password string) (auth AuthResult, err error) {
+	return c.AuthenticateCode(ctx, identifier, password, "")
+}
+
+// AuthenticateCode authenticates the user like Authenticate, passing the second factor code, e.g. of a TOTP
+// authenticator, to the configured SecondFactor
+func (c *Client) AuthenticateCode(ctx context.Context, identifier, password, code string) (auth AuthResult, err error) {
+	auth, _, err = c.authenticate(ctx, identifier, password, code)
+	return
+}
+
+// authenticate authenticates the user like AuthenticateCode, also returning their entry if they were found
+func (c *Client) authenticate(ctx context.Context, identifier, password, code string) (auth AuthResult, user *LDAPEntry, err error) {
+	begin := time.Now()
+	defer func() {
+		recordAuth(c.config.Metrics, c.config.GetDialAddr(), begin, auth, err)
+		dn := ""
+		if user != nil {
+			dn = user.DN
+		}
+		logAuth(c.config.Logger, c.config.GetDialAddr(), dn, begin, auth, err)
+	}()
+
+	l, config, vendor, err := c.open(ctx)
+	if err != nil {
+		if c.config.OfflineCredentials != nil && (isServerFailure(err) || errors.Is(err, ErrCircuitOpen)) {
+			auth, user, err = c.authenticateOffline(ctx, identifier, password, code)
+		}
+		return
+	}
+	defer l.Close()
+
+	attributes := append([]string{"*"}, userGroupAttributes(config, vendor)...)
+	user, err = findUser(l, config, identifier, attributes)
+	if err != nil {
+		if errors.Is(err, ErrUserNotFound) {
+			auth.ErrorMessage = err.Error()
+			return auth, nil, nil
+		}
+		return
+	}
+	// resolved before the bind, which drops the sync user's access rights
+	groups, err := resolveUserGroups(l, config, user)
+	if err != nil {
+		return
+	}
+
+	controls := append(config.requestControls(), ldap.NewControlBeheraPasswordPolicy())
+	var response []ldap.Control
+	var bindErr error
+	switch {
+	case config.SASL != nil && config.SASL.authenticatesUsers():
+		bindErr = l.saslBind(*config.SASL, config.Server, identifier, password, controls)
+	case config.NTLM != nil:
+		bindErr = l.ntlmBind(config.NTLM.forUsers(), identifier, password, controls)
+	default: // also for the SASL mechanisms that do not check the password
+		response, bindErr = l.bind(user.DN, password, controls)
+	}
+	auth.applyPasswordPolicy(response)
+	if bindErr != nil {
+		auth.ErrorMessage, auth.ResultCode = bindErr.Error(), resultCode(bindErr)
+		return
+	}
+
+	auth.Success = true
+	if auth.PasswordExpiry == nil {
+		auth.PasswordExpiry = readPasswordExpiry(l, user.DN)
+	}
+	ug := userAndGroups(config, user, groups)
+	auth.Identity = &ug
+	auth.authorize(config.RequiredGroups, config.RequireAllGroups, ug.hasGroup)
+	auth.verifySecondFactor(ctx, config.SecondFactor, user, code)
+	return
+}
+
+// authenticateOffline authenticates the user against the OfflineCredentials, applying the RequiredGroups to their
+// groups as of the last sync, and the SecondFactor to their entry as synced
+func (c *Client) authenticateOffline(ctx context.Context, identifier, password, code string) (auth AuthResult, user *LDAPEntry, err error) {
+	if auth, user, err = c.config.OfflineCredentials.verify(identifier, password); err != nil || !auth.Success {
+		return
+	}
+	auth.authorize(c.config.RequiredGroups, c.config.RequireAllGroups, auth.Identity.hasGroup)
+	auth.verifySecondFactor(ctx, c.config.SecondFactor, user, code)
+	return
+}
+
+// SecondFactor verifies a second authentication factor of the user, whose password was accepted, e.g. by checking
+// the code presented with the credentials against a TOTP secret among the user's attributes, or with a Duo push.
+// It returns an error if the user failed, or could not complete, the verification
+type SecondFactor func(ctx context.Context, user *LDAPEntry, code string) error
+
+// verifySecondFactor demotes a successful authentication to a failed one unless the user passes the second factor, if any
+func (auth *AuthResult) verifySecondFactor(ctx context.Context, verify SecondFactor, user *LDAPEntry, code string) {
+	if !auth.Success || verify == nil {
+		return
+	}
+	if err := verify(ctx, user, code); err != nil {
+		auth.Success = false
+		auth.ErrorMessage = "second factor: " + err.Error()
+	}
+}
+
+// authorize demotes a successful authentication to a Forbidden one unless the user is a member of any, or all, of
+// the required groups, if any
+func (auth *AuthResult) authorize(required []string, all bool, member func(group string) bool) {
+	if !auth.Success || requiredGroupsMet(required, all, member) {
+		return
+	}
+	auth.Success = false
+	auth.Forbidden = true
+	auth.ErrorMessage = "the user is not a member of the required groups"
+}
+
+func requiredGroupsMet(required []string, all bool, member func(group string) bool) bool {
+	for _, group := range required {
+		if member(group) != all {
+			return !all // a member of one of them, or not of one of all of them
+		}
+	}
+	return all || len(required) == 0
+}
+
+// hasGroup determines whether the group, given by DN or ID, is among the groups
+func (ug UsersAndGroups) hasGroup(group string) bool {
+	_, found := findGroup(ug.Groups, group)
+	return found
+}
+
+// directMember returns a function determining whether the bound user is a direct member of a group, by its DN:
+// from the user's memberOf, or else by comparing the group's member and uniqueMember with the user DN
+func directMember(l *conn, userDN string) func(group string) bool {
+	var memberOf []string
+	if user, err := readEntry(l, userDN, []string{"memberOf"}); err == nil {
+		_, memberOf = user.GetAttribute("memberOf")
+	}
+	return func(group string) bool {
+		for _, dn := range memberOf {
+			if normalizeDN(dn) == normalizeDN(group) {
+				return true
+			}
+		}
+		for _, attribute := range []string{"member", "uniqueMember"} {
+			if matched, err := l.Compare(group, attribute, userDN); err == nil && matched {
+				return true
+			}
+		}
+		return false
+	}
+}
@@ -0,0 +1,52 @@
+package ldapsync_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+
+	ldapsync "github.com/adedayo/ldap-sync/pkg"
+	"github.com/go-ldap/ldap/v3"
+)
+
+func TestAuthRejectsSASLMechanismsNotCheckingPasswords(t *testing.T) {
+	server, _ := fixture(t)
+	host, port, _ := net.SplitHostPort(server.Addr())
+	called := false
+	for _, sasl := range []ldapsync.SASLOptions{
+		{Mechanism: ldapsync.SASLExternal},
+		{Mechanism: ldapsync.SASLGSSAPI, GSSAPIClient: func(username, password string) (ldap.GSSAPIClient, error) {
+			called = true
+			return nil, errors.New("no Kerberos in tests")
+		}},
+	} {
+		sasl := sasl
+		auth, err := ldapsync.AuthContext(context.Background(), ldapsync.LDAPAuthData{Server: host, Port: port,
+			TLS: "none", User: "alice", Password: "wrong", SASL: &sasl})
+		if err != nil {
+			t.Fatalf("%s: %v", sasl.Mechanism, err)
+		}
+		if auth.Success || auth.ErrorMessage == "" {
+			t.Errorf("%s: authenticated %+v, want a rejection", sasl.Mechanism, auth)
+		}
+	}
+	if called {
+		t.Error("the GSSAPI client was asked to bind a user")
+	}
+}
+
+func TestAuthenticateBindsUsersWithTheirPasswordUnderExternal(t *testing.T) {
+	_, config := fixture(t)
+	config.SASL = &ldapsync.SASLOptions{Mechanism: ldapsync.SASLExternal} // for the sync user alone
+	client := ldapsync.NewClient(config)
+	for password, success := range map[string]bool{"alice-secret": true, "wrong": false} {
+		auth, err := client.Authenticate(context.Background(), "alice", password)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if auth.Success != success {
+			t.Errorf("authenticated with %q: %v, want %v (%s)", password, auth.Success, success, auth.ErrorMessage)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package ldapsync
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// AvatarOptions configures the extraction of user photos into the AvatarRef of users, as data URLs or, if a
+// Directory is set, files named by the hash of their content
+type AvatarOptions struct {
+	// attributes holding the photo, in order of preference; defaults to thumbnailPhoto (Active Directory) and jpegPhoto
+	Attributes []string `json:"attributes"`
+	// photos larger than this (in bytes) are skipped, 100KiB if zero
+	MaxBytes int `json:"maxBytes"`
+	// directory to write the photos to, in which case the AvatarRef is the URLPrefix followed by the file name
+	Directory string `json:"directory"`
+	// e.g. /avatars/ where the Directory is served; the path of the file if empty
+	URLPrefix string `json:"urlPrefix"`
+}
+
+const defaultAvatarBytes = 100 << 10
+
+// avatarFormats are the accepted image formats by their signatures
+var avatarFormats = []struct {
+	signature      []byte
+	mediaType, ext string
+}{
+	{[]byte{0xff, 0xd8, 0xff}, "image/jpeg", ".jpg"},
+	{[]byte("\x89PNG\r\n\x1a\n"), "image/png", ".png"},
+	{[]byte("GIF87a"), "image/gif", ".gif"},
+	{[]byte("GIF89a"), "image/gif", ".gif"},
+}
+
+// extractAvatars extracts the photos of the users, by DN key, failing if a photo can not be written
+func (sr *LDAPRecords) extractAvatars(opts AvatarOptions) (avatars map[string]string, err error) {
+	if opts.Directory != "" {
+		if err = os.MkdirAll(opts.Directory, 0755); err != nil {
+			return
+		}
+	}
+	avatars = make(map[string]string)
+	for _, ent := range sr.GetUsers() {
+		ref, found, extractErr := opts.extract(ent)
+		if extractErr != nil {
+			return nil, fmt.Errorf("avatar of %s: %w", ent.DN, extractErr)
+		}
+		if found {
+			avatars[dnKey(ent.DN)] = ref
+		}
+	}
+	return
+}
+
+// extract returns the reference to the first photo of the entry within the size limit and of an accepted format
+func (opts AvatarOptions) extract(ent *LDAPEntry) (ref string, found bool, err error) {
+	maxBytes := opts.MaxBytes
+	if maxBytes <= 0 {
+		maxBytes = defaultAvatarBytes
+	}
+	for _, name := range opts.attributes() {
+		att := ent.attribute(name)
+		if att == nil {
+			continue
+		}
+		for _, photo := range att.RawValues() {
+			if len(photo) == 0 || len(photo) > maxBytes {
+				continue
+			}
+			for _, format := range avatarFormats {
+				if !bytes.HasPrefix(photo, format.signature) {
+					continue
+				}
+				if opts.Directory == "" {
+					return "data:" + format.mediaType + ";base64," + base64.StdEncoding.EncodeToString(photo), true, nil
+				}
+				ref, err = opts.write(photo, format.ext)
+				return ref, err == nil, err
+			}
+		}
+	}
+	return
+}
+
+func (opts AvatarOptions) attributes() []string {
+	if len(opts.Attributes) > 0 {
+		return opts.Attributes
+	}
+	return []string{"thumbnailPhoto", "jpegPhoto"}
+}
+
+// write writes the photo to the Directory, unless it is already there, returning its reference
+func (opts AvatarOptions) write(photo []byte, ext string) (string, error) {
+	sum := sha256.Sum256(photo)
+	name := hex.EncodeToString(sum[:16]) + ext
+	path := filepath.Join(opts.Directory, name)
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		// written under a temporary name and renamed, so readers never see a partial photo
+		tmp := path + ".tmp"
+		if err = os.WriteFile(tmp, photo, 0644); err != nil {
+			return "", err
+		}
+		if err = os.Rename(tmp, path); err != nil {
+			return "", err
+		}
+	}
+	if opts.URLPrefix == "" {
+		return path, nil
+	}
+	return opts.URLPrefix + name, nil
+}
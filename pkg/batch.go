@@ -0,0 +1,262 @@
+package ldapsync
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// BatchOptions configures a BatchingSink
+type BatchOptions struct {
+	BatchSize     int           // changes applied at a time, 500 if zero
+	FlushInterval time.Duration // how long changes wait for a batch to fill, none if zero
+	QueueSize     int           // batches queued for the sink before Apply blocks, 4 if zero
+	OnError       func(error)   // called with the errors of the sink, if set
+}
+
+// BatchingSink applies changes to a slow sink in batches from a bounded queue. Apply splits the changes into
+// batches and queues them for the sink, blocking while the queue is full, so a slow sink throttles the sync rather
+// than letting changes pile up in memory. Batches smaller than the BatchSize wait up to the FlushInterval to be
+// merged with following ones; a change and its reversal, e.g. a user removed and added again, cancel out.
+//
+// Changes are applied asynchronously, in order: errors of the sink are reported to the OnError callback, and the
+// first of them is returned by the next call of Apply (which then queues nothing), Flush or Close. The changes of the
+// failed batches were accepted by an earlier Apply, so a Daemon can not retry them: a full resync (Daemon.Resync)
+// restores them
+type BatchingSink struct {
+	sink     Sink
+	options  BatchOptions
+	queue    chan batch
+	done     chan struct{}
+	once     sync.Once
+	drained  sync.WaitGroup // of the queued changes
+	mu       sync.Mutex
+	failures int   // of batches since the failure was last returned
+	failure  error // the first of them
+}
+
+type batch struct {
+	changes ChangeSet
+	current UsersAndGroups
+}
+
+func NewBatchingSink(sink Sink, options BatchOptions) *BatchingSink {
+	if options.BatchSize <= 0 {
+		options.BatchSize = 500
+	}
+	if options.QueueSize <= 0 {
+		options.QueueSize = 4
+	}
+	s := &BatchingSink{sink: sink, options: options, queue: make(chan batch, options.QueueSize), done: make(chan struct{})}
+	go s.run()
+	return s
+}
+
+// Apply queues the changes for the sink in batches, blocking while the queue is full until the context is done. It
+// returns the failure of any batch since the last one was returned instead
+func (s *BatchingSink) Apply(ctx context.Context, changes ChangeSet, current UsersAndGroups) error {
+	if err := s.takeFailure(); err != nil {
+		return err
+	}
+	for _, cs := range changes.split(s.options.BatchSize) {
+		s.drained.Add(1)
+		select {
+		case s.queue <- batch{changes: cs, current: current}:
+		case <-ctx.Done():
+			s.drained.Done()
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// Flush waits until the queued changes have been applied, or the context is done, returning the failure of any
+// batch since the last one was returned
+func (s *BatchingSink) Flush(ctx context.Context) error {
+	drained := make(chan struct{})
+	go func() {
+		s.drained.Wait()
+		close(drained)
+	}()
+	select {
+	case <-drained:
+		return s.takeFailure()
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close applies the queued changes and stops the sink, returning the failure of any batch since the last one was
+// returned. Apply must not be called after Close
+func (s *BatchingSink) Close() error {
+	s.once.Do(func() { close(s.queue) })
+	<-s.done
+	return s.takeFailure()
+}
+
+// fail records the failure of a batch
+func (s *BatchingSink) fail(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.failures == 0 {
+		s.failure = err
+	}
+	s.failures++
+}
+
+// takeFailure returns the failures recorded since it was last called, if any
+func (s *BatchingSink) takeFailure() (err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.failures > 0 {
+		err = fmt.Errorf("applying batches: %d failures, the first: %w", s.failures, s.failure)
+	}
+	s.failures, s.failure = 0, nil
+	return
+}
+
+// run applies the queued batches, merging those smaller than the BatchSize for up to the FlushInterval
+func (s *BatchingSink) run() {
+	defer close(s.done)
+	var pending batch
+	queued := 0 // queued batches merged into pending
+	var timeout <-chan time.Time
+	flush := func() {
+		if queued > 0 {
+			if !pending.changes.IsEmpty() {
+				if err := s.sink.Apply(context.Background(), pending.changes, pending.current); err != nil {
+					s.fail(err)
+					if s.options.OnError != nil {
+						s.options.OnError(err)
+					}
+				}
+			}
+			for ; queued > 0; queued-- {
+				s.drained.Done()
+			}
+		}
+		pending, timeout = batch{}, nil
+	}
+	for {
+		select {
+		case b, ok := <-s.queue:
+			if !ok {
+				flush()
+				return
+			}
+			pending.changes, pending.current = pending.changes.merge(b.changes), b.current
+			queued++
+			switch {
+			case pending.changes.size() >= s.options.BatchSize, s.options.FlushInterval <= 0 && len(s.queue) == 0:
+				flush()
+			case timeout == nil && s.options.FlushInterval > 0:
+				timeout = time.After(s.options.FlushInterval)
+			}
+		case <-timeout:
+			flush()
+		}
+	}
+}
+
+func (cs ChangeSet) size() int {
+	return len(cs.AddedUsers) + len(cs.RemovedUsers) + len(cs.AddedGroups) + len(cs.RemovedGroups) +
+		len(cs.AddedMemberships) + len(cs.RemovedMemberships) + len(cs.AddedEntities) + len(cs.RemovedEntities)
+}
+
+// split splits the changes into change sets of at most n changes, in the order they are to be applied: additions
+// of users, entities and groups, then of memberships, then removals of memberships, then of groups, users and
+// entities
+func (cs ChangeSet) split(n int) (sets []ChangeSet) {
+	var current ChangeSet
+	add := func(apply func(*ChangeSet)) {
+		apply(&current)
+		if current.size() >= n {
+			sets = append(sets, current)
+			current = ChangeSet{}
+		}
+	}
+	for _, u := range cs.AddedUsers {
+		u := u
+		add(func(c *ChangeSet) { c.AddedUsers = append(c.AddedUsers, u) })
+	}
+	for _, e := range cs.AddedEntities {
+		e := e
+		add(func(c *ChangeSet) { c.AddedEntities = append(c.AddedEntities, e) })
+	}
+	for _, g := range cs.AddedGroups {
+		g := g
+		add(func(c *ChangeSet) { c.AddedGroups = append(c.AddedGroups, g) })
+	}
+	for _, m := range cs.AddedMemberships {
+		m := m
+		add(func(c *ChangeSet) { c.AddedMemberships = append(c.AddedMemberships, m) })
+	}
+	for _, m := range cs.RemovedMemberships {
+		m := m
+		add(func(c *ChangeSet) { c.RemovedMemberships = append(c.RemovedMemberships, m) })
+	}
+	for _, g := range cs.RemovedGroups {
+		g := g
+		add(func(c *ChangeSet) { c.RemovedGroups = append(c.RemovedGroups, g) })
+	}
+	for _, u := range cs.RemovedUsers {
+		u := u
+		add(func(c *ChangeSet) { c.RemovedUsers = append(c.RemovedUsers, u) })
+	}
+	for _, e := range cs.RemovedEntities {
+		e := e
+		add(func(c *ChangeSet) { c.RemovedEntities = append(c.RemovedEntities, e) })
+	}
+	if !current.IsEmpty() {
+		sets = append(sets, current)
+	}
+	return
+}
+
+// merge returns the changes followed by the next ones, without the changes the next ones reverse
+func (cs ChangeSet) merge(next ChangeSet) (merged ChangeSet) {
+	merged.AddedUsers, merged.RemovedUsers = mergeUsers(cs.AddedUsers, cs.RemovedUsers, next.AddedUsers, next.RemovedUsers)
+	merged.AddedGroups, merged.RemovedGroups = mergeGroups(cs.AddedGroups, cs.RemovedGroups, next.AddedGroups, next.RemovedGroups)
+	merged.AddedMemberships, merged.RemovedMemberships = mergeMemberships(cs.AddedMemberships, cs.RemovedMemberships,
+		next.AddedMemberships, next.RemovedMemberships)
+	merged.AddedEntities, merged.RemovedEntities = mergeEntities(cs.AddedEntities, cs.RemovedEntities, next.AddedEntities, next.RemovedEntities)
+	return
+}
+
+func mergeUsers(added, removed, nextAdded, nextRemoved []User) ([]User, []User) {
+	key := func(u User) string { return normalizeDN(u.DN) }
+	return append(without(added, nextRemoved, key), without(nextAdded, removed, key)...),
+		append(without(removed, nextAdded, key), without(nextRemoved, added, key)...)
+}
+
+func mergeGroups(added, removed, nextAdded, nextRemoved []Group) ([]Group, []Group) {
+	key := func(g Group) string { return normalizeDN(g.DN) }
+	return append(without(added, nextRemoved, key), without(nextAdded, removed, key)...),
+		append(without(removed, nextAdded, key), without(nextRemoved, added, key)...)
+}
+
+func mergeMemberships(added, removed, nextAdded, nextRemoved []Membership) ([]Membership, []Membership) {
+	key := func(m Membership) string { return normalizeDN(m.UserDN) + "\x00" + normalizeDN(m.GroupDN) }
+	return append(without(added, nextRemoved, key), without(nextAdded, removed, key)...),
+		append(without(removed, nextAdded, key), without(nextRemoved, added, key)...)
+}
+
+func mergeEntities(added, removed, nextAdded, nextRemoved []Entity) ([]Entity, []Entity) {
+	return append(without(added, nextRemoved, entityKey), without(nextAdded, removed, entityKey)...),
+		append(without(removed, nextAdded, entityKey), without(nextRemoved, added, entityKey)...)
+}
+
+// without returns the items whose keys are not among those of the others
+func without[T any](items, others []T, key func(T) string) (kept []T) {
+	exclude := make(map[string]bool, len(others))
+	for _, o := range others {
+		exclude[key(o)] = true
+	}
+	for _, item := range items {
+		if !exclude[key(item)] {
+			kept = append(kept, item)
+		}
+	}
+	return
+}
@@ -0,0 +1,118 @@
+package ldapsync
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+// ErrCircuitOpen is returned without contacting a server whose circuit breaker is open
+var ErrCircuitOpen = errors.New("circuit open: directory server is failing, retry after the cooldown")
+
+// CircuitBreaker configures a circuit breaker for a server: after FailureThreshold consecutive failures
+// (connection errors, busy or unavailable server) the circuit opens and calls fail fast with ErrCircuitOpen
+// for the Cooldown period, after which a single trial call is let through to probe the server
+type CircuitBreaker struct {
+	FailureThreshold int      `json:"failureThreshold"` // zero or less disables the breaker
+	Cooldown         Duration `json:"cooldown"`         // defaults to 30s
+}
+
+type breakerState int
+
+const (
+	breakerClosed breakerState = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+// breaker is the circuit breaker state of a server
+type breaker struct {
+	mu       sync.Mutex
+	config   CircuitBreaker
+	state    breakerState
+	failures int
+	openedAt time.Time
+}
+
+func (b *breaker) configure(config CircuitBreaker) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.config = config
+}
+
+func (b *breaker) cooldown() time.Duration {
+	if b.config.Cooldown <= 0 {
+		return 30 * time.Second
+	}
+	return time.Duration(b.config.Cooldown)
+}
+
+// allow returns ErrCircuitOpen if calls to the server should fail fast
+func (b *breaker) allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case breakerOpen:
+		if time.Since(b.openedAt) < b.cooldown() {
+			return ErrCircuitOpen
+		}
+		b.state = breakerHalfOpen // let a trial call through
+		return nil
+	case breakerHalfOpen:
+		return ErrCircuitOpen // a trial call is in progress
+	default:
+		return nil
+	}
+}
+
+// record updates the breaker with the outcome of a call
+func (b *breaker) record(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.config.FailureThreshold <= 0 {
+		b.state, b.failures = breakerClosed, 0
+		return
+	}
+	if !isServerFailure(err) {
+		b.state, b.failures = breakerClosed, 0
+		return
+	}
+	b.failures++
+	if b.state == breakerHalfOpen || b.failures >= b.config.FailureThreshold {
+		b.state = breakerOpen
+		b.openedAt = time.Now()
+	}
+}
+
+// release releases the trial call of a half-open breaker that was abandoned before reaching the server, without
+// recording an outcome: the next call is let through as the trial instead
+func (b *breaker) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == breakerHalfOpen {
+		b.state = breakerOpen // its cooldown has passed
+	}
+}
+
+// isServerFailure determines whether the error indicates a failing server, as opposed to e.g. bad credentials or a missing entry
+func isServerFailure(err error) bool {
+	if err == nil {
+		return false
+	}
+	var ldapErr *ldap.Error
+	if errors.As(err, &ldapErr) {
+		return isResultCode(err, ldap.ErrorNetwork, ldap.LDAPResultBusy, ldap.LDAPResultUnavailable,
+			ldap.LDAPResultServerDown, ldap.LDAPResultTimeout, ldap.LDAPResultConnectError)
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// breakerError adds the server address to ErrCircuitOpen
+func breakerError(addr string, err error) error {
+	return fmt.Errorf("%s: %w", addr, err)
+}
@@ -0,0 +1,75 @@
+package ldapsync
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+func TestBreakerOpensAfterConsecutiveFailures(t *testing.T) {
+	b := &breaker{}
+	b.configure(CircuitBreaker{FailureThreshold: 2, Cooldown: Duration(time.Hour)})
+	unavailable := ldap.NewError(ldap.LDAPResultUnavailable, errors.New("unavailable"))
+
+	b.record(unavailable)
+	b.record(nil) // a success resets the count
+	b.record(unavailable)
+	if err := b.allow(); err != nil {
+		t.Fatalf("open after a failure since the last success: %v", err)
+	}
+	b.record(ldap.NewError(ldap.LDAPResultInvalidCredentials, errors.New("invalid credentials")))
+	if err := b.allow(); err != nil {
+		t.Fatalf("open after a failure of the client: %v", err)
+	}
+	b.record(unavailable)
+	b.record(unavailable)
+	if err := b.allow(); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("allowed a call after 2 failures: %v", err)
+	}
+}
+
+func TestBreakerLetsOneTrialThroughAfterTheCooldown(t *testing.T) {
+	b := &breaker{}
+	b.configure(CircuitBreaker{FailureThreshold: 1, Cooldown: Duration(time.Hour)})
+	unavailable := ldap.NewError(ldap.LDAPResultUnavailable, errors.New("unavailable"))
+	b.record(unavailable)
+	b.openedAt = time.Now().Add(-2 * time.Hour) // the cooldown has passed
+
+	if err := b.allow(); err != nil {
+		t.Fatalf("no trial after the cooldown: %v", err)
+	}
+	if err := b.allow(); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("a second call during the trial: %v", err)
+	}
+	b.release() // the trial was abandoned before reaching the server
+	if err := b.allow(); err != nil {
+		t.Fatalf("no trial after an abandoned one: %v", err)
+	}
+	b.record(unavailable) // the trial fails
+	if err := b.allow(); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("allowed a call after a failed trial: %v", err)
+	}
+
+	b.openedAt = time.Now().Add(-2 * time.Hour)
+	if err := b.allow(); err != nil {
+		t.Fatalf("no trial after the cooldown: %v", err)
+	}
+	b.record(nil) // the trial succeeds
+	for i := 0; i < 2; i++ {
+		if err := b.allow(); err != nil {
+			t.Errorf("call %d after a successful trial: %v", i, err)
+		}
+	}
+}
+
+func TestBreakerDisabled(t *testing.T) {
+	b := &breaker{}
+	for i := 0; i < 10; i++ {
+		b.record(ldap.NewError(ldap.ErrorNetwork, errors.New("connection refused")))
+	}
+	if err := b.allow(); err != nil {
+		t.Errorf("a breaker without a threshold opened: %v", err)
+	}
+}
@@ -0,0 +1,113 @@
+package ldapsync
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+// Cache holds recent results, such as those of Do and ResolveUserGroups, for reuse within their time to live
+type Cache interface {
+	// Get returns the value cached under the key, unless it is missing or has expired
+	Get(key string) (value []byte, found bool, err error)
+	// Set caches the value under the key for the time to live
+	Set(key string, value []byte, ttl time.Duration) error
+}
+
+// MemoryCache is an in-process Cache
+type MemoryCache struct {
+	mu      sync.Mutex
+	entries map[string]cacheEntry
+}
+
+type cacheEntry struct {
+	value   []byte
+	expires time.Time
+}
+
+func NewMemoryCache() *MemoryCache {
+	return &MemoryCache{entries: make(map[string]cacheEntry)}
+}
+
+func (c *MemoryCache) Get(key string) ([]byte, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, found := c.entries[key]
+	if !found {
+		return nil, false, nil
+	}
+	if time.Now().After(entry.expires) {
+		delete(c.entries, key)
+		return nil, false, nil
+	}
+	return entry.value, true, nil
+}
+
+func (c *MemoryCache) Set(key string, value []byte, ttl time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[key] = cacheEntry{value: append([]byte{}, value...), expires: time.Now().Add(ttl)}
+	return nil
+}
+
+// caching determines whether results are to be cached
+func (conf LDAPSyncConfig) caching() bool {
+	return conf.Cache != nil && conf.CacheTTL > 0
+}
+
+// cacheKey returns the cache key of results of the kind (e.g. sync) for the configuration and, optionally,
+// the subject (e.g. a user DN). Configurations differing in anything but the sync password have different keys
+func (conf LDAPSyncConfig) cacheKey(kind, subject string) string {
+	conf.SyncPassword = ""
+	data, _ := json.Marshal(conf)
+	h := sha256.New()
+	h.Write(data)
+	h.Write([]byte{0})
+	h.Write([]byte(subject))
+	return "ldapsync/" + kind + "/" + hex.EncodeToString(h.Sum(nil))
+}
+
+// cachedRecords is the cached form of a sync result
+type cachedRecords struct {
+	Entries        []*LDAPEntry
+	Schema         *Schema
+	Vendor         Vendor
+	Truncated      bool
+	Truncations    []Truncation
+	ServerFiltered bool
+}
+
+// loadCached loads the cached result of the sync into the records, returning false if there is none
+func (sr *LDAPRecords) loadCached(key string, cache Cache) bool {
+	data, found, err := cache.Get(key)
+	if err != nil || !found {
+		return false
+	}
+	var cached cachedRecords
+	if json.Unmarshal(data, &cached) != nil {
+		return false
+	}
+	for _, ent := range cached.Entries {
+		ent.indexAttributes()
+	}
+	sr.Entries, sr.Schema, sr.Vendor = cached.Entries, cached.Schema, cached.Vendor
+	sr.Truncated, sr.Truncations, sr.serverFiltered = cached.Truncated, cached.Truncations, cached.ServerFiltered
+	return true
+}
+
+// cache caches the result of the sync, on a best effort basis
+func (sr *LDAPRecords) cache(key string, cache Cache, ttl time.Duration) {
+	data, err := json.Marshal(cachedRecords{
+		Entries:        sr.Entries,
+		Schema:         sr.Schema,
+		Vendor:         sr.Vendor,
+		Truncated:      sr.Truncated,
+		Truncations:    sr.Truncations,
+		ServerFiltered: sr.serverFiltered,
+	})
+	if err == nil {
+		cache.Set(key, data, ttl)
+	}
+}
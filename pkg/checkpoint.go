@@ -0,0 +1,104 @@
+package ldapsync
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"strings"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+// checkpoint records the progress of the search of a BaseDN, so an interrupted sync can resume from the
+// last completed page. The entries of each page are saved under their own key, so every page is written once
+type checkpoint struct {
+	Cookie   []byte `json:"cookie"`   // paging cookie of the next page
+	Pages    int    `json:"pages"`    // number of pages saved
+	Complete bool   `json:"complete"` // whether all the pages have been fetched
+}
+
+// checkpointer saves and restores the checkpoint of the search of a BaseDN in the state store
+type checkpointer struct {
+	store StateStore
+	key   string
+}
+
+func newCheckpointer(store StateStore, addr string, req *ldap.SearchRequest) *checkpointer {
+	// the checkpoint is only valid for the same search
+	h := fnv.New64a()
+	fmt.Fprintf(h, "%d|%s|%s", req.Scope, req.Filter, strings.Join(req.Attributes, ","))
+	return &checkpointer{
+		store: store,
+		key:   fmt.Sprintf("ldapsync/checkpoint/%s/%s/%x", addr, req.BaseDN, h.Sum64()),
+	}
+}
+
+func (cp *checkpointer) loadCheckpoint() (c checkpoint, err error) {
+	data, found, err := cp.store.Load(cp.key)
+	if err != nil || !found {
+		return
+	}
+	err = json.Unmarshal(data, &c)
+	return
+}
+
+// load returns the saved checkpoint and the entries of its pages, if any
+func (cp *checkpointer) load() (c checkpoint, entries []*LDAPEntry, err error) {
+	if c, err = cp.loadCheckpoint(); err != nil {
+		return
+	}
+	for i := 0; i < c.Pages; i++ {
+		var page []*LDAPEntry
+		data, found, err := cp.store.Load(cp.pageKey(i))
+		if err != nil {
+			return c, nil, err
+		}
+		if !found {
+			return c, nil, fmt.Errorf("checkpoint %s is missing page %d", cp.key, i)
+		}
+		if err = json.Unmarshal(data, &page); err != nil {
+			return c, nil, err
+		}
+		for _, ent := range page {
+			ent.indexAttributes()
+		}
+		entries = append(entries, page...)
+	}
+	return
+}
+
+// savePage saves the entries of a completed page, and the cookie of the next page, empty if it was the last
+func (cp *checkpointer) savePage(c *checkpoint, entries []*LDAPEntry, nextCookie []byte) error {
+	data, err := json.Marshal(entries)
+	if err != nil {
+		return err
+	}
+	if err = cp.store.Save(cp.pageKey(c.Pages), data); err != nil {
+		return err
+	}
+	c.Pages++
+	c.Cookie = nextCookie
+	c.Complete = len(nextCookie) == 0
+	if data, err = json.Marshal(c); err != nil {
+		return err
+	}
+	return cp.store.Save(cp.key, data)
+}
+
+// clear deletes the checkpoint and its pages
+func (cp *checkpointer) clear() error {
+	c, err := cp.loadCheckpoint()
+	if err != nil {
+		c = checkpoint{}
+	}
+	for i := 0; i < c.Pages; i++ {
+		if err := cp.store.Delete(cp.pageKey(i)); err != nil {
+			return err
+		}
+	}
+	return cp.store.Delete(cp.key)
+}
+
+func (cp *checkpointer) pageKey(page int) string {
+	return fmt.Sprintf("%s/page/%d", cp.key, page)
+}
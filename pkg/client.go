@@ -0,0 +1,108 @@
+package ldapsync
+
+import (
+	"context"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	"github.com/go-ldap/ldap/v3"
+)
+
+// Client runs operations against the configured directory server, bound as the sync user if the server requires
+// authentication. With the Pool option, the client reuses its connections across operations
+type Client struct {
+	config LDAPSyncConfig
+	pool   *connPool
+}
+
+// NewClient returns a client of the configured server
+func NewClient(config LDAPSyncConfig) *Client {
+	c := &Client{config: config.Sanitize()}
+	if config.Pool != nil {
+		c.pool = newConnPool(*config.Pool)
+	}
+	return c
+}
+
+// Close closes the idle connections of the client's pool. Operations after Close connect anew each time
+func (c *Client) Close() {
+	c.pool.close()
+}
+
+// Do syncs like DoContext, with a connection of the client's pool
+func (c *Client) Do(ctx context.Context) (LDAPRecords, error) {
+	return doContext(ctx, c.config, c.pool)
+}
+
+// open connects to the server, returning the connection along with the configuration completed from its RootDSE:
+// the discovered BaseDNs if "auto", and the vendor defaults if DetectVendor
+func (c *Client) open(ctx context.Context) (l *conn, config LDAPSyncConfig, vendor Vendor, err error) {
+	if err = c.config.Retry.do(ctx, c.config.Metrics, c.config.Logger, c.config.GetDialAddr(), func() (err error) {
+		l, err = c.pool.connect(ctx, c.config)
+		return
+	}); err != nil {
+		return
+	}
+	config = c.config
+	dse, dseErr := readRootDSE(l)
+	if dseErr != nil && (config.autoBaseDNs() || config.DetectVendor) {
+		l.Close()
+		return nil, config, vendor, dseErr
+	}
+	vendor = dse.Vendor()
+	if config.DetectVendor {
+		config = config.WithVendorDefaults(vendor)
+	}
+	if config.autoBaseDNs() {
+		config.BaseDNs = dse.BaseDNs()
+	}
+	return
+}
+
+// ExtendedResult is the response of an extended operation
+type ExtendedResult struct {
+	OID      string // the responseName, if the server sent one
+	Value    []byte // the responseValue, nil if the server sent none
+	Controls []ldap.Control
+}
+
+// Extended invokes the extended operation with the OID and request value (nil for none), e.g. the Cancel operation
+// (1.3.6.1.1.8) or a server-specific operation. The configured request controls are attached
+func (c *Client) Extended(ctx context.Context, oid string, value []byte) (result ExtendedResult, err error) {
+	l, err := c.pool.connect(ctx, c.config)
+	if err != nil {
+		return
+	}
+	defer l.Close()
+
+	request := ldap.NewExtendedRequest(oid, nil)
+	if value != nil {
+		request.Value = ber.NewString(ber.ClassContext, ber.TypePrimitive, 1, string(value), "Extended Request Value")
+	}
+	request.Controls = c.config.requestControls()
+	response, err := l.Extended(request)
+	if err != nil {
+		err = opError("extended operation "+oid, l.addr, err)
+		return
+	}
+	result = ExtendedResult{OID: response.Name, Controls: response.Controls}
+	if response.Value != nil {
+		result.Value = response.Value.Data.Bytes()
+	}
+	return
+}
+
+// Compare determines whether the entry with the DN has the attribute value, e.g. whether a user's DN is among the
+// values of a group's member attribute, with the LDAP Compare operation: the server matches the value with the
+// attribute's equality rule, without a search
+func (c *Client) Compare(ctx context.Context, dn, attribute, value string) (matched bool, err error) {
+	l, err := c.pool.connect(ctx, c.config)
+	if err != nil {
+		return
+	}
+	defer l.Close()
+
+	if matched, err = l.Compare(dn, attribute, value); err != nil {
+		err = searchError("compare", l.addr, dn, 0, err)
+	}
+	return
+}
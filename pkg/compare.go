@@ -0,0 +1,79 @@
+package ldapsync
+
+import (
+	"sync"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/unicode/norm"
+)
+
+// ValuePreparation configures how string values are prepared before comparison, in the spirit of RFC 4518,
+// so that e.g. names with accents compare equal regardless of how they were composed
+type ValuePreparation struct {
+	Normalize bool `json:"normalize"` // apply Unicode NFC normalization to values
+	CaseFold  bool `json:"caseFold"`  // fold the case of all values, not just those of case-insensitive attributes
+}
+
+// folders holds case folders, which are stateful and so can not be shared by concurrent comparisons
+var folders = sync.Pool{New: func() interface{} { return cases.Fold() }}
+
+// foldCase folds the case of the value
+func foldCase(value string) string {
+	folder := folders.Get().(cases.Caser)
+	defer folders.Put(folder)
+	return folder.String(value)
+}
+
+// comparator compares attribute values according to the attributes' matching rules and the value preparation
+type comparator struct {
+	schema *Schema // may be nil, in which case well-known attribute semantics apply
+	prep   ValuePreparation
+}
+
+func (cmp comparator) rule(attribute string) MatchingRule {
+	rule := cmp.schema.MatchingRule(attribute)
+	if cmp.prep.CaseFold && rule == ExactMatch {
+		return CaseIgnoreMatch
+	}
+	return rule
+}
+
+// ruleFor is the rule for comparing a group attribute with a user attribute
+func (cmp comparator) ruleFor(groupAttribute, userAttribute string) MatchingRule {
+	rule := cmp.schema.comparisonRule(groupAttribute, userAttribute)
+	if cmp.prep.CaseFold && rule == ExactMatch {
+		return CaseIgnoreMatch
+	}
+	return rule
+}
+
+// normalize returns the canonical form of a value compared with the rule, such that equal values have equal forms
+func (cmp comparator) normalize(rule MatchingRule, value string) string {
+	value = cmp.prepare(value)
+	if rule == CaseIgnoreMatch && cmp.prep.CaseFold {
+		value = foldCase(value)
+	}
+	return normalizeValue(rule, value)
+}
+
+// prepare applies the Unicode normalization, if configured
+func (cmp comparator) prepare(value string) string {
+	if cmp.prep.Normalize {
+		return norm.NFC.String(value)
+	}
+	return value
+}
+
+func (cmp comparator) equal(attribute, a, b string) bool {
+	rule := cmp.rule(attribute)
+	return cmp.normalize(rule, a) == cmp.normalize(rule, b)
+}
+
+// comparator returns the comparator of the synced records
+func (sr *LDAPRecords) comparator() comparator {
+	cmp := comparator{schema: sr.Schema}
+	if sr.config != nil {
+		cmp.prep = sr.config.ValuePreparation
+	}
+	return cmp
+}
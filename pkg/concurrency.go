@@ -0,0 +1,71 @@
+package ldapsync
+
+import (
+	"context"
+	"sync"
+)
+
+// forEachBaseDN runs the sync of each of the BaseDNs, by their position, on the connection or, with Concurrency, on
+// as many connections of the pool at once. The first failure stops the syncs still running and is returned. Each
+// worker connects its own connection, bound to the context cancelled by failures, rather than sharing the one of
+// the sync, which would only be interrupted by the end of the parent context
+func forEachBaseDN(ctx context.Context, l *conn, pool *connPool, config LDAPSyncConfig,
+	syncBaseDN func(ctx context.Context, l *conn, i int) error) error {
+	workers := config.Concurrency
+	if workers > len(config.BaseDNs) {
+		workers = len(config.BaseDNs)
+	}
+	if workers <= 1 {
+		for i := range config.BaseDNs {
+			if err := syncBaseDN(ctx, l, i); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	next := make(chan int, len(config.BaseDNs))
+	for i := range config.BaseDNs {
+		next <- i
+	}
+	close(next)
+	var mu sync.Mutex
+	var first error
+	fail := func(err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if first == nil {
+			first = err
+			cancel()
+		}
+	}
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			l, err := pool.connect(ctx, config)
+			if err != nil {
+				fail(err)
+				return
+			}
+			defer l.Close()
+			for i := range next {
+				if ctx.Err() != nil {
+					return
+				}
+				if err := syncBaseDN(ctx, l, i); err != nil {
+					fail(err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if first == nil {
+		return ctx.Err() // the parent context is done, before the syncs noticed
+	}
+	return first
+}
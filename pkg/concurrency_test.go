@@ -0,0 +1,25 @@
+package ldapsync_test
+
+import (
+	"testing"
+
+	ldapsync "github.com/adedayo/ldap-sync/pkg"
+)
+
+func TestConcurrentSyncOfBaseDNs(t *testing.T) {
+	_, config := fixture(t)
+	config.BaseDNs = []string{"ou=people,dc=example,dc=com", "ou=other,dc=example,dc=com"}
+	config.Concurrency = 2
+	records, err := ldapsync.Do(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if users := records.GetUsers(); len(users) != 3 {
+		t.Errorf("synced %d users of the BaseDNs, want alice, dave and carol", len(users))
+	}
+
+	config.BaseDNs = append(config.BaseDNs, "ou=missing,dc=example,dc=com")
+	if _, err = ldapsync.Do(config); err == nil {
+		t.Error("synced a missing BaseDN")
+	}
+}
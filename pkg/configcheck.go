@@ -0,0 +1,244 @@
+package ldapsync
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/go-ldap/ldap/v3"
+	"golang.org/x/text/unicode/norm"
+)
+
+// ConfigError lists the problems of an invalid configuration
+type ConfigError struct {
+	Problems []string
+}
+
+func (e *ConfigError) Error() string {
+	return "invalid configuration: " + strings.Join(e.Problems, "; ")
+}
+
+// Validate checks the configuration without connecting to the server: the connection settings, BaseDNs and
+// ExcludeDNs, filter expressions, entity classes, request controls and role rules. It returns a *ConfigError listing
+// the problems, if any
+func (conf LDAPSyncConfig) Validate() error {
+	var problems []string
+	problem := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	if conf.Server == "" {
+		problem("no server")
+	}
+	switch conf.TLS {
+	case "", "none", "tls", "starttls":
+	default:
+		problem("tls %q is not one of none, tls or starttls", conf.TLS)
+	}
+	if conf.TLS == "tls" || conf.TLS == "starttls" {
+		if _, err := conf.TLSOptions.tlsConfig(conf.Server); err != nil {
+			problem("tlsOptions: %v", err)
+		}
+	} else if conf.TLSOptions.hasClientCertificate() {
+		problem("the client certificate of the tlsOptions needs tls or starttls")
+	}
+	switch conf.Incremental {
+	case "", IncrementalSyncRepl, IncrementalDirSync:
+	default:
+		problem("incremental %q is not one of %s or %s", conf.Incremental, IncrementalSyncRepl, IncrementalDirSync)
+	}
+	if _, err := decodeSyncCookie(conf.SyncCookie); err != nil {
+		problem("%v", err)
+	}
+	for _, server := range conf.Servers {
+		if host, port, err := net.SplitHostPort(server); err == nil {
+			if n, err := strconv.Atoi(port); host == "" || err != nil || n < 1 || n > 65535 {
+				problem("invalid server %q", server)
+			}
+		} else if server == "" || strings.ContainsAny(server, ":/") {
+			problem("invalid server %q", server)
+		}
+	}
+	if conf.Port != nil {
+		if port, err := strconv.Atoi(*conf.Port); err != nil || port < 1 || port > 65535 {
+			problem("invalid port %q", *conf.Port)
+		}
+	}
+	if conf.SASL != nil {
+		switch conf.SASL.mechanism() {
+		case SASLDigestMD5:
+			if conf.RequiresAuthentication && (conf.SyncUserName == "" || conf.SyncPassword == "") {
+				problem("the DIGEST-MD5 mechanism needs a syncUserName and syncUserPassword")
+			}
+		case SASLExternal:
+			if !conf.TLSOptions.hasClientCertificate() {
+				problem("the EXTERNAL mechanism needs the client certificate of the tlsOptions")
+			}
+		case SASLGSSAPI: // the identity is that of the Kerberos client
+		default:
+			problem("sasl mechanism %q is not one of %s, %s or %s", conf.SASL.Mechanism, SASLDigestMD5, SASLExternal, SASLGSSAPI)
+		}
+		if conf.NTLM != nil {
+			problem("sasl and ntlm are exclusive")
+		}
+	} else if conf.NTLM != nil {
+		if conf.RequiresAuthentication && (conf.SyncUserName == "" || conf.SyncPassword == "" && conf.NTLM.NTHash == "") {
+			problem("ntlm needs a syncUserName and a syncUserPassword or ntHash")
+		}
+		if hash := conf.NTLM.NTHash; hash != "" {
+			if _, err := hex.DecodeString(hash); err != nil || len(hash) != 32 {
+				problem("ntlm ntHash is not 32 hexadecimal digits")
+			}
+		}
+	} else if conf.RequiresAuthentication && (conf.SyncUserName == "" || conf.SyncPassword == "") {
+		problem("syncRequiresAuth needs a syncUserName and syncUserPassword")
+	}
+
+	if len(conf.BaseDNs) == 0 {
+		problem("no baseDNs")
+	}
+	for _, baseDN := range conf.BaseDNs {
+		if strings.EqualFold(baseDN, AutoBaseDN) {
+			continue
+		}
+		if _, err := newSearchRequest(baseDN); err != nil {
+			problem("baseDN %s: %v", baseDN, err)
+		} else if _, err = ldap.ParseDN(baseDNOf(baseDN)); err != nil {
+			problem("baseDN %s: %v", baseDN, err)
+		}
+	}
+	for _, dn := range conf.ExcludeDNs {
+		if _, err := ldap.ParseDN(dn); err != nil {
+			problem("excludeDN %s: %v", dn, err)
+		}
+	}
+
+	for _, rule := range conf.DNRewrites {
+		if from, err := ldap.ParseDN(rule.From); err != nil || len(from.RDNs) == 0 {
+			problem("dnRewrite from %q is not a DN", rule.From)
+		}
+		if _, err := ldap.ParseDN(rule.To); err != nil {
+			problem("dnRewrite to %q: %v", rule.To, err)
+		}
+	}
+
+	for name, filter := range map[string]LDAPFilter{"userFilter": conf.UserFilter, "groupFilter": conf.GroupFilter} {
+		for _, err := range filter.expressionErrors() {
+			problem("%s: %v", name, err)
+		}
+	}
+	classes := make(map[string]bool)
+	for _, class := range conf.EntityClasses {
+		switch {
+		case class.Name == "":
+			problem("entity class without a name")
+		case classes[class.Name]:
+			problem("duplicate entity class %s", class.Name)
+		}
+		classes[class.Name] = true
+		if class.Filter.isEmpty() {
+			problem("entity class %s: no filter", class.Name)
+		}
+		for _, err := range class.Filter.expressionErrors() {
+			problem("entity class %s: %v", class.Name, err)
+		}
+	}
+	for _, spec := range conf.ControlSpecs {
+		if spec.OID == "" {
+			problem("control without an oid")
+		}
+	}
+	for _, rule := range conf.RoleMapping.Rules {
+		if rule.Role == "" {
+			problem("role rule without a role")
+		}
+		if _, err := path.Match(rule.Pattern, ""); err != nil {
+			problem("role %s: pattern %q: %v", rule.Role, rule.Pattern, err)
+		}
+	}
+	if conf.AttributeMapping != nil {
+		for field, attribute := range conf.AttributeMapping.Extra {
+			if field == "" || !isAttributeDescription(attribute) {
+				problem("attributeMapping extra %q: invalid attribute %q", field, attribute)
+			}
+		}
+	}
+	for _, attribute := range conf.SyncAttributes {
+		if attribute != "*" && attribute != "+" && !isAttributeDescription(attribute) {
+			problem("syncAttributes: invalid attribute %q", attribute)
+		}
+	}
+	for _, attribute := range conf.ExcludeAttributes {
+		if !isAttributeDescription(attribute) {
+			problem("excludeAttributes: invalid attribute %q", attribute)
+		}
+	}
+	if conf.Avatars != nil && conf.Avatars.MaxBytes < 0 {
+		problem("negative avatars maxBytes")
+	}
+	if conf.SizeLimit < 0 || conf.TimeLimit < 0 {
+		problem("negative sizeLimit or timeLimit")
+	}
+	if conf.Retry != nil && (conf.Retry.MaxAttempts < 0 || conf.Retry.InitialBackoff < 0 || conf.Retry.MaxBackoff < 0) {
+		problem("negative retry maxAttempts, initialBackoff or maxBackoff")
+	}
+	if conf.Referrals != nil {
+		for _, creds := range conf.Referrals.Credentials {
+			if creds.Host == "" || creds.SyncUserName == "" || creds.SyncPassword == "" {
+				problem("referrals credentials need a host, syncUserName and syncUserPassword")
+			}
+		}
+	}
+	if conf.CacheTTL < 0 {
+		problem("negative cacheTTL")
+	}
+	if conf.Pool != nil && (conf.Pool.Size < 0 || conf.Pool.IdleTimeout < 0 || conf.Pool.HealthCheckAfter < 0) {
+		problem("negative pool size, idleTimeout or healthCheckAfter")
+	}
+	if conf.Concurrency < 0 {
+		problem("negative concurrency")
+	}
+
+	if len(problems) > 0 {
+		return &ConfigError{Problems: problems}
+	}
+	return nil
+}
+
+// expressionErrors returns the errors of the filter's regular expressions, other than those of extensible matches
+func (lf LDAPFilter) expressionErrors() (errs []error) {
+	for _, fe := range lf.Filters {
+		if _, extensible := parseExtensibleMatch(fe.Name); extensible {
+			continue
+		}
+		if _, err := regexp.Compile(norm.NFC.String(fe.Value)); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", fe.Name, err))
+		}
+	}
+	for _, group := range lf.FilterGroups {
+		errs = append(errs, group.expressionErrors()...)
+	}
+	return
+}
+
+// Preflight checks that the server is reachable with the configuration: that it connects and binds, reads the
+// RootDSE and can read the entry of each BaseDN. It returns the server's vendor
+func Preflight(ctx context.Context, config LDAPSyncConfig) (vendor Vendor, err error) {
+	l, config, vendor, err := NewClient(config).open(ctx)
+	if err != nil {
+		return
+	}
+	defer l.Close()
+
+	for _, baseDN := range config.BaseDNs {
+		if _, err = readEntry(l, baseDNOf(baseDN), []string{"1.1"}); err != nil {
+			return
+		}
+	}
+	return
+}
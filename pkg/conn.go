@@ -0,0 +1,180 @@
+package ldapsync
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+// conn is a directory connection whose operations are subject to the limits configured for its server.
+// The connection is closed, aborting any outstanding operation, once its context is done
+type conn struct {
+	*ldap.Conn
+	addr      string // the server address, which identifies the server for the purpose of limits
+	hooks     *Hooks
+	metrics   Metrics
+	logger    Logger
+	ctx       context.Context
+	stop      chan struct{}
+	closeOnce sync.Once
+	boundAs   string    // the DN of the last successful bind, empty if anonymous
+	pool      *connPool // the pool the connection returns to once closed, if any
+}
+
+// dial opens a connection to the server address, unless its circuit breaker is open
+func dial(ctx context.Context, addr string, config LDAPSyncConfig, dialer func(context.Context) (*ldap.Conn, error)) (*conn, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	limits := limitsFor(addr)
+	limits.configure(config)
+	if err := limits.breaker.allow(); err != nil {
+		return nil, breakerError(addr, err)
+	}
+	end := startOperation(config.Hooks, metricsOr(config.Metrics), loggerOr(config.Logger), Operation{Name: "dial", Server: addr})
+	l, err := dialer(ctx)
+	end(err)
+	limits.breaker.record(err)
+	if err != nil {
+		return nil, err
+	}
+
+	return newConn(ctx, l, addr, config), nil
+}
+
+// newConn returns the connection to the server address, closed once the context is done
+func newConn(ctx context.Context, l *ldap.Conn, addr string, config LDAPSyncConfig) *conn {
+	c := &conn{Conn: l, addr: addr, hooks: config.Hooks, metrics: metricsOr(config.Metrics),
+		logger: loggerOr(config.Logger), ctx: ctx, stop: make(chan struct{})}
+	if ctx.Done() != nil {
+		go func() {
+			select {
+			case <-ctx.Done():
+				l.Close()
+			case <-c.stop:
+			}
+		}()
+	}
+	return c
+}
+
+// Close closes the connection, or returns it to its pool if any
+func (c *conn) Close() {
+	c.closeOnce.Do(func() {
+		close(c.stop)
+		if c.pool == nil || !c.pool.put(c) {
+			c.Conn.Close()
+		}
+	})
+}
+
+// do runs an LDAP operation once the server's limits allow it
+func (c *conn) do(operation Operation, op func() error) (err error) {
+	done, err := limitsFor(c.addr).wait(c.ctx)
+	if err != nil {
+		if errors.Is(err, ErrCircuitOpen) {
+			err = breakerError(c.addr, err)
+		}
+		return
+	}
+	end := startOperation(c.hooks, c.metrics, c.logger, operation)
+	err = op()
+	end(err)
+	if ctxErr := c.ctx.Err(); err != nil && ctxErr != nil {
+		err = ctxErr // the operation was aborted by closing the connection
+		done(nil)
+		return
+	}
+	done(err)
+	return
+}
+
+func (c *conn) Bind(username, password string) error {
+	err := c.do(Operation{Name: "bind", Server: c.addr, BindDN: username}, func() error {
+		return c.Conn.Bind(username, password)
+	})
+	c.boundAs = boundAs(username, err)
+	return err
+}
+
+// boundAs returns the DN a connection is bound as after the bind as the username: anonymous if the bind failed
+func boundAs(username string, err error) string {
+	if err != nil {
+		return ""
+	}
+	return username
+}
+
+func (c *conn) Extended(request *ldap.ExtendedRequest) (response *ldap.ExtendedResponse, err error) {
+	err = c.do(Operation{Name: "extended", Server: c.addr}, func() error {
+		response, err = c.Conn.Extended(request)
+		return err
+	})
+	return
+}
+
+func (c *conn) Compare(dn, attribute, value string) (matched bool, err error) {
+	err = c.do(Operation{Name: "compare", Server: c.addr, BaseDN: dn}, func() error {
+		matched, err = c.Conn.Compare(dn, attribute, value)
+		return err
+	})
+	return
+}
+
+func (c *conn) Search(searchRequest *ldap.SearchRequest) (sr *ldap.SearchResult, err error) {
+	err = c.do(Operation{Name: "search", Server: c.addr, BaseDN: searchRequest.BaseDN}, func() error {
+		sr, err = c.Conn.Search(searchRequest)
+		return err
+	})
+	return
+}
+
+// searchPages runs the search a page at a time (unless paging is false), starting from the page of the cookie if
+// any, handing each page and the cookie of the next (empty after the last page) to the callback.
+// If the server truncates the results at its size limit, the entries it did return are handed over as the last page
+// before the size limit error is returned. Stops at the first error, including that of the callback or the connection's context being done
+func (c *conn) searchPages(searchRequest *ldap.SearchRequest, pageSize uint32, paging bool, cookie []byte,
+	page func(sr *ldap.SearchResult, next []byte) error) error {
+	if !paging {
+		sr, err := c.Search(searchRequest)
+		if err != nil && !(isSizeLimitExceeded(err) && sr != nil) {
+			return err
+		}
+		if pageErr := page(sr, nil); pageErr != nil {
+			return pageErr
+		}
+		return err // the results were truncated
+	}
+
+	pagingControl := ldap.NewControlPaging(pageSize)
+	pagingControl.SetCookie(cookie)
+	searchRequest.Controls = append(searchRequest.Controls, pagingControl)
+	for {
+		if err := c.ctx.Err(); err != nil {
+			return err
+		}
+		sr, err := c.Search(searchRequest)
+		if isSizeLimitExceeded(err) && sr != nil {
+			if pageErr := page(sr, nil); pageErr != nil {
+				return pageErr
+			}
+			return err // the results were truncated
+		}
+		if err != nil {
+			return err
+		}
+		var next []byte
+		if ctrl, ok := ldap.FindControl(sr.Controls, ldap.ControlTypePaging).(*ldap.ControlPaging); ok {
+			next = ctrl.Cookie
+		}
+		if err = page(sr, next); err != nil {
+			return err
+		}
+		if len(next) == 0 {
+			return nil // last page
+		}
+		pagingControl.SetCookie(next)
+	}
+}
@@ -0,0 +1,158 @@
+package ldapsync
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// ConnectorScopes are the scopes an OIDC client requested, as passed to a Dex connector
+type ConnectorScopes struct {
+	OfflineAccess bool // the client will refresh the identity, so Login returns the ConnectorData to do it with
+	Groups        bool // the client requested the user's groups
+}
+
+// ConnectorIdentity is the identity of a user as returned by a Dex connector
+type ConnectorIdentity struct {
+	UserID            string
+	Username          string
+	PreferredUsername string
+	Email             string
+	EmailVerified     bool
+	Groups            []string
+	ConnectorData     []byte // opaque state for Refresh, the user's DN
+}
+
+// connectorData is the ConnectorData of the identities of a Connector
+type connectorData struct {
+	DN string `json:"dn"`
+}
+
+// Connector adapts a Client to the password and refresh connector interfaces of Dex (Login, Refresh and Groups), so
+// OIDC brokers can use it as their LDAP backend. Users are authenticated with Client.Authenticate, so the
+// configured RequiredGroups and SecondFactor apply at login, and their groups are resolved as by ResolveUserGroups
+type Connector struct {
+	Client *Client
+
+	UsernamePrompt string // label of the username field of the login form, "Username" if empty
+	IDAttribute    string // user attribute of the UserID, e.g. objectGUID, the user's ID if empty
+	NameAttribute  string // attribute of the Username (display name), cn if empty
+	EmailAttribute string // attribute of the Email, mail if empty
+	GroupsAsDNs    bool   // return the groups' DNs rather than their IDs
+}
+
+func NewConnector(client *Client) *Connector {
+	return &Connector{Client: client}
+}
+
+// Prompt returns the label of the username field of the login form
+func (c *Connector) Prompt() string {
+	if c.UsernamePrompt == "" {
+		return "Username"
+	}
+	return c.UsernamePrompt
+}
+
+// Login authenticates the user. Rejected credentials, and users outside the RequiredGroups, are reported by a false
+// validPassword rather than an error, which is kept for failures to reach the directory
+func (c *Connector) Login(ctx context.Context, s ConnectorScopes, username, password string) (identity ConnectorIdentity, validPassword bool, err error) {
+	if username == "" || password == "" {
+		return // not an unauthenticated bind
+	}
+	auth, user, err := c.Client.authenticate(ctx, username, password, "")
+	if err != nil || !auth.Success {
+		return
+	}
+	identity, err = c.identity(s, *auth.Identity, user)
+	return identity, err == nil, err
+}
+
+// Refresh returns the current identity of the user, whose entry and groups are read afresh. It fails if the user
+// was deleted, no longer matches the UserFilter, or left the RequiredGroups
+func (c *Connector) Refresh(ctx context.Context, s ConnectorScopes, identity ConnectorIdentity) (ConnectorIdentity, error) {
+	var data connectorData
+	if err := json.Unmarshal(identity.ConnectorData, &data); err != nil || data.DN == "" {
+		return identity, fmt.Errorf("invalid connector data of user %s", identity.UserID)
+	}
+	ug, user, err := c.Client.syncUser(ctx, data.DN)
+	if err != nil {
+		if errors.Is(err, ErrUserNotFound) {
+			return identity, fmt.Errorf("refreshing user %s: %w", identity.UserID, err)
+		}
+		return identity, err
+	}
+	config := c.Client.config
+	if !requiredGroupsMet(config.RequiredGroups, config.RequireAllGroups, ug.hasGroup) {
+		return identity, fmt.Errorf("refreshing user %s: the user is not a member of the required groups", identity.UserID)
+	}
+	return c.identity(s, ug, user)
+}
+
+// Groups returns the current groups of the user of the identity
+func (c *Connector) Groups(ctx context.Context, identity ConnectorIdentity) (groups []string, err error) {
+	var data connectorData
+	if err = json.Unmarshal(identity.ConnectorData, &data); err != nil || data.DN == "" {
+		return nil, fmt.Errorf("invalid connector data of user %s", identity.UserID)
+	}
+	resolved, err := c.Client.ResolveUserGroups(ctx, data.DN)
+	if err != nil {
+		return
+	}
+	return c.groupNames(resolved), nil
+}
+
+// identity returns the identity of the user, with their groups if the scopes request them
+func (c *Connector) identity(s ConnectorScopes, ug UsersAndGroups, user *LDAPEntry) (identity ConnectorIdentity, err error) {
+	u := ug.Users[0]
+	identity.UserID, identity.PreferredUsername = u.ID, u.ID
+	if c.IDAttribute != "" {
+		if identity.UserID = idValue(user, c.IDAttribute); identity.UserID == "" {
+			return identity, fmt.Errorf("user %s has no %s", u.DN, c.IDAttribute)
+		}
+	}
+	identity.Username, _ = user.GetString(defaultString(c.NameAttribute, "cn"))
+	if identity.Username == "" {
+		identity.Username = u.ID
+	}
+	identity.Email, _ = user.GetString(defaultString(c.EmailAttribute, "mail"))
+	identity.EmailVerified = identity.Email != "" // vouched for by the directory
+	if s.Groups {
+		identity.Groups = c.groupNames(ug.Groups)
+	}
+	identity.ConnectorData, err = json.Marshal(connectorData{DN: u.DN})
+	return
+}
+
+func (c *Connector) groupNames(groups []Group) []string {
+	names := make([]string, len(groups))
+	for i, g := range groups {
+		names[i] = g.ID
+		if c.GroupsAsDNs {
+			names[i] = g.DN
+		}
+	}
+	return names
+}
+
+// idValue returns the value of the attribute identifying the entry, with binary values such as objectGUID hex encoded
+func idValue(ent *LDAPEntry, attribute string) string {
+	att := ent.attribute(attribute)
+	if att == nil || len(att.RawValues()) == 0 {
+		return ""
+	}
+	value := att.RawValues()[0]
+	for _, b := range value {
+		if b < 0x20 || b > 0x7e {
+			return fmt.Sprintf("%x", value)
+		}
+	}
+	return string(value)
+}
+
+func defaultString(value, fallback string) string {
+	if value == "" {
+		return fallback
+	}
+	return value
+}
@@ -0,0 +1,44 @@
+package ldapsync
+
+import (
+	"github.com/go-ldap/ldap/v3"
+)
+
+// ControlSpec configures a request control by OID, e.g. 2.16.840.1.113730.3.4.2 (ManageDsaIT)
+type ControlSpec struct {
+	OID      string `json:"oid"`
+	Critical bool   `json:"critical"` // the server must fail the operation if it does not support the control
+	Value    string `json:"value"`    // the encoded control value, if any
+}
+
+func (spec ControlSpec) control() ldap.Control {
+	return ldap.NewControlString(spec.OID, spec.Critical, spec.Value)
+}
+
+// requestControls returns the controls to attach to operations: those of the ControlSpecs followed by the Controls
+func requestControls(specs []ControlSpec, controls []ldap.Control) []ldap.Control {
+	all := make([]ldap.Control, 0, len(specs)+len(controls))
+	for _, spec := range specs {
+		all = append(all, spec.control())
+	}
+	return append(all, controls...)
+}
+
+// requestControls returns the controls to attach to the bind and searches of the sync
+func (conf LDAPSyncConfig) requestControls() []ldap.Control {
+	return requestControls(conf.ControlSpecs, conf.Controls)
+}
+
+// bind binds with the request controls, if any, returning the response controls, which the server may send even
+// if the bind fails, e.g. password policy controls
+func (c *conn) bind(username, password string, controls []ldap.Control) (response []ldap.Control, err error) {
+	err = c.do(Operation{Name: "bind", Server: c.addr, BindDN: username}, func() error {
+		result, err := c.Conn.SimpleBind(&ldap.SimpleBindRequest{Username: username, Password: password, Controls: controls})
+		if result != nil {
+			response = result.Controls
+		}
+		return err
+	})
+	c.boundAs = boundAs(username, err)
+	return
+}
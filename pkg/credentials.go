@@ -0,0 +1,133 @@
+package ldapsync
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// CredentialStore holds the userPassword hashes of the users of the last sync, with their groups, to verify
+// credentials locally when the directory is unreachable, e.g. at the edge or in air-gapped sites. It is opt-in: set
+// as the OfflineCredentials of the configuration, each complete sync replaces its contents, and Client.Authenticate
+// falls back to it when it cannot reach the directory. The sync user must be allowed to read userPassword, which
+// Active Directory never allows. Hashes are verified by VerifyPasswordHash.
+//
+// The store holds password hashes in memory: protect the process, and any Cache of the syncs, accordingly
+type CredentialStore struct {
+	mu    sync.RWMutex
+	users map[string]*offlineUser // by normalized DN and lower-cased ID
+	count int
+}
+
+type offlineUser struct {
+	hashes   []string
+	identity UsersAndGroups
+	entry    *LDAPEntry // as synced, without the userPassword, for the SecondFactor
+}
+
+func NewCredentialStore() *CredentialStore {
+	return &CredentialStore{users: make(map[string]*offlineUser)}
+}
+
+// Update replaces the contents of the store with the users of the records that have a userPassword
+func (s *CredentialStore) Update(records *LDAPRecords) {
+	ug := records.GetUsersAndGroups()
+	groupsOf := make(map[string][]Group)
+	for _, g := range ug.Groups {
+		for _, member := range g.Members {
+			key := normalizeDN(member)
+			group := g
+			group.Members, group.ExternalMembers, group.UnexpandedGroups = []string{member}, nil, nil
+			groupsOf[key] = append(groupsOf[key], group)
+		}
+	}
+
+	users, count := make(map[string]*offlineUser), 0
+	for _, ent := range records.GetUsers() {
+		_, hashes := ent.GetAttribute("userPassword")
+		if len(hashes) == 0 {
+			continue
+		}
+		user := User{ID: entryID(ent, records.config.UserIDAttribute), DN: ent.DN, SID: entrySID(ent), Sources: ent.sources()}
+		records.config.AttributeMapping.mapUser(&user, ent)
+		identity := UsersAndGroups{Users: []User{user}, Groups: groupsOf[normalizeDN(ent.DN)]}
+		for _, g := range identity.Groups {
+			identity.Memberships = append(identity.Memberships, Membership{UserDN: user.DN, GroupDN: g.DN})
+		}
+		if roles := ug.Roles[user.ID]; len(roles) > 0 {
+			identity.Roles = map[string][]string{user.ID: roles}
+		}
+		attributes := make([]LDAPAttribute, 0, len(ent.Attributes))
+		for _, att := range ent.Attributes {
+			if name, _ := attributeDescription(att.Name); name != "userpassword" {
+				attributes = append(attributes, att)
+			}
+		}
+		u := &offlineUser{hashes: hashes, identity: identity, entry: NewLDAPEntry(ent.DN, attributes)}
+		count++
+		users[normalizeDN(ent.DN)] = u
+		if user.ID != "" {
+			users[strings.ToLower(user.ID)] = u
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.users, s.count = users, count
+}
+
+// Len returns the number of users whose credentials the store can verify
+func (s *CredentialStore) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.count
+}
+
+// Verify verifies the credentials of the user, identified by DN or ID, against their stored hashes. As with
+// Authenticate, rejected credentials, including an unknown user, are reported by the result, which is marked as
+// Offline, and the error is kept for users none of whose hashes could be verified, e.g. of unsupported schemes
+func (s *CredentialStore) Verify(identifier, password string) (auth AuthResult, err error) {
+	auth, _, err = s.verify(identifier, password)
+	return
+}
+
+// verify verifies the credentials like Verify, also returning the user's entry if they were found
+func (s *CredentialStore) verify(identifier, password string) (auth AuthResult, user *LDAPEntry, err error) {
+	auth.Offline = true
+	if password == "" {
+		auth.ErrorMessage = "empty password"
+		return
+	}
+	s.mu.RLock()
+	u, found := s.users[strings.ToLower(identifier)]
+	if !found {
+		u, found = s.users[normalizeDN(identifier)]
+	}
+	s.mu.RUnlock()
+	if !found {
+		auth.ErrorMessage = fmt.Sprintf("no stored credentials of %s: %v", identifier, ErrUserNotFound)
+		return
+	}
+
+	user = u.entry
+	verified := false
+	for _, hash := range u.hashes {
+		matched, hashErr := VerifyPasswordHash(hash, password)
+		if matched {
+			auth.Success = true
+			identity := u.identity
+			auth.Identity = &identity
+			return
+		}
+		if hashErr == nil {
+			verified = true
+		} else {
+			err = hashErr
+		}
+	}
+	auth.ErrorMessage = "invalid credentials"
+	if verified {
+		err = nil
+	}
+	return
+}
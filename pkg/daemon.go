@@ -0,0 +1,289 @@
+package ldapsync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrSyncIncomplete reports a sync of a Daemon whose results are Truncated or Partial, and are not applied to its
+// sinks, lest the entries missing from them be taken as deleted
+var ErrSyncIncomplete = errors.New("sync incomplete")
+
+// defaultSyncInterval is the interval between the syncs of a Daemon, unless configured
+const defaultSyncInterval = 15 * time.Minute
+
+// DaemonConfig configures a Daemon: the sync and its schedule
+type DaemonConfig struct {
+	LDAPSyncConfig
+	Interval Duration `json:"interval"` // between the starts of syncs, e.g. "15m", the default
+	// age of the last successful sync beyond which the daemon is no longer ready, three intervals if zero
+	MaxStaleness Duration `json:"maxStaleness"`
+}
+
+// Sink receives the results of a Daemon's syncs, e.g. to provision them to an application
+type Sink interface {
+	// Apply applies the changes since the previous sync (all the users, groups and memberships, after the first
+	// sync), of which current is the result. The changes are applied again with those of the next sync if any sink
+	// fails them
+	Apply(ctx context.Context, changes ChangeSet, current UsersAndGroups) error
+}
+
+// SinkFunc adapts a function to a Sink
+type SinkFunc func(ctx context.Context, changes ChangeSet, current UsersAndGroups) error
+
+func (f SinkFunc) Apply(ctx context.Context, changes ChangeSet, current UsersAndGroups) error {
+	return f(ctx, changes, current)
+}
+
+// Daemon syncs on a schedule, applying the changes of each sync to its sinks. Its configuration can be replaced
+// while it runs, see Reload
+type Daemon struct {
+	Sinks   []Sink
+	OnError func(error) // called with the errors of syncs and sinks, if set
+	// held during each sync and the application of its changes, which is skipped if the lock is held elsewhere
+	Lock SyncLock
+	// elects the replica that syncs among replicas of the daemon, the others standing by, if set. A replica
+	// gaining the leadership resyncs in full
+	Elector *LeaderElector
+
+	mu       sync.Mutex
+	config   DaemonConfig
+	reloaded chan struct{}
+	resync   chan struct{}  // a pending resync, see Resync
+	full     bool           // whether the pending resync is a full one
+	last     UsersAndGroups // result of the last sync all the sinks applied
+	records  *LDAPRecords   // records of that sync, if incremental, which the next one resumes from
+	status   DaemonStatus
+}
+
+// DaemonStatus is the state of a Daemon
+type DaemonStatus struct {
+	Running     bool      // whether Run is running
+	Syncing     bool      // whether a sync is in progress
+	Standby     bool      // whether another replica is the leader, see Elector
+	LastAttempt time.Time // start of the last sync
+	LastSuccess time.Time // completion of the last successful sync
+	LastError   string    `json:",omitempty"` // error of the last sync, if it failed
+}
+
+func NewDaemon(config DaemonConfig, sinks ...Sink) *Daemon {
+	return &Daemon{Sinks: sinks, config: config, reloaded: make(chan struct{}, 1), resync: make(chan struct{}, 1)}
+}
+
+// Reload replaces the configuration of the daemon, after validating it. A sync in progress completes with the
+// configuration it started with, and the next one, rescheduled by the new interval, uses the new configuration
+func (d *Daemon) Reload(config DaemonConfig) error {
+	if err := config.Validate(); err != nil {
+		return err
+	}
+	d.mu.Lock()
+	d.config = config
+	d.mu.Unlock()
+	select {
+	case d.reloaded <- struct{}{}:
+	default: // a reload is already pending
+	}
+	return nil
+}
+
+// Resync requests an immediate sync, rescheduling the following ones from it. A full resync bypasses the Cache and
+// applies all the users, groups and memberships to the sinks, as the first sync does, rather than the changes since
+// the last sync. Requests made while a sync is in progress are coalesced into one follow-up sync, a full one if any
+// of them was
+func (d *Daemon) Resync(full bool) {
+	d.mu.Lock()
+	d.full = d.full || full
+	d.mu.Unlock()
+	select {
+	case d.resync <- struct{}{}:
+	default: // a resync is already pending
+	}
+}
+
+// Config returns the current configuration of the daemon
+func (d *Daemon) Config() DaemonConfig {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.config
+}
+
+// Status returns the state of the daemon
+func (d *Daemon) Status() DaemonStatus {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.status
+}
+
+// Ready determines whether the daemon's results are current: its last sync succeeded, and no longer ago than the
+// MaxStaleness, so the directory is reachable. A standby replica is ready while it runs
+func (d *Daemon) Ready() (bool, DaemonStatus) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	status := d.status
+	ready := status.Running && (status.Standby || !status.LastSuccess.IsZero() && status.LastError == "" &&
+		time.Since(status.LastSuccess) <= d.config.maxStaleness())
+	return ready, status
+}
+
+func (config DaemonConfig) maxStaleness() time.Duration {
+	if config.MaxStaleness <= 0 {
+		return 3 * config.interval()
+	}
+	return time.Duration(config.MaxStaleness)
+}
+
+func (config DaemonConfig) interval() time.Duration {
+	if config.Interval <= 0 {
+		return defaultSyncInterval
+	}
+	return time.Duration(config.Interval)
+}
+
+// Run syncs immediately and then at the configured interval until the context is done
+func (d *Daemon) Run(ctx context.Context) error {
+	d.setStatus(func(status *DaemonStatus) { status.Running = true })
+	defer d.setStatus(func(status *DaemonStatus) { status.Running = false })
+	if d.Elector != nil {
+		go d.Elector.Run(ctx, func(leader bool) {
+			if leader {
+				d.Resync(true)
+			}
+		})
+	}
+
+	var started time.Time
+	next := time.Now()
+	for {
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-d.reloaded:
+			timer.Stop()
+			d.records = nil // the SyncCookie may not be of the new configuration
+			if !started.IsZero() {
+				next = started.Add(d.Config().interval())
+			}
+			continue
+		case <-d.resync:
+			timer.Stop()
+		case <-timer.C:
+		}
+		started = time.Now()
+		d.mu.Lock()
+		config, full := d.config, d.full
+		d.full = false
+		d.mu.Unlock()
+		if full {
+			config.Cache = nil
+			d.last, d.records = UsersAndGroups{}, nil
+		}
+		d.sync(ctx, config)
+		next = started.Add(config.interval())
+	}
+}
+
+// sync syncs with the configuration and applies the changes since the last sync all the sinks applied to the sinks.
+// Incomplete results are not applied. An incremental sync resumes from the SyncCookie of that sync, whose records it
+// is merged with, or fetches the whole content without one
+func (d *Daemon) sync(ctx context.Context, config DaemonConfig) {
+	standby := d.Elector != nil && !d.Elector.IsLeader()
+	d.setStatus(func(status *DaemonStatus) { status.Standby = standby })
+	if standby {
+		return
+	}
+	if d.Lock != nil {
+		locked, err := d.Lock.TryLock()
+		if err == nil && !locked {
+			err = ErrSyncLocked
+		}
+		if err != nil {
+			d.error(err)
+			return
+		}
+		defer d.Lock.Unlock()
+	}
+	d.setStatus(func(status *DaemonStatus) {
+		status.Syncing = true
+		status.LastAttempt = time.Now()
+	})
+	if config.Incremental != "" {
+		config.SyncCookie = ""
+		if d.records != nil {
+			config.SyncCookie = d.records.SyncCookie
+		}
+	}
+	records, err := DoContext(ctx, config.LDAPSyncConfig)
+	if err == nil {
+		err = records.incomplete()
+	}
+	if err == nil && d.records != nil {
+		records = records.Merge(*d.records)
+	}
+	d.setStatus(func(status *DaemonStatus) {
+		status.Syncing = false
+		status.LastError = ""
+		if err != nil {
+			status.LastError = err.Error()
+		} else {
+			status.LastSuccess = time.Now()
+		}
+	})
+	if err != nil {
+		d.error(err)
+		return
+	}
+	current := records.GetUsersAndGroups()
+	changes := Diff(d.last, current)
+	applied := true
+	for _, sink := range d.Sinks {
+		// the leadership may have been lost during the sync, e.g. to a replica that took over the expired lease
+		// while the directory was slow, in which case that replica applies the changes
+		if d.Elector != nil && !d.Elector.IsLeader() {
+			d.setStatus(func(status *DaemonStatus) { status.Standby = true })
+			return
+		}
+		if err := sink.Apply(ctx, changes, current); err != nil {
+			d.error(err)
+			applied = false
+		}
+	}
+	if applied {
+		d.last, d.records = current, nil
+		if config.Incremental != "" {
+			d.records = &records
+		}
+	}
+}
+
+// incomplete returns ErrSyncIncomplete, describing why, if the records are Truncated or Partial
+func (sr *LDAPRecords) incomplete() error {
+	switch {
+	case sr.Partial:
+		return fmt.Errorf("%w: the sync was interrupted", ErrSyncIncomplete)
+	case sr.Truncated:
+		baseDNs := make([]string, len(sr.Truncations))
+		for i, truncation := range sr.Truncations {
+			baseDNs[i] = truncation.BaseDN
+		}
+		return fmt.Errorf("%w: the server truncated the results of %s", ErrSyncIncomplete, strings.Join(baseDNs, "; "))
+	}
+	return nil
+}
+
+func (d *Daemon) error(err error) {
+	if d.OnError != nil {
+		d.OnError(err)
+	}
+}
+
+func (d *Daemon) setStatus(update func(*DaemonStatus)) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	update(&d.status)
+}
@@ -0,0 +1,130 @@
+package ldapsync_test
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	ldapsync "github.com/adedayo/ldap-sync/pkg"
+)
+
+// runDaemon runs a daemon of the configuration with the sink until the test ends, returning the channel of its
+// errors
+func runDaemon(t *testing.T, d *ldapsync.Daemon) <-chan error {
+	t.Helper()
+	errs := make(chan error, 10)
+	d.OnError = func(err error) { errs <- err }
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		d.Run(ctx)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+	return errs
+}
+
+func TestDaemonDoesNotApplyTruncatedSyncs(t *testing.T) {
+	_, config := fixture(t)
+	config.SizeLimit = 1
+	applied := make(chan ldapsync.ChangeSet, 10)
+	d := ldapsync.NewDaemon(ldapsync.DaemonConfig{LDAPSyncConfig: config, Interval: ldapsync.Duration(time.Hour)},
+		ldapsync.SinkFunc(func(ctx context.Context, changes ldapsync.ChangeSet, current ldapsync.UsersAndGroups) error {
+			applied <- changes
+			return nil
+		}))
+	errs := runDaemon(t, d)
+	select {
+	case err := <-errs:
+		if !errors.Is(err, ldapsync.ErrSyncIncomplete) {
+			t.Fatalf("error %v, want ErrSyncIncomplete", err)
+		}
+	case changes := <-applied:
+		t.Fatalf("applied %+v of a truncated sync", changes)
+	case <-time.After(10 * time.Second):
+		t.Fatal("no sync")
+	}
+	if ready, status := d.Ready(); ready || status.LastError == "" {
+		t.Errorf("ready %v with status %+v after a truncated sync", ready, status)
+	}
+}
+
+func TestDaemonReappliesChangesASinkFailed(t *testing.T) {
+	_, config := fixture(t)
+	applied := make(chan ldapsync.ChangeSet, 10)
+	fail := true
+	d := ldapsync.NewDaemon(ldapsync.DaemonConfig{LDAPSyncConfig: config, Interval: ldapsync.Duration(time.Hour)},
+		ldapsync.SinkFunc(func(ctx context.Context, changes ldapsync.ChangeSet, current ldapsync.UsersAndGroups) error {
+			applied <- changes
+			if fail {
+				fail = false
+				return errors.New("sink unavailable")
+			}
+			return nil
+		}))
+	runDaemon(t, d)
+	for sync := 1; sync <= 3; sync++ {
+		select {
+		case changes := <-applied:
+			if added := len(changes.AddedUsers); sync < 3 && added != 2 || sync == 3 && added != 0 {
+				t.Errorf("sync %d added %d users", sync, added)
+			}
+		case <-time.After(10 * time.Second):
+			t.Fatalf("no sync %d", sync)
+		}
+		d.Resync(false)
+	}
+}
+
+// switchLease is a Lease its holder holds while it is on
+type switchLease struct{ on atomic.Bool }
+
+func (l *switchLease) Acquire(ctx context.Context, holder string, ttl time.Duration) (bool, error) {
+	return l.on.Load(), nil
+}
+
+func (l *switchLease) Release(ctx context.Context, holder string) error { return nil }
+
+func TestDaemonDoesNotApplyChangesAfterLosingTheLeadership(t *testing.T) {
+	_, config := fixture(t)
+	lease := &switchLease{}
+	lease.on.Store(true)
+	elector := &ldapsync.LeaderElector{Lease: lease, TTL: 30 * time.Millisecond}
+	applied := make(chan string, 10)
+	d := ldapsync.NewDaemon(ldapsync.DaemonConfig{LDAPSyncConfig: config, Interval: ldapsync.Duration(time.Hour)},
+		ldapsync.SinkFunc(func(ctx context.Context, changes ldapsync.ChangeSet, current ldapsync.UsersAndGroups) error {
+			applied <- "first"
+			lease.on.Store(false) // another replica takes the lease over while the sink applies the changes
+			for elector.IsLeader() {
+				time.Sleep(time.Millisecond)
+			}
+			return nil
+		}),
+		ldapsync.SinkFunc(func(ctx context.Context, changes ldapsync.ChangeSet, current ldapsync.UsersAndGroups) error {
+			applied <- "second"
+			return nil
+		}))
+	d.Elector = elector
+	runDaemon(t, d)
+	select {
+	case sink := <-applied:
+		if sink != "first" {
+			t.Fatalf("the %s sink applied the changes first", sink)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("no sync")
+	}
+	select {
+	case sink := <-applied:
+		t.Errorf("the %s sink applied the changes after the leadership was lost", sink)
+	case <-time.After(100 * time.Millisecond):
+	}
+	if _, status := d.Ready(); !status.Standby {
+		t.Errorf("status %+v, want a standby", status)
+	}
+}
@@ -0,0 +1,117 @@
+package ldapsync
+
+// ChangeSet is the difference between two syncs: the users, groups, memberships and entities added and removed
+type ChangeSet struct {
+	AddedUsers         []User       `json:",omitempty"`
+	RemovedUsers       []User       `json:",omitempty"`
+	AddedGroups        []Group      `json:",omitempty"`
+	RemovedGroups      []Group      `json:",omitempty"`
+	AddedMemberships   []Membership `json:",omitempty"`
+	RemovedMemberships []Membership `json:",omitempty"`
+	AddedEntities      []Entity     `json:",omitempty"`
+	RemovedEntities    []Entity     `json:",omitempty"`
+}
+
+// IsEmpty determines whether nothing changed
+func (cs ChangeSet) IsEmpty() bool {
+	return len(cs.AddedUsers)+len(cs.RemovedUsers)+len(cs.AddedGroups)+len(cs.RemovedGroups)+
+		len(cs.AddedMemberships)+len(cs.RemovedMemberships)+len(cs.AddedEntities)+len(cs.RemovedEntities) == 0
+}
+
+// Diff returns the changes from the old to the new sync result. Users and groups are matched by DN, memberships by
+// their user and group DNs, taken from the groups' Members if the Memberships are not recorded, and entities by
+// class and DN
+func Diff(old, new UsersAndGroups) (cs ChangeSet) {
+	oldUsers, newUsers := usersByDN(old.Users), usersByDN(new.Users)
+	for _, dn := range sortedKeys(newUsers) {
+		if _, found := oldUsers[dn]; !found {
+			cs.AddedUsers = append(cs.AddedUsers, newUsers[dn])
+		}
+	}
+	for _, dn := range sortedKeys(oldUsers) {
+		if _, found := newUsers[dn]; !found {
+			cs.RemovedUsers = append(cs.RemovedUsers, oldUsers[dn])
+		}
+	}
+
+	oldGroups, newGroups := groupsByDN(old.Groups), groupsByDN(new.Groups)
+	for _, dn := range sortedKeys(newGroups) {
+		if _, found := oldGroups[dn]; !found {
+			cs.AddedGroups = append(cs.AddedGroups, newGroups[dn])
+		}
+	}
+	for _, dn := range sortedKeys(oldGroups) {
+		if _, found := newGroups[dn]; !found {
+			cs.RemovedGroups = append(cs.RemovedGroups, oldGroups[dn])
+		}
+	}
+
+	oldMemberships, newMemberships := membershipsByDNs(old), membershipsByDNs(new)
+	for _, key := range sortedKeys(newMemberships) {
+		if _, found := oldMemberships[key]; !found {
+			cs.AddedMemberships = append(cs.AddedMemberships, newMemberships[key])
+		}
+	}
+	for _, key := range sortedKeys(oldMemberships) {
+		if _, found := newMemberships[key]; !found {
+			cs.RemovedMemberships = append(cs.RemovedMemberships, oldMemberships[key])
+		}
+	}
+
+	oldEntities, newEntities := entitiesByKey(old.Entities), entitiesByKey(new.Entities)
+	for _, key := range sortedKeys(newEntities) {
+		if _, found := oldEntities[key]; !found {
+			cs.AddedEntities = append(cs.AddedEntities, newEntities[key])
+		}
+	}
+	for _, key := range sortedKeys(oldEntities) {
+		if _, found := newEntities[key]; !found {
+			cs.RemovedEntities = append(cs.RemovedEntities, oldEntities[key])
+		}
+	}
+	return
+}
+
+func usersByDN(users []User) map[string]User {
+	byDN := make(map[string]User, len(users))
+	for _, u := range users {
+		byDN[normalizeDN(u.DN)] = u
+	}
+	return byDN
+}
+
+func groupsByDN(groups []Group) map[string]Group {
+	byDN := make(map[string]Group, len(groups))
+	for _, g := range groups {
+		byDN[normalizeDN(g.DN)] = g
+	}
+	return byDN
+}
+
+func membershipsByDNs(ug UsersAndGroups) map[string]Membership {
+	memberships := ug.Memberships
+	if len(memberships) == 0 {
+		for _, g := range ug.Groups {
+			for _, member := range g.Members {
+				memberships = append(memberships, Membership{UserDN: member, GroupDN: g.DN})
+			}
+		}
+	}
+	byDNs := make(map[string]Membership, len(memberships))
+	for _, m := range memberships {
+		byDNs[normalizeDN(m.UserDN)+"\x00"+normalizeDN(m.GroupDN)] = m
+	}
+	return byDNs
+}
+
+func entitiesByKey(entities []Entity) map[string]Entity {
+	byKey := make(map[string]Entity, len(entities))
+	for _, e := range entities {
+		byKey[entityKey(e)] = e
+	}
+	return byKey
+}
+
+func entityKey(e Entity) string {
+	return e.Class + "\x00" + normalizeDN(e.DN)
+}
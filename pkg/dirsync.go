@@ -0,0 +1,59 @@
+package ldapsync
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+// dirSync runs the Active Directory DirSync search from the cookie, nil for the whole content, handing the entries
+// added or modified to the callback a response at a time. Modified entries hold only their changed attributes (and
+// objectGUID). Returns the deletions and the cookie to resume from next time.
+//
+// The search uses the object security flag, so the sync account needs no replication rights, but only gets the
+// objects and attributes it may read
+func (c *conn) dirSync(searchRequest *ldap.SearchRequest, cookie []byte, changed func([]*ldap.Entry) error) (delta SyncDelta, next []byte, err error) {
+	const maxBytes = 1 << 20 // bound on the size of each response, which go-ldap calls the MaxAttrCount
+	control := ldap.NewRequestControlDirSync(ldap.DirSyncObjectSecurity, maxBytes, cookie)
+	searchRequest.Controls = append(searchRequest.Controls, control)
+	delta.ChangedAttributesOnly = len(cookie) > 0
+	next = cookie
+	for {
+		if err = c.ctx.Err(); err != nil {
+			return
+		}
+		var sr *ldap.SearchResult
+		if sr, err = c.Search(searchRequest); err != nil {
+			return
+		}
+		var entries []*ldap.Entry
+		for _, entry := range sr.Entries {
+			if !strings.EqualFold(entry.GetAttributeValue("isDeleted"), "TRUE") {
+				entries = append(entries, entry)
+				continue
+			}
+			// deleted objects are moved to the Deleted Objects container, their objectGUID identifies them
+			if guid := entry.GetRawAttributeValue("objectGUID"); len(guid) > 0 {
+				delta.DeletedUUIDs = append(delta.DeletedUUIDs, fmt.Sprintf("%x", guid))
+			}
+		}
+		if len(entries) > 0 {
+			if err = changed(entries); err != nil {
+				return
+			}
+		}
+		ctrl, _ := ldap.FindControl(sr.Controls, ldap.ControlTypeDirSync).(*ldap.ControlDirSync)
+		if ctrl == nil {
+			return delta, next, errors.New("the server returned no DirSync control")
+		}
+		if len(ctrl.Cookie) > 0 {
+			next = ctrl.Cookie
+			control.Cookie = ctrl.Cookie
+		}
+		if ctrl.Flags == 0 {
+			return // no more changes
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package ldapsync
+
+import (
+	"strings"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+// DNIsUnder checks whether dn is equal to or a descendant of base, comparing attribute types and values
+// case-insensitively. Returns false if either DN can not be parsed
+func DNIsUnder(dn, base string) bool {
+	d, err := ldap.ParseDN(dn)
+	if err != nil {
+		return false
+	}
+	b, err := ldap.ParseDN(base)
+	if err != nil {
+		return false
+	}
+	return d.EqualFold(b) || b.AncestorOfFold(d)
+}
+
+// ParentDN returns the DN of the parent of the entry with the DN, e.g. ou=users,dc=example,dc=com for
+// uid=johnd,ou=users,dc=example,dc=com. The parent of a single-RDN DN is the empty DN
+func ParentDN(dn string) (string, error) {
+	d, err := ldap.ParseDN(dn)
+	if err != nil {
+		return "", err
+	}
+	if len(d.RDNs) == 0 {
+		return "", nil
+	}
+	return (&ldap.DN{RDNs: d.RDNs[1:]}).String(), nil
+}
+
+// RDNs splits the DN into its relative distinguished names, from the entry up to the root, with their
+// special characters escaped, e.g. [cn=Smith\, John ou=users dc=example dc=com]
+func RDNs(dn string) ([]string, error) {
+	d, err := ldap.ParseDN(dn)
+	if err != nil {
+		return nil, err
+	}
+	rdns := make([]string, len(d.RDNs))
+	for i, rdn := range d.RDNs {
+		rdns[i] = rdn.String()
+	}
+	return rdns, nil
+}
+
+// excluded determines whether the DN is at or below one of the configured ExcludeDNs
+func (conf LDAPSyncConfig) excluded(dn string) bool {
+	for _, base := range conf.ExcludeDNs {
+		if DNIsUnder(dn, base) {
+			return true
+		}
+	}
+	return false
+}
+
+// EscapeDNValue escapes the special characters of an attribute value of a DN (RFC 4514), so a user-supplied value
+// such as "smith,ou=admins" stays a single value, e.g. uid=smith\,ou=admins,ou=users,dc=example,dc=com
+func EscapeDNValue(value string) string {
+	return ldap.EscapeDN(value)
+}
+
+// EscapeFilterValue escapes the special characters of an assertion value of a filter (RFC 4515), so a user-supplied
+// value such as "*)(uid=*" can not widen or restructure the filter
+func EscapeFilterValue(value string) string {
+	return ldap.EscapeFilter(value)
+}
+
+// isAttributeDescription determines whether the name is an attribute description (RFC 4512): a name, e.g. uid, or
+// a numeric OID, optionally with options, e.g. cn;lang-es. Names from configuration and requests are checked before
+// being written into DNs and filters
+func isAttributeDescription(name string) bool {
+	parts := strings.Split(name, ";")
+	if !isAttributeType(parts[0]) {
+		return false
+	}
+	for _, option := range parts[1:] {
+		if option == "" || strings.IndexFunc(option, func(r rune) bool { return !isKeyChar(r) }) >= 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// isAttributeType determines whether the name is a descriptor (a letter followed by letters, digits and hyphens)
+// or a numeric OID
+func isAttributeType(name string) bool {
+	if name == "" {
+		return false
+	}
+	if name[0] >= '0' && name[0] <= '9' {
+		for _, arc := range strings.Split(name, ".") {
+			if arc == "" || strings.Trim(arc, "0123456789") != "" || (len(arc) > 1 && arc[0] == '0') {
+				return false
+			}
+		}
+		return true
+	}
+	return isLetter(rune(name[0])) && strings.IndexFunc(name, func(r rune) bool { return !isKeyChar(r) }) < 0
+}
+
+func isLetter(r rune) bool {
+	return (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z')
+}
+
+func isKeyChar(r rune) bool {
+	return isLetter(r) || (r >= '0' && r <= '9') || r == '-'
+}
+
+// sanitiseDN re-escapes the attribute values of the DN, leaving the attribute types and the structure of the DN
+// as they are, so equivalent DNs are written alike and values are escaped consistently. DNs that can not be parsed
+// are returned as they are, for validation to report
+func sanitiseDN(dn string) string {
+	d, err := ldap.ParseDN(dn)
+	if err != nil {
+		return dn
+	}
+	rdns := make([]string, len(d.RDNs))
+	for i, rdn := range d.RDNs {
+		atvs := make([]string, len(rdn.Attributes))
+		for j, atv := range rdn.Attributes {
+			atvs[j] = atv.Type + "=" + EscapeDNValue(atv.Value)
+		}
+		rdns[i] = strings.Join(atvs, "+")
+	}
+	return strings.Join(rdns, ",")
+}
@@ -0,0 +1,94 @@
+package ldapsync
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestDNIsUnder(t *testing.T) {
+	const base = "ou=People,dc=Example,dc=com"
+	for dn, under := range map[string]bool{
+		"ou=people,dc=example,dc=com":                     true, // the base itself
+		"uid=alice,OU=PEOPLE,DC=EXAMPLE,DC=COM":           true,
+		"not a DN":                                        false,
+		"uid=bob,ou=disabled,ou=people,dc=example,dc=com": true,
+		"uid=carol,ou=other,dc=example,dc=com":            false,
+		"dc=example,dc=com":                               false, // an ancestor
+		"uid=dave,ou=people2,dc=example,dc=com":           false,
+		"uid=eve\\,ou=people,dc=example,dc=com":           false, // a value with an escaped comma
+	} {
+		if DNIsUnder(dn, base) != under {
+			t.Errorf("%s is under %s: %v, want %v", dn, base, !under, under)
+		}
+	}
+}
+
+func TestParentDN(t *testing.T) {
+	for dn, want := range map[string]string{
+		"uid=alice,ou=people,dc=example,dc=com": "ou=people,dc=example,dc=com",
+		"cn=Smith\\, John,ou=people,dc=com":     "ou=people,dc=com",
+		"dc=com":                                "",
+		"":                                      "",
+	} {
+		if parent, err := ParentDN(dn); err != nil || parent != want {
+			t.Errorf("parent of %q: %q, error %v, want %q", dn, parent, err, want)
+		}
+	}
+	if _, err := ParentDN("not a DN"); err == nil {
+		t.Error("found the parent of an invalid DN")
+	}
+}
+
+func TestRDNs(t *testing.T) {
+	rdns, err := RDNs("cn=Smith\\, John+uid=jsmith,ou=users,dc=example,dc=com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprint(rdns); got != `[cn=Smith\, John+uid=jsmith ou=users dc=example dc=com]` {
+		t.Errorf("RDNs %s", got)
+	}
+}
+
+func TestEscapeValues(t *testing.T) {
+	dn := "uid=" + EscapeDNValue("smith,ou=admins") + ",ou=users,dc=example,dc=com"
+	if !DNIsUnder(dn, "ou=users,dc=example,dc=com") || DNIsUnder(dn, "ou=admins,ou=users,dc=example,dc=com") {
+		t.Errorf("%s: the escaped value is not a single one", dn)
+	}
+	if filter := "(uid=" + EscapeFilterValue("*)(uid=*") + ")"; filter != `(uid=\2a\29\28uid=\2a)` {
+		t.Errorf("filter %s", filter)
+	}
+}
+
+func TestIsAttributeDescription(t *testing.T) {
+	for name, valid := range map[string]bool{
+		"uid":                  true,
+		"cn;lang-es":           true,
+		"2.5.4.3":              true,
+		"sAMAccountName":       true,
+		"":                     false,
+		"1uid":                 false,
+		"2.5..3":               false,
+		"2.05.4":               false,
+		"cn;":                  false,
+		"uid=*)(objectClass=*": false,
+		"cn;lang_es":           false,
+		"user name":            false,
+	} {
+		if isAttributeDescription(name) != valid {
+			t.Errorf("%q is an attribute description: %v, want %v", name, !valid, valid)
+		}
+	}
+}
+
+func TestSanitiseDN(t *testing.T) {
+	for dn, want := range map[string]string{
+		"uid=alice,ou=people,dc=example,dc=com":        "uid=alice,ou=people,dc=example,dc=com",
+		`cn=Smith\2C John,ou=people,dc=example,dc=com`: `cn=Smith\, John,ou=people,dc=example,dc=com`,
+		"cn=a+sn=b,dc=com":                             "cn=a+sn=b,dc=com",
+		"alice@example.com":                            "alice@example.com", // not a DN, left as it is
+	} {
+		if got := sanitiseDN(dn); got != want {
+			t.Errorf("sanitised %s: %s, want %s", dn, got, want)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package ldapsync
+
+import "sort"
+
+// EntityClass configures a type of entity synced besides users and groups, e.g. service accounts, computers or
+// devices. Entries are classified into the first entity class whose Filter they match, independently of the
+// UserFilter and GroupFilter, which may have to exclude them, e.g. computers, which are users on Active Directory
+type EntityClass struct {
+	Name        string     `json:"name"` // e.g. computer
+	Filter      LDAPFilter `json:"filter"`
+	IDAttribute string     `json:"idAttribute"` // attribute holding the entity's ID e.g. cn, defaults to the value of the first RDN
+}
+
+// Entity is an entry of an EntityClass
+type Entity struct {
+	Class   string
+	ID      string
+	DN      string
+	Sources []Provenance `json:",omitempty"` // where the entity was synced from
+}
+
+// GetEntities returns the entries of the entity class with the name, see EntityClass
+func (sr *LDAPRecords) GetEntities(class string) []*LDAPEntry {
+	return sr.classify()[class]
+}
+
+// classify classifies the entries into the entity classes, once
+func (sr *LDAPRecords) classify() map[string][]*LDAPEntry {
+	views := sr.memo()
+	views.entitiesOnce.Do(func() {
+		entities := make(map[string][]*LDAPEntry)
+		classes := sr.config.EntityClasses
+		for _, e := range sr.Entries {
+			for i := range classes {
+				if classes[i].Filter.matches(e, sr.comparator()) {
+					entities[classes[i].Name] = append(entities[classes[i].Name], e)
+					break
+				}
+			}
+		}
+		for class, ents := range entities {
+			entities[class] = dedupeEntries(ents)
+		}
+		views.entities = entities
+	})
+	return views.entities
+}
+
+// getEntities returns the entities of all the entity classes, ordered by class, as configured, and then by DN
+func (sr *LDAPRecords) getEntities() (entities []Entity) {
+	for _, class := range sr.config.EntityClasses {
+		start := len(entities)
+		for _, e := range sr.GetEntities(class.Name) {
+			entities = append(entities, Entity{Class: class.Name, ID: entryID(e, class.IDAttribute), DN: e.DN, Sources: e.sources()})
+		}
+		ofClass := entities[start:]
+		sort.SliceStable(ofClass, func(i, j int) bool { return ofClass[i].DN < ofClass[j].DN })
+	}
+	return
+}
+
+// entityAttributes returns the attributes needed to classify and identify entities
+func (conf LDAPSyncConfig) entityAttributes() (names []string) {
+	for _, class := range conf.EntityClasses {
+		names = append(names, class.Filter.attributes()...)
+		if class.IDAttribute != "" {
+			names = append(names, class.IDAttribute)
+		}
+	}
+	return
+}
@@ -0,0 +1,124 @@
+package ldapsync
+
+import (
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+// ErrUserNotFound is returned when a user looked up by DN or ID does not exist or is not a user
+var ErrUserNotFound = errors.New("user not found")
+
+// The OperationErrors match these with errors.Is by the failure, so callers can tell a server that can not be
+// reached from one rejecting the sync user or failing a search
+var (
+	ErrConnect      = errors.New("connection failed")    // the server could not be reached, or the connection was lost
+	ErrTLSHandshake = errors.New("TLS handshake failed") // of TLS or StartTLS
+	ErrBindFailed   = errors.New("bind failed")          // the server rejected the bind, e.g. the sync user's credentials
+	ErrSearchFailed = errors.New("search failed")        // the server failed a search, e.g. of a missing BaseDN
+)
+
+// OperationError is an error of an operation against a directory server, identifying the server, the operation
+// (dial, tls handshake, starttls, bind, search, read RootDSE, read schema) and, for searches, the BaseDN and page
+type OperationError struct {
+	Op     string
+	Server string // host:port
+	BaseDN string // for searches
+	Page   int    // the 1-based page of a search, zero if not paged or not applicable
+	// the LDAP result code the server failed the operation with, e.g. 49 for invalid credentials or 32 for a missing
+	// BaseDN, zero if none
+	ResultCode uint16
+	MatchedDN  string // the DN of the closest existing ancestor of the entry the server reported missing, if any
+	Err        error
+}
+
+func (e *OperationError) Error() string {
+	op := e.Op
+	if e.Page > 0 {
+		op = fmt.Sprintf("%s page %d", op, e.Page)
+	}
+	if e.BaseDN != "" {
+		op = fmt.Sprintf("%s of %s", op, e.BaseDN)
+	}
+	return fmt.Sprintf("ldap %s on %s: %v", op, e.Server, e.Err)
+}
+
+func (e *OperationError) Unwrap() error {
+	return e.Err
+}
+
+// searchOps are the operations ErrSearchFailed matches
+var searchOps = map[string]bool{"search": true, "read": true, "referral": true, "read RootDSE": true,
+	"read schema": true, IncrementalSyncRepl: true, IncrementalDirSync: true}
+
+// Is matches the operation's failure: ErrTLSHandshake by the operation, ErrConnect if the server could not be
+// reached or the connection was lost otherwise, and ErrBindFailed or ErrSearchFailed by the operation
+func (e *OperationError) Is(target error) bool {
+	handshake := e.Op == "tls handshake" || e.Op == "starttls"
+	connection := !handshake && isConnectionFailure(e.Err)
+	switch target {
+	case ErrConnect:
+		return e.Op == "dial" || connection
+	case ErrTLSHandshake:
+		return handshake
+	case ErrBindFailed:
+		return e.Op == "bind" && !connection
+	case ErrSearchFailed:
+		return searchOps[e.Op] && !connection
+	}
+	return false
+}
+
+// isConnectionFailure determines whether the error is a failure to reach the server, or the loss of the connection
+func isConnectionFailure(err error) bool {
+	var ldapErr *ldap.Error
+	if errors.As(err, &ldapErr) {
+		return isResultCode(err, ldap.ErrorNetwork, ldap.LDAPResultServerDown, ldap.LDAPResultConnectError)
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// opError wraps the error with the operation context, unless it is nil or already wrapped
+func opError(op, server string, err error) error {
+	return searchError(op, server, "", 0, err)
+}
+
+func searchError(op, server, baseDN string, page int, err error) error {
+	var opErr *OperationError
+	if err == nil || errors.As(err, &opErr) {
+		return err
+	}
+	opErr = &OperationError{Op: op, Server: server, BaseDN: baseDN, Page: page, Err: err}
+	var ldapErr *ldap.Error
+	if opErr.ResultCode = resultCode(err); opErr.ResultCode != 0 && errors.As(err, &ldapErr) {
+		opErr.MatchedDN = ldapErr.MatchedDN
+	}
+	return opErr
+}
+
+// resultCode returns the LDAP result code the server failed with, if the error is, or wraps, an LDAP error, zero
+// otherwise
+func resultCode(err error) uint16 {
+	var ldapErr *ldap.Error
+	if !errors.As(err, &ldapErr) || ldapErr.ResultCode == ldap.ErrorNetwork {
+		return 0
+	}
+	return ldapErr.ResultCode
+}
+
+// isResultCode determines whether the error is, or wraps, an LDAP error with one of the result codes
+func isResultCode(err error, codes ...uint16) bool {
+	var ldapErr *ldap.Error
+	if !errors.As(err, &ldapErr) {
+		return false
+	}
+	for _, code := range codes {
+		if ldapErr.ResultCode == code {
+			return true
+		}
+	}
+	return false
+}
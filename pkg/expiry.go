@@ -0,0 +1,92 @@
+package ldapsync
+
+import (
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+// the password expiry of Active Directory accounts whose password never expires
+const neverExpires = math.MaxInt64
+
+// PasswordExpiresIn returns the time until the password expires, if known: negative if it has expired
+func (auth AuthResult) PasswordExpiresIn() (time.Duration, bool) {
+	if auth.PasswordExpiry == nil {
+		return 0, false
+	}
+	return time.Until(*auth.PasswordExpiry), true
+}
+
+// applyPasswordPolicy records the expiry and grace logins of a password policy response control (draft-behera-ldap-password-policy)
+func (auth *AuthResult) applyPasswordPolicy(controls []ldap.Control) {
+	policy, ok := ldap.FindControl(controls, ldap.ControlTypeBeheraPasswordPolicy).(*ldap.ControlBeheraPasswordPolicy)
+	if !ok {
+		return
+	}
+	if policy.Expire >= 0 && policy.Error < 0 {
+		expiry := time.Now().Add(time.Duration(policy.Expire) * time.Second)
+		auth.PasswordExpiry = &expiry
+	}
+	if policy.Grace >= 0 {
+		auth.GraceLogins = int(policy.Grace)
+		if auth.PasswordExpiry == nil {
+			expired := time.Now()
+			auth.PasswordExpiry = &expired // logging in on grace, the password has expired
+		}
+	}
+}
+
+// readPasswordExpiry reads when the Active Directory user's password expires: msDS-UserPasswordExpiryTimeComputed
+// if the server computes it, otherwise pwdLastSet plus the domain's maxPwdAge. Returns nil if the password never
+// expires or its expiry can not be determined
+func readPasswordExpiry(l *conn, userDN string) *time.Time {
+	user, err := readEntry(l, userDN, []string{"msDS-UserPasswordExpiryTimeComputed", "pwdLastSet"})
+	if err != nil {
+		return nil
+	}
+	if _, computed := user.GetAttribute("msDS-UserPasswordExpiryTimeComputed"); len(computed) > 0 {
+		return fileTime(computed[0])
+	}
+	_, lastSet := user.GetAttribute("pwdLastSet")
+	if len(lastSet) == 0 {
+		return nil
+	}
+	set := fileTime(lastSet[0])
+	if set == nil {
+		return nil // never set, the user must change it at next logon
+	}
+	dse, err := readRootDSE(l)
+	if err != nil || dse.DefaultNamingContext == "" {
+		return nil
+	}
+	domain, err := readEntry(l, dse.DefaultNamingContext, []string{"maxPwdAge"})
+	if err != nil {
+		return nil
+	}
+	_, maxAge := domain.GetAttribute("maxPwdAge")
+	if len(maxAge) == 0 {
+		return nil
+	}
+	age, err := strconv.ParseInt(maxAge[0], 10, 64)
+	if err != nil || age == 0 || age == math.MinInt64 {
+		return nil // passwords do not expire in the domain
+	}
+	if age < 0 {
+		age = -age // stored as a negative interval
+	}
+	expiry := set.Add(time.Duration(age) * 100 * time.Nanosecond)
+	return &expiry
+}
+
+// fileTime converts a Windows FILETIME (100ns intervals since 1601-01-01 UTC), returning nil for zero or never
+func fileTime(value string) *time.Time {
+	ft, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || ft <= 0 || ft == neverExpires {
+		return nil
+	}
+	const epochDelta = 116444736000000000 // 100ns intervals between 1601-01-01 and 1970-01-01
+	t := time.Unix(0, 0).UTC().Add(time.Duration(ft-epochDelta) * 100)
+	return &t
+}
@@ -0,0 +1,146 @@
+package ldapsync
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"sort"
+	"time"
+)
+
+// WriteCasbinPolicy writes the group memberships and roles of users as Casbin RBAC grouping policy lines
+// (g, user, group and g, user, role), ready for use with the Casbin file adapter
+func WriteCasbinPolicy(w io.Writer, ug UsersAndGroups) error {
+	ids := userIDs(ug)
+	cw := csv.NewWriter(w)
+	for _, g := range ug.Groups {
+		for _, m := range g.Members {
+			if id, exists := ids[normalizeDN(m)]; exists {
+				if err := cw.Write([]string{"g", id, g.ID}); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	for _, user := range sortedKeys(ug.Roles) {
+		for _, role := range ug.Roles[user] {
+			if err := cw.Write([]string{"g", user, role}); err != nil {
+				return err
+			}
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// OPAData is the directory state as Open Policy Agent data, e.g. data.ldap.users["johnd"].roles
+type OPAData struct {
+	Users  map[string]OPAUser  `json:"users"`  // by user ID
+	Groups map[string]OPAGroup `json:"groups"` // by group ID
+}
+
+type OPAUser struct {
+	DN     string   `json:"dn"`
+	Groups []string `json:"groups"` // group IDs
+	Roles  []string `json:"roles"`
+}
+
+type OPAGroup struct {
+	DN      string   `json:"dn"`
+	Members []string `json:"members"` // user IDs
+}
+
+// ToOPAData converts users, groups and roles into Open Policy Agent data
+func ToOPAData(ug UsersAndGroups) OPAData {
+	ids := userIDs(ug)
+	data := OPAData{
+		Users:  make(map[string]OPAUser, len(ug.Users)),
+		Groups: make(map[string]OPAGroup, len(ug.Groups)),
+	}
+	for _, u := range ug.Users {
+		data.Users[u.ID] = OPAUser{DN: u.DN, Groups: []string{}, Roles: append([]string{}, ug.Roles[u.ID]...)}
+	}
+	for _, g := range ug.Groups {
+		og := OPAGroup{DN: g.DN, Members: []string{}}
+		for _, m := range g.Members {
+			if id, exists := ids[normalizeDN(m)]; exists {
+				og.Members = append(og.Members, id)
+				u := data.Users[id]
+				u.Groups = append(u.Groups, g.ID)
+				data.Users[id] = u
+			}
+		}
+		data.Groups[g.ID] = og
+	}
+	return data
+}
+
+// WriteOPAData writes the users, groups and roles as an Open Policy Agent data.json document
+func WriteOPAData(w io.Writer, ug UsersAndGroups) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(ToOPAData(ug))
+}
+
+// WriteOPABundle writes a gzipped tarball Open Policy Agent bundle holding the users, groups and roles as data
+// under the root path (e.g. "ldap" for data.ldap), and a manifest with the revision
+func WriteOPABundle(w io.Writer, ug UsersAndGroups, root, revision string) error {
+	var data interface{} = ToOPAData(ug)
+	if root != "" {
+		data = map[string]interface{}{root: data}
+	}
+	dataJSON, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	manifest := map[string]interface{}{"revision": revision}
+	if root != "" {
+		manifest["roots"] = []string{root}
+	}
+	manifestJSON, err := json.Marshal(manifest)
+	if err != nil {
+		return err
+	}
+
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	now := time.Now()
+	for _, file := range []struct {
+		name string
+		body []byte
+	}{{"/data.json", dataJSON}, {"/.manifest", manifestJSON}} {
+		if err := tw.WriteHeader(&tar.Header{Name: file.name, Mode: 0644, Size: int64(len(file.body)), ModTime: now}); err != nil {
+			return err
+		}
+		if _, err := tw.Write(file.body); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// userIDs returns the user IDs by normalised user DN
+func userIDs(ug UsersAndGroups) map[string]string {
+	ids := make(map[string]string, len(ug.Users))
+	for _, u := range ug.Users {
+		ids[normalizeDN(u.DN)] = u.ID
+		for _, dn := range u.AlternateDNs {
+			ids[normalizeDN(dn)] = u.ID
+		}
+	}
+	return ids
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
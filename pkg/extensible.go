@@ -0,0 +1,124 @@
+package ldapsync
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+// Active Directory matching rules for extensible match filter expressions, e.g. userAccountControl:1.2.840.113556.1.4.803:
+const (
+	MatchingRuleBitAnd  = "1.2.840.113556.1.4.803"  // all the bits of the value are set
+	MatchingRuleBitOr   = "1.2.840.113556.1.4.804"  // any of the bits of the value is set
+	MatchingRuleInChain = "1.2.840.113556.1.4.1941" // transitive DN match, evaluated client-side on the direct values only
+)
+
+// extensibleMatch is an RFC 4515 extensible match assertion, written as the Name of a FilterExpression:
+// attr:dn:rule, attr:rule, attr:dn, :dn:rule or :rule, with an optional trailing colon
+type extensibleMatch struct {
+	attribute    string // empty to match any attribute
+	dnAttributes bool   // also match the attributes of the entry's DN
+	rule         string // OID or name of the matching rule, empty to match the Value as a regular expression
+}
+
+// parseExtensibleMatch parses the name of a filter expression, returning false if it is a plain attribute name
+func parseExtensibleMatch(name string) (m extensibleMatch, ok bool) {
+	if !strings.Contains(name, ":") {
+		return
+	}
+	parts := strings.Split(strings.TrimSuffix(name, ":"), ":")
+	m.attribute = parts[0]
+	for _, part := range parts[1:] {
+		switch {
+		case strings.EqualFold(part, "dn") && !m.dnAttributes && m.rule == "":
+			m.dnAttributes = true
+		case part != "" && m.rule == "":
+			m.rule = part
+		default:
+			return m, false
+		}
+	}
+	return m, m.attribute != "" || m.rule != ""
+}
+
+// attributeName returns the attribute of the filter expression, which may be an extensible match
+func attributeName(name string) string {
+	if m, ok := parseExtensibleMatch(name); ok {
+		return m.attribute
+	}
+	return name
+}
+
+// matchesExtensible evaluates the extensible match expression against the values of the entry's attribute (any
+// attribute if none is named) and, for :dn: assertions, the values of its DN. Without a matching rule the Value is a
+// regular expression, as for plain expressions, otherwise it is the assertion value of the rule
+func (ent *LDAPEntry) matchesExtensible(ff *FilterExpression, cmp comparator) bool {
+	m := ff.extensible
+	match := func(attribute, value string) bool {
+		if m.rule == "" {
+			re := ff.pattern(attribute, cmp)
+			return re != nil && re.MatchString(cmp.prepare(value))
+		}
+		return cmp.matchesRule(m.rule, attribute, value, ff.Value)
+	}
+
+	for _, att := range ent.Attributes {
+		if m.attribute != "" && !strings.EqualFold(att.Name, m.attribute) {
+			continue
+		}
+		for _, v := range att.StringValues() {
+			if match(att.Name, v) {
+				return true
+			}
+		}
+	}
+	if m.dnAttributes {
+		if dn, err := ldap.ParseDN(ent.DN); err == nil {
+			for _, rdn := range dn.RDNs {
+				for _, atv := range rdn.Attributes {
+					if (m.attribute == "" || strings.EqualFold(atv.Type, m.attribute)) && match(atv.Type, atv.Value) {
+						return true
+					}
+				}
+			}
+		}
+	}
+	return false
+}
+
+// matchesRule evaluates the assertion value against the attribute value with the matching rule (OID or name).
+// Unknown rules match nothing, as their result is undefined
+func (cmp comparator) matchesRule(rule, attribute, value, assertion string) bool {
+	switch rule {
+	case MatchingRuleBitAnd, MatchingRuleBitOr:
+		v, err := parseBits(value)
+		if err != nil {
+			return false
+		}
+		a, err := parseBits(assertion)
+		if err != nil {
+			return false
+		}
+		if rule == MatchingRuleBitAnd {
+			return v&a == a
+		}
+		return v&a != 0
+	case MatchingRuleInChain:
+		return cmp.normalize(DistinguishedNameMatch, value) == cmp.normalize(DistinguishedNameMatch, assertion)
+	}
+	if r, known := equalityRules[strings.ToLower(rule)]; known {
+		if r == ExactMatch && cmp.prep.CaseFold {
+			r = CaseIgnoreMatch
+		}
+		return cmp.normalize(r, value) == cmp.normalize(r, assertion)
+	}
+	return false
+}
+
+// parseBits parses a decimal integer as a bit field, including the negative values of signed 32-bit attributes such
+// as groupType
+func parseBits(s string) (uint64, error) {
+	i, err := strconv.ParseInt(strings.TrimSpace(s), 10, 64)
+	return uint64(i), err
+}
@@ -0,0 +1,48 @@
+package ldapsync
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"sync"
+)
+
+// replicas returns the configurations of the Server and the other Servers, in the order connections try them: the
+// Server first, or with RoundRobin, the next server along for each connection
+func (conf LDAPSyncConfig) replicas() []LDAPSyncConfig {
+	replicas := []LDAPSyncConfig{conf}
+	for _, server := range conf.Servers {
+		replica := conf
+		if host, port, err := net.SplitHostPort(server); err == nil {
+			replica.Server, replica.Port = host, &port
+		} else {
+			replica.Server = server
+		}
+		replicas = append(replicas, replica)
+	}
+	if conf.RoundRobin && len(replicas) > 1 {
+		start := nextReplica(conf.GetDialAddr()+","+strings.Join(conf.Servers, ",")) % len(replicas)
+		replicas = append(replicas[start:], replicas[:start]...)
+	}
+	return replicas
+}
+
+var roundRobin = struct {
+	sync.Mutex
+	next map[string]int
+}{next: make(map[string]int)}
+
+// nextReplica returns the count of the connections to the servers so far, shared by all syncs and authentications
+// in the process
+func nextReplica(servers string) int {
+	roundRobin.Lock()
+	defer roundRobin.Unlock()
+	n := roundRobin.next[servers]
+	roundRobin.next[servers] = n + 1
+	return n
+}
+
+// isFailover determines whether a connection failed for its server, so another server may be tried
+func isFailover(err error) bool {
+	return isServerFailure(err) || errors.Is(err, ErrCircuitOpen)
+}
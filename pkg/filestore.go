@@ -0,0 +1,161 @@
+package ldapsync
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// sweepInterval is the interval at which a FileStore removes expired cache files, which are otherwise only removed
+// when read
+const sweepInterval = time.Hour
+
+// FileStore is an on-disk StateStore and Cache, keeping each value in its own file under a directory, so that
+// checkpoints and cached results survive restarts without external dependencies. Writes are atomic (write to a
+// temporary file, then rename), so a FileStore may be shared by processes on the same host. Cached values expire
+// when read, and are swept hourly by Set, so entries that are never read again do not accumulate
+type FileStore struct {
+	dir string
+
+	mu    sync.Mutex
+	swept time.Time // of the last sweep
+}
+
+// NewFileStore returns a store in the directory, creating it if needed
+func NewFileStore(dir string) (*FileStore, error) {
+	for _, sub := range []string{"state", "cache"} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0700); err != nil {
+			return nil, err
+		}
+	}
+	return &FileStore{dir: dir}, nil
+}
+
+// path returns the file of the key in the area (state or cache); keys are hashed as they may hold any character
+func (s *FileStore) path(area, key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(s.dir, area, hex.EncodeToString(sum[:]))
+}
+
+func (s *FileStore) Load(key string) ([]byte, bool, error) {
+	return readFile(s.path("state", key))
+}
+
+func (s *FileStore) Save(key string, value []byte) error {
+	return writeFileAtomic(s.path("state", key), value)
+}
+
+func (s *FileStore) Delete(key string) error {
+	err := os.Remove(s.path("state", key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// Get returns the cached value, unless it is missing or has expired. Cached values are prefixed with their expiry
+func (s *FileStore) Get(key string) ([]byte, bool, error) {
+	path := s.path("cache", key)
+	data, found, err := readFile(path)
+	if err != nil || !found {
+		return nil, false, err
+	}
+	if len(data) < 8 || time.Now().UnixNano() > int64(binary.BigEndian.Uint64(data)) {
+		os.Remove(path) // expired or corrupt
+		return nil, false, nil
+	}
+	return data[8:], true, nil
+}
+
+func (s *FileStore) Set(key string, value []byte, ttl time.Duration) error {
+	data := make([]byte, 8+len(value))
+	binary.BigEndian.PutUint64(data, uint64(time.Now().Add(ttl).UnixNano()))
+	copy(data[8:], value)
+	if err := writeFileAtomic(s.path("cache", key), data); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if time.Since(s.swept) >= sweepInterval {
+		s.swept = time.Now()
+		go s.Sweep()
+	}
+	return nil
+}
+
+// Sweep removes the expired or corrupt cache files, and temporary files left over by interrupted writes
+func (s *FileStore) Sweep() error {
+	dir := filepath.Join(s.dir, "cache")
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	for _, file := range files {
+		path := filepath.Join(dir, file.Name())
+		if strings.HasPrefix(file.Name(), ".tmp-") {
+			if info, err := file.Info(); err == nil && now.Sub(info.ModTime()) > sweepInterval {
+				os.Remove(path)
+			}
+			continue
+		}
+		if cacheFileExpired(path, now) {
+			os.Remove(path)
+		}
+	}
+	return nil
+}
+
+// cacheFileExpired determines whether the cache file has expired or is corrupt, reading just its expiry
+func cacheFileExpired(path string, now time.Time) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return false // removed since, or not ours to remove
+	}
+	defer f.Close()
+	var expiry [8]byte
+	if _, err = io.ReadFull(f, expiry[:]); err != nil {
+		return true
+	}
+	return now.UnixNano() > int64(binary.BigEndian.Uint64(expiry[:]))
+}
+
+func readFile(path string) ([]byte, bool, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return data, true, nil
+}
+
+// writeFileAtomic writes the file via a temporary file in the same directory, renamed over the file once written
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // no-op once renamed
+	if _, err = tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
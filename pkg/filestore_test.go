@@ -0,0 +1,42 @@
+package ldapsync_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	ldapsync "github.com/adedayo/ldap-sync/pkg"
+)
+
+func TestFileStoreSweepsExpiredCacheFiles(t *testing.T) {
+	dir := t.TempDir()
+	store, err := ldapsync.NewFileStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = store.Save("checkpoint", []byte("cookie")); err != nil {
+		t.Fatal(err)
+	}
+	for key, ttl := range map[string]time.Duration{"live": time.Hour, "expired": -time.Second} {
+		if err = store.Set(key, []byte(key), ttl); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = os.WriteFile(filepath.Join(dir, "cache", "corrupt"), []byte("short"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err = store.Sweep(); err != nil {
+		t.Fatal(err)
+	}
+
+	if files, _ := os.ReadDir(filepath.Join(dir, "cache")); len(files) != 1 {
+		t.Errorf("%d cache files after the sweep, want that of the live entry", len(files))
+	}
+	if value, found, err := store.Get("live"); err != nil || !found || string(value) != "live" {
+		t.Errorf("got %q, found %v, error %v of the live entry", value, found, err)
+	}
+	if value, found, err := store.Load("checkpoint"); err != nil || !found || string(value) != "cookie" {
+		t.Errorf("loaded %q, found %v, error %v of the state the sweep should keep", value, found, err)
+	}
+}
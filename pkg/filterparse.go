@@ -0,0 +1,256 @@
+package ldapsync
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"regexp/syntax"
+	"strings"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	"github.com/go-ldap/ldap/v3"
+)
+
+// ParseLDAPFilter converts an RFC 4515 filter string, e.g. (&(objectClass=user)(userAccountControl:1.2.840.113556.1.4.803:=2)),
+// into an LDAPFilter. Equality, approximate, substring and presence assertions become regular expressions, and
+// extensible match assertions keep their syntax. Negation and ordering assertions are not supported by LDAPFilter
+func ParseLDAPFilter(filter string) (lf LDAPFilter, err error) {
+	packet, err := ldap.CompileFilter(filter)
+	if err != nil {
+		return
+	}
+	switch packet.Tag {
+	case ldap.FilterAnd, ldap.FilterOr:
+		return parseFilterSet(packet)
+	default:
+		expr, err := parseFilterExpression(packet)
+		if err != nil {
+			return lf, err
+		}
+		return LDAPFilter{Operator: And, Filters: []FilterExpression{expr}}, nil
+	}
+}
+
+func parseFilterSet(packet *ber.Packet) (lf LDAPFilter, err error) {
+	lf.Operator = And
+	if packet.Tag == ldap.FilterOr {
+		lf.Operator = Or
+	}
+	for _, child := range packet.Children {
+		switch child.Tag {
+		case ldap.FilterAnd, ldap.FilterOr:
+			group, err := parseFilterSet(child)
+			if err != nil {
+				return lf, err
+			}
+			lf.FilterGroups = append(lf.FilterGroups, group)
+		default:
+			expr, err := parseFilterExpression(child)
+			if err != nil {
+				return lf, err
+			}
+			lf.Filters = append(lf.Filters, expr)
+		}
+	}
+	return
+}
+
+func parseFilterExpression(packet *ber.Packet) (expr FilterExpression, err error) {
+	switch packet.Tag {
+	case ldap.FilterEqualityMatch, ldap.FilterApproxMatch:
+		expr.Name = ber.DecodeString(packet.Children[0].Data.Bytes())
+		expr.Value = exactly(ber.DecodeString(packet.Children[1].Data.Bytes()))
+	case ldap.FilterPresent:
+		expr.Name = ber.DecodeString(packet.Data.Bytes())
+		expr.Value = "" // matches any value
+	case ldap.FilterSubstrings:
+		expr.Name = ber.DecodeString(packet.Children[0].Data.Bytes())
+		var re strings.Builder
+		re.WriteString("^")
+		for _, child := range packet.Children[1].Children {
+			if child.Tag != ldap.FilterSubstringsInitial && !strings.HasSuffix(re.String(), ".*") {
+				re.WriteString(".*")
+			}
+			re.WriteString(regexp.QuoteMeta(ber.DecodeString(child.Data.Bytes())))
+			if child.Tag != ldap.FilterSubstringsFinal {
+				re.WriteString(".*")
+			}
+		}
+		re.WriteString("$")
+		expr.Value = re.String()
+	case ldap.FilterExtensibleMatch:
+		var m extensibleMatch
+		var value string
+		for _, child := range packet.Children {
+			switch child.Tag {
+			case ldap.MatchingRuleAssertionMatchingRule:
+				m.rule = ber.DecodeString(child.Data.Bytes())
+			case ldap.MatchingRuleAssertionType:
+				m.attribute = ber.DecodeString(child.Data.Bytes())
+			case ldap.MatchingRuleAssertionMatchValue:
+				value = ber.DecodeString(child.Data.Bytes())
+			case ldap.MatchingRuleAssertionDNAttributes:
+				m.dnAttributes, _ = child.Value.(bool)
+			}
+		}
+		expr.Name = m.attribute
+		if m.dnAttributes {
+			expr.Name += ":dn"
+		}
+		if m.rule != "" {
+			expr.Name += ":" + m.rule
+			expr.Value = value
+		} else {
+			expr.Value = exactly(value)
+		}
+		expr.Name += ":"
+	default:
+		filter, _ := ldap.DecompileFilter(packet)
+		err = fmt.Errorf("unsupported filter %s: LDAPFilter supports equality, substring, presence and extensible match "+
+			"assertions combined with & and |", filter)
+	}
+	return
+}
+
+// exactly returns a regular expression matching the value exactly
+func exactly(value string) string {
+	return "^" + regexp.QuoteMeta(value) + "$"
+}
+
+// FormatLDAPFilter converts the filter into an RFC 4515 filter string, the reverse of ParseLDAPFilter. Only the
+// expressions ParseLDAPFilter produces can be converted: values matching any value, or literals, possibly with .*
+// wildcards and a (?i) flag, which LDAP assertions imply
+func FormatLDAPFilter(lf LDAPFilter) (string, error) {
+	return formatLDAPFilter(lf, nil)
+}
+
+// formatLDAPFilter converts the filter as FormatLDAPFilter does. Given the matching rules of the attributes, it only
+// converts the assertions the server evaluates as the filter does: (?i) patterns of attributes compared
+// case-insensitively, and substrings of attributes with a substring matching rule, unlike DNs and integers
+func formatLDAPFilter(lf LDAPFilter, rule func(attribute string) MatchingRule) (string, error) {
+	var parts []string
+	for _, fe := range lf.Filters {
+		part, err := formatFilterExpression(fe, rule)
+		if err != nil {
+			return "", err
+		}
+		parts = append(parts, part)
+	}
+	for _, group := range lf.FilterGroups {
+		part, err := formatLDAPFilter(group, rule)
+		if err != nil {
+			return "", err
+		}
+		parts = append(parts, part)
+	}
+	switch len(parts) {
+	case 0:
+		return "", errors.New("an empty filter matches no entries, which no LDAP filter expresses")
+	case 1:
+		return parts[0], nil
+	}
+	operator := "&"
+	if lf.Operator == Or {
+		operator = "|"
+	}
+	return "(" + operator + strings.Join(parts, "") + ")", nil
+}
+
+// serverFilter returns the search filter of the entries any of the UserFilter, GroupFilter or EntityClasses filters
+// match, so the server sends just those. The filters are still evaluated client-side, so it may match more entries,
+// and it is not found if any filter has no LDAP filter equivalent the server evaluates alike with the matching rules
+// of the schema, e.g. a regular expression, or the DN rewrites of the sync could change what the filters match
+func (conf LDAPSyncConfig) serverFilter(schema *Schema) (filter string, found bool) {
+	if conf.ClientSideFilters || len(conf.DNRewrites) > 0 {
+		return
+	}
+	filters := []LDAPFilter{conf.UserFilter, conf.GroupFilter}
+	for _, class := range conf.EntityClasses {
+		filters = append(filters, class.Filter)
+	}
+	parts := make([]string, len(filters))
+	for i, lf := range filters {
+		part, err := formatLDAPFilter(lf, schema.MatchingRule)
+		if err != nil {
+			return
+		}
+		parts[i] = part
+	}
+	return "(|" + strings.Join(parts, "") + ")", true
+}
+
+func formatFilterExpression(fe FilterExpression, rule func(attribute string) MatchingRule) (string, error) {
+	if strings.EqualFold(fe.Name, "dn") {
+		return "", fmt.Errorf("dn: the DN %s has no LDAP filter equivalent", fe.Value)
+	}
+	if m, ok := parseExtensibleMatch(fe.Name); ok && m.rule != "" {
+		return "(" + strings.TrimSuffix(fe.Name, ":") + ":=" + EscapeFilterValue(fe.Value) + ")", nil
+	}
+	value, caseIgnore, ok := assertionValue(fe.Value)
+	if !ok {
+		return "", fmt.Errorf("%s: the regular expression %s has no LDAP filter equivalent", fe.Name, fe.Value)
+	}
+	if rule != nil {
+		attribute, _, _ := strings.Cut(fe.Name, ":")
+		switch r := rule(attribute); {
+		case caseIgnore && r != CaseIgnoreMatch:
+			return "", fmt.Errorf("%s: the server compares values of the attribute case-sensitively, unlike %s", fe.Name, fe.Value)
+		case value != "*" && strings.Contains(value, "*") && (r == DistinguishedNameMatch || r == IntegerMatch):
+			return "", fmt.Errorf("%s: the attribute has no substring matching rule for %s", fe.Name, fe.Value)
+		}
+	}
+	if strings.HasSuffix(fe.Name, ":") {
+		if value == "*" {
+			return "", fmt.Errorf("%s: an extensible match needs an assertion value", fe.Name)
+		}
+		return "(" + strings.TrimSuffix(fe.Name, ":") + ":=" + value + ")", nil
+	}
+	return "(" + fe.Name + "=" + value + ")", nil
+}
+
+// assertionValue converts a regular expression to the escaped value of an equality, substring or presence
+// assertion, if it is a literal with .* wildcards, where the ends of an unanchored pattern are wildcards too, or
+// matches any value. It also returns whether the pattern is case-insensitive, i.e. has a (?i) flag
+func assertionValue(pattern string) (value string, caseIgnore bool, ok bool) {
+	caseIgnore = strings.HasPrefix(pattern, "(?i)")
+	re, err := syntax.Parse(strings.TrimPrefix(pattern, "(?i)"), syntax.Perl)
+	if err != nil {
+		return
+	}
+	items := []*syntax.Regexp{re}
+	if re.Op == syntax.OpConcat {
+		items = re.Sub
+	}
+	var parts []string
+	wildcard := func() {
+		if len(parts) == 0 || parts[len(parts)-1] != "*" {
+			parts = append(parts, "*")
+		}
+	}
+	if len(items) > 0 && items[0].Op == syntax.OpBeginText {
+		items = items[1:]
+	} else {
+		wildcard()
+	}
+	anchoredEnd := len(items) > 0 && items[len(items)-1].Op == syntax.OpEndText
+	if anchoredEnd {
+		items = items[:len(items)-1]
+	}
+	for _, item := range items {
+		switch {
+		case item.Op == syntax.OpLiteral:
+			parts = append(parts, EscapeFilterValue(string(item.Rune)))
+			caseIgnore = caseIgnore || item.Flags&syntax.FoldCase != 0
+		case item.Op == syntax.OpStar && (item.Sub[0].Op == syntax.OpAnyCharNotNL || item.Sub[0].Op == syntax.OpAnyChar):
+			wildcard()
+		case item.Op == syntax.OpEmptyMatch:
+		default:
+			return "", false, false
+		}
+	}
+	if !anchoredEnd {
+		wildcard()
+	}
+	value = strings.Join(parts, "")
+	return value, caseIgnore, value != ""
+}
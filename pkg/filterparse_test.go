@@ -0,0 +1,98 @@
+package ldapsync
+
+import "testing"
+
+func TestAssertionValue(t *testing.T) {
+	for pattern, want := range map[string]struct {
+		value      string
+		caseIgnore bool
+	}{
+		"":                {"*", false},
+		".*":              {"*", false},
+		"^.*$":            {"*", false},
+		"^alice$":         {"alice", false},
+		"(?i)^Alice$":     {"Alice", true},
+		"^a.*e$":          {"a*e", false},
+		"^ali":            {"ali*", false},
+		"ice$":            {"*ice", false},
+		"lic":             {"*lic*", false},
+		"a.*e":            {"*a*e*", false},
+		".*lic.*":         {"*lic*", false},
+		`^a\.b\*c$`:       {`a.b\2ac`, false},
+		"^(a(?i)lice)$":   {"", false}, // a capture
+		"^al[a-z]ce$":     {"", false},
+		"^alice|^bob$":    {"", false},
+		"^$":              {"", false},
+		"^al(?i:ice)$":    {"alICE", true}, // folded, for the server to compare case-insensitively
+		"unclosed(paren$": {"", false},
+	} {
+		value, caseIgnore, ok := assertionValue(pattern)
+		if value != want.value || caseIgnore != want.caseIgnore || ok != (want.value != "") {
+			t.Errorf("%q: %q, case-insensitive %v, ok %v, want %q, %v", pattern, value, caseIgnore, ok, want.value,
+				want.caseIgnore)
+		}
+	}
+}
+
+func TestServerFilter(t *testing.T) {
+	filter := func(name, value string) LDAPFilter {
+		return LDAPFilter{Operator: And, Filters: []FilterExpression{{Name: name, Value: value}}}
+	}
+	for _, test := range []struct {
+		user, group LDAPFilter
+		want        string // not found if empty
+	}{
+		{filter("objectClass", "^person$"), filter("cn", "(?i)^admins$"), "(|(objectClass=person)(cn=admins))"},
+		{filter("mail", "(?i)example"), filter("objectClass", "group"), "(|(mail=*example*)(objectClass=*group*))"},
+		{filter("employeeNumber", "(?i)^e1$"), filter("cn", "^admins$"), ""}, // compared case-sensitively
+		{filter("objectClass", "^person$"), filter("member", "alice"), ""},   // no substring matching rule
+		{filter("objectClass", "^person$"), filter("member", "^uid=alice,dc=example,dc=com$"),
+			"(|(objectClass=person)(member=uid=alice,dc=example,dc=com))"},
+		{filter("uid", "^a[lz]ice$"), filter("cn", "^admins$"), ""},
+	} {
+		config := LDAPSyncConfig{UserFilter: test.user, GroupFilter: test.group}
+		if got, found := config.serverFilter(nil); got != test.want || found != (test.want != "") {
+			t.Errorf("%+v and %+v: %s, found %v, want %q", test.user.Filters, test.group.Filters, got, found, test.want)
+		}
+	}
+
+	schema := &Schema{AttributeTypes: map[string]*AttributeType{
+		"employeenumber": {OID: "2.16.840.1.113730.3.1.3", Names: []string{"employeeNumber"}, Equality: "caseIgnoreMatch"},
+	}}
+	config := LDAPSyncConfig{UserFilter: filter("employeeNumber", "(?i)^e1$"), GroupFilter: filter("cn", "^admins$")}
+	if got, _ := config.serverFilter(schema); got != "(|(employeeNumber=e1)(cn=admins))" {
+		t.Errorf("filter %s of a case-insensitive attribute of the schema", got)
+	}
+}
+
+func TestParseAndFormatLDAPFilter(t *testing.T) {
+	for _, test := range []struct{ filter, want string }{ // formatted as parsed if want is empty
+		{"(objectClass=person)", ""},
+		{"(&(objectClass=user)(userAccountControl:1.2.840.113556.1.4.803:=2))", ""},
+		{"(|(cn=a*)(cn=*b)(cn=a*b*c))", ""},
+		{"(cn:dn:=people)", ""},
+		{`(cn=a\2ab)`, ""},
+		{"(cn~=smith)", "(cn=smith)"}, // approximate matches are evaluated as equality
+		{"(&(objectClass=group)(|(cn=admins)(cn=staff))(mail=*))",
+			"(&(objectClass=group)(mail=*)(|(cn=admins)(cn=staff)))"}, // expressions ahead of groups
+	} {
+		filter, want := test.filter, test.want
+		lf, err := ParseLDAPFilter(filter)
+		if err != nil {
+			t.Errorf("%s: %v", filter, err)
+			continue
+		}
+		if want == "" {
+			want = filter
+		}
+		if formatted, err := FormatLDAPFilter(lf); err != nil || formatted != want {
+			t.Errorf("%s: formatted %s, error %v, want %s", filter, formatted, err, want)
+		}
+	}
+
+	for _, unsupported := range []string{"(!(cn=admins))", "(uidNumber>=1000)", "(cn=admins"} {
+		if lf, err := ParseLDAPFilter(unsupported); err == nil {
+			t.Errorf("%s: parsed %+v", unsupported, lf)
+		}
+	}
+}
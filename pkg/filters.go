@@ -3,6 +3,8 @@ package ldapsync
 import (
 	"regexp"
 	"strings"
+
+	"golang.org/x/text/unicode/norm"
 )
 
 // Used for determining group membership of users
@@ -18,24 +20,30 @@ type Constraint struct {
 }
 
 func (c Constraint) IsMember(user, group *LDAPEntry) bool {
+	return c.isMember(user, group, comparator{})
+}
+
+// isMember compares values using the comparator
+func (c Constraint) isMember(user, group *LDAPEntry, cmp comparator) bool {
 	if strings.ToLower(c.UserAttribute) == "dn" {
 		if strings.ToLower(c.GroupAttribute) == "dn" {
-			return user.DN == group.DN
+			return cmp.equal("dn", user.DN, group.DN)
 		} else {
 			//some group attribute
-			return group.ContainsAttributeValue(c.GroupAttribute, user.DN)
+			return group.containsValue(c.GroupAttribute, user.DN, cmp)
 		}
 	} else {
 		//some user attribute
 		if strings.ToLower(c.GroupAttribute) == "dn" {
-			return user.ContainsAttributeValue(c.UserAttribute, group.DN)
+			return user.containsValue(c.UserAttribute, group.DN, cmp)
 		} else {
 			//some group attribute
 			if exist, uValues := user.GetAttribute(c.UserAttribute); exist {
 				if gexist, gValues := group.GetAttribute(c.GroupAttribute); gexist {
+					rule := cmp.ruleFor(c.GroupAttribute, c.UserAttribute)
 					for _, uv := range uValues {
 						for _, gv := range gValues {
-							if uv == gv {
+							if cmp.normalize(rule, uv) == cmp.normalize(rule, gv) {
 								return true //found a match
 							}
 						}
@@ -54,17 +62,21 @@ func (c Constraint) IsMember(user, group *LDAPEntry) bool {
 
 // determines whether a user based on a user LDAP attribute belongs to a group e.g. {UserAttribute: uid, GroupAttribute: memberUid}
 func (gmf GroupMembershipAssociator) IsMember(user, group *LDAPEntry) bool {
+	return gmf.isMember(user, group, comparator{})
+}
+
+func (gmf GroupMembershipAssociator) isMember(user, group *LDAPEntry, cmp comparator) bool {
 
 	switch gmf.Operator {
 	case And:
 		for _, c := range gmf.Constraints {
-			if !c.IsMember(user, group) {
+			if !c.isMember(user, group, cmp) {
 				return false // short circuit
 			}
 		}
 		//all the constraints are valid, check additional rules
 		for _, gma := range gmf.AdditionalRules {
-			if !gma.IsMember(user, group) {
+			if !gma.isMember(user, group, cmp) {
 				return false // short circuit
 			}
 		}
@@ -74,13 +86,13 @@ func (gmf GroupMembershipAssociator) IsMember(user, group *LDAPEntry) bool {
 	case Or:
 
 		for _, c := range gmf.Constraints {
-			if c.IsMember(user, group) {
+			if c.isMember(user, group, cmp) {
 				return true // short circuit
 			}
 		}
 
 		for _, gma := range gmf.AdditionalRules {
-			if gma.IsMember(user, group) {
+			if gma.isMember(user, group, cmp) {
 				return true // short circuit
 			}
 		}
@@ -93,6 +105,27 @@ func (gmf GroupMembershipAssociator) IsMember(user, group *LDAPEntry) bool {
 
 }
 
+// constraints returns the constraints of this associator and, recursively, those of its additional rules
+func (gmf GroupMembershipAssociator) constraints() []Constraint {
+	cs := append([]Constraint{}, gmf.Constraints...)
+	for _, gma := range gmf.AdditionalRules {
+		cs = append(cs, gma.constraints()...)
+	}
+	return cs
+}
+
+// attributes returns the names of the attributes the constraints compare, other than the DN
+func (gmf GroupMembershipAssociator) attributes() (names []string) {
+	for _, c := range gmf.constraints() {
+		for _, name := range []string{c.UserAttribute, c.GroupAttribute} {
+			if name != "" && strings.ToLower(name) != "dn" {
+				names = append(names, name)
+			}
+		}
+	}
+	return
+}
+
 type LDAPFilterOperator int
 
 const (
@@ -123,7 +156,44 @@ func (lf *LDAPFilter) compile() {
 	lf.compiled = true
 }
 
+// compiledCopy returns a compiled deep copy of the filter, which can be matched by concurrent goroutines as it is
+// no longer compiled on first use, and independent of copies sharing the expressions of the original
+func (lf LDAPFilter) compiledCopy() LDAPFilter {
+	lf.Filters = append([]FilterExpression(nil), lf.Filters...)
+	groups := make([]LDAPFilter, len(lf.FilterGroups))
+	for i, fg := range lf.FilterGroups {
+		groups[i] = fg.compiledCopy()
+	}
+	if lf.FilterGroups != nil {
+		lf.FilterGroups = groups
+	}
+	lf.compile()
+	return lf
+}
+
+// attributes returns the names of the attributes the filter tests, other than the DN
+func (f LDAPFilter) attributes() (names []string) {
+	for _, ff := range f.Filters {
+		switch name := attributeName(ff.Name); strings.ToLower(name) {
+		case "dn":
+		case "":
+			names = append(names, "*") // an extensible match on any attribute needs them all
+		default:
+			names = append(names, name)
+		}
+	}
+	for _, fg := range f.FilterGroups {
+		names = append(names, fg.attributes()...)
+	}
+	return
+}
+
 func (f *LDAPFilter) Matches(ent *LDAPEntry) bool {
+	return f.matches(ent, comparator{})
+}
+
+// matches evaluates the filter, matching case-insensitively where the comparator says an attribute is case-insensitive
+func (f *LDAPFilter) matches(ent *LDAPEntry, cmp comparator) bool {
 
 	if ent == nil {
 		return false //bail out on nonsensical entry
@@ -138,21 +208,21 @@ func (f *LDAPFilter) Matches(ent *LDAPEntry) bool {
 	case And:
 		for _, ff := range f.Filters {
 			if strings.ToLower(ff.Name) == "dn" {
-				if ent.DN == ff.Value {
+				if cmp.equal("dn", ent.DN, ff.Value) {
 					m = true
 				} else {
 					return false // short-circuit on wrong DN
 				}
 			} else {
-				if !ent.ContainsAttribute(&ff) {
+				if !ent.containsAttribute(&ff, cmp) {
 					return false // short-circuit entity with non-matching attribute
 				} else {
 					m = true
 				}
 			}
 		}
-		for _, fg := range f.FilterGroups {
-			if fg.Matches(ent) {
+		for i := range f.FilterGroups {
+			if f.FilterGroups[i].matches(ent, cmp) {
 				m = true
 			} else {
 				return false // short-circuit any group that does not match
@@ -161,17 +231,17 @@ func (f *LDAPFilter) Matches(ent *LDAPEntry) bool {
 	case Or:
 		for _, ff := range f.Filters {
 			if strings.ToLower(ff.Name) == "dn" {
-				if ent.DN == ff.Value {
+				if cmp.equal("dn", ent.DN, ff.Value) {
 					return true // short-circuit on correct DN
 				}
 			} else {
-				if ent.ContainsAttribute(&ff) {
+				if ent.containsAttribute(&ff, cmp) {
 					return true // short-circuit entity with matching attribute
 				}
 			}
 		}
-		for _, fg := range f.FilterGroups {
-			if fg.Matches(ent) {
+		for i := range f.FilterGroups {
+			if f.FilterGroups[i].matches(ent, cmp) {
 				return true // short-circuit on any group match
 			}
 		}
@@ -181,12 +251,14 @@ func (f *LDAPFilter) Matches(ent *LDAPEntry) bool {
 }
 
 func (ent *LDAPEntry) ContainsAttributeValue(attr, value string) bool {
-	for _, att := range ent.Attributes {
-		if att.Name == attr {
-			for _, v := range att.Values {
-				if v == value {
-					return true
-				}
+	return ent.containsValue(attr, value, comparator{})
+}
+
+func (ent *LDAPEntry) containsValue(attr, value string, cmp comparator) bool {
+	for _, att := range ent.attributes(attr) {
+		for _, v := range att.StringValues() {
+			if cmp.equal(attr, v, value) {
+				return true
 			}
 		}
 	}
@@ -195,13 +267,22 @@ func (ent *LDAPEntry) ContainsAttributeValue(attr, value string) bool {
 }
 
 func (ent *LDAPEntry) ContainsAttribute(ff *FilterExpression) bool {
+	return ent.containsAttribute(ff, comparator{})
+}
+
+func (ent *LDAPEntry) containsAttribute(ff *FilterExpression, cmp comparator) bool {
 	ff.compile()
-	for _, att := range ent.Attributes {
-		if att.Name == ff.Name {
-			for _, v := range att.Values {
-				if ff.compiledValue.MatchString(v) {
-					return true
-				}
+	if ff.extensible != nil {
+		return ent.matchesExtensible(ff, cmp)
+	}
+	re := ff.pattern(ff.Name, cmp)
+	if re == nil {
+		return false // invalid regular expression
+	}
+	for _, att := range ent.attributes(ff.Name) {
+		for _, v := range att.StringValues() {
+			if re.MatchString(cmp.prepare(v)) {
+				return true
 			}
 		}
 	}
@@ -212,19 +293,53 @@ type NameValue struct {
 	Name, Value string
 }
 
+// FilterExpression matches entries with an attribute value matching the Value regular expression.
+// The Name may also be an extensible match assertion such as userAccountControl:1.2.840.113556.1.4.803: or ou:dn:,
+// in which case the Value is the assertion value of the matching rule, if there is one
 type FilterExpression struct {
-	Name, Value          string
-	compiledValue        *regexp.Regexp
-	compiledSuccessfully bool
+	Name, Value   string
+	compiledValue *regexp.Regexp
+	compiledFold  *regexp.Regexp // case-insensitive variant, for case-insensitive attributes
+	// variants of the NFC normalized Value, for values normalized by the ValuePreparation, the same as the above if
+	// normalizing does not change the Value
+	normalizedValue, normalizedFold *regexp.Regexp
+	extensible                      *extensibleMatch
+	compiled                        bool // successfully or not: compiledValue is nil if the Value is an invalid regular expression
 }
 
 func (fe *FilterExpression) compile() {
-	if fe.compiledSuccessfully {
+	if fe.compiled {
 		return //compile once
 	}
+	fe.compiled = true
+	if m, ok := parseExtensibleMatch(fe.Name); ok {
+		fe.extensible = &m
+	}
 	re, err := regexp.Compile(fe.Value)
-	if err == nil {
-		fe.compiledValue = re
-		fe.compiledSuccessfully = true
+	if err != nil {
+		return
+	}
+	fe.compiledValue, fe.compiledFold = re, regexp.MustCompile("(?i)"+fe.Value)
+	fe.normalizedValue, fe.normalizedFold = fe.compiledValue, fe.compiledFold
+	if value := norm.NFC.String(fe.Value); value != fe.Value {
+		if re, err = regexp.Compile(value); err == nil {
+			fe.normalizedValue, fe.normalizedFold = re, regexp.MustCompile("(?i)"+value)
+		}
+	}
+}
+
+// pattern returns the compiled Value to match the values of the attribute with, as prepared by the comparator: the
+// case-insensitive variant for case-insensitive attributes, normalized if the values are. It is nil if the Value is
+// an invalid regular expression
+func (fe *FilterExpression) pattern(attribute string, cmp comparator) *regexp.Regexp {
+	fold := cmp.rule(attribute) == CaseIgnoreMatch
+	switch {
+	case cmp.prep.Normalize && fold:
+		return fe.normalizedFold
+	case cmp.prep.Normalize:
+		return fe.normalizedValue
+	case fold:
+		return fe.compiledFold
 	}
+	return fe.compiledValue
 }
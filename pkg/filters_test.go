@@ -0,0 +1,26 @@
+package ldapsync
+
+import "testing"
+
+func TestFilterExpressionsAreNormalizedWithTheValues(t *testing.T) {
+	const decomposed, composed = "Ame\u0301lie", "Am\u00e9lie" // as NFD and NFC
+	entry := &LDAPEntry{DN: "uid=amelie,dc=example,dc=com",
+		Attributes: []LDAPAttribute{{Name: "description", Values: []string{decomposed}}}}
+	for _, test := range []struct {
+		value     string
+		normalize bool
+		matches   bool
+	}{
+		{"^" + decomposed + "$", false, true},
+		{"^" + composed + "$", false, false},
+		{"^" + decomposed + "$", true, true},
+		{"^" + composed + "$", true, true},
+		{"(?i)^AM\u00c9LIE$", true, true},
+	} {
+		fe := &FilterExpression{Name: "description", Value: test.value}
+		cmp := comparator{prep: ValuePreparation{Normalize: test.normalize}}
+		if entry.containsAttribute(fe, cmp) != test.matches {
+			t.Errorf("%q with Normalize %v matches: %v, want %v", test.value, test.normalize, !test.matches, test.matches)
+		}
+	}
+}
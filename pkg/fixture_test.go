@@ -0,0 +1,44 @@
+package ldapsync_test
+
+import (
+	"testing"
+
+	ldapsync "github.com/adedayo/ldap-sync/pkg"
+	"github.com/adedayo/ldap-sync/pkg/ldapsynctest"
+)
+
+// fixture starts a server of a directory of people, some of them under ou=disabled, and of one person outside
+// ou=people, returning a configuration syncing ou=people without ou=disabled
+func fixture(t *testing.T) (*ldapsynctest.Server, ldapsync.LDAPSyncConfig) {
+	t.Helper()
+	server, err := ldapsynctest.NewServer(
+		ldapsynctest.Entry("dc=example,dc=com", "objectClass", "domain", "dc", "example"),
+		ldapsynctest.Entry("ou=people,dc=example,dc=com", "objectClass", "organizationalUnit", "ou", "people"),
+		ldapsynctest.Entry("ou=disabled,ou=people,dc=example,dc=com", "objectClass", "organizationalUnit", "ou", "disabled"),
+		ldapsynctest.Entry("ou=other,dc=example,dc=com", "objectClass", "organizationalUnit", "ou", "other"),
+		ldapsynctest.Entry("uid=alice,ou=people,dc=example,dc=com", "objectClass", "person", "uid", "alice",
+			"userPassword", "alice-secret"),
+		ldapsynctest.Entry("uid=dave,ou=people,dc=example,dc=com", "objectClass", "person", "uid", "dave",
+			"userPassword", "dave-secret"),
+		ldapsynctest.Entry("uid=bob,ou=disabled,ou=people,dc=example,dc=com", "objectClass", "person", "uid", "bob",
+			"userPassword", "bob-secret"),
+		ldapsynctest.Entry("uid=carol,ou=other,dc=example,dc=com", "objectClass", "person", "uid", "carol",
+			"userPassword", "carol-secret"),
+		ldapsynctest.Entry("cn=staff,ou=people,dc=example,dc=com", "objectClass", "groupOfNames", "cn", "staff",
+			"member", "uid=alice,ou=people,dc=example,dc=com", "member", "uid=dave,ou=people,dc=example,dc=com"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { server.Close() })
+
+	config := server.Config("ou=people,dc=example,dc=com")
+	config.ExcludeDNs = []string{"ou=disabled,ou=people,dc=example,dc=com"}
+	if config.UserFilter, err = ldapsync.ParseLDAPFilter("(objectClass=person)"); err != nil {
+		t.Fatal(err)
+	}
+	if config.GroupFilter, err = ldapsync.ParseLDAPFilter("(objectClass=groupOfNames)"); err != nil {
+		t.Fatal(err)
+	}
+	return server, config
+}
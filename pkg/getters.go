@@ -0,0 +1,75 @@
+package ldapsync
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+)
+
+// GetString returns the first value of the attribute, if it has any
+func (ent LDAPEntry) GetString(attribute string) (string, bool) {
+	if _, values := ent.GetAttribute(attribute); len(values) > 0 {
+		return values[0], true
+	}
+	return "", false
+}
+
+// GetStrings returns the values of the attribute, nil if it has none
+func (ent LDAPEntry) GetStrings(attribute string) []string {
+	_, values := ent.GetAttribute(attribute)
+	return values
+}
+
+// GetInt returns the first value of the attribute as an integer (INTEGER syntax), e.g. of uidNumber or
+// userAccountControl, if it has a valid one
+func (ent LDAPEntry) GetInt(attribute string) (int64, bool) {
+	value, found := ent.GetString(attribute)
+	if !found {
+		return 0, false
+	}
+	i, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+	return i, err == nil
+}
+
+// GetBool returns the first value of the attribute as a boolean (Boolean syntax: TRUE or FALSE), if it has a
+// valid one
+func (ent LDAPEntry) GetBool(attribute string) (value bool, ok bool) {
+	s, found := ent.GetString(attribute)
+	if !found {
+		return
+	}
+	switch strings.ToUpper(strings.TrimSpace(s)) {
+	case "TRUE":
+		return true, true
+	case "FALSE":
+		return false, true
+	}
+	return
+}
+
+// GetTime returns the first value of the attribute as a time (GeneralizedTime syntax, e.g. 20240131093000Z), e.g.
+// of createTimestamp or whenChanged, if it has a valid one
+func (ent LDAPEntry) GetTime(attribute string) (time.Time, bool) {
+	value, found := ent.GetString(attribute)
+	if !found {
+		return time.Time{}, false
+	}
+	t, err := ber.ParseGeneralizedTime([]byte(strings.TrimSpace(value)))
+	return t, err == nil
+}
+
+// GetTimeAD returns the first value of the Active Directory attribute as a time (a FILETIME, the number of 100ns
+// intervals since 1601, e.g. of lastLogonTimestamp, pwdLastSet or accountExpires), if it has one. The values 0 and
+// 0x7FFFFFFFFFFFFFFF, which mean never, are not times
+func (ent LDAPEntry) GetTimeAD(attribute string) (time.Time, bool) {
+	value, found := ent.GetString(attribute)
+	if !found {
+		return time.Time{}, false
+	}
+	if t := fileTime(strings.TrimSpace(value)); t != nil {
+		return *t, true
+	}
+	return time.Time{}, false
+}
@@ -0,0 +1,67 @@
+package ldapsync
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// GitHubTeams is the TeamPlatform of the teams of a GitHub organization, identified by their slugs, through the
+// REST API
+type GitHubTeams struct {
+	Organization string
+	Token        string       // personal access token or GitHub App installation token with the admin:org scope
+	BaseURL      string       // of the API, https://api.github.com if empty, e.g. https://github.example.com/api/v3
+	Client       *http.Client // http.DefaultClient if nil
+}
+
+func NewGitHubTeams(organization, token string) *GitHubTeams {
+	return &GitHubTeams{Organization: organization, Token: token}
+}
+
+func (g *GitHubTeams) TeamMembers(ctx context.Context, team string) (logins []string, err error) {
+	for page := 1; ; page++ {
+		var members []struct {
+			Login string `json:"login"`
+		}
+		query := url.Values{"per_page": {"100"}, "page": {strconv.Itoa(page)}}
+		if err = g.request(ctx, http.MethodGet, g.teamURL(team)+"/members?"+query.Encode(), nil, &members); err != nil {
+			return nil, err
+		}
+		for _, m := range members {
+			logins = append(logins, m.Login)
+		}
+		if len(members) < 100 {
+			return
+		}
+	}
+}
+
+// AddTeamMember adds the user to the team, inviting them to the organization if they are not a member of it
+func (g *GitHubTeams) AddTeamMember(ctx context.Context, team, login string) error {
+	return g.request(ctx, http.MethodPut, g.teamURL(team)+"/memberships/"+url.PathEscape(login),
+		map[string]string{"role": "member"}, nil)
+}
+
+func (g *GitHubTeams) RemoveTeamMember(ctx context.Context, team, login string) error {
+	return g.request(ctx, http.MethodDelete, g.teamURL(team)+"/memberships/"+url.PathEscape(login), nil, nil)
+}
+
+func (g *GitHubTeams) teamURL(team string) string {
+	base := strings.TrimSuffix(g.BaseURL, "/")
+	if base == "" {
+		base = "https://api.github.com"
+	}
+	return base + "/orgs/" + url.PathEscape(g.Organization) + "/teams/" + url.PathEscape(team)
+}
+
+func (g *GitHubTeams) request(ctx context.Context, method, url string, body, out interface{}) error {
+	header := http.Header{
+		"Accept":               {"application/vnd.github+json"},
+		"Authorization":        {"Bearer " + g.Token},
+		"X-Github-Api-Version": {"2022-11-28"},
+	}
+	return platformRequest(ctx, g.Client, method, url, header, body, out)
+}
@@ -0,0 +1,110 @@
+package ldapsync
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// GitLab access levels of group members
+const (
+	GitLabGuest      = 10
+	GitLabReporter   = 20
+	GitLabDeveloper  = 30
+	GitLabMaintainer = 40
+	GitLabOwner      = 50
+)
+
+// GitLabGroups is the TeamPlatform of GitLab groups, identified by their ID or full path (e.g. engineering/backend),
+// through the REST API. Only the direct members of groups are managed, and owners are never removed, so that a
+// group cannot be locked out of
+type GitLabGroups struct {
+	Token       string       // personal, group or service account access token with the api scope
+	BaseURL     string       // of the instance, https://gitlab.com if empty
+	AccessLevel int          // of the members added, GitLabDeveloper if zero
+	Client      *http.Client // http.DefaultClient if nil
+}
+
+func NewGitLabGroups(token string) *GitLabGroups {
+	return &GitLabGroups{Token: token}
+}
+
+type gitLabMember struct {
+	ID          int    `json:"id"`
+	Username    string `json:"username"`
+	AccessLevel int    `json:"access_level"`
+}
+
+func (g *GitLabGroups) TeamMembers(ctx context.Context, team string) (logins []string, err error) {
+	for page := 1; ; page++ {
+		var members []gitLabMember
+		query := url.Values{"per_page": {"100"}, "page": {strconv.Itoa(page)}}
+		if err = g.request(ctx, http.MethodGet, g.groupURL(team)+"/members?"+query.Encode(), nil, &members); err != nil {
+			return nil, err
+		}
+		for _, m := range members {
+			if m.AccessLevel < GitLabOwner {
+				logins = append(logins, m.Username)
+			}
+		}
+		if len(members) < 100 {
+			return
+		}
+	}
+}
+
+func (g *GitLabGroups) AddTeamMember(ctx context.Context, team, login string) error {
+	id, err := g.userID(ctx, login)
+	if err != nil {
+		return err
+	}
+	level := g.AccessLevel
+	if level == 0 {
+		level = GitLabDeveloper
+	}
+	err = g.request(ctx, http.MethodPost, g.groupURL(team)+"/members",
+		map[string]int{"user_id": id, "access_level": level}, nil)
+	if isStatus(err, http.StatusConflict) {
+		return nil // an owner, left out of the TeamMembers
+	}
+	return err
+}
+
+func (g *GitLabGroups) RemoveTeamMember(ctx context.Context, team, login string) error {
+	id, err := g.userID(ctx, login)
+	if err != nil {
+		return err
+	}
+	return g.request(ctx, http.MethodDelete, g.groupURL(team)+"/members/"+strconv.Itoa(id), nil, nil)
+}
+
+// userID returns the ID of the user with the username, which the member API takes
+func (g *GitLabGroups) userID(ctx context.Context, login string) (int, error) {
+	var users []gitLabMember
+	if err := g.request(ctx, http.MethodGet, g.apiURL()+"/users?username="+url.QueryEscape(login), nil, &users); err != nil {
+		return 0, err
+	}
+	if len(users) == 0 {
+		return 0, fmt.Errorf("no GitLab user %s", login)
+	}
+	return users[0].ID, nil
+}
+
+func (g *GitLabGroups) apiURL() string {
+	base := strings.TrimSuffix(g.BaseURL, "/")
+	if base == "" {
+		base = "https://gitlab.com"
+	}
+	return base + "/api/v4"
+}
+
+func (g *GitLabGroups) groupURL(group string) string {
+	return g.apiURL() + "/groups/" + url.PathEscape(group)
+}
+
+func (g *GitLabGroups) request(ctx context.Context, method, url string, body, out interface{}) error {
+	return platformRequest(ctx, g.Client, method, url, http.Header{"Private-Token": {g.Token}}, body, out)
+}
@@ -0,0 +1,416 @@
+package ldapsync
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// ImportGrafanaConfig reads a Grafana ldap.toml and returns the equivalent configuration of its first server: the
+// host, TLS settings and (first) CA certificate, bind credentials and search bases, the user and group filters of
+// its search filters with the login placeholder %s matching any value, the group membership of its group search
+// filter (or member_of attribute), and a RoleMapping of its group mappings. Roles are the org_role of the mappings, prefixed with the
+// org_id (e.g. 2:Editor) outside the default organization, and GrafanaAdmin for mappings granting it; the rules are
+// prioritized in the order of the mappings, and a group_dn of * becomes the DefaultRole. Servers that bind as the
+// user logging in (bind_dn containing %s) have no sync credentials to import, which validating the configuration
+// reports
+func ImportGrafanaConfig(r io.Reader) (config LDAPSyncConfig, err error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return
+	}
+	doc, err := parseTOML(string(data))
+	if err != nil {
+		return
+	}
+	servers, _ := doc["servers"].([]map[string]interface{})
+	if len(servers) == 0 {
+		return config, fmt.Errorf("ldap.toml has no [[servers]]")
+	}
+	server := servers[0]
+
+	hosts := strings.Fields(tomlString(server, "host")) // Grafana tries space separated hosts in turn
+	if len(hosts) == 0 {
+		return config, fmt.Errorf("ldap.toml server has no host")
+	}
+	config.Server = hosts[0]
+	switch {
+	case tomlBool(server, "use_ssl") && tomlBool(server, "start_tls"):
+		config.TLS = "starttls"
+	case tomlBool(server, "use_ssl"):
+		config.TLS = "tls"
+	default:
+		config.TLS = "none"
+	}
+	if caCerts := strings.Fields(tomlString(server, "root_ca_cert")); len(caCerts) > 0 {
+		config.TLSOptions.CACertFile = caCerts[0]
+	}
+	config.TLSOptions.InsecureSkipVerify = tomlBool(server, "ssl_skip_verify")
+	if port, ok := server["port"].(int64); ok {
+		p := strconv.FormatInt(port, 10)
+		config.Port = &p
+	} else if config.TLS == "tls" {
+		p := "636"
+		config.Port = &p
+	}
+	if bindDN := tomlString(server, "bind_dn"); bindDN != "" {
+		config.RequiresAuthentication = true
+		if !strings.Contains(bindDN, "%s") {
+			config.SyncUserName = bindDN
+			config.SyncPassword = tomlString(server, "bind_password")
+		}
+	}
+	for _, key := range []string{"search_base_dns", "group_search_base_dns"} {
+		for _, base := range tomlStrings(server, key) {
+			if !containsFold(config.BaseDNs, base) {
+				config.BaseDNs = append(config.BaseDNs, base)
+			}
+		}
+	}
+
+	attributes, _ := server["attributes"].(map[string]interface{})
+	username := tomlString(attributes, "username")
+	if filter := tomlString(server, "search_filter"); filter != "" {
+		if config.UserFilter, err = ParseLDAPFilter(strings.ReplaceAll(filter, "%s", "*")); err != nil {
+			return config, fmt.Errorf("search_filter: %w", err)
+		}
+		if username == "" {
+			username = placeholderAttribute(config.UserFilter)
+		}
+	}
+	config.UserIDAttribute = username
+
+	if filter := tomlString(server, "group_search_filter"); filter != "" {
+		if config.GroupFilter, err = ParseLDAPFilter(strings.ReplaceAll(filter, "%s", "*")); err != nil {
+			return config, fmt.Errorf("group_search_filter: %w", err)
+		}
+		groupAttribute := placeholderAttribute(config.GroupFilter)
+		if groupAttribute == "" {
+			return config, fmt.Errorf("group_search_filter %s does not refer to the user with %%s", filter)
+		}
+		if groups := withoutAttribute(config.GroupFilter, groupAttribute); len(groups.Filters)+len(groups.FilterGroups) > 0 {
+			config.GroupFilter = groups
+		}
+		// Grafana substitutes the group_search_filter_user_attribute of the user, or else their username
+		userAttribute := tomlString(server, "group_search_filter_user_attribute")
+		if userAttribute == "" {
+			userAttribute = username
+		}
+		config.GroupMembership = GroupMembershipAssociator{
+			Constraints: []Constraint{{UserAttribute: userAttribute, GroupAttribute: groupAttribute}},
+		}
+	} else if memberOf := tomlString(attributes, "member_of"); memberOf != "" {
+		config.GroupMembership = GroupMembershipAssociator{
+			Constraints: []Constraint{{UserAttribute: memberOf, GroupAttribute: "dn"}},
+		}
+	}
+
+	mappings, _ := server["group_mappings"].([]map[string]interface{})
+	for i, mapping := range mappings {
+		group, role := tomlString(mapping, "group_dn"), tomlString(mapping, "org_role")
+		if orgID, ok := mapping["org_id"].(int64); ok && orgID != 1 && role != "" {
+			role = strconv.FormatInt(orgID, 10) + ":" + role
+		}
+		if group == "*" {
+			if config.RoleMapping.DefaultRole == "" {
+				config.RoleMapping.DefaultRole = role
+			}
+			continue
+		}
+		priority := len(mappings) - i // Grafana grants the first mapping matching the user
+		if role != "" {
+			config.RoleMapping.Rules = append(config.RoleMapping.Rules, RoleRule{Role: role, Group: group, Priority: priority})
+		}
+		if tomlBool(mapping, "grafana_admin") {
+			config.RoleMapping.Rules = append(config.RoleMapping.Rules, RoleRule{Role: "GrafanaAdmin", Group: group, Priority: priority})
+		}
+	}
+	return
+}
+
+// placeholderAttribute returns the attribute of the first assertion of the filter that the %s placeholder was
+// replaced in, i.e. that matches any value
+func placeholderAttribute(lf LDAPFilter) string {
+	for _, fe := range lf.Filters {
+		if fe.Value == "" {
+			return fe.Name
+		}
+	}
+	for _, group := range lf.FilterGroups {
+		if name := placeholderAttribute(group); name != "" {
+			return name
+		}
+	}
+	return ""
+}
+
+// withoutAttribute returns the filter without the presence assertions of the attribute, which a group search
+// filter uses to select the groups of the user rather than the groups to sync
+func withoutAttribute(lf LDAPFilter, attribute string) LDAPFilter {
+	filtered := LDAPFilter{Operator: lf.Operator}
+	for _, fe := range lf.Filters {
+		if fe.Value != "" || !strings.EqualFold(fe.Name, attribute) {
+			filtered.Filters = append(filtered.Filters, fe)
+		}
+	}
+	for _, group := range lf.FilterGroups {
+		filtered.FilterGroups = append(filtered.FilterGroups, withoutAttribute(group, attribute))
+	}
+	return filtered
+}
+
+func tomlString(table map[string]interface{}, key string) string {
+	s, _ := table[key].(string)
+	return s
+}
+
+func tomlBool(table map[string]interface{}, key string) bool {
+	b, _ := table[key].(bool)
+	return b
+}
+
+func tomlStrings(table map[string]interface{}, key string) (values []string) {
+	items, _ := table[key].([]interface{})
+	for _, item := range items {
+		if s, ok := item.(string); ok {
+			values = append(values, s)
+		}
+	}
+	return
+}
+
+// parseTOML parses the subset of TOML used by configuration files such as Grafana's ldap.toml: tables, arrays of
+// tables, and keys with string, integer, float, boolean and array values. Tables are map[string]interface{},
+// arrays of tables []map[string]interface{}, integers int64 and arrays []interface{}
+func parseTOML(s string) (doc map[string]interface{}, err error) {
+	p := &tomlParser{s: s}
+	doc = make(map[string]interface{})
+	table := doc
+	for {
+		p.skip(true)
+		if p.i >= len(p.s) {
+			return
+		}
+		if p.s[p.i] == '[' {
+			array := strings.HasPrefix(p.s[p.i:], "[[")
+			p.i++
+			if array {
+				p.i++
+			}
+			path, err := p.keyPath()
+			if err != nil {
+				return nil, err
+			}
+			closing := "]"
+			if array {
+				closing = "]]"
+			}
+			if !strings.HasPrefix(p.s[p.i:], closing) {
+				return nil, p.errorf("expected %s", closing)
+			}
+			p.i += len(closing)
+			if table, err = p.table(doc, path, array); err != nil {
+				return nil, err
+			}
+		} else {
+			path, err := p.keyPath()
+			if err != nil {
+				return nil, err
+			}
+			if p.skip(false); p.i >= len(p.s) || p.s[p.i] != '=' {
+				return nil, p.errorf("expected = after %s", strings.Join(path, "."))
+			}
+			p.i++
+			value, err := p.value()
+			if err != nil {
+				return nil, err
+			}
+			parent, err := p.table(table, path[:len(path)-1], false)
+			if err != nil {
+				return nil, err
+			}
+			if _, exists := parent[path[len(path)-1]]; exists {
+				return nil, p.errorf("duplicate key %s", strings.Join(path, "."))
+			}
+			parent[path[len(path)-1]] = value
+		}
+		if p.skip(false); p.i < len(p.s) && p.s[p.i] != '\n' && p.s[p.i] != '\r' {
+			return nil, p.errorf("expected the end of the line")
+		}
+	}
+}
+
+type tomlParser struct {
+	s string
+	i int
+}
+
+func (p *tomlParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("line %d: %s", strings.Count(p.s[:p.i], "\n")+1, fmt.Sprintf(format, args...))
+}
+
+// skip skips whitespace and comments, and line breaks too if newlines
+func (p *tomlParser) skip(newlines bool) {
+	for p.i < len(p.s) {
+		switch c := p.s[p.i]; {
+		case c == ' ' || c == '\t' || newlines && (c == '\n' || c == '\r'):
+			p.i++
+		case c == '#':
+			for p.i < len(p.s) && p.s[p.i] != '\n' {
+				p.i++
+			}
+		default:
+			return
+		}
+	}
+}
+
+// keyPath parses a dotted key, e.g. servers.attributes
+func (p *tomlParser) keyPath() (path []string, err error) {
+	for {
+		p.skip(false)
+		var key string
+		if p.i < len(p.s) && (p.s[p.i] == '"' || p.s[p.i] == '\'') {
+			if key, err = p.str(); err != nil {
+				return
+			}
+		} else {
+			start := p.i
+			for p.i < len(p.s) && isBareKeyChar(p.s[p.i]) {
+				p.i++
+			}
+			if key = p.s[start:p.i]; key == "" {
+				return nil, p.errorf("expected a key")
+			}
+		}
+		path = append(path, key)
+		if p.skip(false); p.i >= len(p.s) || p.s[p.i] != '.' {
+			return
+		}
+		p.i++
+	}
+}
+
+func isBareKeyChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '-'
+}
+
+// table returns the table at the path under the root, creating the missing ones, and appending a table to the
+// array of tables at the path if array. Intermediate arrays of tables resolve to their last table
+func (p *tomlParser) table(root map[string]interface{}, path []string, array bool) (map[string]interface{}, error) {
+	table := root
+	for i, key := range path {
+		last := i == len(path)-1
+		switch value := table[key].(type) {
+		case nil:
+			if last && array {
+				next := make(map[string]interface{})
+				table[key] = []map[string]interface{}{next}
+				table = next
+			} else {
+				next := make(map[string]interface{})
+				table[key] = next
+				table = next
+			}
+		case map[string]interface{}:
+			if last && array {
+				return nil, p.errorf("%s is a table, not an array of tables", strings.Join(path, "."))
+			}
+			table = value
+		case []map[string]interface{}:
+			if last && array {
+				next := make(map[string]interface{})
+				table[key] = append(value, next)
+				table = next
+			} else {
+				table = value[len(value)-1]
+			}
+		default:
+			return nil, p.errorf("%s is not a table", strings.Join(path[:i+1], "."))
+		}
+	}
+	return table, nil
+}
+
+// value parses a string, integer, float, boolean or array
+func (p *tomlParser) value() (interface{}, error) {
+	p.skip(false)
+	if p.i >= len(p.s) {
+		return nil, p.errorf("expected a value")
+	}
+	switch c := p.s[p.i]; {
+	case c == '"' || c == '\'':
+		return p.str()
+	case c == '[':
+		p.i++
+		values := []interface{}{}
+		for {
+			p.skip(true)
+			if p.i < len(p.s) && p.s[p.i] == ']' {
+				p.i++
+				return values, nil
+			}
+			value, err := p.value()
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, value)
+			p.skip(true)
+			if p.i < len(p.s) && p.s[p.i] == ',' {
+				p.i++
+			} else if p.i >= len(p.s) || p.s[p.i] != ']' {
+				return nil, p.errorf("expected , or ] in array")
+			}
+		}
+	case c == '{':
+		return nil, p.errorf("inline tables are not supported")
+	}
+
+	start := p.i
+	for p.i < len(p.s) && strings.IndexByte(" \t\r\n#,]", p.s[p.i]) < 0 {
+		p.i++
+	}
+	token := p.s[start:p.i]
+	switch token {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	}
+	number := strings.ReplaceAll(token, "_", "")
+	if n, err := strconv.ParseInt(number, 0, 64); err == nil {
+		return n, nil
+	}
+	if f, err := strconv.ParseFloat(number, 64); err == nil {
+		return f, nil
+	}
+	p.i = start
+	return nil, p.errorf("invalid value %q", token)
+}
+
+// str parses a basic ("...") or literal ('...') single-line string
+func (p *tomlParser) str() (string, error) {
+	quote := p.s[p.i]
+	if strings.HasPrefix(p.s[p.i:], strings.Repeat(string(quote), 3)) {
+		return "", p.errorf("multi-line strings are not supported")
+	}
+	start := p.i
+	for p.i++; p.i < len(p.s) && p.s[p.i] != quote && p.s[p.i] != '\n'; p.i++ {
+		if quote == '"' && p.s[p.i] == '\\' {
+			p.i++
+		}
+	}
+	if p.i >= len(p.s) || p.s[p.i] != quote {
+		return "", p.errorf("unterminated string")
+	}
+	p.i++
+	if quote == '\'' {
+		return p.s[start+1 : p.i-1], nil
+	}
+	s, err := strconv.Unquote(p.s[start:p.i])
+	if err != nil {
+		return "", p.errorf("invalid string %s", p.s[start:p.i])
+	}
+	return s, nil
+}
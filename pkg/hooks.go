@@ -0,0 +1,81 @@
+package ldapsync
+
+import (
+	"time"
+)
+
+// Operation identifies an LDAP operation against a directory server
+type Operation struct {
+	Name   string // dial, bind, search, compare or extended
+	Server string // host:port
+	BaseDN string // for searches, and the DN of the entry compared
+	BindDN string // for binds, empty if anonymous
+}
+
+// Hooks are called around each LDAP operation and at each stage of a sync, e.g. to record latencies and failures
+// in the caller's own monitoring, or for custom logging and side effects. Any hook may be nil. Operation hooks may be
+// called concurrently; all hooks should return promptly
+type Hooks struct {
+	OnOperationStart func(op Operation)
+	// called once the operation completes, with its duration (excluding any wait for the server's limits) and error
+	OnOperationEnd func(op Operation, duration time.Duration, err error)
+
+	// called once the BaseDNs to sync are known
+	OnSyncStart func(server string, baseDNs []string)
+	// called with each entry synced, including those restored from a checkpoint
+	OnEntry func(entry *LDAPEntry)
+	// called once a BaseDN has been searched, with the number of entries synced from it
+	OnBaseDNDone func(baseDN string, entries int)
+	// called with the error the sync fails with
+	OnError func(err error)
+	// called once the sync succeeds, with its result and duration
+	OnSyncComplete func(result *LDAPRecords, elapsed time.Duration)
+}
+
+func (h *Hooks) syncStart(server string, baseDNs []string) {
+	if h != nil && h.OnSyncStart != nil {
+		h.OnSyncStart(server, baseDNs)
+	}
+}
+
+func (h *Hooks) entries(ents []*LDAPEntry) {
+	if h != nil && h.OnEntry != nil {
+		for _, ent := range ents {
+			h.OnEntry(ent)
+		}
+	}
+}
+
+func (h *Hooks) baseDNDone(baseDN string, entries int) {
+	if h != nil && h.OnBaseDNDone != nil {
+		h.OnBaseDNDone(baseDN, entries)
+	}
+}
+
+// syncEnd calls OnError if the sync failed, otherwise OnSyncComplete
+func (h *Hooks) syncEnd(result *LDAPRecords, elapsed time.Duration, err error) {
+	switch {
+	case h == nil:
+	case err != nil && h.OnError != nil:
+		h.OnError(err)
+	case err == nil && h.OnSyncComplete != nil:
+		h.OnSyncComplete(result, elapsed)
+	}
+}
+
+// startOperation calls the OnOperationStart hook, returning the function to call with the error once the operation
+// completes, which calls the OnOperationEnd hook and records the operation's metrics and log
+func startOperation(h *Hooks, m Metrics, log Logger, op Operation) (end func(error)) {
+	if h != nil && h.OnOperationStart != nil {
+		h.OnOperationStart(op)
+	}
+	begin := time.Now()
+	return func(err error) {
+		duration := time.Since(begin)
+		if h != nil && h.OnOperationEnd != nil {
+			h.OnOperationEnd(op, duration, err)
+		}
+		recordOperation(m, op, duration, err)
+		logOperation(log, op, duration, err)
+	}
+}
@@ -0,0 +1,65 @@
+package ldapsync
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// AuthRequest is the body of a request to an AuthHandler
+type AuthRequest struct {
+	Username string `json:"username"` // the user's DN or ID, the value of the UserIDAttribute
+	Password string `json:"password"`
+	Code     string `json:"code,omitempty"` // second factor code, e.g. of a TOTP authenticator, if a SecondFactor is configured
+}
+
+// AuthHandler is an http.Handler authenticating the AuthRequest POSTed as JSON with Client.AuthenticateCode. It
+// responds with the AuthResult as JSON if the user was authenticated, with 200 OK, and otherwise with
+// {"Success":false} alone: 401 Unauthorized if the credentials were rejected, 403 Forbidden if the user is not in the
+// RequiredGroups, and 502 Bad Gateway if the directory could not be reached. The reason, which would tell a caller
+// whether the user exists, is logged with the Logger of the client's configuration instead
+type AuthHandler struct {
+	Client *Client
+}
+
+func NewAuthHandler(client *Client) *AuthHandler {
+	return &AuthHandler{Client: client}
+}
+
+func (h *AuthHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var request AuthRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<16)).Decode(&request); err != nil {
+		http.Error(w, "invalid request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if request.Username == "" || request.Password == "" {
+		http.Error(w, "username and password are required", http.StatusBadRequest)
+		return
+	}
+
+	auth, err := h.Client.AuthenticateCode(r.Context(), request.Username, request.Password, request.Code)
+	status := http.StatusOK
+	switch {
+	case err != nil:
+		auth.ErrorMessage = err.Error()
+		status = http.StatusBadGateway
+	case auth.Forbidden:
+		status = http.StatusForbidden
+	case !auth.Success:
+		status = http.StatusUnauthorized
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	if status != http.StatusOK {
+		loggerOr(h.Client.config.Logger).Warn("authentication request refused", "status", status,
+			"reason", auth.ErrorMessage)
+		w.Write([]byte(`{"Success":false}` + "\n"))
+		return
+	}
+	json.NewEncoder(w).Encode(auth)
+}
@@ -0,0 +1,164 @@
+package ldapsync
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Incremental sync modes, see LDAPSyncConfig.Incremental
+const (
+	// RFC 4533 Content Synchronization (the SyncRepl control), e.g. of OpenLDAP with the syncprov overlay
+	IncrementalSyncRepl = "syncrepl"
+	// the Active Directory DirSync control (LDAP_SERVER_DIRSYNC_OID), whose BaseDNs must be naming contexts, e.g.
+	// dc=example,dc=com
+	IncrementalDirSync = "dirsync"
+)
+
+// SyncDelta holds the deletions of an incremental sync, whose Entries are only those added or modified since the
+// SyncCookie it started from. Merge applies the delta to the records of the previous sync
+type SyncDelta struct {
+	Deleted      []string // DNs of the deleted entries
+	DeletedUUIDs []string // entryUUIDs of deleted entries the server identified by UUID alone
+	// BaseDNs whose unchanged entries the server listed, rather than the deleted ones: the entries of the previous
+	// sync under them in neither the Entries nor Unchanged (by DN) or UnchangedUUIDs were deleted
+	PresentBaseDNs []string
+	Unchanged      []string
+	UnchangedUUIDs []string
+	// whether the modified Entries hold only their changed attributes, as with DirSync, so that Merge combines them
+	// with the unchanged attributes of the previous sync
+	ChangedAttributesOnly bool
+}
+
+// add adds the delta of a BaseDN
+func (d *SyncDelta) add(baseDN string, delta SyncDelta, present bool) {
+	d.Deleted = append(d.Deleted, delta.Deleted...)
+	d.DeletedUUIDs = append(d.DeletedUUIDs, delta.DeletedUUIDs...)
+	d.ChangedAttributesOnly = d.ChangedAttributesOnly || delta.ChangedAttributesOnly
+	if present {
+		d.PresentBaseDNs = append(d.PresentBaseDNs, baseDN)
+		d.Unchanged = append(d.Unchanged, delta.Unchanged...)
+		d.UnchangedUUIDs = append(d.UnchangedUUIDs, delta.UnchangedUUIDs...)
+	}
+}
+
+// Merge returns the records of the previous sync updated with those of this incremental sync, with the SyncCookie
+// of this one. The records of a full sync are returned as they are.
+//
+// Deletions and renames identified by entryUUID (or the objectGUID of Active Directory) are applied to previous
+// entries with the attribute, which incremental syncs request
+func (sr LDAPRecords) Merge(previous LDAPRecords) LDAPRecords {
+	if sr.Delta == nil {
+		return sr
+	}
+	d := sr.Delta
+	removed := make(map[string]bool)
+	for _, dn := range d.Deleted {
+		removed[dnKey(dn)] = true
+	}
+	removedUUIDs := stringSet(d.DeletedUUIDs)
+	present, presentUUIDs := dnSet(sr.Entries), stringSet(d.UnchangedUUIDs)
+	for _, dn := range d.Unchanged {
+		present[dnKey(dn)] = true
+	}
+	presentBaseDNs := stringSet(d.PresentBaseDNs)
+	changed, changedUUIDs := make(map[string]int), make(map[string]int) // positions of the changed entries
+	for i, ent := range sr.Entries {
+		changed[dnKey(ent.DN)] = i
+		if uuid := syncUUID(ent); uuid != "" {
+			changedUUIDs[uuid] = i
+		}
+	}
+	updated := make([]*LDAPEntry, len(sr.Entries))
+	copy(updated, sr.Entries)
+
+	merged := sr
+	merged.Delta = nil
+	merged.views = &recordViews{}
+	merged.Entries = make([]*LDAPEntry, 0, len(previous.Entries)+len(sr.Entries))
+	for _, ent := range previous.Entries {
+		key, uuid := dnKey(ent.DN), syncUUID(ent)
+		i, isChanged := changed[key]
+		if !isChanged && uuid != "" {
+			i, isChanged = changedUUIDs[uuid] // renamed
+		}
+		switch {
+		case isChanged:
+			if d.ChangedAttributesOnly {
+				updated[i] = updated[i].withAttributesOf(ent)
+			}
+		case removed[key], uuid != "" && removedUUIDs[uuid]:
+		case presentBaseDNs[strings.ToLower(ent.Source.BaseDN)] && !present[key] && !(uuid != "" && presentUUIDs[uuid]):
+		default:
+			merged.Entries = append(merged.Entries, ent)
+		}
+	}
+	merged.Entries = append(merged.Entries, updated...)
+	return merged
+}
+
+// syncUUID returns the lower-cased entryUUID of the entry, or the hex encoded objectGUID of Active Directory
+func syncUUID(ent *LDAPEntry) string {
+	if uuid, _ := ent.GetString("entryUUID"); uuid != "" {
+		return strings.ToLower(uuid)
+	}
+	if att := ent.attribute("objectGUID"); att != nil && len(att.RawValues()) > 0 {
+		return fmt.Sprintf("%x", att.RawValues()[0])
+	}
+	return ""
+}
+
+// withAttributesOf returns the entry holding the changed attributes of an incremental sync with the attributes of
+// its previous version it does not hold, leaving out those the change cleared
+func (ent *LDAPEntry) withAttributesOf(previous *LDAPEntry) *LDAPEntry {
+	attributes := make([]LDAPAttribute, 0, len(ent.Attributes)+len(previous.Attributes))
+	held := make(map[string]bool, len(ent.Attributes))
+	for _, att := range ent.Attributes {
+		held[strings.ToLower(att.Name)] = true
+		if len(att.RawValues()) > 0 {
+			attributes = append(attributes, att)
+		}
+	}
+	for _, att := range previous.Attributes {
+		if !held[strings.ToLower(att.Name)] {
+			attributes = append(attributes, att)
+		}
+	}
+	merged := NewLDAPEntry(ent.DN, attributes)
+	merged.Source = ent.Source
+	return merged
+}
+
+func stringSet(values []string) map[string]bool {
+	set := make(map[string]bool, len(values))
+	for _, v := range values {
+		set[strings.ToLower(v)] = true
+	}
+	return set
+}
+
+// decodeSyncCookie decodes a SyncCookie into the cookies of each BaseDN
+func decodeSyncCookie(cookie string) (cookies map[string][]byte, err error) {
+	cookies = make(map[string][]byte)
+	if cookie == "" {
+		return
+	}
+	data, err := base64.RawURLEncoding.DecodeString(cookie)
+	if err == nil {
+		err = json.Unmarshal(data, &cookies)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid sync cookie: %w", err)
+	}
+	return
+}
+
+// encodeSyncCookie encodes the cookies of each BaseDN into an opaque SyncCookie
+func encodeSyncCookie(cookies map[string][]byte) string {
+	if len(cookies) == 0 {
+		return ""
+	}
+	data, _ := json.Marshal(cookies)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
@@ -0,0 +1,27 @@
+package ldapsync_test
+
+import (
+	"testing"
+
+	ldapsync "github.com/adedayo/ldap-sync/pkg"
+)
+
+func TestMergeAppliesTheDeletionsOfIncrementalSyncs(t *testing.T) {
+	_, config := fixture(t)
+	previous, err := ldapsync.Do(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if previous.GetUsersAndGroups().Incomplete {
+		t.Fatal("a complete sync is incomplete")
+	}
+	delta := previous
+	delta.Entries = nil
+	delta.Delta = &ldapsync.SyncDelta{Deleted: []string{"uid=dave,ou=people,dc=example,dc=com"}}
+	merged := delta.Merge(previous)
+	changes := ldapsync.Diff(previous.GetUsersAndGroups(), merged.GetUsersAndGroups())
+	if len(changes.RemovedUsers) != 1 || changes.RemovedUsers[0].DN != "uid=dave,ou=people,dc=example,dc=com" ||
+		len(changes.AddedUsers) != 0 {
+		t.Errorf("changes %+v, want dave removed", changes)
+	}
+}
@@ -0,0 +1,275 @@
+package ldapsync
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strings"
+)
+
+// Keycloak component provider IDs and types of LDAP user federation
+const (
+	keycloakUserStorage = "org.keycloak.storage.UserStorageProvider"
+	keycloakMapper      = "org.keycloak.storage.ldap.mappers.LDAPStorageMapper"
+	keycloakGroupMapper = "group-ldap-mapper"
+)
+
+// keycloakMaskedSecret is how Keycloak exports the bindCredential of realms
+const keycloakMaskedSecret = "**********"
+
+// KeycloakComponent is the representation of a Keycloak component, as in realm exports and the admin REST API: an
+// LDAP user federation provider, with its mappers as subcomponents
+type KeycloakComponent struct {
+	ID            string                         `json:"id,omitempty"`
+	Name          string                         `json:"name"`
+	ProviderID    string                         `json:"providerId"`
+	ProviderType  string                         `json:"providerType,omitempty"`
+	ParentID      string                         `json:"parentId,omitempty"`
+	SubType       string                         `json:"subType,omitempty"`
+	Config        map[string][]string            `json:"config"`
+	SubComponents map[string][]KeycloakComponent `json:"subComponents,omitempty"`
+}
+
+func (c KeycloakComponent) get(key string) string {
+	if values := c.Config[key]; len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+func (c KeycloakComponent) set(key, value string) {
+	if value != "" {
+		c.Config[key] = []string{value}
+	}
+}
+
+// ImportKeycloakConfig reads the JSON of a Keycloak LDAP user federation component, or of a realm export with one,
+// and returns the equivalent configuration: the server of its first connection URL, TLS settings and bind
+// credentials, the usersDn and the groups.dn of its group mapper as BaseDNs, the user filter of its user object
+// classes and custom search filter, the username attribute as the UserIDAttribute, and the group filter, name
+// attribute and membership of its group mapper. Bind credentials masked by the realm export are left out
+func ImportKeycloakConfig(r io.Reader) (config LDAPSyncConfig, err error) {
+	var doc struct {
+		KeycloakComponent
+		Components map[string][]KeycloakComponent `json:"components"` // of a realm export
+	}
+	if err = json.NewDecoder(r).Decode(&doc); err != nil {
+		return
+	}
+	component := doc.KeycloakComponent
+	if component.ProviderID != "ldap" {
+		found := false
+		for _, c := range doc.Components[keycloakUserStorage] {
+			if c.ProviderID == "ldap" {
+				component, found = c, true
+				break
+			}
+		}
+		if !found {
+			return config, fmt.Errorf("no LDAP user federation component")
+		}
+	}
+
+	u, err := url.Parse(strings.Fields(component.get("connectionUrl") + " ")[0])
+	if err != nil || u.Hostname() == "" {
+		return config, fmt.Errorf("invalid connectionUrl %q", component.get("connectionUrl"))
+	}
+	config.Server = u.Hostname()
+	port := u.Port()
+	switch {
+	case u.Scheme == "ldaps":
+		config.TLS = "tls"
+		if port == "" {
+			port = "636"
+		}
+	case component.get("startTls") == "true":
+		config.TLS = "starttls"
+	default:
+		config.TLS = "none"
+	}
+	if port != "" {
+		config.Port = &port
+	}
+	if component.get("authType") != "none" && component.get("bindDn") != "" {
+		config.RequiresAuthentication = true
+		config.SyncUserName = component.get("bindDn")
+		if credential := component.get("bindCredential"); credential != keycloakMaskedSecret {
+			config.SyncPassword = credential
+		}
+	}
+
+	if usersDN := component.get("usersDn"); usersDN != "" {
+		config.BaseDNs = []string{usersDN}
+	}
+	if config.UserFilter, err = keycloakFilter(component.get("userObjectClasses"), component.get("customUserSearchFilter")); err != nil {
+		return config, fmt.Errorf("customUserSearchFilter: %w", err)
+	}
+	config.UserIDAttribute = component.get("usernameLDAPAttribute")
+
+	for _, mapper := range component.SubComponents[keycloakMapper] {
+		if mapper.ProviderID == keycloakGroupMapper {
+			err = importKeycloakGroupMapper(&config, mapper)
+			break // only the first, a configuration has a single GroupFilter
+		}
+	}
+	return
+}
+
+// importKeycloakGroupMapper configures the groups of the group mapper
+func importKeycloakGroupMapper(config *LDAPSyncConfig, mapper KeycloakComponent) (err error) {
+	if groupsDN := mapper.get("groups.dn"); groupsDN != "" && !containsFold(config.BaseDNs, groupsDN) {
+		config.BaseDNs = append(config.BaseDNs, groupsDN)
+	}
+	if config.GroupFilter, err = keycloakFilter(mapper.get("group.object.classes"), mapper.get("groups.ldap.filter")); err != nil {
+		return fmt.Errorf("groups.ldap.filter: %w", err)
+	}
+	config.GroupIDAttribute = mapper.get("group.name.ldap.attribute")
+
+	membership := defaultString(mapper.get("membership.ldap.attribute"), "member")
+	constraint := Constraint{UserAttribute: "dn", GroupAttribute: membership}
+	switch {
+	case mapper.get("user.roles.retrieve.strategy") == "GET_GROUPS_FROM_USER_MEMBEROF_ATTRIBUTE":
+		constraint = Constraint{UserAttribute: defaultString(mapper.get("memberof.ldap.attribute"), "memberOf"), GroupAttribute: "dn"}
+	case mapper.get("membership.attribute.type") == "UID":
+		constraint.UserAttribute = defaultString(mapper.get("membership.user.ldap.attribute"), "uid")
+	}
+	config.GroupMembership = GroupMembershipAssociator{Constraints: []Constraint{constraint}}
+	if mapper.get("preserve.group.inheritance") == "false" {
+		config.MaxGroupNesting = -1
+	}
+	return
+}
+
+// keycloakFilter returns the filter of entries with all the comma separated object classes and matching the
+// custom LDAP filter, if any
+func keycloakFilter(objectClasses, custom string) (lf LDAPFilter, err error) {
+	for _, class := range strings.Split(objectClasses, ",") {
+		if class = strings.TrimSpace(class); class != "" {
+			lf.Filters = append(lf.Filters, FilterExpression{Name: "objectClass", Value: objectClassPattern(class)})
+		}
+	}
+	if custom = strings.TrimSpace(custom); custom != "" {
+		var customFilter LDAPFilter
+		if customFilter, err = ParseLDAPFilter(custom); err != nil {
+			return
+		}
+		lf.FilterGroups = append(lf.FilterGroups, customFilter)
+	}
+	return
+}
+
+// ExportKeycloakConfig returns the Keycloak LDAP user federation component (read-only, with a group mapper if groups
+// are configured) equivalent to the configuration, e.g. to replicate it in Keycloak. Keycloak searches a single
+// usersDn and groups.dn, the first BaseDN and the last one respectively, and filters entries with object classes and
+// an LDAP filter, so the user and group filters must be made of expressions that ParseLDAPFilter produces
+func ExportKeycloakConfig(config LDAPSyncConfig) (component KeycloakComponent, err error) {
+	var baseDNs []string
+	for _, baseDN := range config.BaseDNs {
+		if strings.EqualFold(baseDN, AutoBaseDN) {
+			return component, fmt.Errorf("base DN %q cannot be exported, Keycloak needs explicit base DNs", AutoBaseDN)
+		}
+		baseDNs = append(baseDNs, baseDNOf(baseDN))
+	}
+	if len(baseDNs) == 0 {
+		return component, fmt.Errorf("no baseDNs")
+	}
+
+	component = KeycloakComponent{
+		Name:          "ldap",
+		ProviderID:    "ldap",
+		ProviderType:  keycloakUserStorage,
+		Config:        make(map[string][]string),
+		SubComponents: make(map[string][]KeycloakComponent),
+	}
+	scheme, port := "ldap", "389"
+	if config.TLS == "tls" {
+		scheme, port = "ldaps", "636"
+	}
+	if config.Port != nil {
+		port = *config.Port
+	}
+	component.set("connectionUrl", scheme+"://"+net.JoinHostPort(config.Server, port))
+	component.set("startTls", fmt.Sprint(config.TLS == "starttls"))
+	if config.RequiresAuthentication {
+		component.set("authType", "simple")
+		component.set("bindDn", config.SyncUserName)
+		component.set("bindCredential", config.SyncPassword)
+	} else {
+		component.set("authType", "none")
+	}
+	component.set("editMode", "READ_ONLY")
+	component.set("searchScope", "2") // subtree
+	component.set("pagination", "true")
+	component.set("usersDn", baseDNs[0])
+
+	userID := defaultString(config.UserIDAttribute, "uid")
+	component.set("usernameLDAPAttribute", userID)
+	component.set("rdnLDAPAttribute", userID)
+	vendor, uuid := "other", "entryUUID"
+	if strings.EqualFold(userID, "sAMAccountName") || strings.EqualFold(userID, "userPrincipalName") {
+		vendor, uuid = "ad", "objectGUID"
+	}
+	component.set("vendor", vendor)
+	component.set("uuidLDAPAttribute", uuid)
+	classes, custom, err := keycloakObjectClasses(config.UserFilter)
+	if err != nil {
+		return component, fmt.Errorf("userFilter: %w", err)
+	}
+	component.set("userObjectClasses", defaultString(classes, "top"))
+	component.set("customUserSearchFilter", custom)
+
+	if config.GroupFilter.isEmpty() && config.GroupIDAttribute == "" && len(config.GroupMembership.constraints()) == 0 {
+		return
+	}
+	mapper := KeycloakComponent{Name: "groups", ProviderID: keycloakGroupMapper, Config: make(map[string][]string)}
+	mapper.set("mode", "READ_ONLY")
+	mapper.set("groups.dn", baseDNs[len(baseDNs)-1])
+	mapper.set("group.name.ldap.attribute", defaultString(config.GroupIDAttribute, "cn"))
+	if classes, custom, err = keycloakObjectClasses(config.GroupFilter); err != nil {
+		return component, fmt.Errorf("groupFilter: %w", err)
+	}
+	mapper.set("group.object.classes", defaultString(classes, "groupOfNames"))
+	mapper.set("groups.ldap.filter", custom)
+	mapper.set("membership.ldap.attribute", "member")
+	mapper.set("membership.attribute.type", "DN")
+	mapper.set("user.roles.retrieve.strategy", "LOAD_GROUPS_BY_MEMBER_ATTRIBUTE")
+	if constraints := config.GroupMembership.constraints(); len(constraints) > 0 {
+		switch c := constraints[0]; {
+		case strings.EqualFold(c.GroupAttribute, "dn"):
+			mapper.set("user.roles.retrieve.strategy", "GET_GROUPS_FROM_USER_MEMBEROF_ATTRIBUTE")
+			mapper.set("memberof.ldap.attribute", c.UserAttribute)
+		case strings.EqualFold(c.UserAttribute, "dn"):
+			mapper.set("membership.ldap.attribute", c.GroupAttribute)
+		default:
+			mapper.set("membership.ldap.attribute", c.GroupAttribute)
+			mapper.set("membership.attribute.type", "UID")
+			mapper.set("membership.user.ldap.attribute", c.UserAttribute)
+		}
+	}
+	mapper.set("preserve.group.inheritance", fmt.Sprint(config.MaxGroupNesting >= 0))
+	component.SubComponents[keycloakMapper] = []KeycloakComponent{mapper}
+	return
+}
+
+// keycloakObjectClasses splits the filter into the comma separated object classes it requires, and an LDAP filter
+// of the rest of it
+func keycloakObjectClasses(lf LDAPFilter) (classes, custom string, err error) {
+	rest := LDAPFilter{Operator: lf.Operator, FilterGroups: lf.FilterGroups}
+	var names []string
+	for _, fe := range lf.Filters {
+		if value, _, ok := assertionValue(fe.Value); ok && lf.Operator == And && strings.EqualFold(fe.Name, "objectClass") &&
+			!strings.Contains(value, "*") {
+			names = append(names, value)
+		} else {
+			rest.Filters = append(rest.Filters, fe)
+		}
+	}
+	if !rest.isEmpty() {
+		if custom, err = FormatLDAPFilter(rest); err != nil {
+			return
+		}
+	}
+	return strings.Join(names, ", "), custom, nil
+}
@@ -0,0 +1,183 @@
+package ldapsync
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// files of the service account mounted into the pods of a Kubernetes cluster
+const (
+	serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount/"
+	kubernetesTime    = "2006-01-02T15:04:05.000000Z07:00" // of the MicroTime fields of Leases
+)
+
+// KubernetesLease is a Lease kept in a coordination.k8s.io/v1 Lease object of a Kubernetes cluster, e.g. for the
+// replicas of a Deployment, through the REST API of the API server. Within a pod, it authenticates with the token of
+// the pod's service account, which needs the get, create and update verbs on the leases of the namespace. Expiry is
+// judged by the renewTime of the lease, so the clocks of the replicas should be synchronised
+type KubernetesLease struct {
+	Name      string
+	Namespace string       // of the lease, that of the pod's service account if empty
+	Server    string       // URL of the API server, that of the KUBERNETES_SERVICE_HOST and _PORT if empty
+	Token     string       // bearer token, the pod's service account token (read on each request, as it is rotated) if empty
+	Client    *http.Client // trusting the CA of the pod's service account if nil
+
+	once   sync.Once
+	client *http.Client
+	err    error
+}
+
+func NewKubernetesLease(name string) *KubernetesLease {
+	return &KubernetesLease{Name: name}
+}
+
+// kubernetesLease is a coordination.k8s.io/v1 Lease
+type kubernetesLease struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Metadata   struct {
+		Name            string `json:"name"`
+		Namespace       string `json:"namespace,omitempty"`
+		ResourceVersion string `json:"resourceVersion,omitempty"` // guards updates against concurrent ones
+	} `json:"metadata"`
+	Spec struct {
+		HolderIdentity       string `json:"holderIdentity,omitempty"`
+		LeaseDurationSeconds int    `json:"leaseDurationSeconds,omitempty"`
+		AcquireTime          string `json:"acquireTime,omitempty"`
+		RenewTime            string `json:"renewTime,omitempty"`
+		LeaseTransitions     int    `json:"leaseTransitions,omitempty"`
+	} `json:"spec"`
+}
+
+// expired determines whether the lease has no holder, or its holder did not renew it in time
+func (l kubernetesLease) expired(now time.Time) bool {
+	renewed, err := time.Parse(time.RFC3339Nano, l.Spec.RenewTime)
+	return l.Spec.HolderIdentity == "" || err != nil ||
+		now.After(renewed.Add(time.Duration(l.Spec.LeaseDurationSeconds)*time.Second))
+}
+
+func (k *KubernetesLease) Acquire(ctx context.Context, holder string, ttl time.Duration) (bool, error) {
+	now := time.Now()
+	var lease kubernetesLease
+	err := k.request(ctx, http.MethodGet, k.leaseURL(), nil, &lease)
+	if isStatus(err, http.StatusNotFound) {
+		lease.APIVersion, lease.Kind = "coordination.k8s.io/v1", "Lease"
+		lease.Metadata.Name = k.Name
+		lease.Spec.HolderIdentity, lease.Spec.LeaseDurationSeconds = holder, durationSeconds(ttl)
+		lease.Spec.AcquireTime, lease.Spec.RenewTime = now.UTC().Format(kubernetesTime), now.UTC().Format(kubernetesTime)
+		err = k.request(ctx, http.MethodPost, k.leasesURL(), lease, nil)
+		if isStatus(err, http.StatusConflict) {
+			return false, nil // another replica created it first
+		}
+		return err == nil, err
+	}
+	if err != nil {
+		return false, err
+	}
+	if lease.Spec.HolderIdentity != holder {
+		if !lease.expired(now) {
+			return false, nil
+		}
+		if lease.Spec.HolderIdentity != "" {
+			lease.Spec.LeaseTransitions++
+		}
+		lease.Spec.HolderIdentity, lease.Spec.AcquireTime = holder, now.UTC().Format(kubernetesTime)
+	}
+	lease.Spec.LeaseDurationSeconds, lease.Spec.RenewTime = durationSeconds(ttl), now.UTC().Format(kubernetesTime)
+	err = k.request(ctx, http.MethodPut, k.leaseURL(), lease, nil)
+	if isStatus(err, http.StatusConflict) {
+		return false, nil // another replica updated it since it was read
+	}
+	return err == nil, err
+}
+
+func (k *KubernetesLease) Release(ctx context.Context, holder string) error {
+	var lease kubernetesLease
+	if err := k.request(ctx, http.MethodGet, k.leaseURL(), nil, &lease); err != nil || lease.Spec.HolderIdentity != holder {
+		if isStatus(err, http.StatusNotFound) {
+			return nil
+		}
+		return err
+	}
+	lease.Spec.HolderIdentity, lease.Spec.AcquireTime, lease.Spec.RenewTime = "", "", ""
+	err := k.request(ctx, http.MethodPut, k.leaseURL(), lease, nil)
+	if isStatus(err, http.StatusConflict) {
+		return nil // another replica took it over
+	}
+	return err
+}
+
+// durationSeconds returns the ttl in whole seconds, at least one
+func durationSeconds(ttl time.Duration) int {
+	if seconds := int((ttl + time.Second - 1) / time.Second); seconds > 1 {
+		return seconds
+	}
+	return 1
+}
+
+func (k *KubernetesLease) leasesURL() string {
+	server := strings.TrimSuffix(k.Server, "/")
+	if server == "" {
+		server = "https://" + net.JoinHostPort(os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT"))
+	}
+	namespace := k.Namespace
+	if namespace == "" {
+		data, _ := os.ReadFile(serviceAccountDir + "namespace")
+		namespace = strings.TrimSpace(string(data))
+	}
+	return server + "/apis/coordination.k8s.io/v1/namespaces/" + url.PathEscape(namespace) + "/leases"
+}
+
+func (k *KubernetesLease) leaseURL() string {
+	return k.leasesURL() + "/" + url.PathEscape(k.Name)
+}
+
+func (k *KubernetesLease) request(ctx context.Context, method, url string, body, out interface{}) error {
+	client, err := k.httpClient()
+	if err != nil {
+		return err
+	}
+	token := k.Token
+	if token == "" {
+		data, err := os.ReadFile(serviceAccountDir + "token")
+		if err != nil {
+			return fmt.Errorf("reading the service account token: %w", err)
+		}
+		token = strings.TrimSpace(string(data))
+	}
+	header := http.Header{"Accept": {"application/json"}, "Authorization": {"Bearer " + token}}
+	return platformRequest(ctx, client, method, url, header, body, out)
+}
+
+// httpClient returns the configured client, or one trusting the CA of the service account
+func (k *KubernetesLease) httpClient() (*http.Client, error) {
+	if k.Client != nil {
+		return k.Client, nil
+	}
+	k.once.Do(func() {
+		ca, err := os.ReadFile(serviceAccountDir + "ca.crt")
+		if err != nil {
+			k.err = fmt.Errorf("reading the service account CA: %w", err)
+			return
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			k.err = errors.New("no certificates in the service account CA")
+			return
+		}
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}
+		k.client = &http.Client{Transport: transport, Timeout: 30 * time.Second}
+	})
+	return k.client, k.err
+}
@@ -0,0 +1,135 @@
+package ldapsync_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	ldapsync "github.com/adedayo/ldap-sync/pkg"
+)
+
+// leaseServer is an in-memory Kubernetes API server of the leases of the namespace default, whose updates are
+// guarded by the resourceVersion of the lease as those of the API server are
+type leaseServer struct {
+	mu       sync.Mutex
+	leases   map[string]map[string]interface{}
+	versions int
+	conflict bool // whether the next write conflicts with one of another replica
+}
+
+func (s *leaseServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if r.Header.Get("Authorization") != "Bearer token" {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	const prefix = "/apis/coordination.k8s.io/v1/namespaces/default/leases"
+	var lease map[string]interface{}
+	if r.Method != http.MethodGet {
+		if err := json.NewDecoder(r.Body).Decode(&lease); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if s.conflict {
+			s.conflict = false
+			http.Error(w, "the object has been modified", http.StatusConflict)
+			return
+		}
+	}
+	switch name := r.URL.Path[len(prefix):]; {
+	case r.Method == http.MethodPost && name == "":
+		name = lease["metadata"].(map[string]interface{})["name"].(string)
+		if s.leases[name] != nil {
+			http.Error(w, "already exists", http.StatusConflict)
+			return
+		}
+		s.write(name, lease)
+	case r.Method == http.MethodGet && s.leases[name[1:]] != nil:
+		json.NewEncoder(w).Encode(s.leases[name[1:]])
+	case r.Method == http.MethodPut && s.leases[name[1:]] != nil:
+		if lease["metadata"].(map[string]interface{})["resourceVersion"] != s.version(name[1:]) {
+			http.Error(w, "the object has been modified", http.StatusConflict)
+			return
+		}
+		s.write(name[1:], lease)
+	default:
+		http.Error(w, "not found", http.StatusNotFound)
+	}
+}
+
+func (s *leaseServer) write(name string, lease map[string]interface{}) {
+	s.versions++
+	lease["metadata"].(map[string]interface{})["resourceVersion"] = strconv.Itoa(s.versions)
+	s.leases[name] = lease
+}
+
+func (s *leaseServer) version(name string) interface{} {
+	return s.leases[name]["metadata"].(map[string]interface{})["resourceVersion"]
+}
+
+// spec returns the spec of the lease
+func (s *leaseServer) spec(name string) map[string]interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.leases[name] == nil {
+		return nil
+	}
+	return s.leases[name]["spec"].(map[string]interface{})
+}
+
+func newLeaseServer(t *testing.T) (*leaseServer, *ldapsync.KubernetesLease) {
+	server := &leaseServer{leases: map[string]map[string]interface{}{}}
+	httpServer := httptest.NewServer(server)
+	t.Cleanup(httpServer.Close)
+	return server, &ldapsync.KubernetesLease{Name: "ldap-sync", Namespace: "default", Server: httpServer.URL,
+		Token: "token", Client: httpServer.Client()}
+}
+
+func TestKubernetesLease(t *testing.T) {
+	server, lease := newLeaseServer(t)
+	ctx := context.Background()
+	acquire := func(holder string, want bool) {
+		t.Helper()
+		if held, err := lease.Acquire(ctx, holder, time.Minute); err != nil || held != want {
+			t.Fatalf("%s acquired %v with error %v, want %v", holder, held, err, want)
+		}
+	}
+
+	acquire("a", true) // creates the lease
+	if spec := server.spec("ldap-sync"); spec["holderIdentity"] != "a" || spec["leaseDurationSeconds"] != 60.0 {
+		t.Fatalf("created %v, want a lease of a for 60s", spec)
+	}
+	acquire("a", true) // renews it
+	acquire("b", false)
+
+	server.conflict = true
+	acquire("a", false) // another replica updated it since it was read
+
+	server.spec("ldap-sync")["renewTime"] = time.Now().Add(-2 * time.Minute).UTC().Format(time.RFC3339Nano)
+	acquire("b", true) // the lease of a expired
+	if spec := server.spec("ldap-sync"); spec["holderIdentity"] != "b" || spec["leaseTransitions"] != 1.0 {
+		t.Errorf("took over %v, want a lease of b after 1 transition", spec)
+	}
+
+	if err := lease.Release(ctx, "a"); err != nil || server.spec("ldap-sync")["holderIdentity"] != "b" {
+		t.Errorf("release by a replica not holding the lease: error %v, lease %v", err, server.spec("ldap-sync"))
+	}
+	if err := lease.Release(ctx, "b"); err != nil || server.spec("ldap-sync")["holderIdentity"] != nil {
+		t.Errorf("release: error %v, lease %v", err, server.spec("ldap-sync"))
+	}
+	acquire("a", true)
+}
+
+func TestKubernetesLeaseCreatedByAnotherReplica(t *testing.T) {
+	server, lease := newLeaseServer(t)
+	server.conflict = true
+	if held, err := lease.Acquire(context.Background(), "a", time.Minute); held || err != nil {
+		t.Errorf("acquired %v with error %v of a lease created concurrently", held, err)
+	}
+}
@@ -0,0 +1,132 @@
+package ldapsynctest
+
+import (
+	"strconv"
+	"strings"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	"github.com/go-ldap/ldap/v3"
+)
+
+// the bitwise matching rules of Active Directory, e.g. for userAccountControl flags
+const (
+	matchingRuleBitAnd = "1.2.840.113556.1.4.803"
+	matchingRuleBitOr  = "1.2.840.113556.1.4.804"
+)
+
+// matches determines whether the entry matches the encoded RFC 4511 filter. Values are compared case-insensitively,
+// and numerically when ordered if both are integers
+func (e entry) matches(filter *ber.Packet) bool {
+	switch filter.Tag {
+	case ldap.FilterAnd:
+		for _, f := range filter.Children {
+			if !e.matches(f) {
+				return false
+			}
+		}
+		return true
+	case ldap.FilterOr:
+		for _, f := range filter.Children {
+			if e.matches(f) {
+				return true
+			}
+		}
+		return false
+	case ldap.FilterNot:
+		return len(filter.Children) == 1 && !e.matches(filter.Children[0])
+	case ldap.FilterPresent:
+		return e.has(filter.Data.String(), func(string) bool { return true })
+	case ldap.FilterSubstrings:
+		return len(filter.Children) == 2 && e.has(stringOf(filter.Children[0]), func(v string) bool {
+			return substringsMatch(strings.ToLower(v), filter.Children[1].Children)
+		})
+	case ldap.FilterExtensibleMatch:
+		return e.extensibleMatch(filter)
+	}
+	if len(filter.Children) != 2 {
+		return false
+	}
+	name, value := stringOf(filter.Children[0]), stringOf(filter.Children[1])
+	switch filter.Tag {
+	case ldap.FilterEqualityMatch, ldap.FilterApproxMatch:
+		return e.has(name, func(v string) bool { return strings.EqualFold(v, value) })
+	case ldap.FilterGreaterOrEqual:
+		return e.has(name, func(v string) bool { return compare(v, value) >= 0 })
+	case ldap.FilterLessOrEqual:
+		return e.has(name, func(v string) bool { return compare(v, value) <= 0 })
+	}
+	return false
+}
+
+// substringsMatch determines whether the lower-cased value has the initial, any and final substrings, in order
+func substringsMatch(value string, substrings []*ber.Packet) bool {
+	for _, s := range substrings {
+		part := strings.ToLower(s.Data.String())
+		switch s.Tag {
+		case ldap.FilterSubstringsInitial:
+			if !strings.HasPrefix(value, part) {
+				return false
+			}
+			value = value[len(part):]
+		case ldap.FilterSubstringsAny:
+			i := strings.Index(value, part)
+			if i < 0 {
+				return false
+			}
+			value = value[i+len(part):]
+		case ldap.FilterSubstringsFinal:
+			if !strings.HasSuffix(value, part) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// extensibleMatch evaluates an extensible match: the bitwise rules of Active Directory, or else equality
+func (e entry) extensibleMatch(filter *ber.Packet) bool {
+	var rule, name, value string
+	for _, child := range filter.Children {
+		switch child.Tag {
+		case ldap.MatchingRuleAssertionMatchingRule:
+			rule = child.Data.String()
+		case ldap.MatchingRuleAssertionType:
+			name = child.Data.String()
+		case ldap.MatchingRuleAssertionMatchValue:
+			value = child.Data.String()
+		}
+	}
+	switch rule {
+	case matchingRuleBitAnd, matchingRuleBitOr:
+		mask, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return false
+		}
+		return e.has(name, func(v string) bool {
+			flags, err := strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				return false
+			}
+			if rule == matchingRuleBitAnd {
+				return flags&mask == mask
+			}
+			return flags&mask != 0
+		})
+	}
+	return name != "" && e.has(name, func(v string) bool { return strings.EqualFold(v, value) })
+}
+
+// compare orders the values numerically if both are integers, otherwise case-insensitively
+func compare(a, b string) int {
+	x, errA := strconv.ParseInt(a, 10, 64)
+	y, errB := strconv.ParseInt(b, 10, 64)
+	switch {
+	case errA == nil && errB == nil && x < y:
+		return -1
+	case errA == nil && errB == nil && x > y:
+		return 1
+	case errA == nil && errB == nil:
+		return 0
+	}
+	return strings.Compare(strings.ToLower(a), strings.ToLower(b))
+}
@@ -0,0 +1,520 @@
+// Package ldapsynctest provides an in-memory LDAP server serving fixture entries, so that sync configurations,
+// filters and membership rules can be tested without a directory server such as OpenLDAP or Active Directory.
+//
+//	server, err := ldapsynctest.NewServer(
+//		ldapsynctest.Entry("uid=alice,ou=people,dc=example,dc=com", "objectClass", "person", "uid", "alice"),
+//		ldapsynctest.Entry("cn=admins,ou=groups,dc=example,dc=com", "objectClass", "groupOfNames",
+//			"member", "uid=alice,ou=people,dc=example,dc=com"),
+//	)
+//	...
+//	defer server.Close()
+//	config := server.Config("dc=example,dc=com")
+//	config.UserFilter, _ = ldapsync.ParseLDAPFilter("(objectClass=person)")
+//	records, err := ldapsync.Do(config)
+//
+// The server answers binds, searches (with the paged results control) and compares, over plain LDAP on the
+// loopback interface. It refuses updates. Binds succeed anonymously, or with the cleartext userPassword of an entry.
+// Searches return at most the size limit of the request, if any, of the matching entries, reporting that the limit
+// was exceeded if more match, so truncated syncs can be tested too.
+// Entries of the referral object class refer searches of their subtrees to the LDAP URLs of their ref attribute, as
+// per RFC 3296, e.g. to another Server
+package ldapsynctest
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	ldapsync "github.com/adedayo/ldap-sync/pkg"
+	ber "github.com/go-asn1-ber/asn1-ber"
+	"github.com/go-ldap/ldap/v3"
+)
+
+// Server is an in-memory LDAP server of fixture entries
+type Server struct {
+	entries  []entry
+	dns      map[string]int // positions of the entries by normalized DN
+	listener net.Listener
+	wg       sync.WaitGroup
+	mu       sync.Mutex
+	conns    map[net.Conn]bool
+	closed   bool
+}
+
+type entry struct {
+	dn         string
+	attributes []attribute
+}
+
+type attribute struct {
+	name   string
+	values [][]byte
+}
+
+// Entry returns a fixture entry with the DN and attribute values, given as name, value pairs. Names may repeat to
+// give an attribute several values
+func Entry(dn string, nameValues ...string) *ldapsync.LDAPEntry {
+	var attributes []ldapsync.LDAPAttribute
+	positions := make(map[string]int)
+	for i := 0; i+1 < len(nameValues); i += 2 {
+		name, value := nameValues[i], nameValues[i+1]
+		key := strings.ToLower(name)
+		if p, exists := positions[key]; exists {
+			attributes[p].Values = append(attributes[p].Values, value)
+			continue
+		}
+		positions[key] = len(attributes)
+		attributes = append(attributes, ldapsync.LDAPAttribute{Name: name, Values: []string{value}})
+	}
+	return ldapsync.NewLDAPEntry(dn, attributes)
+}
+
+// NewServer starts a server of the entries, listening on a free port of the loopback interface
+func NewServer(entries ...*ldapsync.LDAPEntry) (*Server, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	s := &Server{dns: make(map[string]int), listener: listener, conns: make(map[net.Conn]bool)}
+	for _, ent := range entries {
+		e := entry{dn: ent.DN}
+		for _, att := range ent.Attributes {
+			e.attributes = append(e.attributes, attribute{name: att.Name, values: att.RawValues()})
+		}
+		key := normalizeDN(ent.DN)
+		if _, exists := s.dns[key]; exists {
+			listener.Close()
+			return nil, fmt.Errorf("duplicate fixture entry %s", ent.DN)
+		}
+		s.dns[key] = len(s.entries)
+		s.entries = append(s.entries, e)
+	}
+	s.wg.Add(1)
+	go s.serve()
+	return s, nil
+}
+
+// NewServerFromLDIF starts a server of the entries of the LDIF, see NewServer and ldapsync.ReadLDIF
+func NewServerFromLDIF(r io.Reader) (*Server, error) {
+	entries, err := ldapsync.ReadLDIF(r)
+	if err != nil {
+		return nil, err
+	}
+	return NewServer(entries...)
+}
+
+// Addr returns the address the server listens on, host:port
+func (s *Server) Addr() string {
+	return s.listener.Addr().String()
+}
+
+// Config returns a sync configuration of the server, anonymous and without TLS, searching the BaseDNs. The
+// configuration is otherwise empty, for the test to set its filters and membership rules
+func (s *Server) Config(baseDNs ...string) ldapsync.LDAPSyncConfig {
+	host, port, _ := net.SplitHostPort(s.Addr())
+	return ldapsync.LDAPSyncConfig{Server: host, Port: &port, TLS: "none", BaseDNs: baseDNs}
+}
+
+// Close stops the server, closing its connections
+func (s *Server) Close() error {
+	s.mu.Lock()
+	s.closed = true
+	for c := range s.conns {
+		c.Close()
+	}
+	s.mu.Unlock()
+	err := s.listener.Close()
+	s.wg.Wait()
+	return err
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+	for {
+		c, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			c.Close()
+			return
+		}
+		s.conns[c] = true
+		s.mu.Unlock()
+		s.wg.Add(1)
+		go s.handle(c)
+	}
+}
+
+// handle serves the requests of the connection, one at a time, until it is closed or unbound
+func (s *Server) handle(c net.Conn) {
+	defer s.wg.Done()
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, c)
+		s.mu.Unlock()
+		c.Close()
+	}()
+	for {
+		packet, err := ber.ReadPacket(c)
+		if err != nil || len(packet.Children) < 2 {
+			return
+		}
+		id, _ := packet.Children[0].Value.(int64)
+		request := packet.Children[1]
+		var controls []*ber.Packet
+		if len(packet.Children) > 2 {
+			controls = packet.Children[2].Children
+		}
+		var responses []*ber.Packet
+		switch request.Tag {
+		case ldap.ApplicationUnbindRequest:
+			return
+		case ldap.ApplicationAbandonRequest:
+			continue // requests are answered in full before the next is read
+		case ldap.ApplicationBindRequest:
+			responses = []*ber.Packet{s.bind(id, request)}
+		case ldap.ApplicationSearchRequest:
+			responses = s.search(id, request, controls)
+		case ldap.ApplicationCompareRequest:
+			responses = []*ber.Packet{s.compare(id, request)}
+		case ldap.ApplicationModifyRequest, ldap.ApplicationAddRequest, ldap.ApplicationDelRequest,
+			ldap.ApplicationModifyDNRequest:
+			responses = []*ber.Packet{result(id, request.Tag+1, ldap.LDAPResultUnwillingToPerform, "", "the test server is read-only")}
+		case ldap.ApplicationExtendedRequest:
+			responses = []*ber.Packet{result(id, ldap.ApplicationExtendedResponse, ldap.LDAPResultProtocolError, "", "unsupported extended operation")}
+		default:
+			return // not a request the server knows how to answer
+		}
+		for _, response := range responses {
+			if _, err = c.Write(response.Bytes()); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// bind binds anonymously, or as an entry with its cleartext userPassword
+func (s *Server) bind(id int64, request *ber.Packet) *ber.Packet {
+	if len(request.Children) < 3 {
+		return result(id, ldap.ApplicationBindResponse, ldap.LDAPResultProtocolError, "", "invalid bind request")
+	}
+	name, auth := stringOf(request.Children[1]), request.Children[2]
+	if auth.ClassType != ber.ClassContext || auth.Tag != 0 {
+		return result(id, ldap.ApplicationBindResponse, ldap.LDAPResultAuthMethodNotSupported, "", "only simple binds are supported")
+	}
+	password := auth.Data.String()
+	if name == "" && password == "" {
+		return result(id, ldap.ApplicationBindResponse, ldap.LDAPResultSuccess, "", "")
+	}
+	if i, exists := s.dns[normalizeDN(name)]; exists && password != "" {
+		for _, value := range s.entries[i].values("userPassword") {
+			if string(value) == password {
+				return result(id, ldap.ApplicationBindResponse, ldap.LDAPResultSuccess, "", "")
+			}
+		}
+	}
+	return result(id, ldap.ApplicationBindResponse, ldap.LDAPResultInvalidCredentials, "", "invalid credentials")
+}
+
+// search answers the search with the matching entries, a page at a time if the request has the paging control
+func (s *Server) search(id int64, request *ber.Packet, controls []*ber.Packet) []*ber.Packet {
+	if len(request.Children) < 8 {
+		return []*ber.Packet{result(id, ldap.ApplicationSearchResultDone, ldap.LDAPResultProtocolError, "", "invalid search request")}
+	}
+	base := stringOf(request.Children[0])
+	scope, _ := request.Children[1].Value.(int64)
+	sizeLimit, _ := request.Children[3].Value.(int64)
+	filter := request.Children[6]
+	var attributes []string
+	for _, att := range request.Children[7].Children {
+		attributes = append(attributes, stringOf(att))
+	}
+
+	var paging *ldap.ControlPaging
+	for _, packet := range controls {
+		control, err := ldap.DecodeControl(packet)
+		if err != nil {
+			return []*ber.Packet{result(id, ldap.ApplicationSearchResultDone, ldap.LDAPResultProtocolError, "", err.Error())}
+		}
+		if p, ok := control.(*ldap.ControlPaging); ok {
+			paging = p
+		} else if critical(packet) {
+			return []*ber.Packet{result(id, ldap.ApplicationSearchResultDone, ldap.LDAPResultUnavailableCriticalExtension, "",
+				"unsupported critical control "+control.GetControlType())}
+		}
+	}
+
+	if base == "" && scope == ldap.ScopeBaseObject {
+		return []*ber.Packet{
+			searchEntry(id, s.rootDSE(), attributes),
+			result(id, ldap.ApplicationSearchResultDone, ldap.LDAPResultSuccess, "", ""),
+		}
+	}
+	if ref, referred := s.referralAbove(base); referred {
+		return []*ber.Packet{referral(id, ref.values("ref"))}
+	}
+	if _, exists := s.dns[normalizeDN(base)]; !exists && base != "" {
+		return []*ber.Packet{result(id, ldap.ApplicationSearchResultDone, ldap.LDAPResultNoSuchObject, "", "no entry "+base)}
+	}
+	var found []entry
+	var references []*ber.Packet // of the referral entries in scope, whose subtrees are left out
+	for _, e := range s.entries {
+		if !inScope(e.dn, base, int(scope)) {
+			continue
+		}
+		if ref, referred := s.referralAbove(e.dn); referred {
+			if ref.dn == e.dn {
+				references = append(references, reference(id, ref.values("ref")))
+			}
+			continue
+		}
+		if e.matches(filter) {
+			found = append(found, e)
+		}
+	}
+
+	code := uint16(ldap.LDAPResultSuccess)
+	if sizeLimit > 0 && int64(len(found)) > sizeLimit {
+		found, code = found[:sizeLimit], ldap.LDAPResultSizeLimitExceeded // reported with the last page
+	}
+	var done *ber.Packet
+	if paging != nil && paging.PagingSize > 0 {
+		offset, _ := strconv.Atoi(string(paging.Cookie))
+		if offset > len(found) {
+			offset = len(found)
+		}
+		end, next := offset+int(paging.PagingSize), ""
+		if end < len(found) {
+			next, code = strconv.Itoa(end), ldap.LDAPResultSuccess
+		} else {
+			end = len(found)
+		}
+		if offset > 0 {
+			references = nil // sent with the first page
+		}
+		found = found[offset:end]
+		done = result(id, ldap.ApplicationSearchResultDone, code, "", "")
+		response := ldap.NewControlPaging(0)
+		response.SetCookie([]byte(next))
+		done.AppendChild(encodeControls(response))
+	} else {
+		done = result(id, ldap.ApplicationSearchResultDone, code, "", "")
+	}
+	responses := make([]*ber.Packet, 0, len(found)+len(references)+1)
+	for _, e := range found {
+		responses = append(responses, searchEntry(id, e, attributes))
+	}
+	responses = append(responses, references...)
+	return append(responses, done)
+}
+
+// referralAbove returns the referral entry that is, or is an ancestor of, the DN, if any
+func (s *Server) referralAbove(dn string) (ref entry, found bool) {
+	for _, e := range s.entries {
+		if e.has("objectClass", func(v string) bool { return strings.EqualFold(v, "referral") }) &&
+			ldapsync.DNIsUnder(dn, e.dn) {
+			return e, true
+		}
+	}
+	return
+}
+
+// compare answers whether the entry has the attribute value, compared case-insensitively
+func (s *Server) compare(id int64, request *ber.Packet) *ber.Packet {
+	if len(request.Children) < 2 || len(request.Children[1].Children) < 2 {
+		return result(id, ldap.ApplicationCompareResponse, ldap.LDAPResultProtocolError, "", "invalid compare request")
+	}
+	dn := stringOf(request.Children[0])
+	i, exists := s.dns[normalizeDN(dn)]
+	if !exists {
+		return result(id, ldap.ApplicationCompareResponse, ldap.LDAPResultNoSuchObject, "", "no entry "+dn)
+	}
+	assertion := request.Children[1]
+	name, value := stringOf(assertion.Children[0]), stringOf(assertion.Children[1])
+	code := uint16(ldap.LDAPResultCompareFalse)
+	if s.entries[i].has(name, func(v string) bool { return strings.EqualFold(v, value) }) {
+		code = ldap.LDAPResultCompareTrue
+	}
+	return result(id, ldap.ApplicationCompareResponse, code, "", "")
+}
+
+// rootDSE returns the RootDSE, whose namingContexts are the entries without a parent among the fixtures
+func (s *Server) rootDSE() entry {
+	var contexts [][]byte
+	for _, e := range s.entries {
+		if parent, err := ldapsync.ParentDN(e.dn); err == nil {
+			if _, exists := s.dns[normalizeDN(parent)]; !exists {
+				contexts = append(contexts, []byte(e.dn))
+			}
+		}
+	}
+	sort.Slice(contexts, func(i, j int) bool { return string(contexts[i]) < string(contexts[j]) })
+	return entry{attributes: []attribute{
+		{name: "objectClass", values: [][]byte{[]byte("top")}},
+		{name: "namingContexts", values: contexts},
+		{name: "supportedLDAPVersion", values: [][]byte{[]byte("3")}},
+		{name: "supportedControl", values: [][]byte{[]byte(ldap.ControlTypePaging)}},
+		{name: "vendorName", values: [][]byte{[]byte("ldapsynctest")}},
+	}}
+}
+
+// values returns the values of the attribute, of its type with any options
+func (e entry) values(name string) (values [][]byte) {
+	for _, att := range e.attributes {
+		if sameType(att.name, name) {
+			values = append(values, att.values...)
+		}
+	}
+	return
+}
+
+// has determines whether a value of the attribute satisfies the predicate
+func (e entry) has(name string, predicate func(string) bool) bool {
+	if strings.EqualFold(name, "objectClass") && predicate("top") {
+		return true
+	}
+	for _, v := range e.values(name) {
+		if predicate(string(v)) {
+			return true
+		}
+	}
+	return false
+}
+
+// sameType determines whether the attribute descriptions are of the same type, e.g. cn and cn;lang-en
+func sameType(a, b string) bool {
+	a, _, _ = strings.Cut(a, ";")
+	b, _, _ = strings.Cut(b, ";")
+	return strings.EqualFold(a, b)
+}
+
+// selected determines whether the attribute is among those requested: all user attributes if none or *
+func selected(name string, requested []string) bool {
+	if len(requested) == 0 {
+		return true
+	}
+	for _, r := range requested {
+		if r == "*" || sameType(r, name) {
+			return true
+		}
+	}
+	return false
+}
+
+func searchEntry(id int64, e entry, requested []string) *ber.Packet {
+	op := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ldap.ApplicationSearchResultEntry, nil, "Search Result Entry")
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, e.dn, "DN"))
+	attributes := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Attributes")
+	for _, att := range e.attributes {
+		if !selected(att.name, requested) {
+			continue
+		}
+		a := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Attribute")
+		a.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, att.name, "Type"))
+		values := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "Values")
+		for _, v := range att.values {
+			values.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, string(v), "Value"))
+		}
+		a.AppendChild(values)
+		attributes.AppendChild(a)
+	}
+	op.AppendChild(attributes)
+	return message(id, op)
+}
+
+// result returns the response of the operation with the result code. Response controls are appended to it
+func result(id int64, tag ber.Tag, code uint16, matchedDN, diagnostic string) *ber.Packet {
+	return message(id, resultOp(tag, code, matchedDN, diagnostic))
+}
+
+// resultOp returns the protocol operation of the result, to be completed before its message is encoded
+func resultOp(tag ber.Tag, code uint16, matchedDN, diagnostic string) *ber.Packet {
+	op := ber.Encode(ber.ClassApplication, ber.TypeConstructed, tag, nil, ldap.ApplicationMap[uint8(tag)])
+	op.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, int64(code), "Result Code"))
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, matchedDN, "Matched DN"))
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, diagnostic, "Diagnostic Message"))
+	return op
+}
+
+// referral returns the search result referring the search to the URLs
+func referral(id int64, urls [][]byte) *ber.Packet {
+	op := resultOp(ldap.ApplicationSearchResultDone, ldap.LDAPResultReferral, "", "referral")
+	refs := ber.Encode(ber.ClassContext, ber.TypeConstructed, 3, nil, "Referral")
+	for _, url := range urls {
+		refs.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, string(url), "URI"))
+	}
+	op.AppendChild(refs)
+	return message(id, op)
+}
+
+// reference returns the search result reference continuing the search at the URLs
+func reference(id int64, urls [][]byte) *ber.Packet {
+	op := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ldap.ApplicationSearchResultReference, nil,
+		"Search Result Reference")
+	for _, url := range urls {
+		op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, string(url), "URI"))
+	}
+	return message(id, op)
+}
+
+// message returns the LDAP message of the protocol operation
+func message(id int64, op *ber.Packet) *ber.Packet {
+	envelope := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "LDAP Response")
+	envelope.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, id, "Message ID"))
+	envelope.AppendChild(op)
+	return envelope
+}
+
+func encodeControls(controls ...ldap.Control) *ber.Packet {
+	packet := ber.Encode(ber.ClassContext, ber.TypeConstructed, 0, nil, "Controls")
+	for _, control := range controls {
+		packet.AppendChild(control.Encode())
+	}
+	return packet
+}
+
+// critical determines whether the encoded request control is critical
+func critical(control *ber.Packet) bool {
+	if len(control.Children) < 2 {
+		return false
+	}
+	criticality, _ := control.Children[1].Value.(bool)
+	return criticality
+}
+
+// stringOf returns the string of an octet string packet
+func stringOf(packet *ber.Packet) string {
+	if s, ok := packet.Value.(string); ok {
+		return s
+	}
+	return packet.Data.String()
+}
+
+// normalizeDN normalizes the DN for comparisons, case-insensitively and regardless of the spacing of its RDNs
+func normalizeDN(dn string) string {
+	d, err := ldap.ParseDN(dn)
+	if err != nil {
+		return strings.ToLower(dn)
+	}
+	return strings.ToLower(d.String())
+}
+
+// inScope determines whether the entry with the DN is in the scope of a search from the base DN
+func inScope(dn, base string, scope int) bool {
+	switch scope {
+	case ldap.ScopeBaseObject:
+		return normalizeDN(dn) == normalizeDN(base)
+	case ldap.ScopeSingleLevel:
+		parent, err := ldapsync.ParentDN(dn)
+		return err == nil && normalizeDN(parent) == normalizeDN(base)
+	default:
+		return base == "" || ldapsync.DNIsUnder(dn, base)
+	}
+}
@@ -0,0 +1,73 @@
+package ldapsynctest
+
+import (
+	"testing"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+func newTestServer(t *testing.T) *Server {
+	t.Helper()
+	server, err := NewServer(
+		Entry("dc=example,dc=com", "objectClass", "domain", "dc", "example"),
+		Entry("uid=alice,dc=example,dc=com", "objectClass", "person", "uid", "alice", "userPassword", "secret"),
+		Entry("uid=bob,dc=example,dc=com", "objectClass", "person", "uid", "bob"),
+		Entry("uid=carol,dc=example,dc=com", "objectClass", "person", "uid", "carol"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { server.Close() })
+	return server
+}
+
+func dial(t *testing.T, server *Server) *ldap.Conn {
+	t.Helper()
+	l, err := ldap.DialURL("ldap://" + server.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	return l
+}
+
+func entries(sr *ldap.SearchResult) int {
+	if sr == nil {
+		return 0
+	}
+	return len(sr.Entries)
+}
+
+func TestBind(t *testing.T) {
+	l := dial(t, newTestServer(t))
+	if err := l.Bind("uid=alice,dc=example,dc=com", "secret"); err != nil {
+		t.Errorf("bind with the password: %v", err)
+	}
+	if err := l.Bind("uid=alice,dc=example,dc=com", "wrong"); !ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+		t.Errorf("bind with a wrong password: %v, want invalid credentials", err)
+	}
+	if err := l.Bind("uid=bob,dc=example,dc=com", "secret"); !ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+		t.Errorf("bind of an entry without a password: %v, want invalid credentials", err)
+	}
+}
+
+func TestSearchSizeLimit(t *testing.T) {
+	l := dial(t, newTestServer(t))
+	people := func(sizeLimit int) *ldap.SearchRequest {
+		return ldap.NewSearchRequest("dc=example,dc=com", ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, sizeLimit, 0,
+			false, "(objectClass=person)", []string{"uid"}, nil)
+	}
+	sr, err := l.Search(people(2))
+	if !ldap.IsErrorWithCode(err, ldap.LDAPResultSizeLimitExceeded) || sr == nil || len(sr.Entries) != 2 {
+		t.Errorf("search of 3 people limited to 2: %d entries, error %v", entries(sr), err)
+	}
+
+	sr, err = l.SearchWithPaging(people(2), 1)
+	if !ldap.IsErrorWithCode(err, ldap.LDAPResultSizeLimitExceeded) || sr == nil || len(sr.Entries) != 2 {
+		t.Errorf("paged search of 3 people limited to 2: %d entries, error %v", entries(sr), err)
+	}
+
+	if sr, err = l.SearchWithPaging(people(3), 2); err != nil || len(sr.Entries) != 3 {
+		t.Errorf("paged search of 3 people limited to 3: %d entries, error %v", entries(sr), err)
+	}
+}
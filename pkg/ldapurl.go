@@ -0,0 +1,145 @@
+package ldapsync
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+// LDAPURL is an RFC 4516 LDAP URL, e.g. ldap:///ou=people,dc=example,dc=com?uid,mail?sub?(objectClass=person),
+// which may be used as a BaseDN to express the attributes, scope and filter of its search
+type LDAPURL struct {
+	Scheme     string   // ldap or ldaps
+	Host       string   // host[:port], empty for the configured server
+	DN         string   // the base of the search
+	Attributes []string // attributes to retrieve, all user attributes if empty
+	Scope      int      // ldap.ScopeBaseObject (the default), ldap.ScopeSingleLevel or ldap.ScopeWholeSubtree
+	Filter     string   // defaults to (objectClass=*)
+	Extensions []string // non-critical extensions, which are ignored
+}
+
+// isLDAPURL determines whether the BaseDN is an LDAP URL rather than a DN
+func isLDAPURL(baseDN string) bool {
+	lower := strings.ToLower(baseDN)
+	return strings.HasPrefix(lower, "ldap://") || strings.HasPrefix(lower, "ldaps://")
+}
+
+// ParseLDAPURL parses an RFC 4516 LDAP URL. Critical extensions are rejected as they are not supported
+func ParseLDAPURL(rawURL string) (u LDAPURL, err error) {
+	if !isLDAPURL(rawURL) {
+		err = fmt.Errorf("not an LDAP URL: %s", rawURL)
+		return
+	}
+	i := strings.Index(rawURL, "://")
+	u.Scheme = strings.ToLower(rawURL[:i])
+	rest := rawURL[i+3:]
+	u.Host, rest = cut(rest, "/")
+	u.Scope = ldap.ScopeBaseObject
+	u.Filter = "(objectClass=*)"
+
+	parts := strings.SplitN(rest, "?", 5)
+	for len(parts) < 5 {
+		parts = append(parts, "")
+	}
+	decoded := make([]string, 4)
+	for i, part := range parts[:4] {
+		if decoded[i], err = url.PathUnescape(part); err != nil {
+			err = fmt.Errorf("invalid LDAP URL %s: %w", rawURL, err)
+			return
+		}
+	}
+
+	if u.DN = decoded[0]; u.DN != "" {
+		if _, err = ldap.ParseDN(u.DN); err != nil {
+			err = fmt.Errorf("invalid DN in LDAP URL %s: %w", rawURL, err)
+			return
+		}
+	}
+	if decoded[1] != "" {
+		u.Attributes = strings.Split(decoded[1], ",")
+	}
+	if u.Scope, err = parseScope(decoded[2], ldap.ScopeBaseObject); err != nil {
+		err = fmt.Errorf("%w in LDAP URL %s", err, rawURL)
+		return
+	}
+	if decoded[3] != "" {
+		if _, err = ldap.CompileFilter(decoded[3]); err != nil {
+			err = fmt.Errorf("invalid filter in LDAP URL %s: %w", rawURL, err)
+			return
+		}
+		u.Filter = decoded[3]
+	}
+	if parts[4] != "" {
+		for _, ext := range strings.Split(parts[4], ",") {
+			if ext, err = url.PathUnescape(ext); err != nil {
+				err = fmt.Errorf("invalid LDAP URL %s: %w", rawURL, err)
+				return
+			}
+			if strings.HasPrefix(ext, "!") {
+				err = fmt.Errorf("unsupported critical extension %q in LDAP URL %s", ext, rawURL)
+				return
+			}
+			u.Extensions = append(u.Extensions, ext)
+		}
+	}
+	return
+}
+
+// parseScope parses the scope of a search: base, one or sub, or the default if empty
+func parseScope(scope string, defaultScope int) (int, error) {
+	switch strings.ToLower(scope) {
+	case "":
+		return defaultScope, nil
+	case "base":
+		return ldap.ScopeBaseObject, nil
+	case "one":
+		return ldap.ScopeSingleLevel, nil
+	case "sub":
+		return ldap.ScopeWholeSubtree, nil
+	default:
+		return 0, fmt.Errorf("unsupported scope %q", scope)
+	}
+}
+
+// cut slices s around the first instance of sep, as strings.Cut
+func cut(s, sep string) (before, after string) {
+	if i := strings.Index(s, sep); i >= 0 {
+		return s[:i], s[i+len(sep):]
+	}
+	return s, ""
+}
+
+// newSearchRequest returns the request searching the BaseDN, which may be a DN (searched entirely for all
+// attributes) or an LDAP URL on the configured server
+func newSearchRequest(baseDN string) (*ldap.SearchRequest, error) {
+	if !isLDAPURL(baseDN) {
+		return ldap.NewSearchRequest(
+			baseDN, // The base dn to search
+			ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 0, 0, false,
+			"(&(objectClass=*))", // The filter to apply - get everything
+			[]string{},           // A list attributes to retrieve - get all attributes
+			[]ldap.Control{},
+		), nil
+	}
+	u, err := ParseLDAPURL(baseDN)
+	if err != nil {
+		return nil, err
+	}
+	if u.Host != "" {
+		return nil, fmt.Errorf("LDAP URL %s names a host, only the configured server is searched", baseDN)
+	}
+	return ldap.NewSearchRequest(u.DN, u.Scope, ldap.NeverDerefAliases, 0, 0, false,
+		u.Filter, append([]string{}, u.Attributes...), []ldap.Control{}), nil
+}
+
+// baseDNOf returns the DN of the BaseDN, which may be an LDAP URL
+func baseDNOf(baseDN string) string {
+	if isLDAPURL(baseDN) {
+		if u, err := ParseLDAPURL(baseDN); err == nil {
+			return u.DN
+		}
+	}
+	return baseDN
+}
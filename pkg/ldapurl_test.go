@@ -0,0 +1,61 @@
+package ldapsync_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/go-ldap/ldap/v3"
+
+	ldapsync "github.com/adedayo/ldap-sync/pkg"
+)
+
+func TestParseLDAPURL(t *testing.T) {
+	u, err := ldapsync.ParseLDAPURL("LDAPS://ldap.example.com:636/ou=people,dc=example,dc=com?uid,mail?one?(objectClass=person)?x-ext")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := ldapsync.LDAPURL{Scheme: "ldaps", Host: "ldap.example.com:636", DN: "ou=people,dc=example,dc=com",
+		Attributes: []string{"uid", "mail"}, Scope: ldap.ScopeSingleLevel, Filter: "(objectClass=person)",
+		Extensions: []string{"x-ext"}}
+	if fmt.Sprint(u) != fmt.Sprint(want) {
+		t.Errorf("parsed %+v, want %+v", u, want)
+	}
+
+	if u, err = ldapsync.ParseLDAPURL("ldap:///ou=a%20b,dc=example,dc=com"); err != nil {
+		t.Fatal(err)
+	}
+	if u.DN != "ou=a b,dc=example,dc=com" || u.Scope != ldap.ScopeBaseObject || u.Filter != "(objectClass=*)" ||
+		u.Attributes != nil {
+		t.Errorf("parsed %+v, want the defaults of a percent-decoded DN", u)
+	}
+
+	for _, invalid := range []string{
+		"ou=people,dc=example,dc=com",
+		"ldap:///not a DN",
+		"ldap:///dc=example,dc=com??subtree",
+		"ldap:///dc=example,dc=com???(objectClass=person",
+		"ldap:///dc=example,dc=com????!x-critical",
+		"ldap:///dc=example,dc=com%zz",
+	} {
+		if u, err := ldapsync.ParseLDAPURL(invalid); err == nil {
+			t.Errorf("%s: parsed %+v", invalid, u)
+		}
+	}
+}
+
+func TestSyncOfLDAPURLs(t *testing.T) {
+	_, config := fixture(t)
+	config.BaseDNs = []string{"ldap:///ou=people,dc=example,dc=com?uid,objectClass?one?(uid=a*)"}
+	records, err := ldapsync.Do(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if users := records.GetUsers(); len(users) != 1 || users[0].DN != "uid=alice,ou=people,dc=example,dc=com" {
+		t.Errorf("synced %d users, want alice of the filter of the URL", len(users))
+	}
+
+	config.BaseDNs = []string{"ldap://other.example.com/ou=people,dc=example,dc=com"}
+	if _, err = ldapsync.Do(config); err == nil {
+		t.Error("synced an LDAP URL of another host")
+	}
+}
@@ -0,0 +1,266 @@
+package ldapsync
+
+import (
+	"bufio"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+// ldifLineLength is the length at which LDIF lines are folded
+const ldifLineLength = 76
+
+// WriteLDIF writes the entries as LDIF content records (RFC 2849), with their raw values. Values that are not
+// safe strings, e.g. binary and non-ASCII values and those with leading spaces, are base64 encoded
+func WriteLDIF(w io.Writer, entries []*LDAPEntry) error {
+	b := bufio.NewWriter(w)
+	b.WriteString("version: 1\n")
+	for _, ent := range entries {
+		b.WriteString("\n")
+		writeLDIFLine(b, "dn", []byte(ent.DN))
+		for _, att := range ent.Attributes {
+			for _, v := range att.RawValues() {
+				writeLDIFLine(b, att.Name, v)
+			}
+		}
+	}
+	return b.Flush()
+}
+
+// writeLDIFLine writes the attribute value line, folded at ldifLineLength
+func writeLDIFLine(b *bufio.Writer, name string, value []byte) {
+	line := name + ": " + string(value)
+	if !ldifSafe(value) {
+		line = name + ":: " + base64.StdEncoding.EncodeToString(value)
+	}
+	for len(line) > ldifLineLength {
+		b.WriteString(line[:ldifLineLength])
+		b.WriteString("\n ")
+		line = line[ldifLineLength:]
+	}
+	b.WriteString(line)
+	b.WriteString("\n")
+}
+
+// ldifSafe determines whether the value is a SAFE-STRING, which can be written as is: ASCII without NUL, CR or LF,
+// not starting with a space, colon or less-than sign, and (for round trips through most parsers) not ending with a space
+func ldifSafe(value []byte) bool {
+	if len(value) == 0 {
+		return true
+	}
+	switch value[0] {
+	case ' ', ':', '<':
+		return false
+	}
+	if value[len(value)-1] == ' ' {
+		return false
+	}
+	for _, c := range value {
+		if c == 0 || c == '\n' || c == '\r' || c > 127 {
+			return false
+		}
+	}
+	return true
+}
+
+// ReadLDIF reads the content records of LDIF (RFC 2849), e.g. as written by WriteLDIF or exported by slapcat and
+// ldifde. Values may be base64 encoded, or refer to files by file:// URL. Change records other than adds are rejected
+func ReadLDIF(r io.Reader) ([]*LDAPEntry, error) {
+	entries, err := parseLDIF(r)
+	if err != nil {
+		return nil, err
+	}
+	return toEntries(entries, map[string]bool{}, Provenance{Server: LDIFSource}), nil
+}
+
+// LDIFSource is the Server of the Provenance of the entries read from LDIF
+const LDIFSource = "ldif"
+
+// DoFromLDIF syncs like Do from an LDIF dump rather than a live server, e.g. for tests, air-gapped analysis and
+// migrations: the entries of each BaseDN are those of the dump in the scope and filter of its search, and the
+// filters, exclusions, rewrites and membership rules of the configuration apply as they do to a sync. BaseDNs of
+// "auto" take all the entries of the dump. The attributes of LDAP URL BaseDNs, MembershipOnly, SyncAttributes and
+// ExcludeAttributes are not applied
+func DoFromLDIF(r io.Reader, config LDAPSyncConfig) (result LDAPRecords, err error) {
+	config = config.Sanitize()
+	config.compileFilters()
+	result.config, result.views = &config, &recordViews{}
+	parsed, err := parseLDIF(r)
+	if err != nil {
+		return
+	}
+	entries := toEntries(parsed, map[string]bool{}, Provenance{Server: LDIFSource})
+	if config.autoBaseDNs() {
+		config.BaseDNs = []string{""}
+	}
+
+	taken := make(map[*LDAPEntry]bool, len(entries)) // entries of earlier BaseDNs, as BaseDNs may overlap
+	rewriter := newDNRewriter(config.DNRewrites, nil)
+	for _, baseDN := range config.BaseDNs {
+		var searchRequest *ldap.SearchRequest
+		if searchRequest, err = newSearchRequest(baseDN); err != nil {
+			return
+		}
+		var filter LDAPFilter
+		if f := searchRequest.Filter; f != "(&(objectClass=*))" && f != "(objectClass=*)" {
+			if filter, err = ParseLDAPFilter(f); err != nil {
+				return
+			}
+		}
+		var found []*LDAPEntry
+		for _, ent := range entries {
+			if !taken[ent] && inSearchScope(ent.DN, searchRequest.BaseDN, searchRequest.Scope) {
+				found = append(found, ent)
+			}
+		}
+		found = matching(found, filter, config.ValuePreparation)
+		for _, ent := range found {
+			taken[ent] = true
+			ent.Source.BaseDN = searchRequest.BaseDN
+		}
+		if len(config.ExcludeDNs) > 0 {
+			found = config.withoutExcluded(found)
+		}
+		rewriter.rewriteEntries(found)
+		result.Entries = append(result.Entries, found...)
+	}
+	if config.Avatars != nil {
+		result.avatars, err = result.extractAvatars(*config.Avatars)
+	}
+	return
+}
+
+// inSearchScope determines whether the entry with the DN is in the scope of a search from the base DN
+func inSearchScope(dn, base string, scope int) bool {
+	switch scope {
+	case ldap.ScopeBaseObject:
+		return normalizeDN(dn) == normalizeDN(base)
+	case ldap.ScopeSingleLevel:
+		parent, err := ParentDN(dn)
+		return err == nil && normalizeDN(parent) == normalizeDN(base)
+	default:
+		return DNIsUnder(dn, base)
+	}
+}
+
+// parseLDIF parses the content records of the LDIF
+func parseLDIF(r io.Reader) (entries []*ldap.Entry, err error) {
+	b := bufio.NewReader(r)
+	var record []string // the unfolded lines of the current record
+	lineNumber, recordLine := 0, 0
+	for {
+		line, readErr := b.ReadString('\n')
+		if readErr != nil && readErr != io.EOF {
+			return nil, readErr
+		}
+		if line != "" {
+			lineNumber++
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if line != "" && !strings.HasPrefix(line, " ") && len(record) == 0 {
+			recordLine = lineNumber
+		}
+		switch {
+		case strings.HasPrefix(line, " "): // folded
+			if len(record) > 0 && record[len(record)-1] != "#" { // the folded lines of comments are dropped with them
+				record[len(record)-1] += line[1:]
+			}
+		case strings.HasPrefix(line, "#"):
+			record = append(record, "#")
+		case line != "":
+			record = append(record, line)
+		}
+		if line == "" || readErr == io.EOF {
+			entry, recordErr := parseLDIFRecord(record)
+			if recordErr != nil {
+				return nil, fmt.Errorf("LDIF record at line %d: %w", recordLine, recordErr)
+			}
+			if entry != nil {
+				entries = append(entries, entry)
+			}
+			record = nil
+		}
+		if readErr == io.EOF {
+			return
+		}
+	}
+}
+
+// parseLDIFRecord parses the lines of a record, returning nil for the version line and records of comments alone
+func parseLDIFRecord(lines []string) (*ldap.Entry, error) {
+	var entry *ldap.Entry
+	positions := make(map[string]int) // of the attributes, by lower-cased name
+	for _, line := range lines {
+		if line == "#" {
+			continue
+		}
+		name, value, err := parseLDIFLine(line)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case entry == nil && strings.EqualFold(name, "version"):
+			continue
+		case entry == nil && strings.EqualFold(name, "dn"):
+			entry = &ldap.Entry{DN: string(value)}
+			continue
+		case entry == nil:
+			return nil, fmt.Errorf("%s before the dn", name)
+		case strings.EqualFold(name, "control"):
+			continue // controls only apply to the change records, which are rejected
+		case strings.EqualFold(name, "changetype"):
+			if !strings.EqualFold(string(value), "add") {
+				return nil, fmt.Errorf("changetype %s of %s is not supported, only content and add records", value, entry.DN)
+			}
+			continue
+		}
+		key := strings.ToLower(name)
+		i, exists := positions[key]
+		if !exists {
+			i = len(entry.Attributes)
+			positions[key] = i
+			entry.Attributes = append(entry.Attributes, &ldap.EntryAttribute{Name: name})
+		}
+		entry.Attributes[i].Values = append(entry.Attributes[i].Values, string(value))
+		entry.Attributes[i].ByteValues = append(entry.Attributes[i].ByteValues, value)
+	}
+	return entry, nil
+}
+
+// parseLDIFLine parses an attribute value line: a value, a base64 encoded value (::) or a URL to read it from (:<)
+func parseLDIFLine(line string) (name string, value []byte, err error) {
+	i := strings.Index(line, ":")
+	if i <= 0 {
+		return "", nil, fmt.Errorf("invalid line %q", line)
+	}
+	name, rest := line[:i], line[i+1:]
+	switch {
+	case strings.HasPrefix(rest, ":"):
+		value, err = base64.StdEncoding.DecodeString(strings.TrimSpace(rest[1:]))
+		if err != nil {
+			err = fmt.Errorf("invalid base64 value of %s: %w", name, err)
+		}
+	case strings.HasPrefix(rest, "<"):
+		value, err = readLDIFURL(strings.TrimSpace(rest[1:]))
+	default:
+		value = []byte(strings.TrimLeft(rest, " "))
+	}
+	return
+}
+
+// readLDIFURL reads the value a :< line refers to, of which only file:// URLs are supported
+func readLDIFURL(rawURL string) ([]byte, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "file" {
+		return nil, fmt.Errorf("unsupported value URL %s, only file:// URLs are", rawURL)
+	}
+	return os.ReadFile(u.Path)
+}
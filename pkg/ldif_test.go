@@ -0,0 +1,45 @@
+package ldapsync_test
+
+import (
+	"strings"
+	"testing"
+
+	ldapsync "github.com/adedayo/ldap-sync/pkg"
+)
+
+func TestReadLDIFDropsFoldedComments(t *testing.T) {
+	entries, err := ldapsync.ReadLDIF(strings.NewReader(`version: 1
+# the people of the directory, a comment folded
+ over two lines
+
+# alice, also
+ folded
+dn: uid=alice,ou=people,dc=example,dc=com
+# mid-record
+  and folded
+objectClass: person
+uid: ali
+ ce
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].DN != "uid=alice,ou=people,dc=example,dc=com" {
+		t.Fatalf("read %d entries, want alice", len(entries))
+	}
+	if _, uid := entries[0].GetAttribute("uid"); len(uid) != 1 || uid[0] != "alice" {
+		t.Errorf("uid %v, want alice", uid)
+	}
+}
+
+func TestReadLDIFReportsTheLineOfRecordsStartingWithComments(t *testing.T) {
+	_, err := ldapsync.ReadLDIF(strings.NewReader(`dn: uid=alice,ou=people,dc=example,dc=com
+uid: alice
+
+# bob
+uid: bob
+`))
+	if err == nil || !strings.Contains(err.Error(), "line 4") {
+		t.Errorf("error %v, want one of the record at line 4", err)
+	}
+}
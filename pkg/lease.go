@@ -0,0 +1,138 @@
+package ldapsync
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Lease is a lease held by one holder at a time, expiring unless renewed, with which replicas elect a leader, see
+// LeaderElector. RedisStore.Lease, SQLLease and KubernetesLease implement it; other backends can be plugged in by
+// implementing it
+type Lease interface {
+	// Acquire takes the lease for the holder for the ttl, or renews it if the holder holds it, returning whether
+	// the holder holds it
+	Acquire(ctx context.Context, holder string, ttl time.Duration) (bool, error)
+	// Release gives up the lease, if the holder holds it
+	Release(ctx context.Context, holder string) error
+}
+
+// LeaderElector elects one leader among replicas sharing a Lease: the replica holding it, which it renews every
+// third of the TTL. If the leader stops renewing it, e.g. as it crashed, another replica takes over once it expires
+type LeaderElector struct {
+	Lease  Lease
+	Holder string        // identity of the replica, the host name and process ID if empty
+	TTL    time.Duration // of the lease, 30 seconds if zero
+
+	mu     sync.Mutex
+	leader bool
+}
+
+// IsLeader determines whether the replica holds the lease
+func (e *LeaderElector) IsLeader() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.leader
+}
+
+// Run campaigns for the lease until the context is done, then releases it. It calls changed, if set, whenever
+// the replica gains or loses the leadership
+func (e *LeaderElector) Run(ctx context.Context, changed func(leader bool)) {
+	holder, ttl := e.Holder, e.TTL
+	if holder == "" {
+		host, _ := os.Hostname()
+		holder = host + "/" + strconv.Itoa(os.Getpid())
+	}
+	if ttl <= 0 {
+		ttl = 30 * time.Second
+	}
+	ticker := time.NewTicker(ttl / 3)
+	defer ticker.Stop()
+	for {
+		leader, err := e.Lease.Acquire(ctx, holder, ttl)
+		e.mu.Lock()
+		was := e.leader
+		e.leader = leader && err == nil
+		e.mu.Unlock()
+		if was != (leader && err == nil) && changed != nil {
+			changed(!was)
+		}
+
+		select {
+		case <-ctx.Done():
+			e.mu.Lock()
+			e.leader = false
+			e.mu.Unlock()
+			release, cancel := context.WithTimeout(context.Background(), ttl/3)
+			e.Lease.Release(release, holder)
+			cancel()
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// SQLLease is a Lease kept in a table of a SQL database, created with e.g.
+//
+//	CREATE TABLE ldapsync_leases (name VARCHAR(255) PRIMARY KEY, holder VARCHAR(255) NOT NULL, expires BIGINT NOT NULL)
+type SQLLease struct {
+	DB          *sql.DB
+	Table       string // ldapsync_leases if empty
+	Name        string // of the lease, e.g. of the sync it guards
+	Placeholder string // "?" (e.g. MySQL, SQLite), the default, or "$" for numbered ones (PostgreSQL)
+}
+
+func (l SQLLease) Acquire(ctx context.Context, holder string, ttl time.Duration) (bool, error) {
+	now := time.Now()
+	expires := now.Add(ttl).UnixMilli()
+	result, err := l.DB.ExecContext(ctx, l.query("UPDATE %s SET holder = ?, expires = ? WHERE name = ? AND (holder = ? OR expires < ?)"),
+		holder, expires, l.Name, holder, now.UnixMilli())
+	if err != nil {
+		return false, err
+	}
+	if updated, err := result.RowsAffected(); err != nil || updated > 0 {
+		return err == nil, err
+	}
+	if _, err = l.DB.ExecContext(ctx, l.query("INSERT INTO %s (name, holder, expires) VALUES (?, ?, ?)"), l.Name, holder, expires); err != nil {
+		// most likely another replica holds the lease, in which case the insert violates the primary key
+		var current string
+		if l.DB.QueryRowContext(ctx, l.query("SELECT holder FROM %s WHERE name = ?"), l.Name).Scan(&current) == nil {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+func (l SQLLease) Release(ctx context.Context, holder string) error {
+	_, err := l.DB.ExecContext(ctx, l.query("DELETE FROM %s WHERE name = ? AND holder = ?"), l.Name, holder)
+	return err
+}
+
+// query returns the query on the table, with the configured placeholders
+func (l SQLLease) query(format string) string {
+	table := l.Table
+	if table == "" {
+		table = "ldapsync_leases"
+	}
+	query := fmt.Sprintf(format, table)
+	if l.Placeholder != "$" {
+		return query
+	}
+	var b strings.Builder
+	n := 0
+	for _, c := range query {
+		if c == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+		} else {
+			b.WriteRune(c)
+		}
+	}
+	return b.String()
+}
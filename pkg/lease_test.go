@@ -0,0 +1,78 @@
+package ldapsync
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memoryLease is a Lease held by whoever acquires it first until released, recording its releases
+type memoryLease struct {
+	mu       sync.Mutex
+	holder   string
+	released chan string
+}
+
+func (l *memoryLease) Acquire(ctx context.Context, holder string, ttl time.Duration) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.holder == "" {
+		l.holder = holder
+	}
+	return l.holder == holder, nil
+}
+
+func (l *memoryLease) Release(ctx context.Context, holder string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.holder == holder {
+		l.holder = ""
+	}
+	l.released <- holder
+	return nil
+}
+
+func TestLeaderElector(t *testing.T) {
+	lease := &memoryLease{holder: "b", released: make(chan string, 1)}
+	elector := &LeaderElector{Lease: lease, Holder: "a", TTL: 30 * time.Millisecond}
+	changes := make(chan bool, 10)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go elector.Run(ctx, func(leader bool) { changes <- leader })
+
+	time.Sleep(50 * time.Millisecond)
+	if elector.IsLeader() || len(changes) > 0 {
+		t.Fatal("leader while another replica holds the lease")
+	}
+	lease.Release(ctx, "b") // the other replica steps down
+	<-lease.released
+	select {
+	case leader := <-changes:
+		if !leader || !elector.IsLeader() {
+			t.Fatal("not the leader once the lease is free")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no election once the lease is free")
+	}
+
+	cancel()
+	select {
+	case holder := <-lease.released:
+		if holder != "a" || elector.IsLeader() {
+			t.Errorf("released by %s, leader %v, want a release by the leader as it stops", holder, elector.IsLeader())
+		}
+	case <-time.After(time.Second):
+		t.Error("the lease was not released as the elector stopped")
+	}
+}
+
+func TestSQLLeaseQueries(t *testing.T) {
+	query := "UPDATE %s SET holder = ?, expires = ? WHERE name = ? AND (holder = ? OR expires < ?)"
+	if got := (SQLLease{}).query(query); got != "UPDATE ldapsync_leases SET holder = ?, expires = ? WHERE name = ? AND (holder = ? OR expires < ?)" {
+		t.Errorf("query %s", got)
+	}
+	if got := (SQLLease{Table: "leases", Placeholder: "$"}).query(query); got != "UPDATE leases SET holder = $1, expires = $2 WHERE name = $3 AND (holder = $4 OR expires < $5)" {
+		t.Errorf("query %s with numbered placeholders", got)
+	}
+}
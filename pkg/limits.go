@@ -0,0 +1,196 @@
+package ldapsync
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// RateLimit is a token-bucket limit on the rate of operations against a server
+type RateLimit struct {
+	OperationsPerSecond float64 `json:"operationsPerSecond"` // sustained rate, zero or less means unlimited
+	Burst               int     `json:"burst"`               // operations that may be issued at once, at least 1
+}
+
+// serverLimits are the limits on operations against a server, shared by all syncs and authentications in the process
+type serverLimits struct {
+	sem     semaphore   // caps simultaneous outstanding operations
+	bucket  tokenBucket // caps the rate of operations
+	breaker breaker     // fails fast when the server is failing
+}
+
+// configure applies the limits of the config, leaving those it does not set unchanged
+func (s *serverLimits) configure(config LDAPSyncConfig) {
+	if config.MaxConcurrentOperations > 0 {
+		s.sem.setLimit(config.MaxConcurrentOperations)
+	}
+	if config.RateLimit != nil {
+		s.bucket.setLimit(*config.RateLimit)
+	}
+	if config.CircuitBreaker != nil {
+		s.breaker.configure(*config.CircuitBreaker)
+	}
+}
+
+var servers = struct {
+	sync.Mutex
+	m map[string]*serverLimits
+}{m: make(map[string]*serverLimits)}
+
+// limitsFor returns the limits of the server address, which are unlimited until configured
+func limitsFor(addr string) *serverLimits {
+	servers.Lock()
+	defer servers.Unlock()
+	s, exists := servers.m[addr]
+	if !exists {
+		s = &serverLimits{}
+		servers.m[addr] = s
+	}
+	return s
+}
+
+// wait blocks until an operation may be issued against the server, returning a function to call with the
+// outcome of the operation once it completes
+func (s *serverLimits) wait(ctx context.Context) (done func(error), err error) {
+	if err = s.breaker.allow(); err != nil {
+		return
+	}
+	if err = s.bucket.wait(ctx); err != nil {
+		s.breaker.release() // not an outcome of the server
+		return
+	}
+	if err = s.sem.acquire(ctx); err != nil {
+		s.breaker.release()
+		return
+	}
+	return func(opErr error) {
+		s.sem.release()
+		s.breaker.record(opErr)
+	}, nil
+}
+
+// tokenBucket is a token-bucket rate limiter with an adjustable rate
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64 // tokens per second, zero or less means unlimited
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func (b *tokenBucket) setLimit(limit RateLimit) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	first := b.last.IsZero()
+	b.refill(time.Now())
+	b.rate = limit.OperationsPerSecond
+	b.burst = float64(limit.Burst)
+	if b.burst < 1 {
+		b.burst = 1
+	}
+	if first || b.tokens > b.burst {
+		b.tokens = b.burst // a new bucket starts full
+	}
+}
+
+// refill adds the tokens accrued since the last refill. Must be called with the lock held
+func (b *tokenBucket) refill(now time.Time) {
+	if !b.last.IsZero() && b.rate > 0 {
+		b.tokens += now.Sub(b.last).Seconds() * b.rate
+		if b.tokens > b.burst {
+			b.tokens = b.burst
+		}
+	}
+	b.last = now
+}
+
+// wait takes a token, blocking until one accrues or the context is done
+func (b *tokenBucket) wait(ctx context.Context) error {
+	b.mu.Lock()
+	if b.rate <= 0 {
+		b.mu.Unlock()
+		return nil
+	}
+	b.refill(time.Now())
+	b.tokens-- // reserve a token, going into debt if none is available
+	if b.tokens >= 0 {
+		b.mu.Unlock()
+		return nil
+	}
+	delay := time.Duration(-b.tokens / b.rate * float64(time.Second))
+	b.mu.Unlock()
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		b.mu.Lock()
+		b.tokens++ // return the reservation
+		b.mu.Unlock()
+		return ctx.Err()
+	}
+}
+
+// semaphore is a counting semaphore with an adjustable limit; a limit of zero or less means unlimited
+type semaphore struct {
+	mu      sync.Mutex
+	limit   int
+	inUse   int
+	waiters []chan struct{} // FIFO of blocked acquirers
+}
+
+func (s *semaphore) setLimit(limit int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.limit = limit
+	s.wake()
+}
+
+// acquire blocks until a slot is available or the context is done
+func (s *semaphore) acquire(ctx context.Context) error {
+	s.mu.Lock()
+	if s.limit <= 0 || (s.inUse < s.limit && len(s.waiters) == 0) {
+		s.inUse++
+		s.mu.Unlock()
+		return nil
+	}
+	ready := make(chan struct{})
+	s.waiters = append(s.waiters, ready)
+	s.mu.Unlock()
+
+	select {
+	case <-ready:
+		return nil
+	case <-ctx.Done():
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		for i, w := range s.waiters {
+			if w == ready {
+				s.waiters = append(s.waiters[:i], s.waiters[i+1:]...)
+				return ctx.Err()
+			}
+		}
+		// the slot was granted just as the context was done, give it back
+		s.inUse--
+		s.wake()
+		return ctx.Err()
+	}
+}
+
+func (s *semaphore) release() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.inUse--
+	s.wake()
+}
+
+// wake grants free slots to waiters, in order. Must be called with the lock held
+func (s *semaphore) wake() {
+	for len(s.waiters) > 0 && (s.limit <= 0 || s.inUse < s.limit) {
+		s.inUse++
+		close(s.waiters[0])
+		s.waiters = s.waiters[1:]
+	}
+}
@@ -0,0 +1,101 @@
+package ldapsync
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestSemaphoreCapsOperations(t *testing.T) {
+	s := &semaphore{}
+	s.setLimit(1)
+	ctx := context.Background()
+	if err := s.acquire(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	timeout, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	if err := s.acquire(timeout); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("acquired a slot beyond the limit: %v", err)
+	}
+
+	acquired := make(chan error)
+	go func() { acquired <- s.acquire(ctx) }()
+	select {
+	case err := <-acquired:
+		t.Fatalf("acquired a slot beyond the limit: %v", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+	s.release()
+	select {
+	case err := <-acquired:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("a released slot was not granted to the waiter")
+	}
+
+	s.setLimit(0) // unlimited
+	if err := s.acquire(timeout); err != nil {
+		t.Errorf("an unlimited semaphore blocked: %v", err)
+	}
+}
+
+func TestTokenBucketLimitsTheRate(t *testing.T) {
+	b := &tokenBucket{}
+	ctx := context.Background()
+	if err := b.wait(ctx); err != nil {
+		t.Fatalf("an unlimited bucket: %v", err)
+	}
+
+	b.setLimit(RateLimit{OperationsPerSecond: 50, Burst: 2})
+	started := time.Now()
+	for i := 0; i < 4; i++ {
+		if err := b.wait(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 2 operations at once, then 2 at 50 per second
+	if elapsed := time.Since(started); elapsed < 30*time.Millisecond {
+		t.Errorf("4 operations in %v, want at least 40ms", elapsed)
+	}
+
+	timeout, cancel := context.WithTimeout(ctx, time.Millisecond)
+	defer cancel()
+	b.setLimit(RateLimit{OperationsPerSecond: 0.001, Burst: 1})
+	b.tokens = 0
+	if err := b.wait(timeout); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("waited for a token %v, want the deadline of the context", err)
+	}
+	if b.tokens < -0.001 {
+		t.Errorf("%v tokens after an abandoned wait, want its reservation returned", b.tokens)
+	}
+}
+
+func TestServerLimitsDoNotCountAbandonedTrials(t *testing.T) {
+	limits := &serverLimits{}
+	limits.configure(LDAPSyncConfig{MaxConcurrentOperations: 1,
+		CircuitBreaker: &CircuitBreaker{FailureThreshold: 1, Cooldown: Duration(time.Hour)}})
+	if _, err := limits.wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	limits.breaker.mu.Lock()
+	limits.breaker.state, limits.breaker.openedAt = breakerOpen, time.Now().Add(-2*time.Hour)
+	limits.breaker.mu.Unlock()
+
+	// the trial is let through, but times out waiting for the slot of the operation in progress
+	timeout, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := limits.wait(timeout); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("waited %v, want the deadline of the context", err)
+	}
+	limits.sem.release() // the operation in progress ends, without an outcome closing the breaker
+	done, err := limits.wait(context.Background())
+	if err != nil {
+		t.Fatalf("no trial after an abandoned one: %v", err)
+	}
+	done(nil)
+}
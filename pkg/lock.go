@@ -0,0 +1,67 @@
+package ldapsync
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// ErrSyncLocked reports a sync skipped as its SyncLock is held elsewhere
+var ErrSyncLocked = errors.New("sync skipped: the sync lock is held elsewhere")
+
+// SyncLock guards syncs against running concurrently, e.g. in two instances of a scheduled sync against the same
+// target, which would apply the same changes to sinks twice
+type SyncLock interface {
+	// TryLock takes the lock unless it is held elsewhere, returning whether it did
+	TryLock() (bool, error)
+	Unlock() error
+}
+
+// FileLock is a SyncLock held as an advisory lock on a file, e.g. /var/run/ldap-sync.lock, shared by the processes
+// of a host. The operating system releases the lock of a process that exits, including when it crashes
+type FileLock struct {
+	path string
+	mu   sync.Mutex
+	file *os.File
+}
+
+func NewFileLock(path string) *FileLock {
+	return &FileLock{path: path}
+}
+
+func (l *FileLock) TryLock() (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file != nil {
+		return false, fmt.Errorf("lock %s is already held by this process", l.path)
+	}
+	f, err := os.OpenFile(l.path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return false, err
+	}
+	locked, err := tryLockFile(f)
+	if err != nil || !locked {
+		f.Close()
+		return false, err
+	}
+	// record the holder, for operators
+	f.Truncate(0)
+	fmt.Fprintf(f, "%d\n", os.Getpid())
+	l.file = f
+	return true, nil
+}
+
+func (l *FileLock) Unlock() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file == nil {
+		return nil
+	}
+	err := unlockFile(l.file)
+	if closeErr := l.file.Close(); err == nil {
+		err = closeErr
+	}
+	l.file = nil
+	return err
+}
@@ -0,0 +1,88 @@
+package ldapsync
+
+import (
+	"strings"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+// Logger receives the structured logs of syncs, authentications and LDAP operations: a message followed by
+// alternating keys and values, like those of log/slog, whose *slog.Logger is a Logger. Implementations must be safe
+// for concurrent use
+type Logger interface {
+	Debug(msg string, args ...any)
+	Info(msg string, args ...any)
+	Warn(msg string, args ...any)
+	Error(msg string, args ...any)
+}
+
+// NopLogger discards all logs, it is the default
+type NopLogger struct{}
+
+func (NopLogger) Debug(string, ...any) {}
+func (NopLogger) Info(string, ...any)  {}
+func (NopLogger) Warn(string, ...any)  {}
+func (NopLogger) Error(string, ...any) {}
+
+// loggerOr returns the logger, or NopLogger if nil
+func loggerOr(l Logger) Logger {
+	if l == nil {
+		return NopLogger{}
+	}
+	return l
+}
+
+// logOperation logs an LDAP operation at debug level, with the DN bound as redacted
+func logOperation(log Logger, op Operation, duration time.Duration, err error) {
+	args := []any{"operation", op.Name, "server", op.Server, "duration", duration}
+	if op.BaseDN != "" {
+		args = append(args, "baseDN", op.BaseDN)
+	}
+	if op.Name == "bind" {
+		args = append(args, "bindDN", redactDN(op.BindDN))
+	}
+	if err != nil {
+		args = append(args, "error", err)
+	}
+	log.Debug("ldap operation", args...)
+}
+
+// logAuth logs an authentication: at info level if it succeeded, warning if the credentials or the user were rejected,
+// and error if it failed, with the DN of the user, if known, redacted
+func logAuth(log Logger, server, dn string, begin time.Time, auth AuthResult, err error) {
+	log = loggerOr(log)
+	args := []any{"server", server, "duration", time.Since(begin)}
+	if dn != "" {
+		args = append(args, "user", redactDN(dn))
+	}
+	switch {
+	case err != nil:
+		log.Error("authentication failed", append(args, "error", err)...)
+	case !auth.Success:
+		log.Warn("authentication rejected", append(args, "reason", auth.ErrorMessage)...)
+	default:
+		log.Info("authenticated", args...)
+	}
+}
+
+// redactDN returns the DN with the values of its leading RDN masked, e.g. uid=***,ou=people,dc=example,dc=com, so
+// logs show the subtree of a DN but not whom it names. Anonymous binds are logged as such
+func redactDN(dn string) string {
+	if dn == "" {
+		return "anonymous"
+	}
+	parsed, err := ldap.ParseDN(dn)
+	if err != nil || len(parsed.RDNs) == 0 {
+		return "***"
+	}
+	var types []string
+	for _, attr := range parsed.RDNs[0].Attributes {
+		types = append(types, attr.Type+"=***")
+	}
+	rdns := []string{strings.Join(types, "+")}
+	for _, rdn := range parsed.RDNs[1:] {
+		rdns = append(rdns, rdn.String())
+	}
+	return strings.Join(rdns, ",")
+}
@@ -0,0 +1,102 @@
+package ldapsync
+
+// AttributeMapping maps directory attributes to the fields of Users and Groups, so consumers need not read the raw
+// entries. Fields left empty use the conventional attribute noted, and "-" leaves the field unset
+type AttributeMapping struct {
+	Email       string `json:"email"`       // mail
+	DisplayName string `json:"displayName"` // displayName
+	GivenName   string `json:"givenName"`   // givenName
+	Surname     string `json:"surname"`     // sn
+	Phone       string `json:"phone"`       // telephoneNumber
+	Title       string `json:"title"`       // title
+	Department  string `json:"department"`  // department
+	// further user attributes by the name of the user's Extra field to set, e.g. {"employeeID": "employeeNumber"}
+	Extra map[string]string `json:"extra"`
+
+	GroupDisplayName string `json:"groupDisplayName"` // displayName
+	GroupDescription string `json:"groupDescription"` // description
+	GroupEmail       string `json:"groupEmail"`       // mail
+}
+
+// mappedAttribute returns the attribute of the field, the fallback if empty, or none if "-"
+func mappedAttribute(attribute, fallback string) string {
+	switch attribute {
+	case "":
+		return fallback
+	case "-":
+		return ""
+	}
+	return attribute
+}
+
+// userAttributes returns the attributes of the Email, DisplayName, GivenName, Surname, Phone, Title and Department
+func (m AttributeMapping) userAttributes() []string {
+	return []string{
+		mappedAttribute(m.Email, "mail"),
+		mappedAttribute(m.DisplayName, "displayName"),
+		mappedAttribute(m.GivenName, "givenName"),
+		mappedAttribute(m.Surname, "sn"),
+		mappedAttribute(m.Phone, "telephoneNumber"),
+		mappedAttribute(m.Title, "title"),
+		mappedAttribute(m.Department, "department"),
+	}
+}
+
+// groupAttributes returns the attributes of the group's DisplayName, Description and Email
+func (m AttributeMapping) groupAttributes() []string {
+	return []string{
+		mappedAttribute(m.GroupDisplayName, "displayName"),
+		mappedAttribute(m.GroupDescription, "description"),
+		mappedAttribute(m.GroupEmail, "mail"),
+	}
+}
+
+// attributes returns the attributes the mapping reads, of users and groups
+func (m *AttributeMapping) attributes() (names []string) {
+	if m == nil {
+		return
+	}
+	for _, name := range append(m.userAttributes(), m.groupAttributes()...) {
+		if name != "" {
+			names = append(names, name)
+		}
+	}
+	for _, name := range m.Extra {
+		names = append(names, name)
+	}
+	return
+}
+
+// mapUser sets the mapped fields of the user from their entry
+func (m *AttributeMapping) mapUser(u *User, ent *LDAPEntry) {
+	if m == nil {
+		return
+	}
+	fields := []*string{&u.Email, &u.DisplayName, &u.GivenName, &u.Surname, &u.Phone, &u.Title, &u.Department}
+	for i, attribute := range m.userAttributes() {
+		if attribute != "" {
+			*fields[i], _ = ent.GetString(attribute)
+		}
+	}
+	for field, attribute := range m.Extra {
+		if value, found := ent.GetString(attribute); found {
+			if u.Extra == nil {
+				u.Extra = make(map[string]string, len(m.Extra))
+			}
+			u.Extra[field] = value
+		}
+	}
+}
+
+// mapGroup sets the mapped fields of the group from its entry
+func (m *AttributeMapping) mapGroup(g *Group, ent *LDAPEntry) {
+	if m == nil {
+		return
+	}
+	fields := []*string{&g.DisplayName, &g.Description, &g.Email}
+	for i, attribute := range m.groupAttributes() {
+		if attribute != "" {
+			*fields[i], _ = ent.GetString(attribute)
+		}
+	}
+}
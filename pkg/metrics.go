@@ -0,0 +1,75 @@
+package ldapsync
+
+import (
+	"time"
+)
+
+// Metrics receives the measurements of syncs, authentications and LDAP operations, so they can be recorded in any
+// metrics system (statsd, OpenCensus, Prometheus, ...). Implementations must be safe for concurrent use
+type Metrics interface {
+	// Count adds the delta to a counter, e.g. ldapsync_operations_total
+	Count(name string, delta float64, labels map[string]string)
+	// Gauge sets a gauge, e.g. ldapsync_sync_entries
+	Gauge(name string, value float64, labels map[string]string)
+	// Observe records an observation in a histogram, e.g. ldapsync_operation_duration_seconds
+	Observe(name string, value float64, labels map[string]string)
+}
+
+// Metric names
+const (
+	MetricOperations        = "ldapsync_operations_total"           // labels: operation, server, result (success or error)
+	MetricOperationDuration = "ldapsync_operation_duration_seconds" // labels: operation, server
+	MetricSyncs             = "ldapsync_syncs_total"                // labels: server, result (success, partial or error)
+	MetricSyncDuration      = "ldapsync_sync_duration_seconds"      // labels: server
+	MetricSyncEntries       = "ldapsync_sync_entries"               // labels: server
+	MetricSyncPages         = "ldapsync_sync_pages_total"           // labels: server
+	MetricEntriesFetched    = "ldapsync_entries_fetched_total"      // labels: server
+	MetricReconnects        = "ldapsync_reconnects_total"           // labels: server, reason (failover or retry)
+	MetricAuths             = "ldapsync_auths_total"                // labels: server, result (success, failure or error)
+	MetricAuthDuration      = "ldapsync_auth_duration_seconds"      // labels: server
+)
+
+// NopMetrics discards all measurements, it is the default
+type NopMetrics struct{}
+
+func (NopMetrics) Count(string, float64, map[string]string)   {}
+func (NopMetrics) Gauge(string, float64, map[string]string)   {}
+func (NopMetrics) Observe(string, float64, map[string]string) {}
+
+// metricsOr returns the metrics, or NopMetrics if nil
+func metricsOr(m Metrics) Metrics {
+	if m == nil {
+		return NopMetrics{}
+	}
+	return m
+}
+
+// outcome is the value of the result label of an operation with the error
+func outcome(err error) string {
+	if err != nil {
+		return "error"
+	}
+	return "success"
+}
+
+// recordOperation records the outcome and duration of an LDAP operation
+func recordOperation(m Metrics, op Operation, duration time.Duration, err error) {
+	m.Count(MetricOperations, 1, map[string]string{"operation": op.Name, "server": op.Server, "result": outcome(err)})
+	m.Observe(MetricOperationDuration, duration.Seconds(), map[string]string{"operation": op.Name, "server": op.Server})
+}
+
+// recordReconnect records a connection made again after a failure, to the server
+func recordReconnect(m Metrics, server, reason string) {
+	metricsOr(m).Count(MetricReconnects, 1, map[string]string{"server": server, "reason": reason})
+}
+
+// recordAuth records the outcome and duration of an authentication: a failure if the credentials were rejected
+func recordAuth(m Metrics, server string, begin time.Time, auth AuthResult, err error) {
+	m = metricsOr(m)
+	authOutcome := outcome(err)
+	if err == nil && !auth.Success {
+		authOutcome = "failure"
+	}
+	m.Count(MetricAuths, 1, map[string]string{"server": server, "result": authOutcome})
+	m.Observe(MetricAuthDuration, time.Since(begin).Seconds(), map[string]string{"server": server})
+}
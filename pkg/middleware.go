@@ -0,0 +1,111 @@
+package ldapsync
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// MiddlewareOptions configures the Basic Auth Middleware
+type MiddlewareOptions struct {
+	Client *Client
+	Realm  string // announced in the WWW-Authenticate challenge, "Restricted" if empty
+
+	// groups (by DN or ID) the user must be a member of, at least one of them, if any
+	RequiredGroups []string
+
+	// cache of successful authentications, to spare the directory a bind per request, the Client's Cache if nil.
+	// Entries are keyed by an HMAC of the credentials under a random secret of the Middleware, so changed passwords
+	// are not served from the cache, and the keys can not be brute-forced for the passwords. The entries are thus not
+	// shared by the Middlewares of other processes
+	Cache    Cache
+	CacheTTL time.Duration // the Client's CacheTTL if zero, authentications are not cached if neither is set
+}
+
+type identityKey struct{}
+
+// IdentityFromContext returns the user authenticated by the Middleware, with their groups and roles
+func IdentityFromContext(ctx context.Context) (*UsersAndGroups, bool) {
+	identity, ok := ctx.Value(identityKey{}).(*UsersAndGroups)
+	return identity, ok
+}
+
+// Middleware authenticates the HTTP Basic Auth credentials of requests against the directory with
+// Client.Authenticate before passing them on to next, with the authenticated user in their context (see
+// IdentityFromContext). Requests without valid credentials are answered with 401 Unauthorized, those of users
+// outside the RequiredGroups (of the options or of the Client's configuration) with 403 Forbidden, and those
+// failing to reach the directory with 502 Bad Gateway. Basic Auth carries no second factor code, so a configured
+// SecondFactor is given an empty one, suiting out-of-band factors such as push notifications
+func Middleware(next http.Handler, options MiddlewareOptions) http.Handler {
+	realm := options.Realm
+	if realm == "" {
+		realm = "Restricted"
+	}
+	cache, ttl := options.Cache, options.CacheTTL
+	if cache == nil {
+		cache = options.Client.config.Cache
+	}
+	if ttl == 0 {
+		ttl = time.Duration(options.Client.config.CacheTTL)
+	}
+	secret := make([]byte, sha256.Size)
+	if _, err := rand.Read(secret); err != nil {
+		cache = nil // the keys would be guessable
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		username, password, ok := r.BasicAuth()
+		if !ok || username == "" || password == "" {
+			challenge(w, realm)
+			return
+		}
+
+		var auth AuthResult
+		mac := hmac.New(sha256.New, secret)
+		mac.Write([]byte(username + "\x00" + password))
+		key := options.Client.config.cacheKey("auth", hex.EncodeToString(mac.Sum(nil)))
+		cached := false
+		if cache != nil && ttl > 0 {
+			if data, found, err := cache.Get(key); err == nil && found && json.Unmarshal(data, &auth) == nil {
+				cached = true
+			}
+		}
+		if !cached {
+			var err error
+			if auth, err = options.Client.Authenticate(r.Context(), username, password); err != nil {
+				http.Error(w, http.StatusText(http.StatusBadGateway), http.StatusBadGateway)
+				return
+			}
+			if auth.Success && cache != nil && ttl > 0 {
+				if data, err := json.Marshal(auth); err == nil {
+					cache.Set(key, data, ttl)
+				}
+			}
+		}
+
+		if auth.Forbidden {
+			http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+			return
+		}
+		if !auth.Success || auth.Identity == nil {
+			challenge(w, realm)
+			return
+		}
+		if !requiredGroupsMet(options.RequiredGroups, false, auth.Identity.hasGroup) {
+			http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), identityKey{}, auth.Identity)))
+	})
+}
+
+func challenge(w http.ResponseWriter, realm string) {
+	w.Header().Set("WWW-Authenticate", `Basic realm="`+strings.ReplaceAll(realm, `"`, "")+`", charset="UTF-8"`)
+	http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+}
@@ -1,56 +1,190 @@
 package ldapsync
 
 import (
+	"encoding/json"
 	"fmt"
 	"net"
+	"sort"
 	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
 )
 
 type AuthResult struct {
 	Success      bool
 	ErrorMessage string
+	ResultCode   uint16 `json:",omitempty"` // of the server rejecting the bind, e.g. 49 for invalid credentials
+	Forbidden    bool   `json:",omitempty"` // the credentials were accepted, but the user is not in the RequiredGroups
+
+	// when the password expires, if known: from the password policy control, or the Active Directory account
+	PasswordExpiry *time.Time `json:",omitempty"`
+	GraceLogins    int        `json:",omitempty"` // logins left with the expired password, from the password policy control
+
+	// the authenticated user with their groups and roles, if resolved by Client.Authenticate
+	Identity *UsersAndGroups `json:",omitempty"`
+	// the credentials were verified against the hashes of the OfflineCredentials as the directory was unreachable
+	Offline bool `json:",omitempty"`
 }
 
+// LDAPRecords holds the entries of a sync. The records, and their copies, are safe for concurrent reads, e.g. by the
+// handlers of a web server: the users, groups and entities are classified once, on first use, by whichever goroutine
+// gets there first, while the others wait for it. Modifying the Entries, or the entries themselves, is not safe once
+// the records are shared, and changes made after the first use are not reflected in the classification
 type LDAPRecords struct {
 	Entries        []*LDAPEntry
+	Schema         *Schema // the directory schema, if discovered, used to compare attribute values
+	Vendor         Vendor  // the directory vendor, if detected
+	Partial        bool    // whether the sync was interrupted, in which case Entries holds the entries fetched until then
+	Truncated      bool    // whether the server cut the results of any BaseDN short at its size limit
+	Truncations    []Truncation
+	SyncCookie     string     // cookie of an incremental sync to resume from, see LDAPSyncConfig.SyncCookie
+	Delta          *SyncDelta // deletions of an incremental sync from a SyncCookie, nil for a full sync
+	serverFiltered bool       // whether the server applied the filters, so the entries they do not match are missing
 	config         *LDAPSyncConfig
-	users, groups  []*LDAPEntry
+	views          *recordViews
+	avatars        map[string]string // AvatarRefs by DN key
 	UsersAndGroups UsersAndGroups
 }
 
+// recordViews memoizes the classification of the entries of LDAPRecords, shared by the copies of the records
+type recordViews struct {
+	usersOnce, groupsOnce, entitiesOnce sync.Once
+	users, groups                       []*LDAPEntry
+	usersByDN, groupsByDN               map[string]*LDAPEntry   // by DN key
+	entities                            map[string][]*LDAPEntry // by entity class
+}
+
+// memo returns the views of the records, fresh ones, and so no memoization, for records not made by a sync
+func (sr *LDAPRecords) memo() *recordViews {
+	if sr.views == nil {
+		return &recordViews{}
+	}
+	return sr.views
+}
+
 func (sr LDAPRecords) GetUsersAndGroups() UsersAndGroups {
 
 	users := sr.GetUsers()
 	groups := sr.GetGroups()
 
 	ug := UsersAndGroups{
-		Users:  make([]User, len(users)),
-		Groups: make([]Group, len(groups)),
+		Users:      make([]User, len(users)),
+		Groups:     make([]Group, len(groups)),
+		Incomplete: sr.Truncated || sr.Partial,
 	}
 
 	for i, g := range groups {
 		ug.Groups[i] = Group{
-			DN: g.DN,
-			ID: simpleName(g.DN),
+			DN:      g.DN,
+			ID:      entryID(g, sr.config.GroupIDAttribute),
+			Sources: g.sources(),
+		}
+		sr.config.AttributeMapping.mapGroup(&ug.Groups[i], g)
+	}
+	usersBySID := make(map[string]*LDAPEntry)
+	if sr.config.ForeignPrincipals == ResolveForeignPrincipals {
+		for _, u := range users {
+			if sid := entrySID(u); sid != "" {
+				usersBySID[sid] = u
+			}
+		}
+	}
+	unresolved := sr.unresolvedReferences()
+	foreignMembers := make([][]string, len(groups)) // foreign principals resolved to synced users, per group
+	for i, g := range groups {
+		seen := make(map[string]bool)
+		for _, ref := range unresolved[g.DN] {
+			member := ref.value
+			if sid, foreign := ForeignPrincipalSID(member); foreign {
+				switch sr.config.ForeignPrincipals {
+				case ExcludeForeignPrincipals:
+					continue
+				case ResolveForeignPrincipals:
+					if u, exists := usersBySID[sid]; exists {
+						foreignMembers[i] = append(foreignMembers[i], u.DN)
+						continue
+					}
+					if name, wellKnown := WellKnownSIDName(sid); wellKnown {
+						member = name
+					}
+				}
+			}
+			if !seen[member] {
+				seen[member] = true
+				ug.Groups[i].ExternalMembers = append(ug.Groups[i].ExternalMembers, member)
+			}
 		}
 	}
+
+	members := make([]map[string]bool, len(groups)) // per-group set of member DNs already recorded
+	cmp := sr.comparator()
 	for i, u := range users {
 		ug.Users[i] = User{
-			DN: u.DN,
-			ID: simpleName(u.DN),
+			DN:        u.DN,
+			ID:        entryID(u, sr.config.UserIDAttribute),
+			SID:       entrySID(u),
+			Sources:   u.sources(),
+			AvatarRef: sr.avatars[dnKey(u.DN)],
 		}
+		sr.config.AttributeMapping.mapUser(&ug.Users[i], u)
 
 		for j, g := range ug.Groups {
-			if sr.IsMember(u.DN, g.DN) {
-				ug.Groups[j].Members = append(ug.Groups[j].Members, u.DN)
+			if sr.config.GroupMembership.isMember(u, groups[j], cmp) || containsDN(foreignMembers[j], u.DN) {
+				if members[j] == nil {
+					members[j] = make(map[string]bool)
+				}
+				if key := dnKey(u.DN); !members[j][key] {
+					members[j][key] = true
+					ug.Groups[j].Members = append(ug.Groups[j].Members, u.DN)
+					ug.Memberships = append(ug.Memberships, Membership{
+						UserDN:  u.DN,
+						GroupDN: g.DN,
+						Source:  groups[j].Source, // the group asserts the membership
+					})
+				}
 			}
 		}
 	}
 
+	if sr.config.ExpandNestedGroups {
+		sr.expandNestedGroups(&ug, groups)
+	}
+
+	// a stable order, for paging (see UsersPage) and comparing results
+	sort.SliceStable(ug.Users, func(i, j int) bool { return ug.Users[i].DN < ug.Users[j].DN })
+	sort.SliceStable(ug.Groups, func(i, j int) bool { return ug.Groups[i].DN < ug.Groups[j].DN })
+
+	if len(sr.config.RoleMapping.Rules) > 0 || sr.config.RoleMapping.DefaultRole != "" {
+		ug.Roles = sr.config.RoleMapping.Map(ug)
+	}
+	ug.Entities = sr.getEntities()
+
 	return ug
 
 }
 
+// containsDN determines whether the DN is in the list
+func containsDN(dns []string, dn string) bool {
+	for _, d := range dns {
+		if d == dn {
+			return true
+		}
+	}
+	return false
+}
+
+// entryID is the first value of the ID attribute of the entry, falling back to the value of its first RDN
+func entryID(ent *LDAPEntry, idAttribute string) string {
+	if idAttribute != "" {
+		if _, values := ent.GetAttribute(idAttribute); len(values) > 0 {
+			return values[0]
+		}
+	}
+	return simpleName(ent.DN)
+}
+
 func simpleName(dn string) string {
 	x := strings.Split(strings.Split(dn, ",")[0], "=")
 	if len(x) > 1 {
@@ -59,59 +193,87 @@ func simpleName(dn string) string {
 	return "" //error
 }
 
+// dnKey is the key used to compare DNs for de-duplication purposes
+func dnKey(dn string) string {
+	return strings.ToLower(dn)
+}
+
+// dedupeEntries removes entries with a DN that has already been seen, keeping the first occurrence
+func dedupeEntries(ents []*LDAPEntry) []*LDAPEntry {
+	seen := make(map[string]bool, len(ents))
+	out := ents[:0:0]
+	for _, e := range ents {
+		if key := dnKey(e.DN); !seen[key] {
+			seen[key] = true
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+// indexByDN returns the entries by DN key
+func indexByDN(ents []*LDAPEntry) map[string]*LDAPEntry {
+	index := make(map[string]*LDAPEntry, len(ents))
+	for _, e := range ents {
+		index[dnKey(e.DN)] = e
+	}
+	return index
+}
+
 func (sr *LDAPRecords) GetUsers() []*LDAPEntry {
+	return sr.userViews().users
+}
 
-	if sr.users == nil { //only  do this once
+// userViews returns the views of the records with the users classified
+func (sr *LDAPRecords) userViews() *recordViews {
+	views := sr.memo()
+	views.usersOnce.Do(func() {
 		var ents []*LDAPEntry
 		for _, e := range sr.Entries {
-			if sr.config.UserFilter.Matches(e) {
+			if sr.config.UserFilter.matches(e, sr.comparator()) {
 				ents = append(ents, e)
 			}
 		}
-		sr.users = ents
-	}
-	return sr.users
+		views.users = dedupeEntries(ents)
+		views.usersByDN = indexByDN(views.users)
+	})
+	return views
 }
 
 func (sr *LDAPRecords) GetGroups() []*LDAPEntry {
-	if sr.groups == nil { //only  do this once
+	return sr.groupViews().groups
+}
+
+// groupViews returns the views of the records with the groups classified
+func (sr *LDAPRecords) groupViews() *recordViews {
+	views := sr.memo()
+	views.groupsOnce.Do(func() {
 		var ents []*LDAPEntry
 		for _, e := range sr.Entries {
-			if sr.config.GroupFilter.Matches(e) {
+			if sr.config.GroupFilter.matches(e, sr.comparator()) {
 				ents = append(ents, e)
 			}
 		}
-		sr.groups = ents
-	}
-
-	return sr.groups
+		views.groups = dedupeEntries(ents)
+		views.groupsByDN = indexByDN(views.groups)
+	})
+	return views
 }
 
 // checks whether a user distinguished name (DN) belongs to the group specified as a DN
 func (sr *LDAPRecords) IsMember(user, group string) bool {
-	var uu, gg *LDAPEntry
-	for _, g := range sr.GetGroups() {
-		if g.DN == group {
-			gg = g
-		}
-	}
-
+	gg := sr.groupViews().groupsByDN[dnKey(group)]
 	if gg == nil { // group not found
 		return false
 	}
 
-	for _, u := range sr.GetUsers() {
-		if u.DN == user {
-			uu = u
-		}
-	}
-
+	uu := sr.userViews().usersByDN[dnKey(user)]
 	if uu == nil { // user not found
 		return false
 	}
 
 	//found a user and group. Determine if user belongs to group
-	return sr.config.GroupMembership.IsMember(uu, gg)
+	return sr.config.GroupMembership.isMember(uu, gg, sr.comparator())
 }
 
 type LDAPAuthData struct {
@@ -122,6 +284,32 @@ type LDAPAuthData struct {
 	URDNs    string `json:"urdns"`
 	User     string `json:"user"`
 	Password string `json:"pwd"`
+	// finds the user to bind as by searching the URDNs with the filter, every %s of which is replaced by the escaped
+	// User, e.g. (|(uid=%s)(mail=%s)) for users in many OUs logging in by uid or email, rather than binding as
+	// UID=User,URDNs. The search binds as the SyncUserName, if set, and anonymously otherwise
+	UserSearchFilter string `json:"userSearchFilter"`
+	SyncUserName     string `json:"syncUserName"`
+	SyncPassword     string `json:"syncUserPassword"`
+	// bind as the User by the SASL mechanism or NTLM, rather than as a DN with a simple bind, if set. The UID, URDNs
+	// and UserSearchFilter are then not used, and the DN of the user, for the RequiredGroups, is the one the server
+	// reports the connection bound as. Of the SASL mechanisms, only DIGEST-MD5 checks the password of the user
+	SASL *SASLOptions `json:"sasl"`
+	NTLM *NTLMOptions `json:"ntlm"`
+
+	Metrics      Metrics        `json:"-"`        // receives the metrics of the authentication, discarded if nil
+	Logger       Logger         `json:"-"`        // receives the logs of the authentication, discarded if nil
+	ControlSpecs []ControlSpec  `json:"controls"` // request controls attached to the bind, ahead of any Controls
+	Controls     []ldap.Control `json:"-"`
+	TLSOptions   TLSOptions     `json:"tlsOptions"`
+
+	// DNs of the groups the user must be a member of for Auth to succeed: any of them, or all of them if RequireAllGroups
+	RequiredGroups   []string `json:"requiredGroups"`
+	RequireAllGroups bool     `json:"requireAllGroups"`
+
+	SecondFactor     SecondFactor `json:"-"`                // verifies a second factor of the user once the password is accepted, if set
+	SecondFactorCode string       `json:"secondFactorCode"` // e.g. a TOTP code, passed to the SecondFactor
+
+	Retry *RetryPolicy `json:"retry"` // retries the dial and bind if they fail transiently, if set
 }
 
 type LDAPConfig struct {
@@ -139,12 +327,120 @@ type LDAPSyncConfig struct {
 	RequiresAuthentication bool                      `json:"syncRequiresAuth"` //if sync requires authentication, in which case sync username and passwords below must be set
 	SyncUserName           string                    `json:"syncUserName"`     //distinguished name of an administrative user that the application will use when connecting to the directory server. For Active Directory, the user should be a member of the built-in administrator group
 	SyncPassword           string                    `json:"syncUserPassword"`
+	SASL                   *SASLOptions              `json:"sasl"` // binds the sync user by the SASL mechanism if set, and the users of Client.Authenticate if DIGEST-MD5
+	NTLM                   *NTLMOptions              `json:"ntlm"` // binds the sync user, and the users of Client.Authenticate, by NTLM if set
+	TLSOptions             TLSOptions                `json:"tlsOptions"`
 	TLS                    string                    `json:"tls"`     // options: none, tls, starttls
 	Port                   *string                   `json:"port"`    //389 if not set
-	BaseDNs                []string                  `json:"baseDNs"` //Base DNs to search from `json:"baseDNs"`
+	BaseDNs                []string                  `json:"baseDNs"` //Base DNs to search from, LDAP URLs (e.g. ldap:///ou=people,dc=x?uid,mail?sub?(objectClass=person)), or "auto" to discover them from the RootDSE
 	GroupFilter            LDAPFilter                `json:"groupFilter"`
 	UserFilter             LDAPFilter                `json:"userFilter"`
-	GroupMembership        GroupMembershipAssociator `json:"groupMembership"` // how we determine which groups the user belongs to
+	GroupMembership        GroupMembershipAssociator `json:"groupMembership"`  // how we determine which groups the user belongs to
+	DiscoverSchema         bool                      `json:"discoverSchema"`   // read the server schema to compare values by their attributes' matching rules
+	DetectVendor           bool                      `json:"detectVendor"`     // detect the directory vendor and use its conventional filters, membership and IDs where not configured
+	UserIDAttribute        string                    `json:"userIDAttribute"`  // attribute holding the user's ID e.g. uid, defaults to the value of the first RDN
+	GroupIDAttribute       string                    `json:"groupIDAttribute"` // attribute holding the group's ID e.g. cn, defaults to the value of the first RDN
+	ValuePreparation       ValuePreparation          `json:"valuePreparation"` // Unicode normalization and case folding applied to values before comparison
+	RoleMapping            RoleMapping               `json:"roleMapping"`      // how groups map to application roles
+	// how Active Directory foreign security principals among group members are handled
+	ForeignPrincipals ForeignPrincipalPolicy `json:"foreignPrincipals"`
+	// only fetch the attributes needed to filter users and groups, identify them and determine memberships, rather
+	// than all attributes, for consumers that just need the membership graph of large directories
+	MembershipOnly bool `json:"membershipOnly"`
+	// only fetch these attributes, besides those needed to filter users and groups, identify them, determine
+	// memberships and fill the AttributeMapping, Avatars and OfflineCredentials, rather than all attributes
+	SyncAttributes []string `json:"syncAttributes"`
+	// attributes left out of the synced entries unless needed as above, e.g. jpegPhoto or userCertificate. They are
+	// only left out of the search requests along with SyncAttributes, and removed from the fetched entries otherwise
+	ExcludeAttributes []string `json:"excludeAttributes"`
+	// fetch every entry under the BaseDNs and filter them client-side, rather than sending the UserFilter, GroupFilter
+	// and EntityClasses filters to the server. Needed by ValidateMembership to tell members the UserFilter does not
+	// match from unknown ones, as only matching entries are fetched otherwise
+	ClientSideFilters bool `json:"clientSideFilters"`
+	// request controls attached to the bind and searches of the sync, e.g. ManageDsaIT, ahead of any Controls
+	ControlSpecs []ControlSpec `json:"controls"`
+	// entries requested per page of the searches of the sync, 500 if not set
+	PageSize uint32 `json:"pageSize"`
+	// most entries the server returns for the search of each BaseDN, unlimited (up to the server's own limits) if
+	// not set. Searches cut short are reported in the Truncations of the records
+	SizeLimit int `json:"sizeLimit"`
+	// longest the server spends on the search of each BaseDN, in whole seconds, unlimited if not set
+	TimeLimit Duration `json:"timeLimit"`
+	// follow the referrals of the searches to other servers, e.g. across the domains of an Active Directory forest,
+	// rather than ignoring them. Incremental syncs do not follow referrals
+	Referrals *ReferralOptions `json:"referrals"`
+	// bound on the depth of nested groups expanded when resolving transitive memberships, protecting against
+	// pathological group structures; zero uses the default of 32, and a negative value disables nesting
+	MaxGroupNesting int `json:"maxGroupNesting"`
+	// include the members of nested groups (groups that are members of a group) in the Members of the groups of
+	// GetUsersAndGroups, rather than just the direct members, down to the MaxGroupNesting depth
+	ExpandNestedGroups bool `json:"expandNestedGroups"`
+	// subtrees under the BaseDNs to leave out of the sync, e.g. ou=disabled,dc=example,dc=com
+	ExcludeDNs []string `json:"excludeDNs"`
+	// rules rewriting the suffixes of entry DNs and DN-valued attributes (e.g. member) during the sync, e.g. for
+	// migrations and proxied directories. The ExcludeDNs apply to the DNs before they are rewritten
+	DNRewrites []DNRewrite `json:"dnRewrites"`
+	// types of entities synced besides users and groups, e.g. service accounts, computers or devices
+	EntityClasses []EntityClass `json:"entityClasses"`
+	// maps attributes to the Email, DisplayName and other fields of users and groups, if set
+	AttributeMapping *AttributeMapping `json:"attributeMapping"`
+	// extracts the photos of users into their AvatarRef, if set
+	Avatars *AvatarOptions `json:"avatars"`
+	// fetch only the entries changed since the SyncCookie, with the given protocol: syncrepl, dirsync (Active
+	// Directory), or none if empty.
+	// Incremental syncs are not cached
+	Incremental string `json:"incremental"`
+	// SyncCookie of the records of the previous sync to resume from, the whole content if empty
+	SyncCookie string `json:"syncCookie"`
+	// how long results are served from the Cache, e.g. "5m"
+	CacheTTL Duration `json:"cacheTTL"`
+	// groups (by DN or ID) the user must be a member of for Client.Authenticate to succeed: any of them, or all of
+	// them if RequireAllGroups
+	RequiredGroups   []string `json:"requiredGroups"`
+	RequireAllGroups bool     `json:"requireAllGroups"`
+
+	// cap on simultaneous outstanding operations against the server, shared by all syncs and authentications
+	// in the process. Zero leaves the server's cap (unlimited by default) unchanged
+	MaxConcurrentOperations int `json:"maxConcurrentOperations"`
+	// rate limit on search and bind operations against the server, shared like MaxConcurrentOperations.
+	// Nil leaves the server's rate limit (unlimited by default) unchanged
+	RateLimit *RateLimit `json:"rateLimit"`
+	// circuit breaker that fails fast when the server repeatedly fails, shared like MaxConcurrentOperations.
+	// Nil leaves the server's circuit breaker (disabled by default) unchanged
+	CircuitBreaker *CircuitBreaker `json:"circuitBreaker"`
+	// pool of connections a Client reuses across its operations; nil for a new connection for each operation
+	Pool *PoolOptions `json:"pool"`
+	// retries syncs and the connections of authentications that fail transiently, e.g. as the server is busy, if set.
+	// Retried syncs resume from the checkpoints of the StateStore, if any
+	Retry *RetryPolicy `json:"retry"`
+	// replicas of the Server, as host or host:port (with the Port if not given), connected to in turn when the servers
+	// before them fail, e.g. as they are down
+	Servers []string `json:"servers"`
+	// spread the connections across the Server and Servers in turn, rather than preferring the Server
+	RoundRobin bool `json:"roundRobin"`
+	// BaseDNs searched at once, each on a connection of its own, to cut the time of syncing many domains; 1 if not set
+	Concurrency int `json:"concurrency"`
+
+	// where the progress of the sync is checkpointed a page at a time, so an interrupted sync resumes from the last
+	// completed page. Servers that bind paging cookies to a connection (e.g. OpenLDAP) resume from the start of the BaseDN
+	StateStore StateStore `json:"-"`
+	// called with the progress of the sync after every page, e.g. to drive progress bars and liveness checks
+	Progress func(ProgressEvent) `json:"-"`
+	// called around each LDAP operation and at each stage of the sync
+	Hooks *Hooks `json:"-"`
+	// serves the results of Do and ResolveUserGroups from recent ones of the same configuration, if CacheTTL is set
+	Cache Cache `json:"-"`
+	// receives the metrics of the sync and its LDAP operations, discarded if nil
+	Metrics Metrics `json:"-"`
+	// receives the logs of the sync and its LDAP operations, e.g. a *slog.Logger, discarded if nil
+	Logger Logger `json:"-"`
+	// request controls attached to the bind and searches of the sync, after those of the ControlSpecs
+	Controls []ldap.Control `json:"-"`
+	// verifies a second factor of users whose password Client.Authenticate accepted, if set
+	SecondFactor SecondFactor `json:"-"`
+	// holds the password hashes of the users of each complete sync, which Client.Authenticate verifies credentials
+	// against when the directory is unreachable, if set
+	OfflineCredentials *CredentialStore `json:"-"`
 }
 
 func (conf LDAPSyncConfig) GetDialAddr() string {
@@ -163,57 +459,270 @@ func (conf LDAPSyncConfig) GetDialURL() string {
 	return "ldap://" + net.JoinHostPort(conf.Server, port)
 }
 
-// Prevent LDAP Injection
+// Sanitize returns the configuration with the DNs of its BaseDNs, ExcludeDNs and SyncUserName consistently escaped
+// (see sanitiseDN), guarding against LDAP injection along with the escaping of the values written into DNs and
+// filters (see EscapeDNValue and EscapeFilterValue).
 // See https://cheatsheetseries.owasp.org/cheatsheets/LDAP_Injection_Prevention_Cheat_Sheet.html
-// TODO: Implement the sanitization
 func (conf LDAPSyncConfig) Sanitize() LDAPSyncConfig {
-	for i := range conf.BaseDNs {
-		conf.BaseDNs[i] = sanitiseDN(conf.BaseDNs[i])
+	baseDNs := make([]string, len(conf.BaseDNs)) // a copy, leaving the caller's configuration as it is
+	for i, baseDN := range conf.BaseDNs {
+		baseDNs[i] = baseDN
+		if !isLDAPURL(baseDN) && !strings.EqualFold(baseDN, AutoBaseDN) {
+			baseDNs[i] = sanitiseDN(baseDN)
+		}
 	}
+	if conf.BaseDNs != nil {
+		conf.BaseDNs = baseDNs
+	}
+	excludeDNs := make([]string, len(conf.ExcludeDNs))
+	for i, dn := range conf.ExcludeDNs {
+		excludeDNs[i] = sanitiseDN(dn)
+	}
+	if conf.ExcludeDNs != nil {
+		conf.ExcludeDNs = excludeDNs
+	}
+	conf.SyncUserName = sanitiseDN(conf.SyncUserName) // not necessarily a DN, e.g. a UPN, left as it is
 	return conf
 }
 
-// TODO
-func sanitiseDN(d string) string {
-	return d
+// compileFilters replaces the filters classifying entries with compiled copies, so the records of a sync can match
+// them concurrently without affecting, or being affected by, other syncs of the configuration
+func (conf *LDAPSyncConfig) compileFilters() {
+	conf.UserFilter = conf.UserFilter.compiledCopy()
+	conf.GroupFilter = conf.GroupFilter.compiledCopy()
+	classes := make([]EntityClass, len(conf.EntityClasses))
+	for i, class := range conf.EntityClasses {
+		class.Filter = class.Filter.compiledCopy()
+		classes[i] = class
+	}
+	if conf.EntityClasses != nil {
+		conf.EntityClasses = classes
+	}
 }
 
 type LDAPEntry struct {
 	DN         string
-	Attributes []LDAPAttribute
+	Attributes []LDAPAttribute  // in the order the server returned them
+	Source     Provenance       // where the entry was synced from
+	index      map[string][]int // positions of the attributes of each lower-cased type, see indexAttributes
+	indexed    int              // number of attributes indexed
+}
+
+// NewLDAPEntry returns an entry with its attributes indexed for constant time lookups by name
+func NewLDAPEntry(dn string, attributes []LDAPAttribute) *LDAPEntry {
+	ent := &LDAPEntry{DN: dn, Attributes: attributes}
+	ent.indexAttributes()
+	return ent
+}
+
+// indexAttributes indexes the attributes by type, their name without options. Entries are indexed before they are
+// shared, as the index is not synchronised; an unindexed entry, or one whose Attributes were since changed, falls
+// back to a linear scan
+func (ent *LDAPEntry) indexAttributes() {
+	ent.index = make(map[string][]int, len(ent.Attributes))
+	for i, att := range ent.Attributes {
+		key, _ := attributeDescription(att.Name)
+		ent.index[key] = append(ent.index[key], i)
+	}
+	ent.indexed = len(ent.Attributes)
+}
+
+// attributes returns the attributes matching the attribute description, compared case-insensitively: those of
+// its type with (at least) its options, e.g. cn;lang-es for cn, but not cn for cn;lang-es. The binary transfer
+// option is ignored, so userCertificate and userCertificate;binary match each other
+func (ent *LDAPEntry) attributes(name string) (matched []*LDAPAttribute) {
+	key, options := attributeDescription(name)
+	if ent.index != nil && ent.indexed == len(ent.Attributes) {
+		for _, i := range ent.index[key] {
+			if i < len(ent.Attributes) && ent.Attributes[i].describedBy(key, options) {
+				matched = append(matched, &ent.Attributes[i])
+			}
+		}
+		return
+	}
+	for i := range ent.Attributes {
+		if ent.Attributes[i].describedBy(key, options) {
+			matched = append(matched, &ent.Attributes[i])
+		}
+	}
+	return
+}
+
+// describedBy determines whether the attribute has the type and (at least) the options
+func (att LDAPAttribute) describedBy(key string, options []string) bool {
+	if strings.IndexByte(att.Name, ';') < 0 {
+		return len(options) == 0 && strings.EqualFold(att.Name, key) // without options, the common case
+	}
+	attKey, attOptions := attributeDescription(att.Name)
+	return attKey == key && hasOptions(attOptions, options)
 }
 
+// attribute returns the attribute with the name, compared case-insensitively, or else the first one matching it
+// as an attribute description (see attributes), if the entry has one
+func (ent *LDAPEntry) attribute(name string) *LDAPAttribute {
+	matched := ent.attributes(name)
+	for _, att := range matched {
+		if strings.EqualFold(att.Name, name) {
+			return att
+		}
+	}
+	if len(matched) > 0 {
+		return matched[0]
+	}
+	return nil
+}
+
+// attributeDescription splits the attribute description, e.g. cn;lang-es, into its lower-cased type and options,
+// leaving out the binary transfer option
+func attributeDescription(name string) (key string, options []string) {
+	name = strings.ToLower(name)
+	i := strings.IndexByte(name, ';')
+	if i < 0 {
+		return name, nil
+	}
+	for _, option := range strings.Split(name[i+1:], ";") {
+		if option != "" && option != "binary" {
+			options = append(options, option)
+		}
+	}
+	return name[:i], options
+}
+
+// hasOptions determines whether the options include the wanted ones
+func hasOptions(options, wanted []string) bool {
+	for _, w := range wanted {
+		found := false
+		for _, o := range options {
+			if o == w {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// Provenance identifies where a record was synced from
+type Provenance struct {
+	Server string `json:"server"` // address of the directory server
+	BaseDN string `json:"baseDN"` // the BaseDN searched
+}
+
+// sources returns the provenance of the entry, if known
+func (ent *LDAPEntry) sources() []Provenance {
+	if ent.Source == (Provenance{}) {
+		return nil
+	}
+	return []Provenance{ent.Source}
+}
+
+// GetAttribute returns the values of the attribute, whose name is compared case-insensitively
 func (ent LDAPEntry) GetAttribute(attribute string) (bool, []string) {
-	for _, att := range ent.Attributes {
-		if att.Name == attribute {
-			return true, att.Values
+	switch matched := ent.attributes(attribute); len(matched) {
+	case 0:
+		return false, []string{}
+	case 1:
+		return true, matched[0].StringValues()
+	default:
+		// the values of the attribute and its subtypes, e.g. of cn and cn;lang-es for cn
+		var values []string
+		for _, att := range matched {
+			values = append(values, att.StringValues()...)
 		}
+		return true, values
 	}
-	return false, []string{}
 }
 
-// LDAPAttribute is an LDAP attribute that has a name and a list of values
+// LDAPAttribute is an LDAP attribute that has a name and a list of values.
+// Synced attributes hold the values both as strings and, in ByteValues, as received, as go-ldap decodes them
 type LDAPAttribute struct {
-	Name   string
-	Values []string
+	Name       string
+	Values     []string
+	ByteValues [][]byte `json:"-"` // the raw values, e.g. of binary attributes such as objectSid
+}
+
+// StringValues returns the values as strings
+func (att LDAPAttribute) StringValues() []string {
+	return att.Values
+}
+
+// RawValues returns the values as bytes, without conversion where the raw values are held
+func (att LDAPAttribute) RawValues() [][]byte {
+	if att.ByteValues != nil {
+		return att.ByteValues
+	}
+	raw := make([][]byte, len(att.Values))
+	for i, v := range att.Values {
+		raw[i] = []byte(v)
+	}
+	return raw
+}
+
+// MarshalJSON marshals the attribute with its values as strings
+func (att LDAPAttribute) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Name   string
+		Values []string
+	}{att.Name, att.StringValues()})
 }
 
 func (att LDAPAttribute) String() string {
-	return fmt.Sprintf("%s -> %s", att.Name, att.Values)
+	return fmt.Sprintf("%s -> %s", att.Name, att.StringValues())
 }
 
 type UsersAndGroups struct {
-	Users  []User
-	Groups []Group
+	Users       []User
+	Groups      []Group
+	Memberships []Membership        `json:",omitempty"` // the group memberships of users, with their provenance
+	Roles       map[string][]string `json:",omitempty"` // application roles by user ID, as per the RoleMapping
+	Entities    []Entity            `json:",omitempty"` // entities of the EntityClasses, by class and DN
+	// whether the result is of a Truncated or Partial sync, missing some of the users and groups, which sinks should
+	// not take as deleted
+	Incomplete bool `json:",omitempty"`
+}
+
+// Membership is the membership of a user in a group
+type Membership struct {
+	UserDN  string
+	GroupDN string
+	Source  Provenance // where the group entry asserting the membership was synced from
+	Via     string     `json:",omitempty"` // the nested group the user is a direct member of, see ExpandNestedGroups
 }
 
 type User struct {
 	ID string //simple name johnd
 	DN string // e.g. uid=johnd,ou=users,dc=company,dc=com
+	// DNs of the same person in other directories, when users are correlated across directories
+	AlternateDNs []string     `json:",omitempty"`
+	Sources      []Provenance `json:",omitempty"` // where the user was synced from
+	SID          string       `json:",omitempty"` // Active Directory security identifier, from objectSid
+	AvatarRef    string       `json:",omitempty"` // data URL or file reference of the user's photo, see AvatarOptions
+	// fields mapped from the user's attributes, see AttributeMapping
+	Email       string            `json:",omitempty"`
+	DisplayName string            `json:",omitempty"`
+	GivenName   string            `json:",omitempty"`
+	Surname     string            `json:",omitempty"`
+	Phone       string            `json:",omitempty"`
+	Title       string            `json:",omitempty"`
+	Department  string            `json:",omitempty"`
+	Extra       map[string]string `json:",omitempty"`
 }
 
 type Group struct {
 	ID      string
 	DN      string
-	Members []string //user DNs
+	Members []string //user DNs, each appearing at most once
+	// member references that do not match any synced user, e.g. foreign members, service accounts
+	// excluded by the UserFilter and nested groups
+	ExternalMembers []string     `json:",omitempty"`
+	Sources         []Provenance `json:",omitempty"` // where the group was synced from
+	// nested groups whose members were not expanded as they lie beyond the MaxGroupNesting depth
+	UnexpandedGroups []string `json:",omitempty"`
+	// fields mapped from the group's attributes, see AttributeMapping
+	DisplayName string `json:",omitempty"`
+	Description string `json:",omitempty"`
+	Email       string `json:",omitempty"`
 }
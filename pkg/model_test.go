@@ -0,0 +1,36 @@
+package ldapsync_test
+
+import (
+	"testing"
+
+	ldapsync "github.com/adedayo/ldap-sync/pkg"
+)
+
+func TestIsMember(t *testing.T) {
+	_, config := fixture(t)
+	config.GroupMembership = ldapsync.GroupMembershipAssociator{Operator: ldapsync.And,
+		Constraints: []ldapsync.Constraint{{UserAttribute: "dn", GroupAttribute: "member"}}}
+	records, err := ldapsync.Do(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const staff = "cn=staff,ou=people,dc=example,dc=com"
+	for user, member := range map[string]bool{
+		"uid=alice,ou=people,dc=example,dc=com":  true,
+		"UID=Dave,OU=People,DC=Example,DC=Com":   true, // DNs compare case-insensitively
+		"uid=carol,ou=other,dc=example,dc=com":   false,
+		"uid=nobody,ou=people,dc=example,dc=com": false,
+		"cn=staff,ou=people,dc=example,dc=com":   false, // a group, not a user
+	} {
+		if records.IsMember(user, staff) != member {
+			t.Errorf("%s is a member: %v, want %v", user, !member, member)
+		}
+	}
+	if records.IsMember("uid=alice,ou=people,dc=example,dc=com", "cn=nobody,ou=people,dc=example,dc=com") {
+		t.Error("alice is a member of a missing group")
+	}
+	ug := records.GetUsersAndGroups()
+	if len(ug.Groups) != 1 || len(ug.Groups[0].Members) != 2 {
+		t.Errorf("groups %+v, want staff of alice and dave", ug.Groups)
+	}
+}
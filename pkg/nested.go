@@ -0,0 +1,96 @@
+package ldapsync
+
+import "strings"
+
+// subgroups returns the positions of the groups nested in each group: those that are members of it by the
+// GroupMembership constraints, as users would be, e.g. by the group's member values or the nested group's memberOf
+func (sr *LDAPRecords) subgroups(groups []*LDAPEntry) [][]int {
+	cmp := sr.comparator()
+	nested := make([][]int, len(groups))
+	seen := make([]map[int]bool, len(groups))
+	for _, c := range sr.config.GroupMembership.constraints() {
+		rule := cmp.ruleFor(c.GroupAttribute, c.UserAttribute)
+		parents := make(map[string][]int) // positions of the groups by the normalized values of the group attribute
+		for i, g := range groups {
+			for _, v := range membershipValues(g, c.GroupAttribute) {
+				key := cmp.normalize(rule, v)
+				parents[key] = append(parents[key], i)
+			}
+		}
+		for j, h := range groups {
+			for _, v := range membershipValues(h, c.UserAttribute) {
+				for _, i := range parents[cmp.normalize(rule, v)] {
+					if i == j || seen[i][j] {
+						continue
+					}
+					if seen[i] == nil {
+						seen[i] = make(map[int]bool)
+					}
+					seen[i][j] = true
+					nested[i] = append(nested[i], j)
+				}
+			}
+		}
+	}
+	return nested
+}
+
+// membershipValues returns the values of the attribute of the entry, or its DN for the dn attribute
+func membershipValues(ent *LDAPEntry, attribute string) []string {
+	if strings.EqualFold(attribute, "dn") {
+		return []string{ent.DN}
+	}
+	return ent.GetStrings(attribute)
+}
+
+// expandNestedGroups adds the members of the groups nested in each group, down to the MaxGroupNesting depth, to its
+// Members and the Memberships. Membership cycles are broken by expanding each nested group once per group, and the
+// nested groups beyond the depth are listed in the group's UnexpandedGroups. The groups are those of the
+// UsersAndGroups, in the same order
+func (sr *LDAPRecords) expandNestedGroups(ug *UsersAndGroups, groups []*LDAPEntry) {
+	nested := sr.subgroups(groups)
+	direct := make([][]string, len(groups))
+	for i := range ug.Groups {
+		direct[i] = ug.Groups[i].Members
+	}
+	maxDepth := sr.config.maxGroupNesting()
+	for i := range ug.Groups {
+		if len(nested[i]) == 0 {
+			continue
+		}
+		group := &ug.Groups[i]
+		members := make(map[string]bool, len(group.Members))
+		for _, dn := range group.Members {
+			members[dnKey(dn)] = true
+		}
+		visited := map[int]bool{i: true}
+		level := nested[i]
+		for depth := 1; len(level) > 0; depth++ {
+			var next []int
+			for _, j := range level {
+				if visited[j] {
+					continue // a cycle, or a group reached along several paths
+				}
+				visited[j] = true
+				if depth > maxDepth {
+					group.UnexpandedGroups = append(group.UnexpandedGroups, groups[j].DN)
+					continue
+				}
+				for _, dn := range direct[j] {
+					if key := dnKey(dn); !members[key] {
+						members[key] = true
+						group.Members = append(group.Members, dn)
+						ug.Memberships = append(ug.Memberships, Membership{
+							UserDN:  dn,
+							GroupDN: group.DN,
+							Source:  groups[j].Source, // the nested group asserts the membership
+							Via:     groups[j].DN,
+						})
+					}
+				}
+				next = append(next, nested[j]...)
+			}
+			level = next
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package ldapsync
+
+import (
+	"strings"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+// NTLMOptions binds with NTLM rather than a simple bind, as legacy Active Directory setups allowing only NTLM or
+// Kerberos require. Users bind by their account name, e.g. jdoe or EXAMPLE\jdoe, rather than their DN
+type NTLMOptions struct {
+	Domain string `json:"domain"` // NetBIOS domain of the users, e.g. EXAMPLE; that of the user name or the server if not set
+	// NT hash of the password of the user bound as, hex-encoded, used rather than the password, e.g. for a sync user
+	// whose password is not kept
+	NTHash string `json:"ntHash"`
+}
+
+// forUsers returns the options binding the users authenticating with their password, without the NTHash, which is
+// the sync user's
+func (no NTLMOptions) forUsers() NTLMOptions {
+	return NTLMOptions{Domain: no.Domain}
+}
+
+// ntlmBind binds as the username with the password, or the NTHash if set, by NTLM
+func (c *conn) ntlmBind(options NTLMOptions, username, password string, controls []ldap.Control) (err error) {
+	err = c.do(Operation{Name: "bind", Server: c.addr, BindDN: username}, func() error {
+		_, err := c.Conn.NTLMChallengeBind(ntlmBindRequest(options, username, password, controls))
+		return err
+	})
+	c.boundAs = boundAs(username, err)
+	return
+}
+
+// ntlmBindRequest returns the NTLM bind as the username, split into its domain and account name if qualified
+func ntlmBindRequest(options NTLMOptions, username, password string, controls []ldap.Control) *ldap.NTLMBindRequest {
+	request := &ldap.NTLMBindRequest{Domain: options.Domain, Username: username, Password: password,
+		Hash: options.NTHash, Controls: controls}
+	if domain, user, found := strings.Cut(username, `\`); found {
+		if request.Domain == "" {
+			request.Domain = domain
+		}
+		request.Username = user
+	}
+	return request
+}
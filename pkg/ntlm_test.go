@@ -0,0 +1,19 @@
+package ldapsync
+
+import "testing"
+
+func TestNTLMUsersBindWithoutTheSyncUsersHash(t *testing.T) {
+	options := NTLMOptions{Domain: "EXAMPLE", NTHash: "8846f7eaee8fb117ad06bdd830b7586c"}
+	request := ntlmBindRequest(options.forUsers(), `CORP\jdoe`, "password", nil)
+	if request.Hash != "" || request.Password != "password" {
+		t.Errorf("user bind with hash %q and password %q, want the password alone", request.Hash, request.Password)
+	}
+	if request.Domain != "EXAMPLE" || request.Username != "jdoe" {
+		t.Errorf("user bind as %s\\%s, want EXAMPLE\\jdoe", request.Domain, request.Username)
+	}
+
+	request = ntlmBindRequest(options, `svc-sync`, "", nil)
+	if request.Hash != options.NTHash {
+		t.Errorf("sync user bind with hash %q, want %q", request.Hash, options.NTHash)
+	}
+}
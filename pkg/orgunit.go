@@ -0,0 +1,169 @@
+package ldapsync
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+// OrgUnit is a node of the directory hierarchy (an organizational unit or other container), with the users and
+// groups directly under it. Leading domain components (e.g. dc=example,dc=com) form a single top-level node
+type OrgUnit struct {
+	Name     string     // the value of the RDN, e.g. Sales, or the domain for a top-level node, e.g. example.com
+	DN       string     // empty for the root
+	Parent   *OrgUnit   `json:"-"`
+	Children []*OrgUnit `json:",omitempty"`
+	Users    []User     `json:",omitempty"`
+	Groups   []Group    `json:",omitempty"`
+}
+
+// OrgUnitTree builds the hierarchy of containers from the DNs of the users and groups. The returned root has no DN
+// and holds the top-level nodes, e.g. the naming contexts, as children
+func (ug UsersAndGroups) OrgUnitTree() *OrgUnit {
+	root := &OrgUnit{}
+	units := map[string]*OrgUnit{"": root}
+	for _, u := range ug.Users {
+		if ou := orgUnitOf(u.DN, units); ou != nil {
+			ou.Users = append(ou.Users, u)
+		}
+	}
+	for _, g := range ug.Groups {
+		if ou := orgUnitOf(g.DN, units); ou != nil {
+			ou.Groups = append(ou.Groups, g)
+		}
+	}
+	root.sort()
+	return root
+}
+
+// orgUnitOf returns the node of the parent of the DN, creating it and its ancestors as needed.
+// Returns nil if the DN can not be parsed
+func orgUnitOf(dn string, units map[string]*OrgUnit) *OrgUnit {
+	d, err := ldap.ParseDN(dn)
+	if err != nil || len(d.RDNs) == 0 {
+		return nil
+	}
+	return orgUnit(d.RDNs[1:], units)
+}
+
+func orgUnit(rdns []*ldap.RelativeDN, units map[string]*OrgUnit) *OrgUnit {
+	if len(rdns) == 0 {
+		return units[""]
+	}
+	dn := (&ldap.DN{RDNs: rdns}).String()
+	key := normalizeDN(dn)
+	if ou, exists := units[key]; exists {
+		return ou
+	}
+	var ou *OrgUnit
+	if domain, ok := domainName(rdns); ok {
+		ou = &OrgUnit{Name: domain, DN: dn, Parent: units[""]}
+	} else {
+		parent := orgUnit(rdns[1:], units)
+		ou = &OrgUnit{Name: rdnValue(rdns[0]), DN: dn, Parent: parent}
+	}
+	ou.Parent.Children = append(ou.Parent.Children, ou)
+	units[key] = ou
+	return ou
+}
+
+// domainName returns the dotted domain name if the RDNs are all domain components
+func domainName(rdns []*ldap.RelativeDN) (string, bool) {
+	labels := make([]string, len(rdns))
+	for i, rdn := range rdns {
+		if len(rdn.Attributes) != 1 || !strings.EqualFold(rdn.Attributes[0].Type, "dc") {
+			return "", false
+		}
+		labels[i] = rdn.Attributes[0].Value
+	}
+	return strings.Join(labels, "."), true
+}
+
+func rdnValue(rdn *ldap.RelativeDN) string {
+	values := make([]string, len(rdn.Attributes))
+	for i, atv := range rdn.Attributes {
+		values[i] = atv.Value
+	}
+	return strings.Join(values, "+")
+}
+
+func (ou *OrgUnit) sort() {
+	sort.Slice(ou.Children, func(i, j int) bool {
+		return strings.ToLower(ou.Children[i].Name) < strings.ToLower(ou.Children[j].Name)
+	})
+	for _, c := range ou.Children {
+		c.sort()
+	}
+}
+
+// Find returns the descendant at the path of names (case-insensitive), e.g. Find("example.com", "Sales", "EMEA"),
+// or nil if there is none
+func (ou *OrgUnit) Find(path ...string) *OrgUnit {
+	node := ou
+	for _, name := range path {
+		var next *OrgUnit
+		for _, c := range node.Children {
+			if strings.EqualFold(c.Name, name) {
+				next = c
+				break
+			}
+		}
+		if next == nil {
+			return nil
+		}
+		node = next
+	}
+	return node
+}
+
+// Lookup returns the node with the DN, among this node and its descendants, or nil if there is none
+func (ou *OrgUnit) Lookup(dn string) (found *OrgUnit) {
+	key := normalizeDN(dn)
+	ou.Walk(func(n *OrgUnit) bool {
+		if n.DN != "" && normalizeDN(n.DN) == key {
+			found = n
+		}
+		return found == nil
+	})
+	return
+}
+
+// Walk visits this node and its descendants depth-first, stopping once the visitor returns false
+func (ou *OrgUnit) Walk(visit func(*OrgUnit) bool) bool {
+	if !visit(ou) {
+		return false
+	}
+	for _, c := range ou.Children {
+		if !c.Walk(visit) {
+			return false
+		}
+	}
+	return true
+}
+
+// AllUsers returns the users under this node, including those of its descendants
+func (ou *OrgUnit) AllUsers() (users []User) {
+	ou.Walk(func(n *OrgUnit) bool {
+		users = append(users, n.Users...)
+		return true
+	})
+	return
+}
+
+// AllGroups returns the groups under this node, including those of its descendants
+func (ou *OrgUnit) AllGroups() (groups []Group) {
+	ou.Walk(func(n *OrgUnit) bool {
+		groups = append(groups, n.Groups...)
+		return true
+	})
+	return
+}
+
+// Path returns the names from the top-level node down to this node
+func (ou *OrgUnit) Path() []string {
+	if ou.Parent == nil {
+		return nil
+	}
+	return append(ou.Parent.Path(), ou.Name)
+}
@@ -0,0 +1,30 @@
+package ldapsync
+
+// UsersPage returns at most limit users from the offset, all of those from the offset if limit is not positive,
+// with the total number of users. The page shares the Users slice, in its order: GetUsersAndGroups orders users by
+// DN, so pages are stable across calls and syncs
+func (ug UsersAndGroups) UsersPage(offset, limit int) (page []User, total int) {
+	start, end := pageBounds(len(ug.Users), offset, limit)
+	return ug.Users[start:end:end], len(ug.Users)
+}
+
+// GroupsPage returns at most limit groups from the offset, with the total number of groups, see UsersPage
+func (ug UsersAndGroups) GroupsPage(offset, limit int) (page []Group, total int) {
+	start, end := pageBounds(len(ug.Groups), offset, limit)
+	return ug.Groups[start:end:end], len(ug.Groups)
+}
+
+// pageBounds returns the bounds of the page in a slice of n items, clamped to the slice
+func pageBounds(n, offset, limit int) (start, end int) {
+	if offset < 0 {
+		offset = 0
+	}
+	if offset > n {
+		offset = n
+	}
+	end = n
+	if limit > 0 && limit < n-offset {
+		end = offset + limit
+	}
+	return offset, end
+}
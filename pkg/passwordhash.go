@@ -0,0 +1,330 @@
+package ldapsync
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"hash"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// ErrUnsupportedHash is returned for password hashes of schemes VerifyPasswordHash does not support
+var ErrUnsupportedHash = errors.New("unsupported password hash scheme")
+
+// VerifyPasswordHash verifies the password against a userPassword value, an RFC 3112 {scheme} prefixed hash:
+//   - {SSHA}, {SSHA256}, {SSHA512}, {SMD5} and their unsalted variants {SHA}, {SHA256}, {SHA512} and {MD5}
+//   - {CRYPT} with bcrypt ($2a$, $2b$, $2y$), SHA-crypt ($5$, $6$) or MD5-crypt ($1$) hashes
+//   - {ARGON2} with argon2i or argon2id hashes in the PHC string format, as written by OpenLDAP's pw-argon2
+//
+// A value without a scheme is a cleartext password
+func VerifyPasswordHash(userPassword, password string) (bool, error) {
+	scheme, value := "", userPassword
+	if strings.HasPrefix(userPassword, "{") {
+		if end := strings.IndexByte(userPassword, '}'); end > 0 {
+			scheme, value = strings.ToUpper(userPassword[1:end]), userPassword[end+1:]
+		}
+	}
+	switch scheme {
+	case "", "CLEARTEXT":
+		return subtle.ConstantTimeCompare([]byte(value), []byte(password)) == 1, nil
+	case "SHA", "SSHA":
+		return verifySaltedDigest(sha1.New, value, password)
+	case "SHA256", "SSHA256":
+		return verifySaltedDigest(sha256.New, value, password)
+	case "SHA512", "SSHA512":
+		return verifySaltedDigest(sha512.New, value, password)
+	case "MD5", "SMD5":
+		return verifySaltedDigest(md5.New, value, password)
+	case "CRYPT":
+		return verifyCrypt(value, password)
+	case "ARGON2":
+		return verifyArgon2(value, password)
+	default:
+		return false, fmt.Errorf("%w: {%s}", ErrUnsupportedHash, scheme)
+	}
+}
+
+// verifySaltedDigest verifies the base64 encoded digest of the password and salt, followed by the salt, if any
+func verifySaltedDigest(newHash func() hash.Hash, value, password string) (bool, error) {
+	decoded, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return false, fmt.Errorf("invalid password hash: %w", err)
+	}
+	h := newHash()
+	if len(decoded) < h.Size() {
+		return false, fmt.Errorf("invalid password hash: %d bytes, expected at least %d", len(decoded), h.Size())
+	}
+	digest, salt := decoded[:h.Size()], decoded[h.Size():]
+	h.Write([]byte(password))
+	h.Write(salt)
+	return subtle.ConstantTimeCompare(h.Sum(nil), digest) == 1, nil
+}
+
+func verifyCrypt(value, password string) (bool, error) {
+	var computed string
+	switch {
+	case strings.HasPrefix(value, "$2a$"), strings.HasPrefix(value, "$2b$"), strings.HasPrefix(value, "$2y$"):
+		err := bcrypt.CompareHashAndPassword([]byte(value), []byte(password))
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return false, nil
+		}
+		return err == nil, err
+	case strings.HasPrefix(value, "$5$"):
+		computed = shaCrypt(value, password, sha256.New, "$5$", sha256Order)
+	case strings.HasPrefix(value, "$6$"):
+		computed = shaCrypt(value, password, sha512.New, "$6$", sha512Order)
+	case strings.HasPrefix(value, "$1$"):
+		computed = md5Crypt(value, password)
+	default:
+		return false, fmt.Errorf("%w: {CRYPT} %.3s", ErrUnsupportedHash, value)
+	}
+	if computed == "" {
+		return false, fmt.Errorf("invalid {CRYPT} password hash: malformed, or of more than %d rounds", maxSHACryptRounds)
+	}
+	return subtle.ConstantTimeCompare([]byte(computed), []byte(value)) == 1, nil
+}
+
+// cryptAlphabet is the base64 alphabet of crypt(3)
+const cryptAlphabet = "./0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+// cryptEncode encodes the digest with the alphabet of crypt(3), taking its bytes three at a time in the order, in
+// which -1 stands for a zero byte, e.g. {0, 10, 20} encodes digest[0], digest[10] and digest[20]
+func cryptEncode(digest []byte, order [][3]int) string {
+	var b strings.Builder
+	for _, group := range order {
+		var w uint
+		chars := 4
+		for _, i := range group {
+			w <<= 8
+			if i >= 0 {
+				w |= uint(digest[i])
+			} else {
+				chars-- // a byte short of a full group
+			}
+		}
+		for ; chars > 0; chars-- {
+			b.WriteByte(cryptAlphabet[w&0x3f])
+			w >>= 6
+		}
+	}
+	return b.String()
+}
+
+var sha256Order = [][3]int{{0, 10, 20}, {21, 1, 11}, {12, 22, 2}, {3, 13, 23}, {24, 4, 14}, {15, 25, 5}, {6, 16, 26},
+	{27, 7, 17}, {18, 28, 8}, {9, 19, 29}, {-1, 31, 30}}
+
+var sha512Order = [][3]int{{0, 21, 42}, {22, 43, 1}, {44, 2, 23}, {3, 24, 45}, {25, 46, 4}, {47, 5, 26}, {6, 27, 48},
+	{28, 49, 7}, {50, 8, 29}, {9, 30, 51}, {31, 52, 10}, {53, 11, 32}, {12, 33, 54}, {34, 55, 13}, {56, 14, 35},
+	{15, 36, 57}, {37, 58, 16}, {59, 17, 38}, {18, 39, 60}, {40, 61, 19}, {62, 20, 41}, {-1, -1, 63}}
+
+var md5Order = [][3]int{{0, 6, 12}, {1, 7, 13}, {2, 8, 14}, {3, 9, 15}, {4, 10, 5}, {-1, -1, 11}}
+
+// maxSHACryptRounds bounds the rounds of SHA-crypt hashes, which are read from the directory: the 999,999,999 the
+// scheme allows would take minutes to verify
+const maxSHACryptRounds = 1000000
+
+// shaCrypt computes the SHA-crypt hash of the password with the salt and rounds of the setting, a hash with the
+// magic prefix ($5$ or $6$), returning "" if the setting is invalid or asks for more than maxSHACryptRounds rounds.
+// See https://www.akkadia.org/drepper/SHA-crypt.txt
+func shaCrypt(setting, password string, newHash func() hash.Hash, magic string, order [][3]int) string {
+	rest := strings.TrimPrefix(setting, magic)
+	rounds, explicitRounds := 5000, false
+	if strings.HasPrefix(rest, "rounds=") {
+		spec, after, found := strings.Cut(strings.TrimPrefix(rest, "rounds="), "$")
+		n, err := strconv.Atoi(spec)
+		if !found || err != nil || n > maxSHACryptRounds {
+			return ""
+		}
+		rounds, explicitRounds, rest = n, true, after
+		if rounds < 1000 {
+			rounds = 1000
+		}
+	}
+	salt, _, _ := strings.Cut(rest, "$")
+	if len(salt) > 16 {
+		salt = salt[:16]
+	}
+	p, s := []byte(password), []byte(salt)
+
+	h := newHash()
+	h.Write(p)
+	h.Write(s)
+	h.Write(p)
+	b := h.Sum(nil)
+
+	h.Reset()
+	h.Write(p)
+	h.Write(s)
+	h.Write(repeated(b, len(p)))
+	for n := len(p); n > 0; n >>= 1 {
+		if n&1 != 0 {
+			h.Write(b)
+		} else {
+			h.Write(p)
+		}
+	}
+	a := h.Sum(nil)
+
+	h.Reset()
+	for range p {
+		h.Write(p)
+	}
+	dp := repeated(h.Sum(nil), len(p))
+
+	h.Reset()
+	for i := 0; i < 16+int(a[0]); i++ {
+		h.Write(s)
+	}
+	ds := repeated(h.Sum(nil), len(s))
+
+	c := a
+	for i := 0; i < rounds; i++ {
+		h.Reset()
+		if i&1 != 0 {
+			h.Write(dp)
+		} else {
+			h.Write(c)
+		}
+		if i%3 != 0 {
+			h.Write(ds)
+		}
+		if i%7 != 0 {
+			h.Write(dp)
+		}
+		if i&1 != 0 {
+			h.Write(c)
+		} else {
+			h.Write(dp)
+		}
+		c = h.Sum(nil)
+	}
+
+	prefix := magic
+	if explicitRounds {
+		prefix += "rounds=" + strconv.Itoa(rounds) + "$"
+	}
+	return prefix + salt + "$" + cryptEncode(c, order)
+}
+
+// md5Crypt computes the MD5-crypt hash of the password with the salt of the setting, a $1$ hash
+func md5Crypt(setting, password string) string {
+	salt, _, _ := strings.Cut(strings.TrimPrefix(setting, "$1$"), "$")
+	if len(salt) > 8 {
+		salt = salt[:8]
+	}
+	p, s := []byte(password), []byte(salt)
+
+	alternate := md5.Sum(bytes.Join([][]byte{p, s, p}, nil))
+	h := md5.New()
+	h.Write(p)
+	h.Write([]byte("$1$"))
+	h.Write(s)
+	h.Write(repeated(alternate[:], len(p)))
+	for n := len(p); n > 0; n >>= 1 {
+		if n&1 != 0 {
+			h.Write([]byte{0})
+		} else {
+			h.Write(p[:1])
+		}
+	}
+	final := h.Sum(nil)
+
+	for i := 0; i < 1000; i++ {
+		h.Reset()
+		if i&1 != 0 {
+			h.Write(p)
+		} else {
+			h.Write(final)
+		}
+		if i%3 != 0 {
+			h.Write(s)
+		}
+		if i%7 != 0 {
+			h.Write(p)
+		}
+		if i&1 != 0 {
+			h.Write(final)
+		} else {
+			h.Write(p)
+		}
+		final = h.Sum(nil)
+	}
+	return "$1$" + salt + "$" + cryptEncode(final, md5Order)
+}
+
+// repeated returns the bytes repeated up to the length
+func repeated(b []byte, length int) []byte {
+	out := make([]byte, 0, length)
+	for len(out) < length {
+		out = append(out, b[:minInt(len(b), length-len(out))]...)
+	}
+	return out
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// bounds of the parameters of {ARGON2} hashes, which are read from the directory: the memory (in KiB) and passes a
+// verification may take, and the lengths of the hash below which it is too weak to be trusted and above which it
+// only costs time to compute
+const (
+	maxArgon2Memory = 1 << 20
+	maxArgon2Time   = 16
+	minArgon2Length = 16
+	maxArgon2Length = 64
+)
+
+// verifyArgon2 verifies a PHC string, e.g. $argon2id$v=19$m=65536,t=2,p=1$<salt>$<hash>
+func verifyArgon2(value, password string) (bool, error) {
+	parts := strings.Split(value, "$")
+	if len(parts) != 6 || parts[0] != "" {
+		return false, fmt.Errorf("invalid {ARGON2} password hash")
+	}
+	var memory, time uint32
+	var threads uint8
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &memory, &time, &threads); err != nil {
+		return false, fmt.Errorf("invalid {ARGON2} parameters %s: %w", parts[3], err)
+	}
+	if time < 1 || time > maxArgon2Time || threads < 1 || memory > maxArgon2Memory {
+		return false, fmt.Errorf("invalid {ARGON2} parameters %s: t must be between 1 and %d, p at least 1 and m at most %d",
+			parts[3], maxArgon2Time, maxArgon2Memory)
+	}
+	if parts[2] != "v=19" {
+		return false, fmt.Errorf("%w: {ARGON2} version %s", ErrUnsupportedHash, parts[2])
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return false, fmt.Errorf("invalid {ARGON2} salt: %w", err)
+	}
+	digest, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return false, fmt.Errorf("invalid {ARGON2} hash: %w", err)
+	}
+	if len(digest) < minArgon2Length || len(digest) > maxArgon2Length {
+		return false, fmt.Errorf("invalid {ARGON2} hash: not between %d and %d bytes", minArgon2Length, maxArgon2Length)
+	}
+	var computed []byte
+	switch parts[1] {
+	case "argon2id":
+		computed = argon2.IDKey([]byte(password), salt, time, memory, threads, uint32(len(digest)))
+	case "argon2i":
+		computed = argon2.Key([]byte(password), salt, time, memory, threads, uint32(len(digest)))
+	default:
+		return false, fmt.Errorf("%w: {ARGON2} %s", ErrUnsupportedHash, parts[1])
+	}
+	return subtle.ConstantTimeCompare(computed, digest) == 1, nil
+}
@@ -0,0 +1,54 @@
+package ldapsync_test
+
+import (
+	"encoding/base64"
+	"fmt"
+	"testing"
+
+	"golang.org/x/crypto/argon2"
+
+	ldapsync "github.com/adedayo/ldap-sync/pkg"
+)
+
+// argon2Hash returns the {ARGON2} hash of the password with the parameters, in the PHC string format
+func argon2Hash(password string, memory, time uint32, length int) string {
+	salt := []byte("saltsaltsaltsalt")
+	digest := argon2.IDKey([]byte(password), salt, time, memory, 1, uint32(length))
+	return fmt.Sprintf("{ARGON2}$argon2id$v=19$m=%d,t=%d,p=1$%s$%s", memory, time,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(digest))
+}
+
+func TestVerifyPasswordHash(t *testing.T) {
+	for _, userPassword := range []string{
+		"secret",
+		"{SHA}5en6G6MezRroT3XKqkdPOmY/BfQ=",
+		"{CRYPT}$1$saltstr$2v0xBJ/TLP2HGP.WwPB8M.",
+		"{CRYPT}$5$saltstring$C3o4O1TC6aRHF4FI.QSZMXtHbaj2gSXr4sUc/3NcUi.",
+		"{CRYPT}$5$rounds=2000$saltstring$x1.O0yCfsq06D8EpEMYe9IQaKt15hgFy.n01D4S/kF7",
+		"{CRYPT}$6$saltstring$AIsRs/Ee56G/tC8MEHhvReZTfx8u3rXXMl6eYrjCG9ibix19DxoMBLogdTET5Ukw9Sf7eZTITsuk0Ry5qulYz.",
+		"{CRYPT}$6$rounds=2000$saltstring$aq.2Pyb4Fb7WNJzp0WC3kqHAsRO4.E2hN3GRZmgb3z2BE/HRCYIVvnk4mnGeH0oh0ffp8uZ0DYUD5IJCrDY0Q/",
+		argon2Hash("secret", 64, 2, 32),
+	} {
+		if ok, err := ldapsync.VerifyPasswordHash(userPassword, "secret"); !ok || err != nil {
+			t.Errorf("%s: verified %v, error %v", userPassword, ok, err)
+		}
+		if ok, err := ldapsync.VerifyPasswordHash(userPassword, "wrong"); ok || err != nil {
+			t.Errorf("%s with a wrong password: verified %v, error %v", userPassword, ok, err)
+		}
+	}
+}
+
+func TestVerifyPasswordHashRejectsCostlyHashes(t *testing.T) {
+	for name, userPassword := range map[string]string{
+		"argon2 of too many passes":    argon2Hash("secret", 64, 17, 32),
+		"argon2 of no passes":          "{ARGON2}$argon2id$v=19$m=64,t=0,p=1$c2FsdHNhbHRzYWx0c2FsdA$" + base64.RawStdEncoding.EncodeToString(make([]byte, 32)),
+		"argon2 of too much memory":    "{ARGON2}$argon2id$v=19$m=2097152,t=1,p=1$c2FsdHNhbHRzYWx0c2FsdA$" + base64.RawStdEncoding.EncodeToString(make([]byte, 32)),
+		"argon2 of a too long digest":  argon2Hash("secret", 64, 1, 65),
+		"argon2 of a too short digest": argon2Hash("secret", 64, 1, 15),
+		"sha-crypt of too many rounds": "{CRYPT}$6$rounds=1000001$saltstring$aq.2Pyb4Fb7WNJzp0WC3kqHAsRO4.E2hN3GRZmgb3z2BE/HRCYIVvnk4mnGeH0oh0ffp8uZ0DYUD5IJCrDY0Q/",
+	} {
+		if ok, err := ldapsync.VerifyPasswordHash(userPassword, "secret"); ok || err == nil {
+			t.Errorf("%s: verified %v, error %v, want an error", name, ok, err)
+		}
+	}
+}
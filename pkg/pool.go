@@ -0,0 +1,150 @@
+package ldapsync
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+// PoolOptions configures the pool of connections a Client reuses across its operations, sparing each the dial and
+// bind of a new connection
+type PoolOptions struct {
+	Size        int      `json:"size"`        // most idle connections kept, 4 if not set
+	IdleTimeout Duration `json:"idleTimeout"` // how long idle connections are kept, 5m if not set
+	// connections idle for longer are checked to be alive, with a read of the RootDSE, before they are reused;
+	// 30s if not set
+	HealthCheckAfter Duration `json:"healthCheckAfter"`
+}
+
+// connPool holds the idle connections of a Client, most recently used last
+type connPool struct {
+	options PoolOptions
+	mu      sync.Mutex
+	idle    []idleConn
+	closed  bool
+}
+
+type idleConn struct {
+	*ldap.Conn
+	addr    string // of the server, which may be any of the replicas
+	boundAs string
+	since   time.Time
+}
+
+func newConnPool(options PoolOptions) *connPool {
+	if options.Size <= 0 {
+		options.Size = 4
+	}
+	if options.IdleTimeout <= 0 {
+		options.IdleTimeout = Duration(5 * time.Minute)
+	}
+	if options.HealthCheckAfter <= 0 {
+		options.HealthCheckAfter = Duration(30 * time.Second)
+	}
+	return &connPool{options: options}
+}
+
+// connect returns an idle connection of the pool, bound as the sync user if the server requires authentication,
+// or a new one if there is none. Closing the connection returns it to the pool. A nil pool always connects anew
+func (p *connPool) connect(ctx context.Context, config LDAPSyncConfig) (l *conn, err error) {
+	if p == nil {
+		return connect(ctx, config)
+	}
+	for {
+		idle, found := p.get()
+		if !found {
+			break
+		}
+		if l = p.reuse(ctx, idle, config); l != nil {
+			return
+		}
+	}
+	if l, err = connect(ctx, config); err == nil {
+		l.pool = p
+	}
+	return
+}
+
+// get takes the most recently used idle connection out of the pool
+func (p *connPool) get() (idle idleConn, found bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.prune(time.Now())
+	if n := len(p.idle); n > 0 {
+		idle, p.idle = p.idle[n-1], p.idle[:n-1]
+		found = true
+	}
+	return
+}
+
+// reuse readies the idle connection for the operations of the context, checking its health and restoring the bind
+// of the sync user (e.g. after an authentication bound it as the user), or closes it and returns nil if it can not
+func (p *connPool) reuse(ctx context.Context, idle idleConn, config LDAPSyncConfig) *conn {
+	if idle.IsClosing() {
+		return nil
+	}
+	l := newConn(ctx, idle.Conn, idle.addr, config)
+	l.boundAs = idle.boundAs
+	var err error
+	if time.Since(idle.since) > time.Duration(p.options.HealthCheckAfter) {
+		_, err = readRootDSE(l)
+	}
+	switch {
+	case err != nil:
+	case config.RequiresAuthentication && l.boundAs != config.SyncUserName:
+		err = l.bindSyncUser(config)
+	case !config.RequiresAuthentication && l.boundAs != "":
+		err = l.do(Operation{Name: "bind", Server: l.addr}, func() error {
+			return l.Conn.UnauthenticatedBind("")
+		})
+		l.boundAs = ""
+	}
+	if err != nil {
+		l.Close()
+		return nil
+	}
+	l.pool = p
+	return l
+}
+
+// put returns the connection to the pool, unless it is broken, its context is done, or the pool is full or closed
+func (p *connPool) put(c *conn) bool {
+	if c.IsClosing() || c.ctx.Err() != nil {
+		return false
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := time.Now()
+	p.prune(now)
+	if p.closed || len(p.idle) >= p.options.Size {
+		return false
+	}
+	p.idle = append(p.idle, idleConn{Conn: c.Conn, addr: c.addr, boundAs: c.boundAs, since: now})
+	return true
+}
+
+// prune closes the connections idle for longer than the IdleTimeout. The pool must be locked
+func (p *connPool) prune(now time.Time) {
+	expired := 0
+	for expired < len(p.idle) && now.Sub(p.idle[expired].since) > time.Duration(p.options.IdleTimeout) {
+		p.idle[expired].Close()
+		expired++
+	}
+	p.idle = append(p.idle[:0], p.idle[expired:]...)
+}
+
+// close closes the idle connections, and those returned to the pool from then on
+func (p *connPool) close() {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.closed = true
+	for _, idle := range p.idle {
+		idle.Close()
+	}
+	p.idle = nil
+}
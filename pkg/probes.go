@@ -0,0 +1,53 @@
+package ldapsync
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+)
+
+// ProbeHandler serves the liveness and readiness probes of the daemon, e.g. for Kubernetes, with its DaemonStatus
+// as JSON:
+//   - /healthz: 200 OK while the daemon runs, 503 Service Unavailable otherwise
+//   - /readyz: 200 OK while the daemon is Ready, its last sync having succeeded recently enough, 503 otherwise
+func (d *Daemon) ProbeHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		status := d.Status()
+		writeProbe(w, status.Running, status)
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		ready, status := d.Ready()
+		writeProbe(w, ready, status)
+	})
+	return mux
+}
+
+func writeProbe(w http.ResponseWriter, ok bool, status DaemonStatus) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if !ok {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(status)
+}
+
+// ResyncHandler serves requests for an immediate resync of the daemon, see Resync: a POST, for a full resync with
+// the query ?full=true, is answered with 202 Accepted. It is an administrative endpoint, to be served on a
+// private address
+func (d *Daemon) ResyncHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		full, err := strconv.ParseBool(r.URL.Query().Get("full"))
+		if err != nil && r.URL.Query().Get("full") != "" {
+			http.Error(w, "invalid full: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		d.Resync(full)
+		w.WriteHeader(http.StatusAccepted)
+	})
+}
@@ -0,0 +1,51 @@
+package ldapsync
+
+import (
+	"time"
+)
+
+// ProgressEvent reports the progress of a sync, after each page of entries fetched
+type ProgressEvent struct {
+	BaseDN         string        // the BaseDN being searched
+	BaseDNs        int           // the number of BaseDNs to search
+	BaseDNsDone    int           // the number of BaseDNs completely searched
+	PagesCompleted int           // pages fetched so far, across BaseDNs
+	EntriesFetched int           // entries fetched so far, across BaseDNs
+	Elapsed        time.Duration // time since the sync started
+}
+
+// progressReporter keeps track of the progress of a sync, reporting it to the configured callback, if any
+type progressReporter struct {
+	report func(ProgressEvent)
+	start  time.Time
+	event  ProgressEvent
+}
+
+func newProgressReporter(report func(ProgressEvent), baseDNs int) *progressReporter {
+	return &progressReporter{
+		report: report,
+		start:  time.Now(),
+		event:  ProgressEvent{BaseDNs: baseDNs},
+	}
+}
+
+func (p *progressReporter) startBaseDN(baseDN string) {
+	p.event.BaseDN = baseDN
+}
+
+func (p *progressReporter) page(entries int) {
+	p.event.PagesCompleted++
+	p.event.EntriesFetched += entries
+	p.emit()
+}
+
+func (p *progressReporter) baseDNDone() {
+	p.event.BaseDNsDone++
+}
+
+func (p *progressReporter) emit() {
+	if p.report != nil {
+		p.event.Elapsed = time.Since(p.start)
+		p.report(p.event)
+	}
+}
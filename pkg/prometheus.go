@@ -0,0 +1,162 @@
+package ldapsync
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// PrometheusMetrics records the metrics in memory and serves them in the Prometheus text exposition format, as an
+// http.Handler for Prometheus to scrape (e.g. at /metrics), without depending on the Prometheus client library.
+// Counts are counters, Gauges gauges and Observations histograms
+type PrometheusMetrics struct {
+	mu       sync.Mutex
+	buckets  []float64
+	families map[string]*metricFamily
+}
+
+type metricFamily struct {
+	kind   string // counter, gauge or histogram
+	series map[string]*metricSeries
+}
+
+// metricSeries is a series of a family by its labels: the value of a counter or gauge, or the buckets, sum and count
+// of a histogram
+type metricSeries struct {
+	value   float64
+	buckets []uint64
+	count   uint64
+}
+
+// DefaultBuckets are the upper bounds, in seconds, of the histogram buckets of PrometheusMetrics by default: those of
+// the Prometheus client
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// NewPrometheusMetrics returns metrics with histograms of the buckets, in increasing order, or of the DefaultBuckets
+// if none
+func NewPrometheusMetrics(buckets ...float64) *PrometheusMetrics {
+	if len(buckets) == 0 {
+		buckets = DefaultBuckets
+	}
+	return &PrometheusMetrics{buckets: buckets, families: make(map[string]*metricFamily)}
+}
+
+func (pm *PrometheusMetrics) Count(name string, delta float64, labels map[string]string) {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	pm.series(name, "counter", labels).value += delta
+}
+
+func (pm *PrometheusMetrics) Gauge(name string, value float64, labels map[string]string) {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	pm.series(name, "gauge", labels).value = value
+}
+
+func (pm *PrometheusMetrics) Observe(name string, value float64, labels map[string]string) {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	s := pm.series(name, "histogram", labels)
+	if s.buckets == nil {
+		s.buckets = make([]uint64, len(pm.buckets))
+	}
+	for i, bound := range pm.buckets {
+		if value <= bound {
+			s.buckets[i]++
+		}
+	}
+	s.value += value
+	s.count++
+}
+
+// series returns the series of the family of the name with the labels, created on first use. A family keeps the
+// kind it was first recorded as
+func (pm *PrometheusMetrics) series(name, kind string, labels map[string]string) *metricSeries {
+	family, found := pm.families[name]
+	if !found {
+		family = &metricFamily{kind: kind, series: make(map[string]*metricSeries)}
+		pm.families[name] = family
+	}
+	key := formatLabels(labels)
+	s, found := family.series[key]
+	if !found {
+		s = &metricSeries{}
+		family.series[key] = s
+	}
+	return s
+}
+
+// ServeHTTP serves the metrics in the Prometheus text exposition format
+func (pm *PrometheusMetrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	pm.WriteTo(w)
+}
+
+// WriteTo writes the metrics in the Prometheus text exposition format, sorted by name and labels
+func (pm *PrometheusMetrics) WriteTo(w io.Writer) (n int64, err error) {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	var b strings.Builder
+	names := make([]string, 0, len(pm.families))
+	for name := range pm.families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		family := pm.families[name]
+		fmt.Fprintf(&b, "# TYPE %s %s\n", name, family.kind)
+		keys := make([]string, 0, len(family.series))
+		for key := range family.series {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			s := family.series[key]
+			if family.kind != "histogram" {
+				fmt.Fprintf(&b, "%s%s %s\n", name, braced(key), formatFloat(s.value))
+				continue
+			}
+			for i, bound := range pm.buckets {
+				fmt.Fprintf(&b, "%s_bucket%s %d\n", name, braced(joinLabels(key, `le="`+formatFloat(bound)+`"`)), s.buckets[i])
+			}
+			fmt.Fprintf(&b, "%s_bucket%s %d\n", name, braced(joinLabels(key, `le="+Inf"`)), s.count)
+			fmt.Fprintf(&b, "%s_sum%s %s\n", name, braced(key), formatFloat(s.value))
+			fmt.Fprintf(&b, "%s_count%s %d\n", name, braced(key), s.count)
+		}
+	}
+	written, err := io.WriteString(w, b.String())
+	return int64(written), err
+}
+
+// formatLabels formats the labels as name="value" pairs sorted by name, with the values escaped
+func formatLabels(labels map[string]string) string {
+	pairs := make([]string, 0, len(labels))
+	for name, value := range labels {
+		value = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+		pairs = append(pairs, name+`="`+value+`"`)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+func joinLabels(labels, label string) string {
+	if labels == "" {
+		return label
+	}
+	return labels + "," + label
+}
+
+func braced(labels string) string {
+	if labels == "" {
+		return ""
+	}
+	return "{" + labels + "}"
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
@@ -0,0 +1,302 @@
+package ldapsync
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// RedisOptions configures a RedisStore
+type RedisOptions struct {
+	Addr     string // host:port
+	Username string // for Redis 6 ACLs, if any
+	Password string
+	DB       int
+	Prefix   string        // prepended to keys, to share a database with other applications
+	TLS      *tls.Config   // connect over TLS if set
+	Timeout  time.Duration // of dialling and of each command, 5 seconds if zero
+	MaxIdle  int           // idle connections kept for reuse, 4 if zero
+}
+
+// RedisStore is a StateStore and Cache kept in Redis, so that the replicas of a horizontally scaled deployment share
+// sync checkpoints and cached results. It speaks the Redis protocol (RESP) directly, without a client library
+type RedisStore struct {
+	options RedisOptions
+	mu      sync.Mutex
+	idle    []*redisConn
+}
+
+func NewRedisStore(options RedisOptions) *RedisStore {
+	if options.Timeout <= 0 {
+		options.Timeout = 5 * time.Second
+	}
+	if options.MaxIdle <= 0 {
+		options.MaxIdle = 4
+	}
+	return &RedisStore{options: options}
+}
+
+func (s *RedisStore) Load(key string) ([]byte, bool, error) {
+	return s.get(key)
+}
+
+func (s *RedisStore) Save(key string, value []byte) error {
+	_, err := s.do(context.Background(), "SET", s.options.Prefix+key, string(value))
+	return err
+}
+
+func (s *RedisStore) Delete(key string) error {
+	_, err := s.do(context.Background(), "DEL", s.options.Prefix+key)
+	return err
+}
+
+func (s *RedisStore) Get(key string) ([]byte, bool, error) {
+	return s.get(key)
+}
+
+func (s *RedisStore) Set(key string, value []byte, ttl time.Duration) error {
+	_, err := s.do(context.Background(), "SET", s.options.Prefix+key, string(value), "PX", milliseconds(ttl))
+	return err
+}
+
+// milliseconds returns the ttl in whole milliseconds, at least one, as PX 0 is an error
+func milliseconds(ttl time.Duration) string {
+	if ms := int64((ttl + time.Millisecond - 1) / time.Millisecond); ms > 1 {
+		return strconv.FormatInt(ms, 10)
+	}
+	return "1"
+}
+
+func (s *RedisStore) get(key string) ([]byte, bool, error) {
+	reply, err := s.do(context.Background(), "GET", s.options.Prefix+key)
+	if err != nil || reply == nil {
+		return nil, false, err
+	}
+	value, ok := reply.([]byte)
+	if !ok {
+		return nil, false, fmt.Errorf("redis: unexpected reply %v to GET", reply)
+	}
+	return value, true, nil
+}
+
+// Close closes the idle connections
+func (s *RedisStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, c := range s.idle {
+		c.Close()
+	}
+	s.idle = nil
+	return nil
+}
+
+// do runs the command on an idle connection, or a new one, returning the connection to the pool unless it failed.
+// The command is abandoned when the context is done
+func (s *RedisStore) do(ctx context.Context, args ...string) (interface{}, error) {
+	c, err := s.conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	stop, stopped := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(stopped)
+		select {
+		case <-ctx.Done():
+			c.SetDeadline(time.Unix(1, 0)) // unblocks the command
+		case <-stop:
+		}
+	}()
+	reply, err := c.command(s.deadline(ctx), args...)
+	close(stop)
+	<-stopped
+	var redisErr redisError
+	if err != nil && !errors.As(err, &redisErr) {
+		c.Close() // the connection is in an unknown state
+		if ctx.Err() != nil {
+			err = ctx.Err()
+		}
+		return nil, err
+	}
+	s.release(c)
+	return reply, err
+}
+
+// deadline returns the deadline of a command: the configured Timeout from now, or that of the context if earlier
+func (s *RedisStore) deadline(ctx context.Context) time.Time {
+	deadline := time.Now().Add(s.options.Timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		return d
+	}
+	return deadline
+}
+
+func (s *RedisStore) conn(ctx context.Context) (*redisConn, error) {
+	s.mu.Lock()
+	if n := len(s.idle); n > 0 {
+		c := s.idle[n-1]
+		s.idle = s.idle[:n-1]
+		s.mu.Unlock()
+		return c, nil
+	}
+	s.mu.Unlock()
+
+	dialer := &net.Dialer{Timeout: s.options.Timeout}
+	var nc net.Conn
+	var err error
+	if s.options.TLS != nil {
+		nc, err = (&tls.Dialer{NetDialer: dialer, Config: s.options.TLS}).DialContext(ctx, "tcp", s.options.Addr)
+	} else {
+		nc, err = dialer.DialContext(ctx, "tcp", s.options.Addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	c := &redisConn{Conn: nc, r: bufio.NewReader(nc)}
+	if s.options.Password != "" {
+		args := []string{"AUTH", s.options.Password}
+		if s.options.Username != "" {
+			args = []string{"AUTH", s.options.Username, s.options.Password}
+		}
+		if _, err = c.command(s.deadline(ctx), args...); err != nil {
+			c.Close()
+			return nil, err
+		}
+	}
+	if s.options.DB != 0 {
+		if _, err = c.command(s.deadline(ctx), "SELECT", strconv.Itoa(s.options.DB)); err != nil {
+			c.Close()
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+func (s *RedisStore) release(c *redisConn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.idle) >= s.options.MaxIdle {
+		c.Close()
+		return
+	}
+	s.idle = append(s.idle, c)
+}
+
+// redisError is an error reply of the server
+type redisError string
+
+func (e redisError) Error() string {
+	return "redis: " + string(e)
+}
+
+type redisConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+// command sends the command and reads its reply before the deadline: a string, an int64, []byte for bulk strings
+// (nil if missing) or []interface{} for arrays
+func (c *redisConn) command(deadline time.Time, args ...string) (interface{}, error) {
+	c.SetDeadline(deadline)
+	buf := []byte("*" + strconv.Itoa(len(args)) + "\r\n")
+	for _, arg := range args {
+		buf = append(buf, "$"+strconv.Itoa(len(arg))+"\r\n"...)
+		buf = append(buf, arg...)
+		buf = append(buf, "\r\n"...)
+	}
+	if _, err := c.Write(buf); err != nil {
+		return nil, err
+	}
+	return c.reply()
+}
+
+func (c *redisConn) reply() (interface{}, error) {
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 {
+		return nil, fmt.Errorf("redis: malformed reply %q", line)
+	}
+	kind, body := line[0], line[1:len(line)-2]
+	switch kind {
+	case '+':
+		return body, nil
+	case '-':
+		return nil, redisError(body)
+	case ':':
+		return strconv.ParseInt(body, 10, 64)
+	case '$':
+		n, err := strconv.Atoi(body)
+		if err != nil || n < 0 {
+			return nil, err // nil bulk string: missing key
+		}
+		data := make([]byte, n+2)
+		if _, err = io.ReadFull(c.r, data); err != nil {
+			return nil, err
+		}
+		return data[:n], nil
+	case '*':
+		n, err := strconv.Atoi(body)
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		// the whole array is read even if an element is an error, leaving the connection at the next reply
+		items := make([]interface{}, n)
+		var itemErr error
+		for i := range items {
+			var redisErr redisError
+			items[i], err = c.reply()
+			if err != nil && !errors.As(err, &redisErr) {
+				return nil, err
+			}
+			if itemErr == nil {
+				itemErr = err
+			}
+		}
+		if itemErr != nil {
+			return nil, itemErr
+		}
+		return items, nil
+	default:
+		return nil, fmt.Errorf("redis: unexpected reply %q", line)
+	}
+}
+
+// scripts checking the holder of a lease before renewing or releasing it, atomically
+const (
+	acquireLeaseScript = `if redis.call('SET', KEYS[1], ARGV[1], 'NX', 'PX', ARGV[2]) then return 1 end
+if redis.call('GET', KEYS[1]) == ARGV[1] then redis.call('PEXPIRE', KEYS[1], ARGV[2]) return 1 end
+return 0`
+	releaseLeaseScript = `if redis.call('GET', KEYS[1]) == ARGV[1] then return redis.call('DEL', KEYS[1]) end
+return 0`
+)
+
+// Lease returns the Lease kept under the key
+func (s *RedisStore) Lease(key string) Lease {
+	return redisLease{store: s, key: s.options.Prefix + key}
+}
+
+type redisLease struct {
+	store *RedisStore
+	key   string
+}
+
+func (l redisLease) Acquire(ctx context.Context, holder string, ttl time.Duration) (bool, error) {
+	reply, err := l.store.do(ctx, "EVAL", acquireLeaseScript, "1", l.key, holder, milliseconds(ttl))
+	if err != nil {
+		return false, err
+	}
+	return reply == int64(1), nil
+}
+
+func (l redisLease) Release(ctx context.Context, holder string) error {
+	_, err := l.store.do(ctx, "EVAL", releaseLeaseScript, "1", l.key, holder)
+	return err
+}
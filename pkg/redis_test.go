@@ -0,0 +1,211 @@
+package ldapsync_test
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	ldapsync "github.com/adedayo/ldap-sync/pkg"
+)
+
+// redisServer is an in-memory Redis server of the commands of a RedisStore, whose EVALs of the lease scripts it
+// tells apart by their number of arguments. GETs of the key "broken" reply with an array holding an error, and
+// commands on the key "hung" get no reply
+type redisServer struct {
+	mu     sync.Mutex
+	values map[string]string
+	px     []string // the PX of the SETs and EVALs, in order
+}
+
+func newRedisServer(t *testing.T) (*redisServer, *ldapsync.RedisStore) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &redisServer{values: map[string]string{}}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go server.serve(conn)
+		}
+	}()
+	store := ldapsync.NewRedisStore(ldapsync.RedisOptions{Addr: listener.Addr().String()})
+	t.Cleanup(func() {
+		store.Close()
+		listener.Close()
+	})
+	return server, store
+}
+
+func (s *redisServer) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	for {
+		args, err := readCommand(r)
+		if err != nil {
+			return
+		}
+		if len(args) > 1 && args[1] == "hung" || len(args) > 3 && args[3] == "hung" {
+			io.Copy(io.Discard, r)
+			return
+		}
+		s.mu.Lock()
+		reply := s.reply(args)
+		s.mu.Unlock()
+		if _, err = io.WriteString(conn, reply); err != nil {
+			return
+		}
+	}
+}
+
+// readCommand reads an array of bulk strings
+func readCommand(r *bufio.Reader) ([]string, error) {
+	var n int
+	if _, err := fmt.Fscanf(r, "*%d\r\n", &n); err != nil {
+		return nil, err
+	}
+	args := make([]string, n)
+	for i := range args {
+		var length int
+		if _, err := fmt.Fscanf(r, "$%d\r\n", &length); err != nil {
+			return nil, err
+		}
+		data := make([]byte, length+2)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return nil, err
+		}
+		args[i] = string(data[:length])
+	}
+	return args, nil
+}
+
+func (s *redisServer) reply(args []string) string {
+	switch {
+	case args[0] == "GET" && args[1] == "broken":
+		return "*2\r\n-ERR broken element\r\n:1\r\n"
+	case args[0] == "GET":
+		value, ok := s.values[args[1]]
+		if !ok {
+			return "$-1\r\n"
+		}
+		return "$" + strconv.Itoa(len(value)) + "\r\n" + value + "\r\n"
+	case args[0] == "SET":
+		if len(args) == 5 {
+			s.px = append(s.px, args[4])
+		}
+		s.values[args[1]] = args[2]
+		return "+OK\r\n"
+	case args[0] == "DEL":
+		delete(s.values, args[1])
+		return ":1\r\n"
+	case args[0] == "EVAL" && len(args) == 6: // acquire
+		s.px = append(s.px, args[5])
+		if holder, ok := s.values[args[3]]; ok && holder != args[4] {
+			return ":0\r\n"
+		}
+		s.values[args[3]] = args[4]
+		return ":1\r\n"
+	case args[0] == "EVAL" && len(args) == 5: // release
+		if s.values[args[3]] != args[4] {
+			return ":0\r\n"
+		}
+		delete(s.values, args[3])
+		return ":1\r\n"
+	}
+	return "-ERR unknown command\r\n"
+}
+
+func TestRedisStore(t *testing.T) {
+	server, store := newRedisServer(t)
+	if err := store.Save("checkpoint", []byte("cookie")); err != nil {
+		t.Fatal(err)
+	}
+	if value, found, err := store.Load("checkpoint"); err != nil || !found || string(value) != "cookie" {
+		t.Errorf("loaded %q, found %v, error %v, want cookie", value, found, err)
+	}
+	if err := store.Delete("checkpoint"); err != nil {
+		t.Fatal(err)
+	}
+	if value, found, err := store.Load("checkpoint"); err != nil || found {
+		t.Errorf("loaded %q, found %v, error %v of a deleted key", value, found, err)
+	}
+
+	if err := store.Set("result", []byte("entries"), 1500*time.Microsecond); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Set("result", []byte("entries"), time.Microsecond); err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(server.px) != "[2 1]" {
+		t.Errorf("set with PX %v, want the TTLs rounded up to whole milliseconds", server.px)
+	}
+}
+
+func TestRedisStoreReadsWholeArraysHoldingErrors(t *testing.T) {
+	_, store := newRedisServer(t)
+	if err := store.Save("checkpoint", []byte("cookie")); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := store.Load("broken"); err == nil {
+		t.Error("loaded an array holding an error")
+	}
+	// on the connection of the array, which was returned to the pool
+	if value, _, err := store.Load("checkpoint"); err != nil || string(value) != "cookie" {
+		t.Errorf("loaded %q, error %v after an array holding an error, want cookie", value, err)
+	}
+}
+
+func TestRedisLease(t *testing.T) {
+	server, store := newRedisServer(t)
+	lease, ctx := store.Lease("leader"), context.Background()
+	for _, acquire := range []struct {
+		holder string
+		held   bool
+	}{{"a", true}, {"a", true}, {"b", false}} {
+		if held, err := lease.Acquire(ctx, acquire.holder, 100*time.Microsecond); err != nil || held != acquire.held {
+			t.Errorf("%s acquired %v with error %v, want %v", acquire.holder, held, err, acquire.held)
+		}
+	}
+	if fmt.Sprint(server.px) != "[1 1 1]" {
+		t.Errorf("acquired with PX %v, want 1", server.px)
+	}
+	if err := lease.Release(ctx, "b"); err != nil {
+		t.Fatal(err)
+	}
+	if err := lease.Release(ctx, "a"); err != nil {
+		t.Fatal(err)
+	}
+	if held, err := lease.Acquire(ctx, "b", time.Second); err != nil || !held {
+		t.Errorf("b acquired %v with error %v of a released lease", held, err)
+	}
+}
+
+func TestRedisLeaseHonoursTheContext(t *testing.T) {
+	_, store := newRedisServer(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	started := time.Now()
+	if _, err := store.Lease("hung").Acquire(ctx, "a", time.Second); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("error %v, want the deadline of the context", err)
+	}
+	if elapsed := time.Since(started); elapsed > time.Second {
+		t.Errorf("acquired in %v, after the deadline of the context", elapsed)
+	}
+
+	ctx, cancel = context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	if err := store.Lease("hung").Release(ctx, "a"); !errors.Is(err, context.Canceled) {
+		t.Errorf("error %v, want the cancellation of the context", err)
+	}
+}
@@ -0,0 +1,201 @@
+package ldapsync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	"github.com/go-ldap/ldap/v3"
+)
+
+// ReferralOptions configures the following of the referrals of searches to other servers, e.g. to the domains of an
+// Active Directory forest or the partitions of a distributed directory
+type ReferralOptions struct {
+	HopLimit int `json:"hopLimit"` // most referrals followed in a chain, 5 if not set
+	// the credentials binding to the referred servers by their host; servers of other hosts are searched
+	// anonymously, and those of referrals without a host as the sync user
+	Credentials []ReferralCredentials `json:"credentials"`
+}
+
+// ReferralCredentials binds to the referred servers of a host
+type ReferralCredentials struct {
+	Host         string `json:"host"` // host name, or host:port, of the referred servers, e.g. dc1.emea.example.com
+	SyncUserName string `json:"syncUserName"`
+	SyncPassword string `json:"syncUserPassword"`
+}
+
+func (ro ReferralOptions) hopLimit() int {
+	if ro.HopLimit <= 0 {
+		return 5
+	}
+	return ro.HopLimit
+}
+
+// credentials returns the credentials for the host and port, if any
+func (ro ReferralOptions) credentials(host, port string) (creds ReferralCredentials, found bool) {
+	for _, c := range ro.Credentials {
+		if strings.EqualFold(c.Host, host) || strings.EqualFold(c.Host, net.JoinHostPort(host, port)) {
+			return c, true
+		}
+	}
+	return
+}
+
+// referredConfig returns the configuration connecting to the server of the referral URL. Referrals over ldaps use
+// TLS, and those over ldap use StartTLS if the configured server uses TLS
+func (ro ReferralOptions) referredConfig(config LDAPSyncConfig, u LDAPURL) LDAPSyncConfig {
+	if u.Host == "" {
+		return config // the configured server
+	}
+	referred := config
+	referred.Servers = nil // the replicas of the configured server
+	host, port, err := net.SplitHostPort(u.Host)
+	if err != nil {
+		host, port = strings.Trim(u.Host, "[]"), "389"
+		if u.Scheme == "ldaps" {
+			port = "636"
+		}
+	}
+	referred.Server, referred.Port = host, &port
+	if !strings.EqualFold(host, config.Server) {
+		referred.TLSOptions.ServerName = ""
+	}
+	switch {
+	case u.Scheme == "ldaps":
+		referred.TLS = "tls"
+	case config.TLS == "tls" || config.TLS == "starttls":
+		referred.TLS = "starttls"
+	default:
+		referred.TLS = "none"
+	}
+	creds, found := ro.credentials(host, port)
+	referred.RequiresAuthentication, referred.SyncUserName, referred.SyncPassword = found, creds.SyncUserName, creds.SyncPassword
+	return referred
+}
+
+// referralRequest returns the search continuing the request at the referral URL: with the DN, scope and filter of the
+// URL where it has them, and those of the request otherwise, as per RFC 4511 section 4.5.3. The URL of a continuation
+// reference (rather than of a referral of the whole search) is of an entry of the single level of a one-level search,
+// which is searched alone
+func referralRequest(u LDAPURL, ref string, continuation bool, request *ldap.SearchRequest,
+	controls []ldap.Control) *ldap.SearchRequest {
+	_, rest := cut(ref[strings.Index(ref, "://")+3:], "/")
+	parts := strings.SplitN(rest, "?", 5)
+	for len(parts) < 5 {
+		parts = append(parts, "")
+	}
+	baseDN, scope, filter := u.DN, request.Scope, request.Filter
+	if baseDN == "" {
+		baseDN = request.BaseDN
+	}
+	if continuation && scope == ldap.ScopeSingleLevel {
+		scope = ldap.ScopeBaseObject
+	}
+	if parts[2] != "" {
+		scope = u.Scope
+	}
+	if parts[3] != "" {
+		filter = u.Filter
+	}
+	return ldap.NewSearchRequest(baseDN, scope, request.DerefAliases, request.SizeLimit, request.TimeLimit, false,
+		filter, append([]string{}, request.Attributes...), controls)
+}
+
+// referralURLs returns the URLs of the referral the error reports, if any
+func referralURLs(err error) (urls []string) {
+	var ldapErr *ldap.Error
+	if !errors.As(err, &ldapErr) || ldapErr.ResultCode != ldap.LDAPResultReferral || ldapErr.Packet == nil ||
+		len(ldapErr.Packet.Children) < 2 {
+		return
+	}
+	for _, child := range ldapErr.Packet.Children[1].Children {
+		if child.ClassType != ber.ClassContext || child.Tag != 3 {
+			continue
+		}
+		for _, ref := range child.Children {
+			if url, ok := ref.Value.(string); ok {
+				urls = append(urls, url)
+			}
+		}
+	}
+	return
+}
+
+// referralChaser follows the referrals of the searches of a sync, each at most once
+type referralChaser struct {
+	ctx     context.Context
+	config  LDAPSyncConfig
+	options ReferralOptions
+	mu      sync.Mutex // guards visited, as the BaseDNs may be searched concurrently
+	visited map[string]bool
+}
+
+func newReferralChaser(ctx context.Context, config LDAPSyncConfig) *referralChaser {
+	return &referralChaser{ctx: ctx, config: config, options: *config.Referrals, visited: make(map[string]bool)}
+}
+
+// chase searches the referred servers of the referrals of the request, or of its continuation references, and those
+// they refer to in turn, passing the entries of each page to the page function with the address of the server they
+// come from. Referrals to the subtrees of the ExcludeDNs are skipped, and those beyond the hop limit fail
+func (rc *referralChaser) chase(refs []string, continuation bool, request *ldap.SearchRequest, hop int,
+	page func(server string, entries []*ldap.Entry) error) error {
+	for _, ref := range refs {
+		rc.mu.Lock()
+		visited := rc.visited[ref]
+		rc.visited[ref] = true
+		rc.mu.Unlock()
+		if visited {
+			continue // a referral loop, or a partition referred to more than once
+		}
+		u, err := ParseLDAPURL(ref)
+		if err != nil {
+			return err
+		}
+		referred := referralRequest(u, ref, continuation, request, rc.config.requestControls())
+		if len(rc.config.ExcludeDNs) > 0 && rc.config.excluded(referred.BaseDN) {
+			continue
+		}
+		if hop > rc.options.hopLimit() {
+			return ldap.NewError(ldap.LDAPResultReferralLimitExceeded,
+				fmt.Errorf("the hop limit of %d referrals is exceeded following %s", rc.options.hopLimit(), ref))
+		}
+		continuations, referrals, err := rc.search(rc.options.referredConfig(rc.config, u), referred, page)
+		if err != nil {
+			return err
+		}
+		if err = rc.chase(continuations, true, referred, hop+1, page); err != nil {
+			return err
+		}
+		if err = rc.chase(referrals, false, referred, hop+1, page); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// search runs the referred search on the server of the configuration, returning the continuation references and
+// referrals it makes in turn
+func (rc *referralChaser) search(config LDAPSyncConfig, request *ldap.SearchRequest,
+	page func(server string, entries []*ldap.Entry) error) (continuations, referrals []string, err error) {
+	l, err := connect(rc.ctx, config)
+	if err != nil {
+		return
+	}
+	defer l.Close()
+	dse, _ := readRootDSE(l)
+	err = l.searchPages(request, rc.config.pageSize(), dse.pagingSupported(), nil, func(sr *ldap.SearchResult, next []byte) error {
+		continuations = append(continuations, sr.Referrals...)
+		return page(l.addr, sr.Entries)
+	})
+	if isResultCode(err, ldap.LDAPResultReferral) {
+		referrals, err = referralURLs(err), nil
+	}
+	if err != nil {
+		err = searchError("referral", l.addr, request.BaseDN, 0, err)
+	}
+	return
+}
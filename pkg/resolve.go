@@ -0,0 +1,184 @@
+package ldapsync
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+// ResolveUserGroups determines the groups of the user directly from the server, without a sync, e.g. for
+// authorization at login. The groups are resolved, in order of preference:
+//   - on Active Directory, from the user's tokenGroups, which include nested groups
+//   - with the configured GroupMembership constraints, by searching the BaseDNs for the groups referring to the user
+//   - from the user's memberOf, or else by searching for groups with the user DN as a member or uniqueMember
+//
+// Groups not matching the GroupFilter, if any, are left out. The groups' Members are not resolved
+func (c *Client) ResolveUserGroups(ctx context.Context, userDN string) (groups []Group, err error) {
+	if c.config.caching() {
+		key := c.config.cacheKey("usergroups", normalizeDN(userDN))
+		if data, found, cacheErr := c.config.Cache.Get(key); cacheErr == nil && found && json.Unmarshal(data, &groups) == nil {
+			return
+		}
+		defer func() {
+			if data, marshalErr := json.Marshal(groups); err == nil && marshalErr == nil {
+				c.config.Cache.Set(key, data, time.Duration(c.config.CacheTTL))
+			}
+		}()
+	}
+
+	l, config, vendor, err := c.open(ctx)
+	if err != nil {
+		return
+	}
+	defer l.Close()
+
+	user, err := readEntry(l, userDN, userGroupAttributes(config, vendor))
+	if err != nil {
+		return
+	}
+	return resolveUserGroups(l, config, user)
+}
+
+// userGroupAttributes returns the user attributes needed to resolve the user's groups
+func userGroupAttributes(config LDAPSyncConfig, vendor Vendor) []string {
+	attributes := []string{"memberOf"}
+	for _, c := range config.GroupMembership.constraints() {
+		if !strings.EqualFold(c.UserAttribute, "dn") {
+			attributes = append(attributes, c.UserAttribute)
+		}
+	}
+	if vendor == ActiveDirectory {
+		attributes = append(attributes, "tokenGroups") // only returned by base searches
+	}
+	return attributes
+}
+
+// resolveUserGroups resolves the groups of the user, read with (at least) its userGroupAttributes
+func resolveUserGroups(l *conn, config LDAPSyncConfig, user *LDAPEntry) (groups []Group, err error) {
+	constraints := config.GroupMembership.constraints()
+	var entries []*LDAPEntry
+	var tokenGroups [][]byte
+	if att := user.attribute("tokenGroups"); att != nil {
+		tokenGroups = att.RawValues()
+	}
+	switch {
+	case len(tokenGroups) > 0:
+		var sids []string
+		for _, sid := range tokenGroups {
+			sids = append(sids, "(objectSid="+escapeFilterBytes(sid)+")")
+		}
+		entries, err = searchBaseDNs(l, config, "(|"+strings.Join(sids, "")+")", config.groupAttributes())
+	case len(constraints) > 0:
+		entries, err = searchBaseDNs(l, config, memberFilter(user, constraints), config.groupAttributes())
+	default:
+		if _, memberOf := user.GetAttribute("memberOf"); len(memberOf) > 0 {
+			for _, dn := range memberOf {
+				group, groupErr := readEntry(l, dn, config.groupAttributes())
+				if groupErr != nil {
+					if isResultCode(groupErr, ldap.LDAPResultNoSuchObject) {
+						continue // e.g. a group outside the directory partition
+					}
+					return nil, groupErr
+				}
+				entries = append(entries, group)
+			}
+		} else {
+			dn := EscapeFilterValue(user.DN)
+			entries, err = searchBaseDNs(l, config, "(|(member="+dn+")(uniqueMember="+dn+"))", config.groupAttributes())
+		}
+	}
+	if err != nil {
+		return
+	}
+
+	for _, g := range matching(dedupeEntries(entries), config.GroupFilter, config.ValuePreparation) {
+		group := Group{ID: entryID(g, config.GroupIDAttribute), DN: g.DN, Sources: g.sources()}
+		config.AttributeMapping.mapGroup(&group, g)
+		groups = append(groups, group)
+	}
+	return
+}
+
+// memberFilter returns the filter of the groups that refer to the user according to the constraints
+func memberFilter(user *LDAPEntry, constraints []Constraint) string {
+	var assertions []string
+	for _, c := range constraints {
+		if strings.EqualFold(c.GroupAttribute, "dn") {
+			continue // the group is identified by a user attribute, e.g. memberOf, rather than referring to the user
+		}
+		values := []string{user.DN}
+		if !strings.EqualFold(c.UserAttribute, "dn") {
+			_, values = user.GetAttribute(c.UserAttribute)
+		}
+		for _, v := range values {
+			assertions = append(assertions, fmt.Sprintf("(%s=%s)", c.GroupAttribute, EscapeFilterValue(v)))
+		}
+	}
+	return "(|" + strings.Join(assertions, "") + ")"
+}
+
+// groupAttributes returns the group attributes needed to filter and identify groups
+func (conf LDAPSyncConfig) groupAttributes() []string {
+	attributes := conf.GroupFilter.attributes()
+	if conf.GroupIDAttribute != "" {
+		attributes = append(attributes, conf.GroupIDAttribute)
+	}
+	if conf.AttributeMapping != nil {
+		for _, name := range conf.AttributeMapping.groupAttributes() {
+			if name != "" {
+				attributes = append(attributes, name)
+			}
+		}
+	}
+	if len(attributes) == 0 {
+		return []string{"1.1"} // no attributes
+	}
+	return attributes
+}
+
+// readEntry reads the attributes of the entry with the DN
+func readEntry(l *conn, dn string, attributes []string) (*LDAPEntry, error) {
+	sr, err := l.Search(ldap.NewSearchRequest(dn, ldap.ScopeBaseObject, ldap.NeverDerefAliases, 0, 0, false,
+		"(objectClass=*)", attributes, nil))
+	if err != nil {
+		return nil, searchError("read", l.addr, dn, 0, err)
+	}
+	if len(sr.Entries) == 0 {
+		return nil, searchError("read", l.addr, dn, 0, ldap.NewError(ldap.LDAPResultNoSuchObject, fmt.Errorf("no entry %s", dn)))
+	}
+	return toEntries(sr.Entries[:1], map[string]bool{}, Provenance{Server: l.addr})[0], nil
+}
+
+// searchBaseDNs searches the configured BaseDNs with the filter for the attributes, unless it is an empty disjunction
+func searchBaseDNs(l *conn, config LDAPSyncConfig, filter string, attributes []string) (entries []*LDAPEntry, err error) {
+	if filter == "(|)" {
+		return
+	}
+	seen := make(map[string]bool)
+	for _, baseDN := range config.BaseDNs {
+		base := baseDNOf(baseDN)
+		searchRequest := ldap.NewSearchRequest(base, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 0, 0, false,
+			filter, attributes, config.requestControls())
+		err = l.searchPages(searchRequest, defaultSearchPageSize, true, nil, func(sr *ldap.SearchResult, next []byte) error {
+			entries = append(entries, toEntries(sr.Entries, seen, Provenance{Server: l.addr, BaseDN: base})...)
+			return nil
+		})
+		if err != nil {
+			return nil, searchError("search", l.addr, base, 0, err)
+		}
+	}
+	return
+}
+
+// escapeFilterBytes escapes every byte of a binary value, e.g. a SID, for use in a filter
+func escapeFilterBytes(value []byte) string {
+	var b strings.Builder
+	for _, v := range value {
+		fmt.Fprintf(&b, "\\%02x", v)
+	}
+	return b.String()
+}
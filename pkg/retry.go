@@ -0,0 +1,80 @@
+package ldapsync
+
+import (
+	"context"
+	"errors"
+	"net"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+// RetryPolicy retries syncs and authentications that fail transiently, e.g. as the server is busy or the network
+// drops, waiting exponentially longer between the attempts
+type RetryPolicy struct {
+	MaxAttempts    int      `json:"maxAttempts"`    // attempts in all, including the first, 3 if not set
+	InitialBackoff Duration `json:"initialBackoff"` // wait before the first retry, doubling for each retry after, 1s if not set
+	MaxBackoff     Duration `json:"maxBackoff"`     // longest wait between attempts, 30s if not set
+	// LDAP result codes retried besides network failures; if not set, busy (51), unavailable (52), server down (81),
+	// timeout (85) and connect error (91)
+	ResultCodes []uint16 `json:"resultCodes"`
+}
+
+func (p *RetryPolicy) maxAttempts() int {
+	if p.MaxAttempts <= 0 {
+		return 3
+	}
+	return p.MaxAttempts
+}
+
+// backoff returns the wait before the retry following the attempt
+func (p *RetryPolicy) backoff(attempt int) time.Duration {
+	wait, limit := time.Duration(p.InitialBackoff), time.Duration(p.MaxBackoff)
+	if wait <= 0 {
+		wait = time.Second
+	}
+	if limit <= 0 {
+		limit = 30 * time.Second
+	}
+	for i := 1; i < attempt && wait < limit; i++ {
+		wait *= 2
+	}
+	if wait > limit {
+		wait = limit
+	}
+	return wait
+}
+
+// retryable determines whether the error is transient by the policy
+func (p *RetryPolicy) retryable(err error) bool {
+	if p == nil || err == nil {
+		return false
+	}
+	if len(p.ResultCodes) == 0 {
+		return isServerFailure(err)
+	}
+	var ldapErr *ldap.Error
+	if errors.As(err, &ldapErr) {
+		return isResultCode(err, append([]uint16{ldap.ErrorNetwork}, p.ResultCodes...)...)
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// do runs the attempt until it succeeds or fails other than transiently, the attempts run out, or the context is
+// done, recording and logging the retries as reconnects to the server. A nil policy runs the attempt once
+func (p *RetryPolicy) do(ctx context.Context, m Metrics, log Logger, server string, attempt func() error) (err error) {
+	for n := 1; ; n++ {
+		err = attempt()
+		if p == nil || n >= p.maxAttempts() || !p.retryable(err) || ctx.Err() != nil {
+			return
+		}
+		loggerOr(log).Warn("retrying", "server", server, "attempt", n+1, "backoff", p.backoff(n), "error", err)
+		select {
+		case <-time.After(p.backoff(n)):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		recordReconnect(m, server, "retry")
+	}
+}
@@ -0,0 +1,106 @@
+package ldapsync
+
+import (
+	"strings"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+// DNRewrite rewrites the suffix From of DNs to To, e.g. from dc=old,dc=corp to dc=new,dc=corp, or from
+// o=proxy,dc=corp to dc=corp. An empty To strips the suffix
+type DNRewrite struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// dnRewriter applies the first of its rules under whose From a DN is
+type dnRewriter struct {
+	rules  []DNRewrite
+	froms  []*ldap.DN
+	schema *Schema // identifies the DN-valued attributes
+}
+
+func newDNRewriter(rules []DNRewrite, schema *Schema) *dnRewriter {
+	r := &dnRewriter{schema: schema}
+	for _, rule := range rules {
+		from, err := ldap.ParseDN(rule.From)
+		if err != nil || len(from.RDNs) == 0 {
+			continue // validated by Validate
+		}
+		r.rules = append(r.rules, rule)
+		r.froms = append(r.froms, from)
+	}
+	return r
+}
+
+// rewrite returns the rewritten DN, unchanged if no rule applies
+func (r *dnRewriter) rewrite(dn string) string {
+	d, err := ldap.ParseDN(dn)
+	if err != nil {
+		return dn
+	}
+	for i, from := range r.froms {
+		if !from.EqualFold(d) && !from.AncestorOfFold(d) {
+			continue
+		}
+		kept := len(d.RDNs) - len(from.RDNs)
+		rdns := splitRDNs(dn)
+		if len(rdns) != len(d.RDNs) {
+			// an unusual DN, e.g. with a multi-valued RDN, use the parsed (normalised) RDNs
+			rdns = make([]string, len(d.RDNs))
+			for j, rdn := range d.RDNs {
+				rdns[j] = rdn.String()
+			}
+		}
+		parts := rdns[:kept:kept]
+		if r.rules[i].To != "" {
+			parts = append(parts, r.rules[i].To)
+		}
+		return strings.Join(parts, ",")
+	}
+	return dn
+}
+
+// rewriteEntries rewrites the DNs of the entries and the values of their DN-valued attributes, e.g. member
+func (r *dnRewriter) rewriteEntries(ents []*LDAPEntry) {
+	if len(r.rules) == 0 {
+		return
+	}
+	for _, ent := range ents {
+		ent.DN = r.rewrite(ent.DN)
+		for i := range ent.Attributes {
+			att := &ent.Attributes[i]
+			if r.schema.MatchingRule(att.Name) != DistinguishedNameMatch {
+				continue
+			}
+			for j, v := range att.ByteValues {
+				att.ByteValues[j] = []byte(r.rewrite(string(v)))
+			}
+			for j, v := range att.Values {
+				att.Values[j] = r.rewrite(v)
+			}
+		}
+	}
+}
+
+// splitRDNs splits the DN at the commas separating its RDNs, leaving them as they are written
+func splitRDNs(dn string) (rdns []string) {
+	start, quoted := 0, false
+	for i := 0; i < len(dn); i++ {
+		switch dn[i] {
+		case '\\':
+			i++ // an escaped character
+		case '"':
+			quoted = !quoted
+		case ',':
+			if !quoted {
+				rdns = append(rdns, strings.TrimSpace(dn[start:i]))
+				start = i + 1
+			}
+		}
+	}
+	if strings.TrimSpace(dn) != "" {
+		rdns = append(rdns, strings.TrimSpace(dn[start:]))
+	}
+	return
+}
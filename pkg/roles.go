@@ -0,0 +1,89 @@
+package ldapsync
+
+import (
+	"path"
+	"sort"
+	"strings"
+)
+
+// RoleRule maps the groups it matches to an application role. A rule matches a group if any of its
+// criteria match; the criteria are compared case-insensitively
+type RoleRule struct {
+	Role     string `json:"role"`
+	Group    string `json:"group"`    // exact group ID (e.g. cn) or DN
+	DNPrefix string `json:"dnPrefix"` // prefix of the group DN, e.g. cn=app-
+	Pattern  string `json:"pattern"`  // wildcard pattern on the group ID, e.g. app-*-admins (see path.Match)
+	OrgUnit  string `json:"orgUnit"`  // DN of an organizational unit the group is in, e.g. ou=app-roles,dc=example,dc=com
+	Priority int    `json:"priority"` // roles of higher priority rules are listed first
+}
+
+func (r RoleRule) matches(g Group) bool {
+	id, dn := strings.ToLower(g.ID), strings.ToLower(g.DN)
+	if r.Group != "" && (strings.ToLower(r.Group) == id || normalizeDN(r.Group) == normalizeDN(g.DN)) {
+		return true
+	}
+	if r.DNPrefix != "" && strings.HasPrefix(dn, strings.ToLower(r.DNPrefix)) {
+		return true
+	}
+	if r.OrgUnit != "" && DNIsUnder(g.DN, r.OrgUnit) {
+		return true
+	}
+	if r.Pattern != "" {
+		if matched, err := path.Match(strings.ToLower(r.Pattern), id); err == nil && matched {
+			return true
+		}
+	}
+	return false
+}
+
+// RoleMapping converts LDAP group memberships into application roles
+type RoleMapping struct {
+	Rules       []RoleRule `json:"rules"`
+	HighestOnly bool       `json:"highestOnly"` // only grant the roles of the highest priority rules a user matches
+	DefaultRole string     `json:"defaultRole"` // role of users that match no rule, if set
+}
+
+// Map returns the roles of each user, keyed by user ID, ordered by rule priority
+func (m RoleMapping) Map(ug UsersAndGroups) map[string][]string {
+	rules := append([]RoleRule{}, m.Rules...)
+	sort.SliceStable(rules, func(i, j int) bool {
+		return rules[i].Priority > rules[j].Priority
+	})
+
+	groupsOf := make(map[string][]Group) // groups by normalised member DN
+	for _, g := range ug.Groups {
+		for _, member := range g.Members {
+			key := normalizeDN(member)
+			groupsOf[key] = append(groupsOf[key], g)
+		}
+	}
+
+	roles := make(map[string][]string, len(ug.Users))
+	for _, u := range ug.Users {
+		var userRoles []string
+		seen := make(map[string]bool)
+		matchedPriority, matched := 0, false
+		for _, rule := range rules {
+			if matched && m.HighestOnly && rule.Priority < matchedPriority {
+				break
+			}
+			for _, g := range groupsOf[normalizeDN(u.DN)] {
+				if rule.matches(g) {
+					if !seen[rule.Role] {
+						seen[rule.Role] = true
+						userRoles = append(userRoles, rule.Role)
+					}
+					matchedPriority, matched = rule.Priority, true
+					break
+				}
+			}
+		}
+		if len(userRoles) == 0 && m.DefaultRole != "" {
+			userRoles = []string{m.DefaultRole}
+		}
+		if len(userRoles) > 0 {
+			roles[u.ID] = append(roles[u.ID], userRoles...)
+		}
+	}
+	return roles
+}
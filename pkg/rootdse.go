@@ -0,0 +1,170 @@
+package ldapsync
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+// AutoBaseDN may be used as a BaseDN to have the BaseDNs discovered from the server's RootDSE
+const AutoBaseDN = "auto"
+
+// operational attributes of the RootDSE, which some servers only return when explicitly requested
+var rootDSEAttributes = []string{
+	"*", "+",
+	"namingContexts", "defaultNamingContext", "rootDomainNamingContext",
+	"subschemaSubentry", "supportedControl", "supportedExtension",
+	"supportedCapabilities", "supportedSASLMechanisms", "supportedLDAPVersion",
+	"vendorName", "vendorVersion",
+}
+
+// OIDs of the request controls whose support is checked before use
+const (
+	ControlPaging         = "1.2.840.113556.1.4.319"    // RFC 2696 simple paged results
+	ControlServerSideSort = "1.2.840.113556.1.4.473"    // RFC 2891 server side sorting
+	ControlVLV            = "2.16.840.1.113730.3.4.9"   // virtual list view
+	ControlDirSync        = "1.2.840.113556.1.4.841"    // Active Directory DirSync
+	ControlSyncRequest    = "1.3.6.1.4.1.4203.1.9.1.1"  // RFC 4533 content synchronization
+	ControlPasswordPolicy = "1.3.6.1.4.1.42.2.27.8.5.1" // password policy (Behera draft)
+)
+
+var controlNames = map[string]string{
+	ControlPaging:         "paged results",
+	ControlServerSideSort: "server side sorting",
+	ControlVLV:            "virtual list view",
+	ControlDirSync:        "DirSync",
+	ControlSyncRequest:    "content synchronization (SyncRepl)",
+	ControlPasswordPolicy: "password policy",
+}
+
+// UnsupportedControlError is returned when an operation needs a control the server does not support
+type UnsupportedControlError struct {
+	OID string
+}
+
+func (e UnsupportedControlError) Error() string {
+	if name, exists := controlNames[e.OID]; exists {
+		return fmt.Sprintf("the directory server does not support the %s control (%s)", name, e.OID)
+	}
+	return fmt.Sprintf("the directory server does not support the control %s", e.OID)
+}
+
+// RootDSE is the information a directory server publishes about itself at the root of its tree
+type RootDSE struct {
+	NamingContexts          []string
+	DefaultNamingContext    string //Active Directory only
+	SubschemaSubentry       string
+	SupportedControls       []string
+	SupportedExtensions     []string
+	SupportedCapabilities   []string
+	SupportedSASLMechanisms []string
+	VendorName              string
+	VendorVersion           string
+	Entry                   LDAPEntry // the complete RootDSE entry
+}
+
+// BaseDNs returns the suffixes to sync: the default naming context if the server advertises one,
+// otherwise all its naming contexts
+func (dse RootDSE) BaseDNs() []string {
+	if dse.DefaultNamingContext != "" {
+		return []string{dse.DefaultNamingContext}
+	}
+	return dse.NamingContexts
+}
+
+// SupportsControl determines whether the server advertises support for the control in its supportedControl attribute
+func (dse RootDSE) SupportsControl(oid string) bool {
+	for _, c := range dse.SupportedControls {
+		if c == oid {
+			return true
+		}
+	}
+	return false
+}
+
+// RequireControl returns an UnsupportedControlError if the server does not advertise support for the control
+func (dse RootDSE) RequireControl(oid string) error {
+	if !dse.SupportsControl(oid) {
+		return UnsupportedControlError{OID: oid}
+	}
+	return nil
+}
+
+// pagingSupported determines whether searches may be paged. Servers that do not publish their
+// supported controls (e.g. due to access controls on the RootDSE) are assumed to support paging
+func (dse RootDSE) pagingSupported() bool {
+	return len(dse.SupportedControls) == 0 || dse.SupportsControl(ControlPaging)
+}
+
+// ReadRootDSE connects to the configured server and reads its RootDSE
+func ReadRootDSE(config LDAPSyncConfig) (dse RootDSE, err error) {
+	l, err := connect(context.Background(), config.Sanitize())
+	if err != nil {
+		return
+	}
+	defer l.Close()
+	return readRootDSE(l)
+}
+
+// DiscoverBaseDNs determines the BaseDNs of the configured server from its RootDSE
+// (namingContexts/defaultNamingContext), so the directory suffix need not be known upfront
+func DiscoverBaseDNs(config LDAPSyncConfig) ([]string, error) {
+	dse, err := ReadRootDSE(config)
+	if err != nil {
+		return nil, err
+	}
+	return dse.BaseDNs(), nil
+}
+
+func readRootDSE(l *conn) (dse RootDSE, err error) {
+	searchRequest := ldap.NewSearchRequest(
+		"", // the RootDSE has an empty DN
+		ldap.ScopeBaseObject, ldap.NeverDerefAliases, 0, 0, false,
+		"(objectClass=*)",
+		rootDSEAttributes,
+		[]ldap.Control{},
+	)
+
+	sr, err := l.Search(searchRequest)
+	if err != nil {
+		err = opError("read RootDSE", l.addr, err)
+		return
+	}
+	if len(sr.Entries) == 0 {
+		return
+	}
+
+	entry := sr.Entries[0]
+	dse = RootDSE{
+		NamingContexts:          entry.GetEqualFoldAttributeValues("namingContexts"),
+		DefaultNamingContext:    entry.GetEqualFoldAttributeValue("defaultNamingContext"),
+		SubschemaSubentry:       entry.GetEqualFoldAttributeValue("subschemaSubentry"),
+		SupportedControls:       entry.GetEqualFoldAttributeValues("supportedControl"),
+		SupportedExtensions:     entry.GetEqualFoldAttributeValues("supportedExtension"),
+		SupportedCapabilities:   entry.GetEqualFoldAttributeValues("supportedCapabilities"),
+		SupportedSASLMechanisms: entry.GetEqualFoldAttributeValues("supportedSASLMechanisms"),
+		VendorName:              entry.GetEqualFoldAttributeValue("vendorName"),
+		VendorVersion:           entry.GetEqualFoldAttributeValue("vendorVersion"),
+		Entry:                   LDAPEntry{DN: entry.DN},
+	}
+	for _, att := range entry.Attributes {
+		dse.Entry.Attributes = append(dse.Entry.Attributes, LDAPAttribute{
+			Name:   att.Name,
+			Values: att.Values,
+		})
+	}
+	dse.Entry.indexAttributes()
+	return
+}
+
+// autoBaseDNs determines whether the BaseDNs are to be discovered from the RootDSE
+func (conf LDAPSyncConfig) autoBaseDNs() bool {
+	for _, base := range conf.BaseDNs {
+		if strings.EqualFold(base, AutoBaseDN) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,101 @@
+package ldapsync
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+// SASL mechanisms of SASLOptions
+const (
+	SASLDigestMD5 = "DIGEST-MD5"
+	SASLExternal  = "EXTERNAL" // of the identity of the TLS client certificate
+	SASLGSSAPI    = "GSSAPI"   // Kerberos
+)
+
+// SASLOptions binds with a SASL mechanism rather than a simple bind, as directories that disable simple binds (e.g.
+// Active Directory and FreeIPA) mandate. Users bind by their user name, e.g. jdoe or jdoe@EXAMPLE.COM, rather than
+// their DN
+type SASLOptions struct {
+	Mechanism        string `json:"mechanism"`        // DIGEST-MD5, EXTERNAL or GSSAPI
+	Host             string `json:"host"`             // host of the DIGEST-MD5 digest-uri, the server if not set
+	ServicePrincipal string `json:"servicePrincipal"` // of the GSSAPI service ticket, ldap/<server> if not set
+	AuthzID          string `json:"authzID"`          // identity a GSSAPI bind acts as, the authenticated one if not set
+	// returns the Kerberos client of a GSSAPI bind as the user with the password: e.g. with gssapi.NewClientWithPassword,
+	// or with a keytab or credentials cache regardless of the password, of github.com/go-ldap/ldap/v3/gssapi
+	GSSAPIClient func(username, password string) (ldap.GSSAPIClient, error) `json:"-"`
+}
+
+func (so SASLOptions) mechanism() string {
+	return strings.ToUpper(so.Mechanism)
+}
+
+// authenticatesUsers reports whether the mechanism checks the password of a user. EXTERNAL binds as the identity of the
+// TLS client certificate, and a GSSAPI client may bind with a keytab or credentials cache regardless of the password,
+// so they only bind the sync user
+func (so SASLOptions) authenticatesUsers() bool {
+	return so.mechanism() == SASLDigestMD5
+}
+
+// saslBind binds as the username with the password by the SASL mechanism, on the connection to the server
+func (c *conn) saslBind(options SASLOptions, server, username, password string, controls []ldap.Control) (err error) {
+	err = c.do(Operation{Name: "bind", Server: c.addr, BindDN: username}, func() error {
+		switch options.mechanism() {
+		case SASLDigestMD5:
+			host := options.Host
+			if host == "" {
+				host = server
+			}
+			_, err := c.Conn.DigestMD5Bind(&ldap.DigestMD5BindRequest{Host: host, Username: username, Password: password,
+				Controls: controls})
+			return err
+		case SASLExternal:
+			return c.Conn.ExternalBind()
+		case SASLGSSAPI:
+			if options.GSSAPIClient == nil {
+				return errors.New("the GSSAPI mechanism needs a GSSAPIClient")
+			}
+			client, err := options.GSSAPIClient(username, password)
+			if err != nil {
+				return err
+			}
+			spn := options.ServicePrincipal
+			if spn == "" {
+				spn = "ldap/" + server
+			}
+			return c.Conn.GSSAPIBindRequest(client, &ldap.GSSAPIBindRequest{ServicePrincipalName: spn,
+				AuthZID: options.AuthzID, Controls: controls})
+		default:
+			return fmt.Errorf("unsupported SASL mechanism %q", options.Mechanism)
+		}
+	})
+	c.boundAs = boundAs(username, err)
+	return
+}
+
+// bindSyncUser binds as the sync user: by the SASL mechanism or NTLM if set, and with a simple bind otherwise
+func (c *conn) bindSyncUser(config LDAPSyncConfig) (err error) {
+	switch {
+	case config.SASL != nil:
+		return c.saslBind(*config.SASL, config.Server, config.SyncUserName, config.SyncPassword, config.requestControls())
+	case config.NTLM != nil:
+		return c.ntlmBind(*config.NTLM, config.SyncUserName, config.SyncPassword, config.requestControls())
+	}
+	_, err = c.bind(config.SyncUserName, config.SyncPassword, config.requestControls())
+	return
+}
+
+// boundDN returns the DN the connection is bound as, by the "Who am I?" operation of RFC 4532, or empty if the
+// server does not tell it, e.g. for an identity that is not a DN
+func (c *conn) boundDN() (dn string) {
+	_ = c.do(Operation{Name: "extended", Server: c.addr}, func() error {
+		result, err := c.Conn.WhoAmI(nil)
+		if err == nil && strings.HasPrefix(result.AuthzID, "dn:") {
+			dn = strings.TrimPrefix(result.AuthzID, "dn:")
+		}
+		return err
+	})
+	return
+}
@@ -0,0 +1,354 @@
+package ldapsync
+
+import (
+	"context"
+	"math/big"
+	"sort"
+	"strings"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+// MatchingRule is the comparison semantics used for the values of an attribute
+type MatchingRule int
+
+const (
+	ExactMatch             MatchingRule = iota // byte-exact comparison, e.g. caseExactMatch, octetStringMatch
+	CaseIgnoreMatch                            // case insensitive comparison, e.g. caseIgnoreMatch, caseIgnoreIA5Match
+	DistinguishedNameMatch                     // DN comparison, e.g. distinguishedNameMatch for member
+	IntegerMatch                               // numeric comparison, e.g. integerMatch for uidNumber
+	NumericStringMatch                         // comparison ignoring spaces, e.g. numericStringMatch
+)
+
+// equality matching rules by name and OID
+var equalityRules = map[string]MatchingRule{
+	"caseexactmatch":             ExactMatch,
+	"2.5.13.5":                   ExactMatch,
+	"caseexactia5match":          ExactMatch,
+	"1.3.6.1.4.1.1466.109.114.1": ExactMatch,
+	"octetstringmatch":           ExactMatch,
+	"2.5.13.17":                  ExactMatch,
+	"generalizedtimematch":       ExactMatch,
+	"2.5.13.27":                  ExactMatch,
+	"caseignorematch":            CaseIgnoreMatch,
+	"2.5.13.2":                   CaseIgnoreMatch,
+	"caseignoreia5match":         CaseIgnoreMatch,
+	"1.3.6.1.4.1.1466.109.114.2": CaseIgnoreMatch,
+	"caseignorelistmatch":        CaseIgnoreMatch,
+	"2.5.13.11":                  CaseIgnoreMatch,
+	"objectidentifiermatch":      CaseIgnoreMatch,
+	"2.5.13.0":                   CaseIgnoreMatch,
+	"booleanmatch":               CaseIgnoreMatch,
+	"2.5.13.13":                  CaseIgnoreMatch,
+	"distinguishednamematch":     DistinguishedNameMatch,
+	"2.5.13.1":                   DistinguishedNameMatch,
+	"uniquemembermatch":          DistinguishedNameMatch,
+	"2.5.13.23":                  DistinguishedNameMatch,
+	"integermatch":               IntegerMatch,
+	"2.5.13.14":                  IntegerMatch,
+	"numericstringmatch":         NumericStringMatch,
+	"2.5.13.8":                   NumericStringMatch,
+}
+
+// attribute syntaxes by OID, used when an attribute type has no (inherited) equality matching rule, as is the case for Active Directory
+var syntaxRules = map[string]MatchingRule{
+	"1.3.6.1.4.1.1466.115.121.1.12": DistinguishedNameMatch, // DN
+	"1.3.6.1.4.1.1466.115.121.1.27": IntegerMatch,           // INTEGER
+	"1.3.6.1.4.1.1466.115.121.1.36": NumericStringMatch,     // Numeric String
+	"1.3.6.1.4.1.1466.115.121.1.15": CaseIgnoreMatch,        // Directory String
+	"1.3.6.1.4.1.1466.115.121.1.26": CaseIgnoreMatch,        // IA5 String
+	"1.3.6.1.4.1.1466.115.121.1.44": CaseIgnoreMatch,        // Printable String
+	"1.3.6.1.4.1.1466.115.121.1.7":  CaseIgnoreMatch,        // Boolean
+	"1.3.6.1.4.1.1466.115.121.1.38": CaseIgnoreMatch,        // OID
+}
+
+// AttributeType is an attribute type definition (RFC 4512 section 4.1.2) from the directory schema
+type AttributeType struct {
+	OID         string
+	Names       []string
+	Sup         string // the supertype, if any
+	Equality    string // the equality matching rule, possibly inherited from the supertype
+	Syntax      string // the syntax OID, possibly inherited from the supertype
+	SingleValue bool
+}
+
+// Schema is the set of attribute types read from the server's subschema subentry
+type Schema struct {
+	AttributeTypes map[string]*AttributeType // keyed by lower-cased OID and names
+}
+
+// the matching rules of well-known attributes (RFC 4519, RFC 2307 and Active Directory), used for attributes
+// that are not described by a discovered schema
+var knownMatchingRules = map[string]MatchingRule{
+	"dn":                 DistinguishedNameMatch,
+	"distinguishedname":  DistinguishedNameMatch,
+	"member":             DistinguishedNameMatch,
+	"uniquemember":       DistinguishedNameMatch,
+	"memberof":           DistinguishedNameMatch,
+	"manager":            DistinguishedNameMatch,
+	"owner":              DistinguishedNameMatch,
+	"seealso":            DistinguishedNameMatch,
+	"roleoccupant":       DistinguishedNameMatch,
+	"objectcategory":     DistinguishedNameMatch,
+	"cn":                 CaseIgnoreMatch,
+	"commonname":         CaseIgnoreMatch,
+	"sn":                 CaseIgnoreMatch,
+	"surname":            CaseIgnoreMatch,
+	"givenname":          CaseIgnoreMatch,
+	"displayname":        CaseIgnoreMatch,
+	"uid":                CaseIgnoreMatch,
+	"userid":             CaseIgnoreMatch,
+	"mail":               CaseIgnoreMatch,
+	"o":                  CaseIgnoreMatch,
+	"ou":                 CaseIgnoreMatch,
+	"dc":                 CaseIgnoreMatch,
+	"objectclass":        CaseIgnoreMatch,
+	"samaccountname":     CaseIgnoreMatch,
+	"userprincipalname":  CaseIgnoreMatch,
+	"name":               CaseIgnoreMatch,
+	"uidnumber":          IntegerMatch,
+	"gidnumber":          IntegerMatch,
+	"primarygroupid":     IntegerMatch,
+	"useraccountcontrol": IntegerMatch,
+	"grouptype":          IntegerMatch,
+}
+
+// MatchingRule returns the equality semantics of the attribute as described by the schema, falling back to the
+// rules of well-known attributes (so a nil Schema may be used) and then to byte-exact comparison
+func (s *Schema) MatchingRule(attribute string) MatchingRule {
+	rule, _ := s.lookupRule(attribute)
+	return rule
+}
+
+// lookupRule returns the matching rule of the attribute and whether the attribute is known
+func (s *Schema) lookupRule(attribute string) (MatchingRule, bool) {
+	name, _ := attributeDescription(attribute) // subtypes, e.g. cn;lang-es, have the rules of their type
+	if s != nil {
+		if at, exists := s.AttributeTypes[name]; exists {
+			if rule, exists := equalityRules[strings.ToLower(at.Equality)]; exists {
+				return rule, true
+			}
+			if rule, exists := syntaxRules[at.Syntax]; exists {
+				return rule, true
+			}
+		}
+	}
+	rule, exists := knownMatchingRules[name]
+	return rule, exists
+}
+
+// comparisonRule is the matching rule for comparing a group attribute with a user attribute: that of the group
+// attribute (the attribute asserted against) if known, otherwise that of the user attribute
+func (s *Schema) comparisonRule(groupAttribute, userAttribute string) MatchingRule {
+	if rule, known := s.lookupRule(groupAttribute); known {
+		return rule
+	}
+	return s.MatchingRule(userAttribute)
+}
+
+// Equal compares two values of the attribute according to its matching rule
+func (s *Schema) Equal(attribute, a, b string) bool {
+	rule := s.MatchingRule(attribute)
+	return normalizeValue(rule, a) == normalizeValue(rule, b)
+}
+
+func normalizeValue(rule MatchingRule, value string) string {
+	switch rule {
+	case CaseIgnoreMatch:
+		return strings.ToLower(strings.Join(strings.Fields(value), " "))
+	case DistinguishedNameMatch:
+		return normalizeDN(value)
+	case IntegerMatch:
+		if i, ok := new(big.Int).SetString(strings.TrimSpace(value), 10); ok {
+			return i.String()
+		}
+		return value
+	case NumericStringMatch:
+		return strings.ReplaceAll(value, " ", "")
+	default:
+		return value
+	}
+}
+
+// escapes the characters that would make a canonical DN ambiguous
+var dnValueEscaper = strings.NewReplacer(`\`, `\\`, `,`, `\,`, `+`, `\+`, `=`, `\=`)
+
+// normalizeDN returns a canonical, case-folded form of the DN. Unparsable DNs are simply lower-cased
+func normalizeDN(dn string) string {
+	d, err := ldap.ParseDN(dn)
+	if err != nil {
+		return strings.ToLower(dn)
+	}
+	rdns := make([]string, len(d.RDNs))
+	for i, rdn := range d.RDNs {
+		atvs := make([]string, len(rdn.Attributes))
+		for j, atv := range rdn.Attributes {
+			atvs[j] = strings.ToLower(atv.Type) + "=" + dnValueEscaper.Replace(strings.ToLower(atv.Value))
+		}
+		sort.Strings(atvs) // multi-valued RDNs are unordered
+		rdns[i] = strings.Join(atvs, "+")
+	}
+	return strings.Join(rdns, ",")
+}
+
+// ReadSchema connects to the configured server and reads the attribute types of its subschema subentry
+func ReadSchema(config LDAPSyncConfig) (*Schema, error) {
+	l, err := connect(context.Background(), config.Sanitize())
+	if err != nil {
+		return nil, err
+	}
+	defer l.Close()
+
+	dse, err := readRootDSE(l)
+	if err != nil {
+		return nil, err
+	}
+	return readSchema(l, dse)
+}
+
+func readSchema(l *conn, dse RootDSE) (*Schema, error) {
+	subschema := dse.SubschemaSubentry
+	if subschema == "" {
+		subschema = "cn=Subschema" // common default
+	}
+	searchRequest := ldap.NewSearchRequest(
+		subschema,
+		ldap.ScopeBaseObject, ldap.NeverDerefAliases, 0, 0, false,
+		"(objectClass=*)",
+		[]string{"attributeTypes"},
+		[]ldap.Control{},
+	)
+
+	sr, err := l.Search(searchRequest)
+	if err != nil {
+		return nil, opError("read schema", l.addr, err)
+	}
+
+	var definitions []string
+	for _, entry := range sr.Entries {
+		definitions = append(definitions, entry.GetEqualFoldAttributeValues("attributeTypes")...)
+	}
+	return ParseSchema(definitions), nil
+}
+
+// ParseSchema builds a Schema from RFC 4512 attribute type descriptions, e.g.
+// ( 2.5.4.3 NAME ( 'cn' 'commonName' ) SUP name )
+// Descriptions that cannot be parsed are skipped
+func ParseSchema(attributeTypes []string) *Schema {
+	s := &Schema{AttributeTypes: make(map[string]*AttributeType)}
+	var types []*AttributeType
+	for _, def := range attributeTypes {
+		if at, ok := parseAttributeType(def); ok {
+			types = append(types, at)
+			s.AttributeTypes[strings.ToLower(at.OID)] = at
+			for _, name := range at.Names {
+				s.AttributeTypes[strings.ToLower(name)] = at
+			}
+		}
+	}
+
+	//resolve equality and syntax inherited from supertypes
+	for _, at := range types {
+		sup := at.Sup
+		for depth := 0; sup != "" && depth < 16 && (at.Equality == "" || at.Syntax == ""); depth++ {
+			parent, exists := s.AttributeTypes[strings.ToLower(sup)]
+			if !exists {
+				break
+			}
+			if at.Equality == "" {
+				at.Equality = parent.Equality
+			}
+			if at.Syntax == "" {
+				at.Syntax = parent.Syntax
+			}
+			sup = parent.Sup
+		}
+	}
+	return s
+}
+
+func parseAttributeType(def string) (*AttributeType, bool) {
+	tokens := tokenizeSchema(def)
+	if len(tokens) < 3 || tokens[0] != "(" || tokens[len(tokens)-1] != ")" {
+		return nil, false
+	}
+	tokens = tokens[1 : len(tokens)-1]
+	at := &AttributeType{OID: tokens[0]}
+
+	// values returns the (possibly parenthesised) list of values that follow the keyword at index i
+	values := func(i int) ([]string, int) {
+		if i+1 >= len(tokens) {
+			return nil, i
+		}
+		if tokens[i+1] != "(" {
+			return []string{tokens[i+1]}, i + 1
+		}
+		var vs []string
+		j := i + 2
+		for ; j < len(tokens) && tokens[j] != ")"; j++ {
+			if tokens[j] != "$" {
+				vs = append(vs, tokens[j])
+			}
+		}
+		return vs, j
+	}
+
+	for i := 1; i < len(tokens); i++ {
+		var vs []string
+		switch strings.ToUpper(tokens[i]) {
+		case "NAME":
+			vs, i = values(i)
+			at.Names = vs
+		case "SUP":
+			if vs, i = values(i); len(vs) > 0 {
+				at.Sup = vs[0]
+			}
+		case "EQUALITY":
+			if vs, i = values(i); len(vs) > 0 {
+				at.Equality = vs[0]
+			}
+		case "SYNTAX":
+			if vs, i = values(i); len(vs) > 0 {
+				at.Syntax = strings.SplitN(vs[0], "{", 2)[0] // drop length bounds e.g. {256}
+			}
+		case "SINGLE-VALUE":
+			at.SingleValue = true
+		case "DESC", "ORDERING", "SUBSTR", "USAGE":
+			_, i = values(i)
+		default:
+			if strings.HasPrefix(tokens[i], "X-") {
+				_, i = values(i)
+			}
+		}
+	}
+	return at, true
+}
+
+// tokenizeSchema splits a schema description into parentheses, quoted strings (unquoted) and bare words
+func tokenizeSchema(def string) (tokens []string) {
+	for i := 0; i < len(def); {
+		switch c := def[i]; {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '(' || c == ')':
+			tokens = append(tokens, string(c))
+			i++
+		case c == '\'':
+			end := strings.IndexByte(def[i+1:], '\'')
+			if end < 0 {
+				tokens = append(tokens, def[i+1:])
+				return
+			}
+			tokens = append(tokens, def[i+1:i+1+end])
+			i += end + 2
+		default:
+			j := i
+			for j < len(def) && !strings.ContainsRune(" \t\n\r()'", rune(def[j])) {
+				j++
+			}
+			tokens = append(tokens, def[i:j])
+			i = j
+		}
+	}
+	return
+}
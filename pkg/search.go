@@ -0,0 +1,99 @@
+package ldapsync
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+// SearchSpec describes a raw search of the directory
+type SearchSpec struct {
+	BaseDN     string
+	Scope      string   // base, one or sub (the default)
+	Filter     string   // defaults to (objectClass=*)
+	Attributes []string // all user attributes if empty
+	PageSize   uint32   // defaults to 500, paging is skipped if the server does not support it
+	Controls   []ldap.Control
+	// attempts to restart the search after a connection failure or an unavailable server, skipping the entries
+	// already delivered. Zero does not retry
+	Retries int
+}
+
+const defaultSearchPageSize = 500
+
+// Search streams the entries of the search, fetched a page at a time, leaving their classification to the caller.
+// The entries channel is closed once the search completes; the error channel then delivers the error, if any,
+// and is closed. Cancelling the context aborts the search
+func (c *Client) Search(ctx context.Context, spec SearchSpec) (<-chan *LDAPEntry, <-chan error) {
+	entries := make(chan *LDAPEntry, defaultSearchPageSize)
+	errs := make(chan error, 1)
+	go func() {
+		defer close(errs)
+		err := c.search(ctx, spec, entries)
+		close(entries)
+		if err != nil {
+			errs <- err
+		}
+	}()
+	return entries, errs
+}
+
+func (c *Client) search(ctx context.Context, spec SearchSpec, entries chan<- *LDAPEntry) (err error) {
+	seen := make(map[string]bool) // DNs already delivered, skipped when the search is restarted
+	for attempt := 0; ; attempt++ {
+		err = c.searchOnce(ctx, spec, seen, entries)
+		if err == nil || attempt >= spec.Retries || !isServerFailure(err) || ctx.Err() != nil {
+			return
+		}
+		select {
+		case <-time.After(time.Duration(1<<attempt) * time.Second): // back off before retrying
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (c *Client) searchOnce(ctx context.Context, spec SearchSpec, seen map[string]bool, entries chan<- *LDAPEntry) error {
+	scope, err := parseScope(spec.Scope, ldap.ScopeWholeSubtree)
+	if err != nil {
+		return err
+	}
+	l, err := c.pool.connect(ctx, c.config)
+	if err != nil {
+		return err
+	}
+	defer l.Close()
+
+	filter, pageSize := spec.Filter, spec.PageSize
+	if filter == "" {
+		filter = "(objectClass=*)"
+	}
+	if pageSize == 0 {
+		pageSize = defaultSearchPageSize
+	}
+	dse, _ := readRootDSE(l)
+	searchRequest := ldap.NewSearchRequest(spec.BaseDN, scope, ldap.NeverDerefAliases, 0, 0, false, filter,
+		append([]string{}, spec.Attributes...), append(c.config.requestControls(), spec.Controls...))
+
+	pages := 0
+	err = l.searchPages(searchRequest, pageSize, dse.pagingSupported(), nil, func(sr *ldap.SearchResult, next []byte) error {
+		pages++
+		for _, ent := range toEntries(sr.Entries, seen, Provenance{Server: l.addr, BaseDN: spec.BaseDN}) {
+			select {
+			case entries <- ent:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		page := 0
+		if dse.pagingSupported() {
+			page = pages + 1
+		}
+		return searchError("search", l.addr, spec.BaseDN, page, err)
+	}
+	return nil
+}
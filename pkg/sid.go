@@ -0,0 +1,101 @@
+package ldapsync
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+// DecodeSID converts a binary Windows security identifier (e.g. objectSid) to its string form S-1-5-21-...
+func DecodeSID(b []byte) (string, error) {
+	if len(b) < 8 {
+		return "", errors.New("SID too short")
+	}
+	count := int(b[1])
+	if len(b) != 8+4*count {
+		return "", fmt.Errorf("SID length %d does not match its %d sub-authorities", len(b), count)
+	}
+	var authority uint64
+	for _, v := range b[2:8] {
+		authority = authority<<8 | uint64(v)
+	}
+	sid := fmt.Sprintf("S-%d-%d", b[0], authority)
+	for i := 0; i < count; i++ {
+		sid += fmt.Sprintf("-%d", binary.LittleEndian.Uint32(b[8+4*i:]))
+	}
+	return sid, nil
+}
+
+// well-known SIDs, which are the same in every domain
+var wellKnownSIDs = map[string]string{
+	"S-1-0-0":      `NULL SID`,
+	"S-1-1-0":      `Everyone`,
+	"S-1-2-0":      `LOCAL`,
+	"S-1-3-0":      `CREATOR OWNER`,
+	"S-1-5-2":      `NT AUTHORITY\NETWORK`,
+	"S-1-5-4":      `NT AUTHORITY\INTERACTIVE`,
+	"S-1-5-7":      `NT AUTHORITY\ANONYMOUS LOGON`,
+	"S-1-5-9":      `NT AUTHORITY\ENTERPRISE DOMAIN CONTROLLERS`,
+	"S-1-5-11":     `NT AUTHORITY\Authenticated Users`,
+	"S-1-5-15":     `NT AUTHORITY\This Organization`,
+	"S-1-5-17":     `NT AUTHORITY\IUSR`,
+	"S-1-5-18":     `NT AUTHORITY\SYSTEM`,
+	"S-1-5-19":     `NT AUTHORITY\LOCAL SERVICE`,
+	"S-1-5-20":     `NT AUTHORITY\NETWORK SERVICE`,
+	"S-1-5-32-544": `BUILTIN\Administrators`,
+	"S-1-5-32-545": `BUILTIN\Users`,
+	"S-1-5-32-546": `BUILTIN\Guests`,
+	"S-1-5-32-548": `BUILTIN\Account Operators`,
+	"S-1-5-32-549": `BUILTIN\Server Operators`,
+	"S-1-5-32-550": `BUILTIN\Print Operators`,
+	"S-1-5-32-551": `BUILTIN\Backup Operators`,
+	"S-1-5-32-554": `BUILTIN\Pre-Windows 2000 Compatible Access`,
+	"S-1-5-32-555": `BUILTIN\Remote Desktop Users`,
+	"S-1-5-32-580": `BUILTIN\Remote Management Users`,
+}
+
+// WellKnownSIDName returns the name of a well-known SID, such as NT AUTHORITY\Authenticated Users for S-1-5-11
+func WellKnownSIDName(sid string) (string, bool) {
+	name, exists := wellKnownSIDs[strings.ToUpper(sid)]
+	return name, exists
+}
+
+// ForeignPrincipalPolicy determines how Active Directory foreign security principals (members from trusted
+// domains, or well-known SIDs, which appear as CN=S-1-5-...,CN=ForeignSecurityPrincipals,... DNs) among group members are handled
+type ForeignPrincipalPolicy string
+
+const (
+	KeepForeignPrincipals    ForeignPrincipalPolicy = ""        // keep them as external members, as is
+	ExcludeForeignPrincipals ForeignPrincipalPolicy = "exclude" // drop them
+	// replace well-known SIDs by their names and make those matching the objectSid of a synced user
+	// (e.g. from the trusted domain in an aggregate sync) members
+	ResolveForeignPrincipals ForeignPrincipalPolicy = "resolve"
+)
+
+// ForeignPrincipalSID returns the SID of a foreign security principal DN, i.e. one whose first RDN is CN=S-1-...
+func ForeignPrincipalSID(dn string) (string, bool) {
+	d, err := ldap.ParseDN(dn)
+	if err != nil || len(d.RDNs) == 0 || len(d.RDNs[0].Attributes) != 1 {
+		return "", false
+	}
+	atv := d.RDNs[0].Attributes[0]
+	if !strings.EqualFold(atv.Type, "cn") || !strings.HasPrefix(strings.ToUpper(atv.Value), "S-1-") {
+		return "", false
+	}
+	return strings.ToUpper(atv.Value), true
+}
+
+// entrySID returns the string form of the entry's objectSid, if any
+func entrySID(ent *LDAPEntry) string {
+	if att := ent.attribute("objectSid"); att != nil {
+		if raw := att.RawValues(); len(raw) > 0 {
+			if sid, err := DecodeSID(raw[0]); err == nil {
+				return sid
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,209 @@
+package ldapsync
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// ImportSSSDConfig reads the LDAP domain section of an sssd.conf (see sssd-ldap(5)) and returns the equivalent
+// configuration: the server of its first ldap_uri, TLS settings and CA certificates, bind credentials, search
+// bases, and the filters, membership and ID attributes of its ldap_schema and object class and attribute mappings.
+// The domain is that of the section [domain/<domain>], or the first one listed in the [sssd] section's domains if
+// empty
+func ImportSSSDConfig(r io.Reader, domain string) (config LDAPSyncConfig, err error) {
+	sections, err := parseINI(r)
+	if err != nil {
+		return
+	}
+	if domain == "" {
+		if domains := strings.Split(sections["sssd"]["domains"], ","); strings.TrimSpace(domains[0]) != "" {
+			domain = strings.TrimSpace(domains[0])
+		}
+	}
+	if domain == "" {
+		var domains []string
+		for name := range sections {
+			if strings.HasPrefix(name, "domain/") {
+				domains = append(domains, strings.TrimPrefix(name, "domain/"))
+			}
+		}
+		if len(domains) != 1 {
+			return config, fmt.Errorf("sssd.conf has %d domain sections, name the one to import", len(domains))
+		}
+		domain = domains[0]
+	}
+	section, exists := sections["domain/"+strings.ToLower(domain)]
+	if !exists {
+		return config, fmt.Errorf("sssd.conf has no [domain/%s] section", domain)
+	}
+	if provider := section["id_provider"]; provider != "" && provider != "ldap" && provider != "ad" && provider != "ipa" {
+		return config, fmt.Errorf("domain %s has id_provider %s, not an LDAP one", domain, provider)
+	}
+
+	uris := strings.Split(section["ldap_uri"], ",")
+	if strings.TrimSpace(uris[0]) == "" {
+		// the ad and ipa providers name their servers instead, _srv_ for DNS discovery
+		for _, key := range []string{"ad_server", "ipa_server"} {
+			if server := strings.TrimSpace(strings.Split(section[key], ",")[0]); server != "" && server != "_srv_" {
+				uris[0] = "ldap://" + server
+			}
+		}
+	}
+	if strings.TrimSpace(uris[0]) == "" {
+		return config, fmt.Errorf("domain %s has no ldap_uri", domain)
+	}
+	u, err := url.Parse(strings.TrimSpace(uris[0]))
+	if err != nil {
+		return config, fmt.Errorf("domain %s: ldap_uri: %w", domain, err)
+	}
+	config.Server = u.Hostname()
+	port := u.Port()
+	switch {
+	case u.Scheme == "ldaps":
+		config.TLS = "tls"
+		if port == "" {
+			port = "636"
+		}
+	case strings.EqualFold(section["ldap_id_use_start_tls"], "true"):
+		config.TLS = "starttls"
+	default:
+		config.TLS = "none"
+	}
+	config.TLSOptions.CACertFile = section["ldap_tls_cacert"]
+	switch strings.ToLower(section["ldap_tls_reqcert"]) {
+	case "never", "allow":
+		config.TLSOptions.InsecureSkipVerify = true
+	}
+	if port != "" {
+		config.Port = &port
+	}
+
+	if bindDN := section["ldap_default_bind_dn"]; bindDN != "" {
+		config.RequiresAuthentication = true
+		config.SyncUserName = bindDN
+		if authType := section["ldap_default_authtok_type"]; authType == "" || authType == "password" {
+			config.SyncPassword = section["ldap_default_authtok"]
+		}
+	}
+
+	// search bases may carry a scope and filter, e.g. ou=people,dc=example,dc=com?subtree?(objectClass=person)
+	for _, key := range []string{"ldap_user_search_base", "ldap_group_search_base"} {
+		if base := strings.SplitN(section[key], "?", 2)[0]; base != "" && !containsFold(config.BaseDNs, base) {
+			config.BaseDNs = append(config.BaseDNs, base)
+		}
+	}
+	if len(config.BaseDNs) == 0 && section["ldap_search_base"] != "" {
+		config.BaseDNs = []string{strings.SplitN(section["ldap_search_base"], "?", 2)[0]}
+	}
+	if len(config.BaseDNs) == 0 {
+		config.BaseDNs = []string{AutoBaseDN} // sssd discovers it from the RootDSE too
+	}
+
+	schema := strings.ToLower(section["ldap_schema"])
+	if provider := section["id_provider"]; provider == "ad" || provider == "ipa" {
+		schema = provider
+	}
+	userClass, groupClass, groupMember := "posixAccount", "posixGroup", "memberUid"
+	switch schema {
+	case "ad":
+		defaults, _ := DefaultsFor(ActiveDirectory)
+		applySSSDDefaults(&config, defaults)
+		userClass, groupClass, groupMember = "user", "group", "member"
+	case "ipa":
+		defaults, _ := DefaultsFor(FreeIPA)
+		applySSSDDefaults(&config, defaults)
+		userClass, groupClass, groupMember = "posixAccount", "ipaUserGroup", "member"
+	case "rfc2307bis":
+		groupClass, groupMember = "groupOfNames", "member"
+		fallthrough
+	default: // rfc2307
+		config.UserIDAttribute, config.GroupIDAttribute = "uid", "cn"
+	}
+
+	if class := section["ldap_user_object_class"]; class != "" {
+		userClass = class
+	}
+	if class := section["ldap_group_object_class"]; class != "" {
+		groupClass = class
+	}
+	if member := section["ldap_group_member"]; member != "" {
+		groupMember = member
+	}
+	if schema != "ad" || section["ldap_user_object_class"] != "" {
+		config.UserFilter = LDAPFilter{Filters: []FilterExpression{{Name: "objectClass", Value: objectClassPattern(userClass)}}}
+	}
+	if schema != "ad" && schema != "ipa" || section["ldap_group_object_class"] != "" {
+		config.GroupFilter = LDAPFilter{Filters: []FilterExpression{{Name: "objectClass", Value: objectClassPattern(groupClass)}}}
+	}
+	if schema != "ad" && schema != "ipa" || section["ldap_group_member"] != "" {
+		userAttribute := "dn"
+		if strings.EqualFold(groupMember, "memberUid") {
+			userAttribute = "uid"
+			if name := section["ldap_user_name"]; name != "" {
+				userAttribute = name
+			}
+		}
+		config.GroupMembership = GroupMembershipAssociator{
+			Constraints: []Constraint{{UserAttribute: userAttribute, GroupAttribute: groupMember}},
+		}
+	}
+	if name := section["ldap_user_name"]; name != "" {
+		config.UserIDAttribute = name
+	}
+	if name := section["ldap_group_name"]; name != "" {
+		config.GroupIDAttribute = name
+	}
+	return
+}
+
+func applySSSDDefaults(config *LDAPSyncConfig, defaults VendorDefaults) {
+	config.UserFilter = defaults.UserFilter
+	config.GroupFilter = defaults.GroupFilter
+	config.GroupMembership = defaults.GroupMembership
+	config.UserIDAttribute = defaults.UserIDAttribute
+	config.GroupIDAttribute = defaults.GroupIDAttribute
+}
+
+// objectClassPattern returns the filter expression value matching the object class
+func objectClassPattern(class string) string {
+	return "(?i)^" + regexp.QuoteMeta(class) + "$"
+}
+
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseINI parses an INI file into its sections' keys and values, with lower-cased section names and keys
+func parseINI(r io.Reader) (map[string]map[string]string, error) {
+	sections := make(map[string]map[string]string)
+	var section map[string]string
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "" || line[0] == '#' || line[0] == ';':
+		case line[0] == '[' && line[len(line)-1] == ']':
+			name := strings.ToLower(strings.TrimSpace(line[1 : len(line)-1]))
+			if sections[name] == nil {
+				sections[name] = make(map[string]string)
+			}
+			section = sections[name]
+		default:
+			key, value, found := strings.Cut(line, "=")
+			if !found || section == nil {
+				return nil, fmt.Errorf("line %d: expected a key = value in a section: %s", n, line)
+			}
+			section[strings.ToLower(strings.TrimSpace(key))] = strings.TrimSpace(value)
+		}
+	}
+	return sections, scanner.Err()
+}
@@ -0,0 +1,138 @@
+package ldapsync
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// StaleAccount is a user who has not logged on within the threshold of a StaleAccountReport
+type StaleAccount struct {
+	ID        string
+	DN        string
+	OrgUnit   string     // the DN of the container of the user
+	LastLogon *time.Time `json:",omitempty"` // nil if the directory has no record of the user logging on
+	Created   *time.Time `json:",omitempty"`
+	// whole days since the last logon, or since the user was created if they never logged on; -1 if neither is known
+	DaysInactive int
+}
+
+// StaleOrgUnit holds the stale accounts directly under a container
+type StaleOrgUnit struct {
+	DN       string
+	Accounts []StaleAccount
+}
+
+// StaleAccountReport lists the dormant accounts of a sync, grouped by their container, for access reviews
+type StaleAccountReport struct {
+	AsOf      time.Time
+	Threshold Duration
+	OrgUnits  []StaleOrgUnit // ordered by DN, as are their accounts
+}
+
+// Accounts returns the stale accounts of all the containers
+func (r StaleAccountReport) Accounts() (accounts []StaleAccount) {
+	for _, ou := range r.OrgUnits {
+		accounts = append(accounts, ou.Accounts...)
+	}
+	return
+}
+
+// StaleAccounts reports the users who have not logged on for longer than the threshold as of now, by the latest of
+// their lastLogonTimestamp (Active Directory, replicated up to 14 days late) and authTimestamp (OpenLDAP's lastbind
+// overlay). Users who never logged on are stale once they are older than the threshold, by their whenCreated or
+// createTimestamp, or if their creation is unknown.
+//
+// authTimestamp and createTimestamp are operational attributes, which a sync only fetches if they are among the
+// attributes of the LDAP URLs of the BaseDNs, e.g. ldap:///ou=people,dc=example,dc=com?*,authTimestamp,createTimestamp,
+// and none of these attributes are fetched by a MembershipOnly sync
+func (sr *LDAPRecords) StaleAccounts(threshold time.Duration, now time.Time) StaleAccountReport {
+	report := StaleAccountReport{AsOf: now, Threshold: Duration(threshold)}
+	cutoff := now.Add(-threshold)
+	units := make(map[string]*StaleOrgUnit)
+	for _, ent := range sr.GetUsers() {
+		account := StaleAccount{ID: entryID(ent, sr.config.UserIDAttribute), DN: ent.DN, LastLogon: lastLogon(ent),
+			Created: created(ent), DaysInactive: -1}
+		since := account.LastLogon
+		if since == nil {
+			since = account.Created
+		}
+		if since != nil {
+			if !since.Before(cutoff) {
+				continue
+			}
+			account.DaysInactive = int(now.Sub(*since).Hours() / 24)
+		}
+		parent, err := ParentDN(ent.DN)
+		if err != nil {
+			parent = ""
+		}
+		account.OrgUnit = parent
+		key := normalizeDN(parent)
+		if units[key] == nil {
+			units[key] = &StaleOrgUnit{DN: parent}
+		}
+		units[key].Accounts = append(units[key].Accounts, account)
+	}
+	for _, key := range sortedKeys(units) {
+		ou := units[key]
+		sort.Slice(ou.Accounts, func(i, j int) bool { return ou.Accounts[i].DN < ou.Accounts[j].DN })
+		report.OrgUnits = append(report.OrgUnits, *ou)
+	}
+	return report
+}
+
+// lastLogon returns the latest logon of the user recorded by the directory, if any
+func lastLogon(ent *LDAPEntry) (last *time.Time) {
+	if t, ok := ent.GetTimeAD("lastLogonTimestamp"); ok {
+		last = &t
+	}
+	if t, ok := ent.GetTime("authTimestamp"); ok && (last == nil || t.After(*last)) {
+		last = &t
+	}
+	return
+}
+
+// created returns when the entry was created, if known
+func created(ent *LDAPEntry) *time.Time {
+	for _, name := range []string{"whenCreated", "createTimestamp"} {
+		if t, ok := ent.GetTime(name); ok {
+			return &t
+		}
+	}
+	return nil
+}
+
+// WriteStaleAccountsCSV writes the stale accounts of the report as CSV, one per line with a header, with times in
+// RFC 3339 format and empty if unknown
+func WriteStaleAccountsCSV(w io.Writer, report StaleAccountReport) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write([]string{"orgUnit", "id", "dn", "lastLogon", "created", "daysInactive"}); err != nil {
+		return err
+	}
+	for _, a := range report.Accounts() {
+		if err := cw.Write([]string{a.OrgUnit, a.ID, a.DN, formatTime(a.LastLogon), formatTime(a.Created),
+			strconv.Itoa(a.DaysInactive)}); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// WriteStaleAccountsJSON writes the report as indented JSON
+func WriteStaleAccountsJSON(w io.Writer, report StaleAccountReport) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(report)
+}
+
+func formatTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
@@ -0,0 +1,45 @@
+package ldapsync
+
+import (
+	"sync"
+)
+
+// StateStore persists sync state across runs and processes, such as the checkpoints of interrupted syncs
+type StateStore interface {
+	// Load returns the value saved under the key, if any
+	Load(key string) (value []byte, found bool, err error)
+	Save(key string, value []byte) error
+	// Delete removes the key, if present
+	Delete(key string) error
+}
+
+// MemoryStateStore is an in-process StateStore, which survives interrupted syncs but not restarts
+type MemoryStateStore struct {
+	mu     sync.Mutex
+	values map[string][]byte
+}
+
+func NewMemoryStateStore() *MemoryStateStore {
+	return &MemoryStateStore{values: make(map[string][]byte)}
+}
+
+func (s *MemoryStateStore) Load(key string) ([]byte, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	value, found := s.values[key]
+	return value, found, nil
+}
+
+func (s *MemoryStateStore) Save(key string, value []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.values[key] = append([]byte{}, value...)
+	return nil
+}
+
+func (s *MemoryStateStore) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.values, key)
+	return nil
+}
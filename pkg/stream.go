@@ -0,0 +1,33 @@
+package ldapsync
+
+import "context"
+
+// DoStream syncs like Do, passing each entry to the function as its page arrives rather than holding the entries in
+// the records. Memory use is still O(number of DNs) rather than constant, as the DNs passed are kept in a set so
+// that entries of overlapping BaseDNs are passed once. The records hold the rest of the result, e.g. the Truncations
+// and SyncCookie, but no users, groups or memberships: entries may be classified with the Matches of the UserFilter
+// and GroupFilter. Avatars are not extracted and OfflineCredentials are not updated. An error of the function stops
+// the sync, and is returned wrapped in an OperationError. Entries may be passed again by retried syncs, or syncs
+// resumed from their checkpoints
+func DoStream(config LDAPSyncConfig, fn func(*LDAPEntry) error) (LDAPRecords, error) {
+	return DoStreamContext(context.Background(), config, fn)
+}
+
+// DoStreamContext streams the sync like DoStream, until the context is done
+func DoStreamContext(ctx context.Context, config LDAPSyncConfig, fn func(*LDAPEntry) error) (LDAPRecords, error) {
+	return doStream(ctx, config, nil, fn)
+}
+
+// DoStream streams the sync like DoStreamContext, with a connection of the client's pool
+func (c *Client) DoStream(ctx context.Context, fn func(*LDAPEntry) error) (LDAPRecords, error) {
+	return doStream(ctx, c.config, c.pool, fn)
+}
+
+func doStream(ctx context.Context, config LDAPSyncConfig, pool *connPool, fn func(*LDAPEntry) error) (result LDAPRecords,
+	err error) {
+	err = config.Retry.do(ctx, config.Metrics, config.Logger, config.GetDialAddr(), func() (err error) {
+		result, err = syncAttempt(ctx, config, pool, fn)
+		return
+	})
+	return
+}
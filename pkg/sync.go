@@ -1,132 +1,767 @@
 package ldapsync
 
 import (
+	"context"
 	"crypto/tls"
+	"errors"
 	"fmt"
 	"net"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/go-ldap/ldap/v3"
 )
 
 // sync an Do service based on provided sync configuration
 func Do(config LDAPSyncConfig) (result LDAPRecords, err error) {
-	config = config.Sanitize()
-	result.config = &config
-	var l *ldap.Conn
-	tlsConfig := &tls.Config{
-		InsecureSkipVerify: true, //TODO: support self-signed CAs
-	}
+	return DoContext(context.Background(), config)
+}
 
-	if config.TLS == "tls" {
-		l, err = ldap.DialTLS("tcp", config.GetDialAddr(), tlsConfig)
-		if err != nil {
-			return
+// DoContext syncs like Do, until the context is done. If the context is done mid-sync, the entries fetched
+// so far are returned, marked as Partial, along with the context's error
+func DoContext(ctx context.Context, config LDAPSyncConfig) (result LDAPRecords, err error) {
+	return doContext(ctx, config, nil)
+}
+
+// doContext syncs like DoContext, with a connection of the pool if any, retrying by the Retry policy
+func doContext(ctx context.Context, config LDAPSyncConfig, pool *connPool) (result LDAPRecords, err error) {
+	err = config.Retry.do(ctx, config.Metrics, config.Logger, config.GetDialAddr(), func() (err error) {
+		result, err = syncAttempt(ctx, config, pool, nil)
+		return
+	})
+	return
+}
+
+// syncAttempt is an attempt of doContext, which resumes from the checkpoints of the previous attempt if any. The
+// entries are passed to the stream, if set, rather than held by the records
+func syncAttempt(ctx context.Context, config LDAPSyncConfig, pool *connPool, stream func(*LDAPEntry) error) (result LDAPRecords, err error) {
+	config = config.Sanitize()
+	config.compileFilters()
+	result.config, result.views = &config, &recordViews{}
+	metrics, logger, begin := metricsOr(config.Metrics), loggerOr(config.Logger), time.Now()
+	streamed, pages := 0, 0
+	defer func() {
+		server := map[string]string{"server": config.GetDialAddr()}
+		syncOutcome := outcome(err)
+		if result.Partial {
+			syncOutcome = "partial"
 		}
-	} else {
-		l, err = ldap.DialURL(config.GetDialURL())
-		if err != nil {
-			return
+		metrics.Count(MetricSyncs, 1, map[string]string{"server": config.GetDialAddr(), "result": syncOutcome})
+		metrics.Observe(MetricSyncDuration, time.Since(begin).Seconds(), server)
+		if err == nil {
+			metrics.Gauge(MetricSyncEntries, float64(len(result.Entries)+streamed), server)
 		}
-		if config.TLS == "starttls" {
-			err = l.StartTLS(tlsConfig)
-			if err != nil {
-				return
+		args := []any{"server", config.GetDialAddr(), "entries", len(result.Entries) + streamed, "pages", pages,
+			"duration", time.Since(begin)}
+		switch {
+		case result.Partial:
+			logger.Warn("sync interrupted", append(args, "error", err)...)
+		case err != nil:
+			logger.Error("sync failed", append(args, "error", err)...)
+		default:
+			logger.Info("sync completed", args...)
+		}
+		config.Hooks.syncEnd(&result, time.Since(begin), err)
+	}()
+	for _, baseDN := range config.BaseDNs {
+		if _, err = newSearchRequest(baseDN); err != nil {
+			return // an invalid LDAP URL
+		}
+	}
+	syncCookies, err := decodeSyncCookie(config.SyncCookie)
+	if err != nil {
+		return
+	}
+	if config.OfflineCredentials != nil && stream == nil {
+		defer func() {
+			// the users of an incremental sync are only those changed, and those of a truncated one are missing some
+			if err == nil && !result.Partial && !result.Truncated && result.Delta == nil {
+				config.OfflineCredentials.Update(&result)
+			}
+		}()
+	}
+	if config.Avatars != nil && stream == nil {
+		defer func() {
+			if err == nil {
+				result.avatars, err = result.extractAvatars(*config.Avatars)
 			}
+		}()
+	}
+	var cacheKey string
+	if config.caching() && config.Incremental == "" && stream == nil {
+		cacheKey = config.cacheKey("sync", "")
+		if result.loadCached(cacheKey, config.Cache) {
+			return
 		}
+		defer func() {
+			if err == nil {
+				result.cache(cacheKey, config.Cache, time.Duration(config.CacheTTL))
+			}
+		}()
 	}
 
+	l, err := pool.connect(ctx, config)
 	if err != nil {
 		return
 	}
 	defer l.Close()
+	defer func() {
+		if err != nil && ctx.Err() != nil {
+			err = ctx.Err()
+			result.Partial = true
+		}
+	}()
 
-	if config.RequiresAuthentication {
-		err = l.Bind(config.SyncUserName, config.SyncPassword)
-		if err != nil {
+	dse, dseErr := readRootDSE(l)
+	if config.autoBaseDNs() || config.DiscoverSchema || config.DetectVendor {
+		if dseErr != nil {
+			err = dseErr
 			return
 		}
+		if config.DetectVendor {
+			result.Vendor = dse.Vendor()
+			config = config.WithVendorDefaults(result.Vendor)
+		}
+		if config.autoBaseDNs() {
+			config.BaseDNs = dse.BaseDNs()
+		}
+		if config.DiscoverSchema {
+			if result.Schema, err = readSchema(l, dse); err != nil {
+				return
+			}
+		}
 	}
 
-	for _, baseDN := range config.BaseDNs {
-		searchRequest := ldap.NewSearchRequest(
-			baseDN, // The base dn to search
-			ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 0, 0, false,
-			"(&(objectClass=*))", // The filter to apply - get everything
-			[]string{},           // A list attributes to retrieve - get all attributes
-			[]ldap.Control{},
-		)
-
-		sr, e := l.SearchWithPaging(searchRequest, 5 /*limit pagination size to 5*/)
-		if e != nil {
-			err = e
+	config.Hooks.syncStart(l.addr, config.BaseDNs)
+	logger.Info("sync started", "server", l.addr, "baseDNs", config.BaseDNs)
+	var mu sync.Mutex             // guards the state shared by the syncs of the BaseDNs, which may run concurrently
+	seen := make(map[string]bool) // DNs already fetched, as BaseDNs may overlap: O(number of DNs), streamed or not
+	rewriter := newDNRewriter(config.DNRewrites, result.Schema)
+	excludedAttributes := config.excludedAttributes()
+	var chaser *referralChaser
+	if config.Referrals != nil {
+		chaser = newReferralChaser(ctx, config)
+	}
+	var checkpoints []*checkpointer
+	var delta SyncDelta
+	nextCookies := make(map[string][]byte)
+	progressReporter := newProgressReporter(config.Progress, len(config.BaseDNs))
+	entries := make([][]*LDAPEntry, len(config.BaseDNs)) // of each BaseDN, gathered in order once all are synced
+	// add adds the entries of a page to those of the i'th BaseDN, or passes them to the stream
+	add := func(i int, page []*LDAPEntry) error {
+		mu.Lock()
+		defer mu.Unlock()
+		config.Hooks.entries(page)
+		if stream == nil {
+			entries[i] = append(entries[i], page...)
+			return nil
+		}
+		for _, ent := range page {
+			streamed++
+			if err := stream(ent); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	// reportPage reports the progress of a page of the BaseDN, and records it in the metrics
+	reportPage := func(baseDN string, entries int) {
+		mu.Lock()
+		defer mu.Unlock()
+		progressReporter.startBaseDN(baseDN)
+		progressReporter.page(entries)
+		pages++
+		logger.Debug("page synced", "baseDN", baseDN, "entries", entries)
+		metrics.Count(MetricSyncPages, 1, map[string]string{"server": config.GetDialAddr()})
+		metrics.Count(MetricEntriesFetched, float64(entries), map[string]string{"server": config.GetDialAddr()})
+	}
+	// baseDNDone reports the BaseDN synced since it began, with the number of its entries
+	baseDNDone := func(baseDN string, entries int, began time.Time) {
+		mu.Lock()
+		defer mu.Unlock()
+		progressReporter.baseDNDone()
+		config.Hooks.baseDNDone(baseDN, entries)
+		logger.Info("BaseDN synced", "baseDN", baseDN, "entries", entries, "duration", time.Since(began))
+	}
+	if _, found := config.serverFilter(result.Schema); found {
+		for _, baseDN := range config.BaseDNs {
+			result.serverFiltered = result.serverFiltered || !isLDAPURL(baseDN)
+		}
+	}
+	err = forEachBaseDN(ctx, l, pool, config, func(ctx context.Context, l *conn, i int) (err error) {
+		baseDN, began := config.BaseDNs[i], time.Now()
+		var searchRequest *ldap.SearchRequest
+		if searchRequest, err = newSearchRequest(baseDN); err != nil {
+			return
+		}
+		if filter, found := config.serverFilter(result.Schema); found && !isLDAPURL(baseDN) {
+			searchRequest.Filter = filter // the filter of an LDAP URL is its own
+		}
+		searchRequest.Controls = config.requestControls()
+		searchRequest.SizeLimit, searchRequest.TimeLimit = config.SizeLimit, config.timeLimitSeconds()
+		if len(searchRequest.Attributes) == 0 {
+			searchRequest.Attributes = config.syncAttributes()
+		}
+		fetched := 0 // entries of this BaseDN
+		// convert readies the entries of a page the server returned for the records
+		convert := func(server string, entries []*ldap.Entry) []*LDAPEntry {
+			mu.Lock()
+			defer mu.Unlock()
+			withoutAttributes(entries, excludedAttributes)
+			page := toEntries(entries, seen, Provenance{Server: server, BaseDN: searchRequest.BaseDN})
+			if len(config.ExcludeDNs) > 0 {
+				page = config.withoutExcluded(page)
+			}
+			rewriter.rewriteEntries(page)
+			fetched += len(page)
+			return page
+		}
+
+		if config.Incremental != "" {
+			// the entryUUIDs (objectGUIDs of Active Directory) identify the entries the server reports deleted or
+			// renamed by UUID alone
+			if len(searchRequest.Attributes) == 0 {
+				searchRequest.Attributes = []string{"*"}
+			}
+			searchRequest.Attributes = append(searchRequest.Attributes, "entryUUID", "objectGUID")
+			changed := func(entries []*ldap.Entry) error {
+				page := convert(l.addr, entries)
+				if err := add(i, page); err != nil {
+					return err
+				}
+				reportPage(baseDN, len(page))
+				return nil
+			}
+			var baseDNDelta SyncDelta
+			var present bool
+			var next []byte
+			if config.Incremental == IncrementalDirSync {
+				baseDNDelta, next, err = l.dirSync(searchRequest, syncCookies[baseDN], changed)
+			} else {
+				baseDNDelta, present, next, err = l.syncRepl(searchRequest, syncCookies[baseDN], changed)
+			}
+			if err != nil {
+				return searchError(config.Incremental, l.addr, baseDN, 0, err)
+			}
+			mu.Lock()
+			delta.add(searchRequest.BaseDN, baseDNDelta, present)
+			nextCookies[baseDN] = next
+			mu.Unlock()
+			baseDNDone(baseDN, fetched, began)
 			return
 		}
 
-		for _, entry := range sr.Entries {
-			ent := LDAPEntry{
-				DN:         entry.DN,
-				Attributes: make([]LDAPAttribute, len(entry.Attributes)),
+		// resume from the checkpoint of an interrupted sync, if any
+		var cp *checkpointer
+		var progress checkpoint
+		if config.StateStore != nil {
+			cp = newCheckpointer(config.StateStore, l.addr, searchRequest)
+			var restored []*LDAPEntry
+			if progress, restored, err = cp.load(); err != nil {
+				return
+			}
+			mu.Lock()
+			checkpoints = append(checkpoints, cp)
+			for _, ent := range restored {
+				seen[dnKey(ent.DN)] = true
+			}
+			mu.Unlock()
+			if err = add(i, restored); err != nil {
+				return
+			}
+			fetched += len(restored)
+			if progress.Pages > 0 {
+				reportPage(baseDN, len(restored))
+			}
+			if progress.Complete {
+				baseDNDone(baseDN, len(restored), began)
+				return
+			}
+		}
+
+		resumed := len(progress.Cookie) > 0
+		for {
+			pages := 0
+			err = l.searchPages(searchRequest, config.pageSize(), dse.pagingSupported(), progress.Cookie, func(sr *ldap.SearchResult, next []byte) error {
+				pages++
+				page := convert(l.addr, sr.Entries)
+				if chaser != nil && len(sr.Referrals) > 0 {
+					// the referred entries are checkpointed with the page referring to them
+					if err := chaser.chase(sr.Referrals, true, searchRequest, 1, func(server string, entries []*ldap.Entry) error {
+						page = append(page, convert(server, entries)...)
+						return nil
+					}); err != nil {
+						return err
+					}
+				}
+				if err := add(i, page); err != nil {
+					return err
+				}
+				if cp != nil {
+					if err := cp.savePage(&progress, page, next); err != nil {
+						return err
+					}
+				} else {
+					progress.Pages++
+				}
+				reportPage(baseDN, len(page))
+				return nil
+			})
+			if err != nil && resumed && pages == 0 && ctx.Err() == nil {
+				// the server rejected the saved cookie (e.g. it is bound to the connection that was lost), start the BaseDN afresh
+				resumed = false
+				if err = cp.clear(); err != nil {
+					return
+				}
+				progress = checkpoint{}
+				mu.Lock()
+				if stream == nil {
+					for _, ent := range entries[i] {
+						delete(seen, dnKey(ent.DN))
+					}
+					entries[i], fetched = nil, 0
+				} // streamed entries stay seen, rather than being streamed again
+				mu.Unlock()
+				searchRequest.Controls = config.requestControls()
+				continue
 			}
-			for i, att := range entry.Attributes {
-				ent.Attributes[i] = LDAPAttribute{
-					Name:   att.Name,
-					Values: att.Values,
+			break
+		}
+		if chaser != nil && isResultCode(err, ldap.LDAPResultReferral) {
+			// the BaseDN itself is held by another server
+			err = chaser.chase(referralURLs(err), false, searchRequest, 1, func(server string, entries []*ldap.Entry) error {
+				page := convert(server, entries)
+				if err := add(i, page); err != nil {
+					return err
 				}
+				reportPage(baseDN, len(page))
+				return nil
+			})
+		}
+		if isSizeLimitExceeded(err) {
+			// keep what the server returned, with guidance, rather than failing the whole sync
+			err = nil
+			mu.Lock()
+			result.Truncated = true
+			result.Truncations = append(result.Truncations, newTruncation(baseDN, fetched, dse.pagingSupported(), config.SizeLimit))
+			mu.Unlock()
+		}
+		if err != nil {
+			page := 0
+			if dse.pagingSupported() {
+				page = progress.Pages + 1 // the page after the last one completed
 			}
-			result.Entries = append(result.Entries, &ent)
+			return searchError("search", l.addr, baseDN, page, err)
+		}
+		baseDNDone(baseDN, fetched, began)
+		return
+	})
+	for _, ents := range entries {
+		result.Entries = append(result.Entries, ents...) // those fetched so far, if the sync failed
+	}
+	if err != nil {
+		return
+	}
+
+	// the sync is complete, there is nothing to resume
+	for _, cp := range checkpoints {
+		if err = cp.clear(); err != nil {
+			return
+		}
+	}
+	if config.Incremental != "" {
+		result.SyncCookie = encodeSyncCookie(nextCookies)
+		if config.SyncCookie != "" {
+			result.Delta = &delta
 		}
 	}
 	return
 
 }
 
-// Authenticate against LDAP service. Successful authentication if AuthResult.Success = true
-func Auth(data LDAPAuthData) (auth AuthResult, err error) {
+// toEntries converts search result entries, skipping those whose DN has been seen.
+// As the entries outlive the page, they are allocated arena-style: the entries and attributes of the page each come
+// from a single slab, rather than an allocation per entry and attribute. The values are those go-ldap decoded
+func toEntries(entries []*ldap.Entry, seen map[string]bool, source Provenance) []*LDAPEntry {
+	attributes := 0
+	for _, entry := range entries {
+		attributes += len(entry.Attributes)
+	}
+	entrySlab := make([]LDAPEntry, len(entries))
+	attributeSlab := make([]LDAPAttribute, attributes)
 
-	dialURL := net.JoinHostPort(data.Server, data.Port)
-	var l *ldap.Conn
-	tlsConfig := &tls.Config{
-		InsecureSkipVerify: true, //TODO: support self-signed CAs
+	ents := make([]*LDAPEntry, 0, len(entries))
+	for i, entry := range entries {
+		key := dnKey(entry.DN)
+		if seen[key] {
+			continue //already fetched via an overlapping BaseDN
+		}
+		seen[key] = true
+		ent := &entrySlab[i]
+		ent.DN = entry.DN
+		ent.Source = source
+		ent.Attributes = attributeSlab[:len(entry.Attributes):len(entry.Attributes)]
+		attributeSlab = attributeSlab[len(entry.Attributes):]
+		for j, att := range entry.Attributes {
+			ent.Attributes[j] = LDAPAttribute{Name: att.Name, Values: att.Values, ByteValues: att.ByteValues}
+		}
+		ent.indexAttributes()
+		ents = append(ents, ent)
 	}
+	return ents
+}
 
-	if data.TLS == "tls" {
-		l, err = ldap.DialTLS("tcp", dialURL, tlsConfig)
-		if err != nil {
-			auth.ErrorMessage = err.Error()
+// pageSize returns the PageSize, or the default if not set
+func (conf LDAPSyncConfig) pageSize() uint32 {
+	if conf.PageSize == 0 {
+		return defaultSearchPageSize
+	}
+	return conf.PageSize
+}
+
+// timeLimitSeconds returns the TimeLimit in whole seconds, rounded up so short limits are not lost
+func (conf LDAPSyncConfig) timeLimitSeconds() int {
+	if conf.TimeLimit <= 0 {
+		return 0
+	}
+	return int((time.Duration(conf.TimeLimit) + time.Second - 1) / time.Second)
+}
+
+// syncAttributes returns the attributes the searches of the sync fetch: those needed with MembershipOnly, those also
+// needed with the SyncAttributes that are not excluded, or none for all attributes
+func (conf LDAPSyncConfig) syncAttributes() []string {
+	switch {
+	case conf.MembershipOnly:
+		return conf.membershipAttributes()
+	case len(conf.SyncAttributes) == 0:
+		return nil
+	}
+	skipped := conf.excludedAttributes()
+	attributes := conf.membershipAttributes()
+	for _, name := range attributes {
+		skipped[strings.ToLower(name)] = true
+	}
+	for _, name := range conf.SyncAttributes {
+		if key := strings.ToLower(name); !skipped[key] {
+			skipped[key] = true
+			attributes = append(attributes, name)
+		}
+	}
+	return attributes
+}
+
+// excludedAttributes returns the lower-cased ExcludeAttributes, other than those needed to filter and identify users
+// and groups, and to determine memberships, or incremental changes
+func (conf LDAPSyncConfig) excludedAttributes() map[string]bool {
+	excluded := make(map[string]bool, len(conf.ExcludeAttributes))
+	for _, name := range conf.ExcludeAttributes {
+		excluded[strings.ToLower(name)] = true
+	}
+	for _, name := range conf.membershipAttributes() {
+		delete(excluded, strings.ToLower(name))
+	}
+	if conf.Incremental != "" {
+		delete(excluded, "entryuuid") // identify the entries of incremental syncs
+		delete(excluded, "objectguid")
+	}
+	return excluded
+}
+
+// withoutAttributes removes the attributes, by their lower-cased names, from the entries
+func withoutAttributes(ents []*ldap.Entry, excluded map[string]bool) {
+	if len(excluded) == 0 {
+		return
+	}
+	for _, ent := range ents {
+		kept := ent.Attributes[:0]
+		for _, attribute := range ent.Attributes {
+			if !excluded[strings.ToLower(attribute.Name)] {
+				kept = append(kept, attribute)
+			}
+		}
+		ent.Attributes = kept
+	}
+}
+
+// membershipAttributes returns the attributes needed to filter and identify users and groups, and to determine
+// memberships
+func (conf LDAPSyncConfig) membershipAttributes() []string {
+	names := []string{"objectClass", "member", "memberOf", "objectSid"}
+	names = append(names, conf.UserFilter.attributes()...)
+	names = append(names, conf.GroupFilter.attributes()...)
+	names = append(names, conf.GroupMembership.attributes()...)
+	names = append(names, conf.entityAttributes()...)
+	names = append(names, conf.AttributeMapping.attributes()...)
+	if conf.OfflineCredentials != nil {
+		names = append(names, "userPassword")
+	}
+	if conf.Avatars != nil {
+		names = append(names, conf.Avatars.attributes()...)
+	}
+	for _, name := range []string{conf.UserIDAttribute, conf.GroupIDAttribute} {
+		if name != "" {
+			names = append(names, name)
+		}
+	}
+
+	attributes := names[:0]
+	seen := make(map[string]bool, len(names))
+	for _, name := range names {
+		if key := strings.ToLower(name); !seen[key] {
+			seen[key] = true
+			attributes = append(attributes, name)
+		}
+	}
+	return attributes
+}
+
+// withoutExcluded removes the entries in the subtrees of the ExcludeDNs
+func (conf LDAPSyncConfig) withoutExcluded(ents []*LDAPEntry) []*LDAPEntry {
+	kept := ents[:0]
+	for _, ent := range ents {
+		if !conf.excluded(ent.DN) {
+			kept = append(kept, ent)
+		}
+	}
+	return kept
+}
+
+// dnSet returns the set of the DN keys of the entries
+func dnSet(entries []*LDAPEntry) map[string]bool {
+	seen := make(map[string]bool, len(entries))
+	for _, ent := range entries {
+		seen[dnKey(ent.DN)] = true
+	}
+	return seen
+}
+
+// connect connects to the configured server, failing over to the other Servers in turn while they fail
+func connect(ctx context.Context, config LDAPSyncConfig) (l *conn, err error) {
+	for i, replica := range config.replicas() {
+		if i > 0 {
+			loggerOr(config.Logger).Warn("failing over", "server", replica.GetDialAddr(), "error", err)
+			recordReconnect(config.Metrics, replica.GetDialAddr(), "failover")
+		}
+		if l, err = connectServer(ctx, replica); !isFailover(err) || ctx.Err() != nil {
 			return
 		}
-	} else {
-		l, err = ldap.DialURL("ldap://" + dialURL)
+	}
+	return
+}
+
+// connectServer dials the Server and binds as the sync user if authentication is required
+func connectServer(ctx context.Context, config LDAPSyncConfig) (l *conn, err error) {
+	tlsConfig := &tls.Config{}
+	if config.TLS == "tls" || config.TLS == "starttls" {
+		if tlsConfig, err = config.TLSOptions.tlsConfig(config.Server); err != nil {
+			return nil, opError("tls", config.GetDialAddr(), err)
+		}
+	}
+
+	l, err = dial(ctx, config.GetDialAddr(), config, dialer(config.GetDialAddr(), config.TLS, tlsConfig))
+	if err != nil {
+		return nil, opError("dial", config.GetDialAddr(), err)
+	}
+
+	if config.RequiresAuthentication {
+		if err = l.bindSyncUser(config); err != nil {
+			l.Close()
+			return nil, opError("bind", l.addr, err)
+		}
+	}
+	return
+}
+
+// dialer returns a function dialing the address with the TLS option: none, tls or starttls. The dial and TLS
+// handshake are aborted once the context is done
+func dialer(addr, tlsOption string, tlsConfig *tls.Config) func(ctx context.Context) (*ldap.Conn, error) {
+	return func(ctx context.Context) (l *ldap.Conn, err error) {
+		var d net.Dialer
+		netConn, err := d.DialContext(ctx, "tcp", addr)
 		if err != nil {
-			auth.ErrorMessage = err.Error()
 			return
 		}
-		if data.TLS == "starttls" {
+		if ctx.Done() != nil {
+			// the connection is only watched by dial once established, so watch the handshakes here
+			established := make(chan struct{})
+			defer close(established)
+			go func() {
+				select {
+				case <-ctx.Done():
+					netConn.Close()
+				case <-established:
+				}
+			}()
+		}
+		defer func() {
+			if ctxErr := ctx.Err(); err != nil && ctxErr != nil {
+				err = ctxErr // the handshake was aborted by closing the connection
+			}
+		}()
+
+		if tlsOption == "tls" {
+			tlsConn := tls.Client(netConn, tlsConfig)
+			if err = tlsConn.HandshakeContext(ctx); err != nil {
+				netConn.Close()
+				return nil, opError("tls handshake", addr, err)
+			}
+			l = ldap.NewConn(tlsConn, true)
+			l.Start()
+			return
+		}
+		l = ldap.NewConn(netConn, false)
+		l.Start()
+		if tlsOption == "starttls" {
 			err = l.StartTLS(tlsConfig)
 			if err != nil {
-				auth.ErrorMessage = err.Error()
-				return
+				l.Close()
+				return nil, opError("starttls", addr, err)
 			}
 		}
+		return
 	}
+}
 
-	if err != nil {
-		auth.ErrorMessage = err.Error()
+// Authenticate against LDAP service. Successful authentication if AuthResult.Success = true. The user is bound as
+// UID=User,URDNs, with the User escaped as a DN value, so it can not name another entry, or as the entry the
+// UserSearchFilter finds
+func Auth(data LDAPAuthData) (auth AuthResult, err error) {
+	return AuthContext(context.Background(), data)
+}
+
+// AuthContext authenticates like Auth, until the context is done, in which case the context's error is returned
+func AuthContext(ctx context.Context, data LDAPAuthData) (auth AuthResult, err error) {
+
+	dialURL := net.JoinHostPort(data.Server, data.Port)
+	begin := time.Now()
+	var username string
+	defer func() {
+		recordAuth(data.Metrics, dialURL, begin, auth, err)
+		logAuth(data.Logger, dialURL, username, begin, auth, err)
+	}()
+
+	if data.SASL != nil && !data.SASL.authenticatesUsers() {
+		auth.ErrorMessage = fmt.Sprintf("the %s mechanism does not check the password of a user", data.SASL.Mechanism)
+		return
+	}
+	if !data.bindsByName() && data.UserSearchFilter == "" && !isAttributeDescription(data.UID) {
+		auth.ErrorMessage = fmt.Sprintf("invalid uid attribute %q", data.UID)
 		return
 	}
-	defer l.Close()
 
-	username := fmt.Sprintf("%s=%s,%s", data.UID, data.User, data.URDNs)
+	tlsConfig := &tls.Config{}
+	if data.TLS == "tls" || data.TLS == "starttls" {
+		if tlsConfig, err = data.TLSOptions.tlsConfig(data.Server); err != nil {
+			err = opError("tls", dialURL, err)
+			auth.ErrorMessage = err.Error()
+			return
+		}
+	}
 
-	err = l.Bind(username, data.Password)
-	if err != nil {
+	// the user is escaped, so it can not add RDNs, or otherwise change the DN the password is checked against
+	if !data.bindsByName() && data.UserSearchFilter == "" {
+		username = fmt.Sprintf("%s=%s,%s", data.UID, EscapeDNValue(data.User), data.URDNs)
+	}
+
+	// request the password policy control, for the password's expiry
+	controls := append(requestControls(data.ControlSpecs, data.Controls), ldap.NewControlBeheraPasswordPolicy())
+	var l *conn
+	var response []ldap.Control
+	var bindErr error
+	err = data.Retry.do(ctx, data.Metrics, data.Logger, dialURL, func() (err error) {
+		if l, err = dial(ctx, dialURL, LDAPSyncConfig{Metrics: data.Metrics, Logger: data.Logger}, dialer(dialURL, data.TLS, tlsConfig)); err != nil {
+			bindErr = nil
+			return opError("dial", dialURL, err)
+		}
+		if !data.bindsByName() && data.UserSearchFilter != "" {
+			if username, err = data.searchUser(l); err != nil {
+				l.Close()
+				bindErr = nil
+				return
+			}
+		}
+		switch {
+		case data.SASL != nil:
+			bindErr = l.saslBind(*data.SASL, data.Server, data.User, data.Password, controls)
+		case data.NTLM != nil:
+			bindErr = l.ntlmBind(data.NTLM.forUsers(), data.User, data.Password, controls)
+		default:
+			response, bindErr = l.bind(username, data.Password, controls)
+		}
+		if data.Retry.retryable(bindErr) {
+			l.Close()
+			return bindErr
+		}
+		return nil
+	})
+	if errors.Is(err, ErrUserNotFound) {
 		auth.ErrorMessage = err.Error()
+		return auth, nil // rejected like the credentials of a user that does not exist
+	}
+	if err != nil && bindErr == nil {
+		auth.ErrorMessage = err.Error()
+		return
+	}
+	defer l.Close()
+
+	auth.applyPasswordPolicy(response)
+	if err = bindErr; err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return auth, ctxErr // aborted rather than rejected
+		}
+		auth.ErrorMessage, auth.ResultCode = err.Error(), resultCode(err)
 		auth.Success = false
 		return auth, nil //failed authentication, do not propagate that error to the auth API
 	}
 
 	auth.Success = true
+	if data.bindsByName() {
+		username = l.boundDN()
+	}
+	if auth.PasswordExpiry == nil {
+		auth.PasswordExpiry = readPasswordExpiry(l, username)
+	}
+	if len(data.RequiredGroups) > 0 {
+		auth.authorize(data.RequiredGroups, data.RequireAllGroups, directMember(l, username))
+	}
+	if data.SecondFactor != nil && auth.Success {
+		user, readErr := readEntry(l, username, []string{"*"})
+		if readErr != nil {
+			user = NewLDAPEntry(username, nil)
+		}
+		auth.verifySecondFactor(ctx, data.SecondFactor, user, data.SecondFactorCode)
+	}
 
 	return
 
 }
+
+// bindsByName determines whether the User binds by their name, with SASL or NTLM, rather than a DN
+func (data LDAPAuthData) bindsByName() bool {
+	return data.SASL != nil || data.NTLM != nil
+}
+
+// searchUser returns the DN of the only entry under the URDNs matching the UserSearchFilter for the User, searched as
+// the SyncUserName if set. The DN is reported not found if no entry matches, or more than one does
+func (data LDAPAuthData) searchUser(l *conn) (dn string, err error) {
+	if data.SyncUserName != "" {
+		if _, err = l.bind(data.SyncUserName, data.SyncPassword, nil); err != nil {
+			return "", opError("bind", l.addr, err)
+		}
+	}
+	filter := strings.ReplaceAll(data.UserSearchFilter, "%s", EscapeFilterValue(data.User))
+	sr, err := l.Search(ldap.NewSearchRequest(data.URDNs, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 2, 0, false,
+		filter, []string{"1.1"}, nil))
+	if err != nil && !(isSizeLimitExceeded(err) && sr != nil) {
+		return "", searchError("search", l.addr, data.URDNs, 0, err)
+	}
+	switch len(sr.Entries) {
+	case 0:
+		return "", fmt.Errorf("no user matches %s: %w", filter, ErrUserNotFound)
+	case 1:
+		return sr.Entries[0].DN, nil
+	default:
+		return "", fmt.Errorf("more than one user matches %s: %w", filter, ErrUserNotFound)
+	}
+}
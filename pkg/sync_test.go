@@ -0,0 +1,30 @@
+package ldapsync_test
+
+import (
+	"testing"
+
+	ldapsync "github.com/adedayo/ldap-sync/pkg"
+)
+
+func TestSyncedAttributesHoldTheirValues(t *testing.T) {
+	_, config := fixture(t)
+	records, err := ldapsync.Do(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, ent := range records.Entries {
+		for _, att := range ent.Attributes {
+			if len(att.Values) == 0 || len(att.Values) != len(att.ByteValues) {
+				t.Errorf("%s of %s: values %q, raw values %q", att.Name, ent.DN, att.Values, att.ByteValues)
+			}
+			for i, v := range att.Values {
+				if string(att.ByteValues[i]) != v {
+					t.Errorf("%s of %s: value %q, raw value %q", att.Name, ent.DN, v, att.ByteValues[i])
+				}
+			}
+		}
+	}
+	if len(records.Entries) == 0 {
+		t.Error("no entries synced")
+	}
+}
@@ -0,0 +1,226 @@
+package ldapsync
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+// SyncGroup fetches one group and expands its members, without a full sync: large member attributes are read in
+// ranges (as Active Directory requires beyond 1500 values) and the members of nested groups are included. The
+// Members of the result are the users among the (transitive) members; references that are neither users nor
+// groups, e.g. missing entries, are ExternalMembers
+func SyncGroup(ctx context.Context, config LDAPSyncConfig, groupDN string) (Group, error) {
+	return NewClient(config).SyncGroup(ctx, groupDN)
+}
+
+// SyncGroup fetches one group with its expanded members, see SyncGroup
+func (c *Client) SyncGroup(ctx context.Context, groupDN string) (group Group, err error) {
+	l, config, _, err := c.open(ctx)
+	if err != nil {
+		return
+	}
+	defer l.Close()
+
+	root, err := readEntry(l, groupDN, append(config.groupAttributes(), groupMemberAttributes(config)...))
+	if err != nil {
+		return
+	}
+	group = Group{ID: entryID(root, config.GroupIDAttribute), DN: root.DN, Sources: root.sources()}
+	config.AttributeMapping.mapGroup(&group, root)
+
+	e := groupExpander{l: l, config: config, visited: map[string]bool{}, members: map[string]bool{}, external: map[string]bool{}}
+	if err = e.expand(root, 0); err != nil {
+		return
+	}
+	group.Members, group.ExternalMembers, group.UnexpandedGroups = e.memberDNs, e.externalRefs, e.unexpanded
+	return
+}
+
+// groupMemberAttributes returns the group attributes that refer to members: those of the GroupMembership
+// constraints, or else member, uniqueMember and memberUid
+func groupMemberAttributes(config LDAPSyncConfig) (attributes []string) {
+	for _, c := range config.GroupMembership.constraints() {
+		if !strings.EqualFold(c.GroupAttribute, "dn") {
+			attributes = append(attributes, c.GroupAttribute)
+		}
+	}
+	if len(attributes) == 0 {
+		attributes = []string{"member", "uniqueMember", "memberUid"}
+	}
+	return
+}
+
+// groupExpander expands the members of groups, recursively
+type groupExpander struct {
+	l                       *conn
+	config                  LDAPSyncConfig
+	visited                 map[string]bool // groups expanded, to break membership cycles
+	members, external       map[string]bool
+	memberDNs, externalRefs []string
+	unexpanded              []string // nested groups beyond the nesting limit
+}
+
+// expand adds the members of the group, nested at the depth (zero for the group being synced)
+func (e *groupExpander) expand(group *LDAPEntry, depth int) error {
+	e.visited[normalizeDN(group.DN)] = true
+	for _, attribute := range groupMemberAttributes(e.config) {
+		values, err := readRangedValues(e.l, group, attribute)
+		if err != nil {
+			return err
+		}
+		if strings.EqualFold(attribute, "memberUid") {
+			if err = e.addUIDs(values); err != nil {
+				return err
+			}
+			continue
+		}
+		for _, dn := range values {
+			if err = e.addDN(dn, depth); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// addDN classifies the member with the DN, of a group at the depth, as a user, a nested group (which is expanded
+// within the nesting limit) or an external reference
+func (e *groupExpander) addDN(dn string, depth int) error {
+	key := normalizeDN(dn)
+	if e.visited[key] || e.members[key] || e.external[key] {
+		return nil
+	}
+	attributes := append([]string{"objectClass"}, e.config.UserFilter.attributes()...)
+	attributes = append(attributes, e.config.groupAttributes()...)
+	attributes = append(attributes, groupMemberAttributes(e.config)...)
+	member, err := readEntry(e.l, dn, attributes)
+	switch {
+	case isResultCode(err, ldap.LDAPResultNoSuchObject):
+		e.addExternal(dn)
+		return nil
+	case err != nil:
+		return err
+	case e.isGroup(member):
+		if depth+1 > e.config.maxGroupNesting() {
+			e.visited[key] = true
+			e.unexpanded = append(e.unexpanded, member.DN)
+			return nil
+		}
+		return e.expand(member, depth+1)
+	case e.config.UserFilter.isEmpty() || len(matching([]*LDAPEntry{member}, e.config.UserFilter, e.config.ValuePreparation)) > 0:
+		e.members[key] = true
+		e.memberDNs = append(e.memberDNs, member.DN)
+	default:
+		e.addExternal(dn)
+	}
+	return nil
+}
+
+// addUIDs adds the users with the uids, e.g. of posixGroup memberUid values
+func (e *groupExpander) addUIDs(uids []string) error {
+	idAttribute := e.config.UserIDAttribute
+	if idAttribute == "" {
+		idAttribute = "uid"
+	}
+	for _, uid := range uids {
+		users, err := searchBaseDNs(e.l, e.config, fmt.Sprintf("(%s=%s)", idAttribute, EscapeFilterValue(uid)),
+			append([]string{idAttribute}, e.config.UserFilter.attributes()...))
+		if err != nil {
+			return err
+		}
+		users = matching(users, e.config.UserFilter, e.config.ValuePreparation)
+		if len(users) == 0 {
+			e.addExternal(uid)
+		}
+		for _, u := range users {
+			if key := normalizeDN(u.DN); !e.members[key] {
+				e.members[key] = true
+				e.memberDNs = append(e.memberDNs, u.DN)
+			}
+		}
+	}
+	return nil
+}
+
+func (e *groupExpander) addExternal(ref string) {
+	if key := normalizeDN(ref); !e.external[key] {
+		e.external[key] = true
+		e.externalRefs = append(e.externalRefs, ref)
+	}
+}
+
+// isGroup determines whether the entry is a group: one matching the GroupFilter if configured, otherwise one of
+// a conventional group object class
+func (e *groupExpander) isGroup(ent *LDAPEntry) bool {
+	if !e.config.GroupFilter.isEmpty() {
+		return len(matching([]*LDAPEntry{ent}, e.config.GroupFilter, e.config.ValuePreparation)) > 0
+	}
+	_, classes := ent.GetAttribute("objectClass")
+	for _, class := range classes {
+		switch strings.ToLower(class) {
+		case "group", "groupofnames", "groupofuniquenames", "posixgroup", "groupofentries":
+			return true
+		}
+	}
+	return false
+}
+
+// readRangedValues returns all the values of the attribute of the entry, reading any further ranges of values
+// from the server when it returned a range, e.g. member;range=0-1499, rather than all values
+func readRangedValues(l *conn, ent *LDAPEntry, attribute string) ([]string, error) {
+	if exists, values := ent.GetAttribute(attribute); exists {
+		return values, nil
+	}
+	var values []string
+	for {
+		att, end, ranged := rangedAttribute(ent, attribute)
+		if !ranged {
+			return values, nil
+		}
+		values = append(values, att.StringValues()...)
+		if end == "*" {
+			return values, nil
+		}
+		last, err := strconv.Atoi(end)
+		if err != nil {
+			return nil, fmt.Errorf("invalid range %s of %s", att.Name, ent.DN)
+		}
+		if ent, err = readEntry(l, ent.DN, []string{fmt.Sprintf("%s;range=%d-*", attribute, last+1)}); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// rangedAttribute returns the attribute holding a range of the values of the attribute, e.g. member;range=0-1499,
+// and the end of the range, * for the last
+func rangedAttribute(ent *LDAPEntry, attribute string) (att LDAPAttribute, end string, ok bool) {
+	prefix := strings.ToLower(attribute) + ";range="
+	for _, att := range ent.Attributes {
+		if name := strings.ToLower(att.Name); strings.HasPrefix(name, prefix) {
+			bounds := name[len(prefix):]
+			if i := strings.Index(bounds, "-"); i > 0 {
+				return att, bounds[i+1:], true
+			}
+		}
+	}
+	return
+}
+
+// the default MaxGroupNesting
+const defaultMaxGroupNesting = 32
+
+// maxGroupNesting returns the depth of nested groups to expand, zero if nesting is disabled
+func (conf LDAPSyncConfig) maxGroupNesting() int {
+	switch {
+	case conf.MaxGroupNesting == 0:
+		return defaultMaxGroupNesting
+	case conf.MaxGroupNesting < 0:
+		return 0
+	default:
+		return conf.MaxGroupNesting
+	}
+}
@@ -0,0 +1,100 @@
+package ldapsync
+
+import (
+	"strings"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+// syncRepl runs the RFC 4533 refreshOnly content synchronization of the search from the cookie, nil for the whole
+// content, handing the entries added or modified to the callback, a batch at a time. Returns the deletions and the
+// cookie to resume from next time, and whether the unchanged entries were listed rather than the deleted ones
+func (c *conn) syncRepl(searchRequest *ldap.SearchRequest, cookie []byte, changed func([]*ldap.Entry) error) (delta SyncDelta, present bool, next []byte, err error) {
+	const batchSize = 100
+	err = c.do(Operation{Name: "syncrepl", Server: c.addr, BaseDN: searchRequest.BaseDN}, func() error {
+		response := c.Conn.Syncrepl(c.ctx, searchRequest, batchSize, ldap.SyncRequestModeRefreshOnly, cookie, false)
+		var batch []*ldap.Entry
+		for response.Next() {
+			if entry := response.Entry(); entry != nil {
+				state, _ := ldap.FindControl(response.Controls(), ldap.ControlTypeSyncState).(*ldap.ControlSyncState)
+				if state == nil {
+					batch = append(batch, entry) // not synchronized content, e.g. of a server ignoring the control
+					continue
+				}
+				if len(state.Cookie) > 0 {
+					next = state.Cookie
+				}
+				switch state.State {
+				case ldap.SyncStateDelete:
+					delta.Deleted = append(delta.Deleted, entry.DN)
+				case ldap.SyncStatePresent:
+					delta.Unchanged = append(delta.Unchanged, entry.DN)
+				default:
+					batch = append(batch, entry)
+				}
+				if len(batch) >= batchSize {
+					if err := changed(batch); err != nil {
+						return err
+					}
+					batch = nil
+				}
+				continue
+			}
+			for _, control := range response.Controls() {
+				switch ctrl := control.(type) {
+				case *ldap.ControlSyncInfo:
+					next = delta.applySyncInfo(ctrl, next, &present)
+				case *ldap.ControlSyncDone:
+					if len(ctrl.Cookie) > 0 {
+						next = ctrl.Cookie
+					}
+					// without refreshDeletes, the unchanged entries were listed rather than the deleted ones
+					present = present || !ctrl.RefreshDeletes
+				}
+			}
+		}
+		if err := response.Err(); err != nil {
+			return err
+		}
+		if err := c.ctx.Err(); err != nil {
+			return err // the search was abandoned
+		}
+		if len(batch) > 0 {
+			return changed(batch)
+		}
+		return nil
+	})
+	if len(cookie) == 0 {
+		// a refresh from scratch has no previous content to delete from
+		present, delta.Unchanged, delta.UnchangedUUIDs = false, nil, nil
+	}
+	return
+}
+
+// applySyncInfo records the entries of the Sync Info message, and whether it starts a present phase, returning its
+// cookie or, if it has none, the cookie
+func (delta *SyncDelta) applySyncInfo(info *ldap.ControlSyncInfo, cookie []byte, present *bool) []byte {
+	var next []byte
+	switch {
+	case info.NewCookie != nil:
+		next = info.NewCookie.Cookie
+	case info.RefreshDelete != nil:
+		next = info.RefreshDelete.Cookie
+	case info.RefreshPresent != nil:
+		next = info.RefreshPresent.Cookie
+		*present = true
+	case info.SyncIdSet != nil:
+		next = info.SyncIdSet.Cookie
+		for _, id := range info.SyncIdSet.SyncUUIDs {
+			if info.SyncIdSet.RefreshDeletes {
+				delta.DeletedUUIDs = append(delta.DeletedUUIDs, strings.ToLower(id.String()))
+			} else {
+				delta.UnchangedUUIDs = append(delta.UnchangedUUIDs, strings.ToLower(id.String()))
+			}
+		}
+	}
+	if len(next) > 0 {
+		return next
+	}
+	return cookie
+}
@@ -0,0 +1,129 @@
+package ldapsync
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+// SyncUser fetches one user, identified by DN or by the value of the UserIDAttribute, and resolves their groups
+// live from the server (see ResolveUserGroups), without a full sync. The result holds the single user, their groups
+// and memberships and, if a RoleMapping is configured, their roles
+func SyncUser(ctx context.Context, config LDAPSyncConfig, identifier string) (UsersAndGroups, error) {
+	return NewClient(config).SyncUser(ctx, identifier)
+}
+
+// SyncUser fetches one user with their groups, see SyncUser
+func (c *Client) SyncUser(ctx context.Context, identifier string) (ug UsersAndGroups, err error) {
+	ug, _, err = c.syncUser(ctx, identifier)
+	return
+}
+
+// syncUser fetches one user with their groups like SyncUser, also returning their entry
+func (c *Client) syncUser(ctx context.Context, identifier string) (ug UsersAndGroups, user *LDAPEntry, err error) {
+	l, config, vendor, err := c.open(ctx)
+	if err != nil {
+		return
+	}
+	defer l.Close()
+
+	attributes := append([]string{"*"}, userGroupAttributes(config, vendor)...)
+	if user, err = findUser(l, config, identifier, attributes); err != nil {
+		return
+	}
+	groups, err := resolveUserGroups(l, config, user)
+	if err != nil {
+		return
+	}
+
+	return userAndGroups(config, user, groups), user, nil
+}
+
+// userAndGroups returns the user with their groups, memberships and, if a RoleMapping is configured, roles
+func userAndGroups(config LDAPSyncConfig, user *LDAPEntry, groups []Group) (ug UsersAndGroups) {
+	ug.Users = []User{{
+		ID:      entryID(user, config.UserIDAttribute),
+		DN:      user.DN,
+		Sources: user.sources(),
+		SID:     entrySID(user),
+	}}
+	config.AttributeMapping.mapUser(&ug.Users[0], user)
+	for _, g := range groups {
+		g.Members = []string{user.DN}
+		ug.Groups = append(ug.Groups, g)
+		var source Provenance
+		if len(g.Sources) > 0 {
+			source = g.Sources[0]
+		}
+		ug.Memberships = append(ug.Memberships, Membership{UserDN: user.DN, GroupDN: g.DN, Source: source})
+	}
+	if len(config.RoleMapping.Rules) > 0 || config.RoleMapping.DefaultRole != "" {
+		ug.Roles = config.RoleMapping.Map(ug)
+	}
+	return
+}
+
+// findUser reads the user with the DN, or searches the BaseDNs for the user with the ID (the value of the
+// UserIDAttribute, uid if not configured). The user must be under the BaseDNs, not excluded by the ExcludeDNs, and
+// match the UserFilter, if any
+func findUser(l *conn, config LDAPSyncConfig, identifier string, attributes []string) (user *LDAPEntry, err error) {
+	if dn, dnErr := ldap.ParseDN(identifier); dnErr == nil && len(dn.RDNs) > 0 {
+		if !config.inScope(identifier) || config.excluded(identifier) {
+			return nil, fmt.Errorf("%s is not under the baseDNs, or is excluded: %w", identifier, ErrUserNotFound)
+		}
+		if user, err = readEntry(l, identifier, attributes); err != nil {
+			return
+		}
+	} else {
+		idAttribute := config.UserIDAttribute
+		if idAttribute == "" {
+			idAttribute = "uid"
+		}
+		filter := fmt.Sprintf("(%s=%s)", idAttribute, EscapeFilterValue(identifier))
+		var users []*LDAPEntry
+		if users, err = searchBaseDNs(l, config, filter, attributes); err != nil {
+			return
+		}
+		users = matching(users, config.UserFilter, config.ValuePreparation)
+		inScope := users[:0]
+		for _, u := range users {
+			if !config.excluded(u.DN) {
+				inScope = append(inScope, u)
+			}
+		}
+		users = inScope
+		switch len(users) {
+		case 0:
+			return nil, fmt.Errorf("no user with %s %s: %w", idAttribute, identifier, ErrUserNotFound)
+		case 1:
+			return users[0], nil
+		default:
+			dns := make([]string, len(users))
+			for i, u := range users {
+				dns[i] = u.DN
+			}
+			return nil, fmt.Errorf("%d users with %s %s: %s", len(users), idAttribute, identifier, strings.Join(dns, "; "))
+		}
+	}
+	if len(matching([]*LDAPEntry{user}, config.UserFilter, config.ValuePreparation)) == 0 {
+		return nil, fmt.Errorf("%s does not match the user filter: %w", identifier, ErrUserNotFound)
+	}
+	return
+}
+
+// matching returns the entries matching the filter, all of them if it is empty
+func matching(entries []*LDAPEntry, filter LDAPFilter, prep ValuePreparation) []*LDAPEntry {
+	if filter.isEmpty() {
+		return entries
+	}
+	cmp := comparator{prep: prep}
+	var matched []*LDAPEntry
+	for _, ent := range entries {
+		if filter.matches(ent, cmp) {
+			matched = append(matched, ent)
+		}
+	}
+	return matched
+}
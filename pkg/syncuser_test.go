@@ -0,0 +1,31 @@
+package ldapsync_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	ldapsync "github.com/adedayo/ldap-sync/pkg"
+)
+
+func TestSyncUserOnlyFindsUsersInScope(t *testing.T) {
+	_, config := fixture(t)
+	client := ldapsync.NewClient(config)
+	for identifier, found := range map[string]bool{
+		"uid=alice,ou=people,dc=example,dc=com":           true,
+		"alice":                                           true,
+		"uid=carol,ou=other,dc=example,dc=com":            false, // outside the BaseDNs
+		"uid=bob,ou=disabled,ou=people,dc=example,dc=com": false, // excluded
+		"bob": false,
+	} {
+		ug, err := client.SyncUser(context.Background(), identifier)
+		switch {
+		case found && err != nil:
+			t.Errorf("%s: %v", identifier, err)
+		case found && (len(ug.Users) != 1 || ug.Users[0].ID != "alice"):
+			t.Errorf("%s: found %+v, want alice", identifier, ug.Users)
+		case !found && !errors.Is(err, ldapsync.ErrUserNotFound):
+			t.Errorf("%s: found %+v with error %v, want ErrUserNotFound", identifier, ug.Users, err)
+		}
+	}
+}
@@ -0,0 +1,198 @@
+package ldapsync
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// TeamPlatform manages the membership of the teams of a code hosting platform, e.g. the teams of a GitHub
+// organization (GitHubTeams) or GitLab groups (GitLabGroups). Users are identified by their login
+type TeamPlatform interface {
+	TeamMembers(ctx context.Context, team string) ([]string, error)
+	AddTeamMember(ctx context.Context, team, login string) error
+	RemoveTeamMember(ctx context.Context, team, login string) error
+}
+
+// TeamSink is a Sink mirroring the members of LDAP groups in the teams of a TeamPlatform. On each sync, it
+// reconciles the members of every mapped team with the users of its group in the current result, adding the
+// missing ones and removing the others, so changes made on the platform are reverted too. Teams are reconciled in
+// full, so the sink should not be wrapped in a BatchingSink. Members are only added on an Incomplete sync, whose
+// groups may be missing some of their users
+type TeamSink struct {
+	Platform TeamPlatform
+	// teams by group (DN or ID), e.g. "cn=developers,ou=groups,dc=example,dc=com": "developers"
+	Teams map[string]string
+	// returns the platform login of the user, if they have one, their ID if nil
+	Login func(User) (string, bool)
+	// only report the changes to OnChange rather than making them
+	DryRun bool
+	// called with each membership change, made or, if DryRun, planned
+	OnChange func(team, login string, added bool)
+}
+
+func NewTeamSink(platform TeamPlatform, teams map[string]string) *TeamSink {
+	return &TeamSink{Platform: platform, Teams: teams}
+}
+
+// Apply reconciles the teams with the current groups. It carries on past the failures of teams and changes,
+// returning an error counting them
+func (s *TeamSink) Apply(ctx context.Context, changes ChangeSet, current UsersAndGroups) error {
+	users := make(map[string]User, len(current.Users))
+	for _, u := range current.Users {
+		users[normalizeDN(u.DN)] = u
+	}
+	groups := make([]string, 0, len(s.Teams))
+	for group := range s.Teams {
+		groups = append(groups, group)
+	}
+	sort.Strings(groups)
+
+	var failures []error
+	for _, group := range groups {
+		g, found := findGroup(current.Groups, group)
+		if !found {
+			// the group may be filtered out, or failed to sync: leave the team be rather than empty it
+			failures = append(failures, fmt.Errorf("team %s: group %s is not among the synced groups", s.Teams[group], group))
+			continue
+		}
+		desired := make(map[string]bool)
+		for _, member := range g.Members {
+			if u, synced := users[normalizeDN(member)]; synced {
+				if login, ok := s.login(u); ok {
+					desired[strings.ToLower(login)] = true
+				}
+			}
+		}
+		failures = append(failures, s.reconcile(ctx, s.Teams[group], desired, !current.Incomplete)...)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+	}
+	if len(failures) > 0 {
+		return fmt.Errorf("reconciling teams: %d failures, the first: %w", len(failures), failures[0])
+	}
+	return nil
+}
+
+// reconcile makes the logins the members of the team, removing the other members if remove is set
+func (s *TeamSink) reconcile(ctx context.Context, team string, desired map[string]bool, remove bool) (failures []error) {
+	members, err := s.Platform.TeamMembers(ctx, team)
+	if err != nil {
+		return []error{fmt.Errorf("team %s: %w", team, err)}
+	}
+	actual := make(map[string]bool, len(members))
+	for _, login := range members {
+		login = strings.ToLower(login) // logins are case-insensitive on both platforms
+		actual[login] = true
+		if !desired[login] && remove {
+			s.change(team, login, false)
+			if !s.DryRun {
+				if err := s.Platform.RemoveTeamMember(ctx, team, login); err != nil {
+					failures = append(failures, fmt.Errorf("team %s: removing %s: %w", team, login, err))
+				}
+			}
+		}
+	}
+	logins := make([]string, 0, len(desired))
+	for login := range desired {
+		if !actual[login] {
+			logins = append(logins, login)
+		}
+	}
+	sort.Strings(logins)
+	for _, login := range logins {
+		s.change(team, login, true)
+		if !s.DryRun {
+			if err := s.Platform.AddTeamMember(ctx, team, login); err != nil {
+				failures = append(failures, fmt.Errorf("team %s: adding %s: %w", team, login, err))
+			}
+		}
+	}
+	return
+}
+
+func (s *TeamSink) login(u User) (string, bool) {
+	if s.Login != nil {
+		return s.Login(u)
+	}
+	return u.ID, u.ID != ""
+}
+
+func (s *TeamSink) change(team, login string, added bool) {
+	if s.OnChange != nil {
+		s.OnChange(team, login, added)
+	}
+}
+
+// findGroup returns the group with the DN or ID
+func findGroup(groups []Group, group string) (Group, bool) {
+	for _, g := range groups {
+		if strings.EqualFold(g.ID, group) || normalizeDN(g.DN) == normalizeDN(group) {
+			return g, true
+		}
+	}
+	return Group{}, false
+}
+
+// platformRequest sends a request with the JSON of the body, if any, to the API of a TeamPlatform, decoding the JSON
+// of the response into out, if set. Responses other than 2xx are errors, with the status and message of the API
+func platformRequest(ctx context.Context, client *http.Client, method, url string, header http.Header, body, out interface{}) error {
+	var content io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		content = bytes.NewReader(data)
+	}
+	request, err := http.NewRequestWithContext(ctx, method, url, content)
+	if err != nil {
+		return err
+	}
+	for key, values := range header {
+		request.Header[key] = values
+	}
+	if body != nil {
+		request.Header.Set("Content-Type", "application/json")
+	}
+	if client == nil {
+		client = http.DefaultClient
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode/100 != 2 {
+		message, _ := io.ReadAll(io.LimitReader(response.Body, 512))
+		return &platformError{request: method + " " + url, status: response.Status, code: response.StatusCode,
+			message: string(bytes.TrimSpace(message))}
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(response.Body).Decode(out)
+}
+
+// platformError is the error response of the API of a TeamPlatform
+type platformError struct {
+	request, status, message string
+	code                     int
+}
+
+func (e *platformError) Error() string {
+	return fmt.Sprintf("%s: %s: %s", e.request, e.status, e.message)
+}
+
+// isStatus determines whether the error is an error response of the API with the status code
+func isStatus(err error, code int) bool {
+	var pe *platformError
+	return errors.As(err, &pe) && pe.code == code
+}
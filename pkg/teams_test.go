@@ -0,0 +1,59 @@
+package ldapsync_test
+
+import (
+	"context"
+	"testing"
+
+	ldapsync "github.com/adedayo/ldap-sync/pkg"
+)
+
+func TestTruncatedRecordsAreIncomplete(t *testing.T) {
+	_, config := fixture(t)
+	config.SizeLimit = 1
+	records, err := ldapsync.Do(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !records.Truncated || !records.GetUsersAndGroups().Incomplete {
+		t.Errorf("truncated %v, incomplete %v, want both", records.Truncated, records.GetUsersAndGroups().Incomplete)
+	}
+}
+
+// teamPlatform is a TeamPlatform of teams in memory
+type teamPlatform map[string]map[string]bool
+
+func (p teamPlatform) TeamMembers(ctx context.Context, team string) (logins []string, err error) {
+	for login := range p[team] {
+		logins = append(logins, login)
+	}
+	return
+}
+
+func (p teamPlatform) AddTeamMember(ctx context.Context, team, login string) error {
+	p[team][login] = true
+	return nil
+}
+
+func (p teamPlatform) RemoveTeamMember(ctx context.Context, team, login string) error {
+	delete(p[team], login)
+	return nil
+}
+
+func TestTeamSinkOnlyAddsMembersOfIncompleteSyncs(t *testing.T) {
+	group := "cn=staff,ou=people,dc=example,dc=com"
+	current := ldapsync.UsersAndGroups{
+		Users:  []ldapsync.User{{ID: "alice", DN: "uid=alice,ou=people,dc=example,dc=com"}},
+		Groups: []ldapsync.Group{{ID: "staff", DN: group, Members: []string{"uid=alice,ou=people,dc=example,dc=com"}}},
+	}
+	for _, incomplete := range []bool{true, false} {
+		platform := teamPlatform{"staff": {"dave": true}}
+		current.Incomplete = incomplete
+		sink := ldapsync.NewTeamSink(platform, map[string]string{group: "staff"})
+		if err := sink.Apply(context.Background(), ldapsync.ChangeSet{}, current); err != nil {
+			t.Fatal(err)
+		}
+		if !platform["staff"]["alice"] || platform["staff"]["dave"] != incomplete {
+			t.Errorf("incomplete %v: team members %v", incomplete, platform["staff"])
+		}
+	}
+}
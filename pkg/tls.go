@@ -0,0 +1,104 @@
+package ldapsync
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// TLSOptions configures the verification of the server's certificate with the tls and starttls options. By default
+// the certificate must be issued by a CA trusted by the system, or by those of the CACertFile and CACert if set, for
+// the server's host name. The client authenticates with a certificate of its own, for mutual TLS, if one is set
+type TLSOptions struct {
+	CACertFile string `json:"caCertFile"` // PEM bundle of the CAs trusted to issue the server's certificate
+	CACert     string `json:"caCert"`     // PEM of the trusted CAs, e.g. from a secret, along with those of the CACertFile
+	// name the certificate must be issued for, if not the server's host name, e.g. when dialling an IP address
+	ServerName string `json:"serverName"`
+	// verify the certificate chain, but not the name the certificate was issued for
+	SkipHostnameVerify bool `json:"skipHostnameVerify"`
+	// accept any certificate, leaving the connection open to man-in-the-middle attacks: for testing only
+	InsecureSkipVerify bool `json:"insecureSkipVerify"`
+
+	// PEM certificate (with any intermediates) and key the client authenticates with, e.g. for SASL EXTERNAL binds,
+	// from files or, e.g. from a secret, inline
+	ClientCertFile string `json:"clientCertFile"`
+	ClientKeyFile  string `json:"clientKeyFile"`
+	ClientCert     string `json:"clientCert"`
+	ClientKey      string `json:"clientKey"`
+}
+
+// tlsConfig returns the TLS configuration verifying the certificate of the server with the host name
+func (o TLSOptions) tlsConfig(host string) (*tls.Config, error) {
+	config := &tls.Config{ServerName: o.ServerName, InsecureSkipVerify: o.InsecureSkipVerify}
+	if config.ServerName == "" {
+		config.ServerName = host
+	}
+	if o.CACertFile != "" || o.CACert != "" {
+		config.RootCAs = x509.NewCertPool()
+		if o.CACertFile != "" {
+			pem, err := os.ReadFile(o.CACertFile)
+			if err != nil {
+				return nil, fmt.Errorf("reading the CA certificates: %w", err)
+			}
+			if !config.RootCAs.AppendCertsFromPEM(pem) {
+				return nil, fmt.Errorf("no CA certificates in %s", o.CACertFile)
+			}
+		}
+		if o.CACert != "" && !config.RootCAs.AppendCertsFromPEM([]byte(o.CACert)) {
+			return nil, errors.New("no CA certificates in the caCert")
+		}
+	}
+	var err error
+	if config.Certificates, err = o.clientCertificates(); err != nil {
+		return nil, err
+	}
+	if o.SkipHostnameVerify && !o.InsecureSkipVerify {
+		// the standard verification, which can not leave the name out, is replaced by one of the chain alone
+		config.InsecureSkipVerify = true
+		roots := config.RootCAs
+		config.VerifyConnection = func(state tls.ConnectionState) error {
+			if len(state.PeerCertificates) == 0 {
+				return errors.New("the server presented no certificate")
+			}
+			intermediates := x509.NewCertPool()
+			for _, cert := range state.PeerCertificates[1:] {
+				intermediates.AddCert(cert)
+			}
+			_, err := state.PeerCertificates[0].Verify(x509.VerifyOptions{Roots: roots, Intermediates: intermediates})
+			return err
+		}
+	}
+	return config, nil
+}
+
+// clientCertificates returns the certificate the client authenticates with, if any. The files are read for each
+// connection, so renewed certificates are picked up
+func (o TLSOptions) clientCertificates() ([]tls.Certificate, error) {
+	certPEM, keyPEM := []byte(o.ClientCert), []byte(o.ClientKey)
+	var err error
+	if o.ClientCertFile != "" {
+		if certPEM, err = os.ReadFile(o.ClientCertFile); err != nil {
+			return nil, fmt.Errorf("reading the client certificate: %w", err)
+		}
+	}
+	if o.ClientKeyFile != "" {
+		if keyPEM, err = os.ReadFile(o.ClientKeyFile); err != nil {
+			return nil, fmt.Errorf("reading the client key: %w", err)
+		}
+	}
+	if len(certPEM) == 0 && len(keyPEM) == 0 {
+		return nil, nil
+	}
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return nil, fmt.Errorf("client certificate: %w", err)
+	}
+	return []tls.Certificate{cert}, nil
+}
+
+// hasClientCertificate determines whether a client certificate is set
+func (o TLSOptions) hasClientCertificate() bool {
+	return o.ClientCertFile != "" || o.ClientCert != ""
+}
@@ -0,0 +1,36 @@
+package ldapsync
+
+import (
+	"fmt"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+// Truncation records a BaseDN whose results the server cut short at its size limit
+type Truncation struct {
+	BaseDN   string
+	Entries  int    // the number of entries of the BaseDN synced before the limit was reached
+	Guidance string // how the limit may be lifted
+}
+
+// isSizeLimitExceeded determines whether the server truncated the results of a search at its size limit
+func isSizeLimitExceeded(err error) bool {
+	return isResultCode(err, ldap.LDAPResultSizeLimitExceeded)
+}
+
+// newTruncation describes the truncation of the results of the BaseDN, guided by whether they were paged and the
+// SizeLimit of the sync
+func newTruncation(baseDN string, entries int, paged bool, sizeLimit int) Truncation {
+	guidance := "the server does not support paging, so a single search returns at most its size limit of entries: " +
+		"raise the size limit for the sync user (e.g. olcSizeLimit on OpenLDAP), or split the BaseDN into smaller subtrees"
+	if paged {
+		guidance = "the server limits the total number of entries a paged search returns: raise the limit for the sync user " +
+			"(e.g. the unchecked size.prtotal limit on OpenLDAP, MaxResultSetSize on Active Directory), " +
+			"or split the BaseDN into smaller subtrees"
+	}
+	if sizeLimit > 0 {
+		guidance = fmt.Sprintf("the search reached the sizeLimit of %d entries of the configuration, unless the server's "+
+			"own limit is lower: raise the sizeLimit, or split the BaseDN into smaller subtrees", sizeLimit)
+	}
+	return Truncation{BaseDN: baseDN, Entries: entries, Guidance: guidance}
+}
@@ -0,0 +1,135 @@
+package ldapsync
+
+import (
+	"fmt"
+	"strings"
+)
+
+// MembershipWarningReason explains why a group member reference could not be resolved to a synced user
+type MembershipWarningReason string
+
+const (
+	// the reference does not correspond to any synced entry, e.g. a stale DN of a deleted user
+	UnknownMember MembershipWarningReason = "unknown member"
+	// the reference is a DN that lies outside all the configured BaseDNs
+	OutOfScopeMember MembershipWarningReason = "outside BaseDNs"
+	// the reference is a synced entry that the UserFilter does not classify as a user
+	UnmatchedMember MembershipWarningReason = "not matched by UserFilter"
+	// the reference does not correspond to any synced entry, and the server applied the filters of the sync, so it may
+	// be an entry they do not match as well as an unknown one: see ClientSideFilters
+	FilteredMember MembershipWarningReason = "unknown member, or not matched by the filters the server applied"
+)
+
+// MembershipWarning is a group member reference that does not correspond to any synced user.
+// These often indicate a UserFilter or BaseDN misconfiguration
+type MembershipWarning struct {
+	GroupDN   string                  `json:"groupDN"`
+	Attribute string                  `json:"attribute"` // the group attribute holding the reference, e.g. member
+	Value     string                  `json:"value"`     // the unresolved reference
+	Reason    MembershipWarningReason `json:"reason"`
+}
+
+func (w MembershipWarning) String() string {
+	return fmt.Sprintf("group %s: %s value %q %s", w.GroupDN, w.Attribute, w.Value, w.Reason)
+}
+
+// ValidateMembership checks the referential integrity of group membership, reporting every value of
+// a group's membership attribute (as per the GroupMembership constraints) that no synced user carries.
+// References to other synced groups (nested groups) are not reported. Unless the sync fetched the entries with
+// ClientSideFilters, those the filters do not match are not told from unknown ones
+func (sr *LDAPRecords) ValidateMembership() (warnings []MembershipWarning) {
+	groupDNs := make(map[string]bool)
+	for _, g := range sr.GetGroups() {
+		groupDNs[normalizeDN(g.DN)] = true
+	}
+	entryDNs := make(map[string]bool, len(sr.Entries))
+	for _, e := range sr.Entries {
+		entryDNs[normalizeDN(e.DN)] = true
+	}
+
+	unresolved := sr.unresolvedReferences()
+	for _, g := range sr.GetGroups() {
+		for _, ref := range unresolved[g.DN] {
+			if groupDNs[normalizeDN(ref.value)] {
+				continue
+			}
+			if _, foreign := ForeignPrincipalSID(ref.value); foreign && sr.config.ForeignPrincipals == ExcludeForeignPrincipals {
+				continue
+			}
+			reason := UnknownMember
+			if entryDNs[normalizeDN(ref.value)] {
+				reason = UnmatchedMember
+			} else if ref.isDN && !sr.config.inScope(ref.value) {
+				reason = OutOfScopeMember
+			} else if sr.serverFiltered {
+				reason = FilteredMember
+			}
+			warnings = append(warnings, MembershipWarning{
+				GroupDN:   g.DN,
+				Attribute: ref.attribute,
+				Value:     ref.value,
+				Reason:    reason,
+			})
+		}
+	}
+	return
+}
+
+// memberReference is a value of a group's membership attribute
+type memberReference struct {
+	attribute, value string
+	isDN             bool // whether the value is expected to be the DN of a user
+}
+
+// unresolvedReferences returns, keyed by group DN, the values of each group's membership attributes
+// (as per the GroupMembership constraints) that do not correspond to any synced user
+func (sr *LDAPRecords) unresolvedReferences() map[string][]memberReference {
+	users := sr.GetUsers()
+	groups := sr.GetGroups()
+	unresolved := make(map[string][]memberReference)
+	cmp := sr.comparator()
+
+	for _, c := range sr.config.GroupMembership.constraints() {
+		if strings.ToLower(c.GroupAttribute) == "dn" {
+			continue // the reference is held by the user, not the group
+		}
+
+		userIsDN := strings.ToLower(c.UserAttribute) == "dn"
+		rule := cmp.ruleFor(c.GroupAttribute, c.UserAttribute)
+		userValues := make(map[string]bool)
+		for _, u := range users {
+			if userIsDN {
+				userValues[cmp.normalize(rule, u.DN)] = true
+				continue
+			}
+			_, values := u.GetAttribute(c.UserAttribute)
+			for _, v := range values {
+				userValues[cmp.normalize(rule, v)] = true
+			}
+		}
+
+		for _, g := range groups {
+			_, values := g.GetAttribute(c.GroupAttribute)
+			for _, v := range values {
+				if !userValues[cmp.normalize(rule, v)] {
+					unresolved[g.DN] = append(unresolved[g.DN], memberReference{
+						attribute: c.GroupAttribute,
+						value:     v,
+						isDN:      userIsDN,
+					})
+				}
+			}
+		}
+	}
+	return unresolved
+}
+
+// inScope determines whether the DN is at or below one of the configured BaseDNs
+func (conf LDAPSyncConfig) inScope(dn string) bool {
+	for _, base := range conf.BaseDNs {
+		if DNIsUnder(dn, baseDNOf(base)) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,164 @@
+package ldapsync
+
+import (
+	"strings"
+)
+
+// Vendor is the directory server implementation
+type Vendor string
+
+const (
+	UnknownVendor   Vendor = ""
+	ActiveDirectory Vendor = "activedirectory"
+	OpenLDAP        Vendor = "openldap"
+	FreeIPA         Vendor = "freeipa"
+)
+
+const (
+	adCapabilityOID     = "1.2.840.113556.1.4.800" // LDAP_CAP_ACTIVE_DIRECTORY_OID
+	freeIPAExtensionOID = "2.16.840.1.113730.3.8.10."
+)
+
+// Vendor infers the directory server implementation from the hints in the RootDSE
+func (dse RootDSE) Vendor() Vendor {
+	for _, c := range dse.SupportedCapabilities {
+		if c == adCapabilityOID {
+			return ActiveDirectory
+		}
+	}
+	if exists, _ := dse.Entry.GetAttribute("forestFunctionality"); exists {
+		return ActiveDirectory
+	}
+
+	for _, ext := range dse.SupportedExtensions {
+		if strings.HasPrefix(ext, freeIPAExtensionOID) {
+			return FreeIPA // IPA extended operations on a 389 Directory Server
+		}
+	}
+
+	_, classes := dse.Entry.GetAttribute("objectClass")
+	for _, c := range classes {
+		if strings.EqualFold(c, "OpenLDAProotDSE") {
+			return OpenLDAP
+		}
+	}
+	if exists, _ := dse.Entry.GetAttribute("configContext"); exists {
+		return OpenLDAP
+	}
+	return UnknownVendor
+}
+
+// DetectVendor connects to the configured server and infers its implementation from the RootDSE
+func DetectVendor(config LDAPSyncConfig) (Vendor, error) {
+	dse, err := ReadRootDSE(config)
+	if err != nil {
+		return UnknownVendor, err
+	}
+	return dse.Vendor(), nil
+}
+
+// VendorDefaults are the conventional user and group filters, membership strategy and ID attributes of a directory vendor
+type VendorDefaults struct {
+	UserFilter       LDAPFilter
+	GroupFilter      LDAPFilter
+	GroupMembership  GroupMembershipAssociator
+	UserIDAttribute  string
+	GroupIDAttribute string
+}
+
+// DefaultsFor returns the conventional configuration of the vendor's directory
+func DefaultsFor(vendor Vendor) (defaults VendorDefaults, known bool) {
+	switch vendor {
+	case ActiveDirectory:
+		return VendorDefaults{
+			UserFilter: LDAPFilter{
+				Operator: And,
+				Filters: []FilterExpression{
+					{Name: "objectClass", Value: "(?i)^user$"},
+					{Name: "objectCategory", Value: "(?i)^CN=Person,"}, // excludes computers, which are also of class user
+				},
+			},
+			GroupFilter: LDAPFilter{
+				Filters: []FilterExpression{{Name: "objectClass", Value: "(?i)^group$"}},
+			},
+			GroupMembership: GroupMembershipAssociator{
+				Constraints: []Constraint{{UserAttribute: "dn", GroupAttribute: "member"}},
+			},
+			UserIDAttribute:  "sAMAccountName",
+			GroupIDAttribute: "sAMAccountName",
+		}, true
+	case OpenLDAP:
+		return VendorDefaults{
+			UserFilter: LDAPFilter{
+				Operator: Or,
+				Filters: []FilterExpression{
+					{Name: "objectClass", Value: "(?i)^inetOrgPerson$"},
+					{Name: "objectClass", Value: "(?i)^posixAccount$"},
+				},
+			},
+			GroupFilter: LDAPFilter{
+				Operator: Or,
+				Filters: []FilterExpression{
+					{Name: "objectClass", Value: "(?i)^posixGroup$"},
+					{Name: "objectClass", Value: "(?i)^groupOfNames$"},
+					{Name: "objectClass", Value: "(?i)^groupOfUniqueNames$"},
+				},
+			},
+			GroupMembership: GroupMembershipAssociator{
+				Operator: Or,
+				Constraints: []Constraint{
+					{UserAttribute: "uid", GroupAttribute: "memberUid"},
+					{UserAttribute: "dn", GroupAttribute: "member"},
+					{UserAttribute: "dn", GroupAttribute: "uniqueMember"},
+				},
+			},
+			UserIDAttribute:  "uid",
+			GroupIDAttribute: "cn",
+		}, true
+	case FreeIPA:
+		return VendorDefaults{
+			UserFilter: LDAPFilter{
+				Filters: []FilterExpression{{Name: "objectClass", Value: "(?i)^posixAccount$"}},
+			},
+			GroupFilter: LDAPFilter{
+				Filters: []FilterExpression{{Name: "objectClass", Value: "(?i)^ipaUserGroup$"}}, // excludes host groups
+			},
+			GroupMembership: GroupMembershipAssociator{
+				Constraints: []Constraint{{UserAttribute: "dn", GroupAttribute: "member"}},
+			},
+			UserIDAttribute:  "uid",
+			GroupIDAttribute: "cn",
+		}, true
+	default:
+		return defaults, false
+	}
+}
+
+// WithVendorDefaults fills in the filters, membership strategy and ID attributes that have not been configured
+// with the conventional ones of the vendor's directory
+func (conf LDAPSyncConfig) WithVendorDefaults(vendor Vendor) LDAPSyncConfig {
+	defaults, known := DefaultsFor(vendor)
+	if !known {
+		return conf
+	}
+	if conf.UserFilter.isEmpty() {
+		conf.UserFilter = defaults.UserFilter
+	}
+	if conf.GroupFilter.isEmpty() {
+		conf.GroupFilter = defaults.GroupFilter
+	}
+	if len(conf.GroupMembership.constraints()) == 0 {
+		conf.GroupMembership = defaults.GroupMembership
+	}
+	if conf.UserIDAttribute == "" {
+		conf.UserIDAttribute = defaults.UserIDAttribute
+	}
+	if conf.GroupIDAttribute == "" {
+		conf.GroupIDAttribute = defaults.GroupIDAttribute
+	}
+	return conf
+}
+
+func (f LDAPFilter) isEmpty() bool {
+	return len(f.Filters) == 0 && len(f.FilterGroups) == 0
+}
@@ -0,0 +1,101 @@
+package ldapsync
+
+import (
+	"context"
+	"time"
+)
+
+// GroupChangeType is the kind of change of a group's membership
+type GroupChangeType string
+
+const (
+	MemberAdded   GroupChangeType = "added"
+	MemberRemoved GroupChangeType = "removed"
+)
+
+// GroupChange is a change of the membership of a watched group
+type GroupChange struct {
+	Type     GroupChangeType
+	GroupDN  string
+	MemberDN string
+	At       time.Time // when the change was observed
+}
+
+// WatchOptions configures WatchGroup
+type WatchOptions struct {
+	Interval time.Duration // between polls, a minute if zero
+	// called with the error of a poll, after which polling continues; the watch stops at the first error if nil
+	OnError func(error)
+}
+
+// WatchGroup polls the group's expanded membership (see SyncGroup) and emits the members added and removed since the
+// previous poll, the first poll establishing the baseline. The channel is closed once the context is done, or at the
+// first error of a poll if there is no OnError
+func WatchGroup(ctx context.Context, config LDAPSyncConfig, groupDN string, options WatchOptions) <-chan GroupChange {
+	return NewClient(config).WatchGroup(ctx, groupDN, options)
+}
+
+// WatchGroup polls the group for membership changes, see WatchGroup
+func (c *Client) WatchGroup(ctx context.Context, groupDN string, options WatchOptions) <-chan GroupChange {
+	interval := options.Interval
+	if interval <= 0 {
+		interval = time.Minute
+	}
+	changes := make(chan GroupChange)
+	go func() {
+		defer close(changes)
+		var members map[string]string // member DNs by normalised DN, nil until the baseline is established
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			group, err := c.SyncGroup(ctx, groupDN)
+			if err != nil {
+				if ctx.Err() != nil || options.OnError == nil {
+					return
+				}
+				options.OnError(err)
+			} else {
+				current := make(map[string]string, len(group.Members))
+				for _, dn := range group.Members {
+					current[normalizeDN(dn)] = dn
+				}
+				if members != nil && !emitGroupChanges(ctx, changes, group.DN, members, current) {
+					return
+				}
+				members = current
+			}
+
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return changes
+}
+
+// emitGroupChanges emits the members added and removed between the previous and the current membership,
+// returning false if the context is done first
+func emitGroupChanges(ctx context.Context, changes chan<- GroupChange, groupDN string, previous, current map[string]string) bool {
+	now := time.Now()
+	emit := func(change GroupChange) bool {
+		select {
+		case changes <- change:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+	for key, dn := range current {
+		if _, existed := previous[key]; !existed && !emit(GroupChange{Type: MemberAdded, GroupDN: groupDN, MemberDN: dn, At: now}) {
+			return false
+		}
+	}
+	for key, dn := range previous {
+		if _, exists := current[key]; !exists && !emit(GroupChange{Type: MemberRemoved, GroupDN: groupDN, MemberDN: dn, At: now}) {
+			return false
+		}
+	}
+	return true
+}